@@ -0,0 +1,96 @@
+package cookiesession
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// AuthRecord is one way the user has authenticated, such as "pwd", "mfa" or
+// "webauthn", and when they last did so that way.
+type AuthRecord struct {
+	Method string
+	At     time.Time
+}
+
+// RecordAuth records that the user authenticated with method at the given
+// time and marks the session dirty. Each method keeps its own time, so a
+// fresh password login doesn't make an old MFA look recent.
+func (s *Session) RecordAuth(method string, at time.Time) {
+	s.mustBeWritable()
+
+	found := false
+	for i := range s.Auth {
+		if s.Auth[i].Method == method {
+			if at.After(s.Auth[i].At) {
+				s.Auth[i].At = at
+			}
+			found = true
+			break
+		}
+	}
+	if !found {
+		s.Auth = append(s.Auth, AuthRecord{Method: method, At: at})
+	}
+
+	s.dirty = true
+}
+
+// HasRecentAuth reports whether the user last authenticated with method no
+// longer than within before now, for guarding actions that need a recent
+// strong authentication.
+func (s *Session) HasRecentAuth(method string, within time.Duration, now time.Time) bool {
+	for _, a := range s.Auth {
+		if a.Method == method {
+			return now.Sub(a.At) <= within
+		}
+	}
+
+	return false
+}
+
+// AuthTime returns the time of the most recent authentication by any method,
+// or the zero time if there's been none.
+func (s *Session) AuthTime() time.Time {
+	var t time.Time
+	for _, a := range s.Auth {
+		if a.At.After(t) {
+			t = a.At
+		}
+	}
+
+	return t
+}
+
+// marshalAuth encodes Auth as a length-prefixed method and a big-endian Unix
+// time for each record.
+func marshalAuth(auth []AuthRecord) []byte {
+	var buf []byte
+	for _, a := range auth {
+		var at [8]byte
+		binary.BigEndian.PutUint64(at[:], uint64(a.At.Unix()))
+
+		buf = append(buf, bindName(a.Method, nil)...)
+		buf = append(buf, at[:]...)
+	}
+
+	return buf
+}
+
+func unmarshalAuth(value []byte) ([]AuthRecord, error) {
+	var auth []AuthRecord
+
+	for len(value) > 0 {
+		n, l := binary.Uvarint(value)
+		if l <= 0 || n > uint64(len(value)-l) || len(value)-l-int(n) < 8 {
+			return nil, ErrMalformed
+		}
+
+		method := string(value[l : l+int(n)])
+		value = value[l+int(n):]
+
+		auth = append(auth, AuthRecord{Method: method, At: time.Unix(int64(binary.BigEndian.Uint64(value)), 0)})
+		value = value[8:]
+	}
+
+	return auth, nil
+}
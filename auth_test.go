@@ -0,0 +1,71 @@
+package cookiesession_test
+
+import (
+	"testing"
+	"time"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+func TestRecordAuth(t *testing.T) {
+	s, _ := newStore(t)
+
+	ss := cookiesession.NewSession()
+	ss.RecordAuth("pwd", epoch.Add(-time.Hour))
+	ss.RecordAuth("mfa", epoch)
+	ss.RecordAuth("pwd", epoch.Add(-2*time.Hour))
+
+	got, err := s.GetE(save(t, s, ss))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.Auth) != 2 || got.Auth[0].Method != "pwd" || got.Auth[1].Method != "mfa" {
+		t.Fatalf("expected each method recorded once, got %v", got.Auth)
+	}
+	if !got.Auth[0].At.Equal(epoch.Add(-time.Hour)) || !got.Auth[1].At.Equal(epoch) {
+		t.Errorf("expected each method's latest time, got %v", got.Auth)
+	}
+	if !got.AuthTime().Equal(epoch) {
+		t.Errorf("expected the most recent authentication time, got %s", got.AuthTime())
+	}
+}
+
+func TestHasRecentAuth(t *testing.T) {
+	ss := cookiesession.NewSession()
+	if ss.HasRecentAuth("pwd", time.Hour, epoch) {
+		t.Error("expected no recent authentication for a fresh session")
+	}
+
+	ss.RecordAuth("pwd", epoch)
+
+	if !ss.HasRecentAuth("pwd", 5*time.Minute, epoch.Add(5*time.Minute)) {
+		t.Error("expected an authentication within the window to be recent")
+	}
+	if ss.HasRecentAuth("pwd", 5*time.Minute, epoch.Add(6*time.Minute)) {
+		t.Error("expected an authentication outside the window not to be recent")
+	}
+	if ss.HasRecentAuth("webauthn", time.Hour, epoch) {
+		t.Error("expected a method that wasn't used not to count")
+	}
+}
+
+func TestHasRecentAuthPerMethod(t *testing.T) {
+	s, _ := newStore(t)
+
+	ss := cookiesession.NewSession()
+	ss.RecordAuth("mfa", epoch.Add(-24*time.Hour))
+	ss.RecordAuth("pwd", epoch.Add(-time.Minute))
+
+	got, err := s.GetE(save(t, s, ss))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.HasRecentAuth("mfa", 5*time.Minute, epoch) {
+		t.Error("expected a stale mfa not to be made recent by a fresh password login")
+	}
+	if !got.HasRecentAuth("pwd", 5*time.Minute, epoch) {
+		t.Error("expected the fresh password login to be recent")
+	}
+}
@@ -0,0 +1,68 @@
+package cookiesession
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/satori/go.uuid"
+)
+
+var (
+	ErrNotInBackend = errors.New("session isn't in the backend")
+)
+
+// Backend holds session state server-side, keyed by SID, for sessions whose
+// state is too big for a cookie or that must be revocable straight away.
+// Load should return an error for sessions it doesn't have, so that deleting
+// a session's state revokes it. ctx is the context of the request being
+// served, or the background context when there isn't one.
+type Backend interface {
+	Load(ctx context.Context, sid uuid.UUID) ([]byte, error)
+	Store(ctx context.Context, sid uuid.UUID, state []byte) error
+	Delete(ctx context.Context, sid uuid.UUID) error
+}
+
+// MemoryBackend is a Backend that keeps state in memory, for tests and
+// single-process servers. Its zero value is ready to use. Nothing is ever
+// evicted, so sessions that are abandoned rather than deleted stay until the
+// process exits.
+type MemoryBackend struct {
+	mu     sync.RWMutex
+	states map[uuid.UUID][]byte
+}
+
+func (b *MemoryBackend) Load(ctx context.Context, sid uuid.UUID) ([]byte, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	state, ok := b.states[sid]
+	if !ok {
+		return nil, ErrNotInBackend
+	}
+
+	return append([]byte(nil), state...), nil
+}
+
+func (b *MemoryBackend) Store(ctx context.Context, sid uuid.UUID, state []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.states == nil {
+		b.states = make(map[uuid.UUID][]byte)
+	}
+
+	b.states[sid] = append([]byte(nil), state...)
+
+	return nil
+}
+
+func (b *MemoryBackend) Delete(ctx context.Context, sid uuid.UUID) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	wipe(b.states[sid])
+	delete(b.states, sid)
+
+	return nil
+}
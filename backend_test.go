@@ -0,0 +1,96 @@
+package cookiesession_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/satori/go.uuid"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+func TestBackend(t *testing.T) {
+	s, _ := newStore(t)
+
+	var backend cookiesession.MemoryBackend
+	s.Backend = &backend
+
+	ss := cookiesession.NewSession().WithState([]byte("a large cart"))
+	r := save(t, s, ss)
+
+	if state, err := backend.Load(context.Background(), ss.SID); err != nil || string(state) != "a large cart" {
+		t.Fatalf("expected Save to store the state, got %q, %v", state, err)
+	}
+
+	plain, _ := newStore(t)
+	if got, err := plain.GetE(r); err != nil {
+		t.Fatal(err)
+	} else if len(got.State) != 0 {
+		t.Fatalf("expected the cookie not to carry the state, got %q", got.State)
+	}
+
+	got, err := s.GetE(r)
+	if err != nil {
+		t.Fatal(err)
+	} else if got.SID != ss.SID || string(got.State) != "a large cart" {
+		t.Fatalf("expected Get to load the state, got %+v", got)
+	}
+
+	got.SetBytes([]byte("a larger cart"))
+	r = save(t, s, &got)
+	if got, err := s.GetE(r); err != nil || string(got.State) != "a larger cart" {
+		t.Fatalf("expected the updated state, got %q, %v", got.State, err)
+	}
+
+	if err := backend.Delete(context.Background(), ss.SID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.GetE(r); !errors.Is(err, cookiesession.ErrNotInBackend) {
+		t.Fatalf("expected %v once the state is deleted, got %v", cookiesession.ErrNotInBackend, err)
+	}
+}
+
+type ctxKey struct{}
+
+// contextBackend records the ctxKey value of each context it's called with.
+type contextBackend struct {
+	cookiesession.MemoryBackend
+	seen []interface{}
+}
+
+func (b *contextBackend) Load(ctx context.Context, sid uuid.UUID) ([]byte, error) {
+	b.seen = append(b.seen, ctx.Value(ctxKey{}))
+	return b.MemoryBackend.Load(ctx, sid)
+}
+
+func (b *contextBackend) Store(ctx context.Context, sid uuid.UUID, state []byte) error {
+	b.seen = append(b.seen, ctx.Value(ctxKey{}))
+	return b.MemoryBackend.Store(ctx, sid, state)
+}
+
+func TestBackendContext(t *testing.T) {
+	s, _ := newStore(t)
+
+	backend := &contextBackend{}
+	s.Backend = backend
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "request")
+
+	ss := cookiesession.NewSession().WithState([]byte("state"))
+	rec := httptest.NewRecorder()
+	if err := s.SaveFor(rec, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx), ss); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.GetE(request(rec).WithContext(ctx)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(backend.seen) != 2 || backend.seen[0] != "request" || backend.seen[1] != "request" {
+		t.Fatalf("expected the request's context to reach Store and Load, got %v", backend.seen)
+	}
+}
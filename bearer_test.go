@@ -0,0 +1,144 @@
+package cookiesession_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+// token returns a token for a new session with s holding state.
+func token(t *testing.T, s *cookiesession.Store, state string) string {
+	t.Helper()
+
+	v, err := s.Token(cookiesession.NewSession().WithState([]byte(state)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return v
+}
+
+func TestToken(t *testing.T) {
+	s, clock := newStore(t)
+
+	v := token(t, s, "state")
+
+	got, err := s.GetFromToken(v)
+	if err != nil || string(got.State) != "state" || !got.Valid {
+		t.Fatalf("expected the token to decode, got %q, %v", got.State, err)
+	}
+
+	if got, err := s.GetFromToken(value(t, s, cookiesession.NewSession().WithState([]byte("cookie")))); err != nil || string(got.State) != "cookie" {
+		t.Fatalf("expected a cookie value to decode as a token, got %q, %v", got.State, err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: s.Name, Value: v})
+	if got := s.Get(r); string(got.State) != "state" {
+		t.Fatalf("expected a token to work as a cookie value, got %q", got.State)
+	}
+
+	if got, err := s.GetFromToken(tamper(t, v)); err == nil || got.Valid {
+		t.Fatal("expected a tampered token to be rejected")
+	}
+
+	if _, err := s.GetFromToken(""); err == nil {
+		t.Fatal("expected an empty token to be rejected")
+	}
+
+	clock.Advance(s.TTL + cookiesession.DefaultClockSkew + time.Second)
+	if _, err := s.GetFromToken(v); err != cookiesession.ErrExpired {
+		t.Fatalf("expected %v for an old token, got %v", cookiesession.ErrExpired, err)
+	}
+}
+
+func TestTokenNotChunked(t *testing.T) {
+	s, _ := newStore(t)
+	s.ChunkSize = 1000
+
+	state := bulky(t, 3000)
+
+	v, err := s.Token(cookiesession.NewSession().WithState(state))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(v) <= s.ChunkSize || strings.HasPrefix(v, "chunks:") {
+		t.Fatalf("expected the whole value in one token, got %d bytes", len(v))
+	}
+
+	if got, err := s.GetFromToken(v); err != nil || !bytes.Equal(got.State, state) {
+		t.Fatalf("expected the token to decode, got %v", err)
+	}
+}
+
+func TestBearerAuth(t *testing.T) {
+	s, _ := newStore(t)
+
+	v := token(t, s, "bearer")
+
+	get := func(auth string, cookie string) cookiesession.Session {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", auth)
+		if cookie != "" {
+			r.AddCookie(&http.Cookie{Name: s.Name, Value: cookie})
+		}
+
+		return s.Get(r)
+	}
+
+	if got := get("Bearer "+v, ""); got.Valid {
+		t.Fatal("expected the header to be ignored without BearerAuth")
+	}
+
+	s.BearerAuth = true
+
+	for _, auth := range []string{"Bearer " + v, "bearer " + v, "Bearer  " + v + " "} {
+		if got := get(auth, ""); string(got.State) != "bearer" {
+			t.Errorf("expected %q to carry the session, got %q", auth, got.State)
+		}
+	}
+
+	for _, auth := range []string{"", "Bearer", "Bearer ", "Basic " + v, v} {
+		if got := get(auth, ""); got.Valid {
+			t.Errorf("expected %q not to carry a session", auth)
+		}
+	}
+
+	cookie := value(t, s, cookiesession.NewSession().WithState([]byte("cookie")))
+	if got := get("Bearer "+v, cookie); string(got.State) != "cookie" {
+		t.Fatalf("expected the cookie to win over the header, got %q", got.State)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+tamper(t, v))
+	if _, err := s.GetE(r); err == nil {
+		t.Fatal("expected a tampered bearer token to be reported")
+	}
+}
+
+func TestGetFromTokenBindTLS(t *testing.T) {
+	s, _ := newStore(t)
+	s.BindTLS = true
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("state"))
+
+	rec := httptest.NewRecorder()
+	if err := s.SaveFor(rec, withCert("alice"), ss); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.GetFromToken(rec.Result().Cookies()[0].Value); err != cookiesession.ErrNoClientCert {
+		t.Fatalf("expected %v without a request, got %v", cookiesession.ErrNoClientCert, err)
+	}
+
+	if _, err := s.Token(cookiesession.NewSession().WithState([]byte("state"))); err != cookiesession.ErrNoClientCert {
+		t.Fatalf("expected %v making a token without a request, got %v", cookiesession.ErrNoClientCert, err)
+	}
+}
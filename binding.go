@@ -0,0 +1,109 @@
+package cookiesession
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"net"
+	"net/http"
+)
+
+var (
+	ErrNoBindingRequest = errors.New("binding a session needs the request it's saved for")
+	ErrNoClientAddr     = errors.New("request has no usable client address")
+	ErrBindingMismatch  = errors.New("session is bound to a different client")
+	ErrBindingPrefix    = errors.New("binding prefix is longer than the address")
+)
+
+// Binding picks the request attributes that Store.Binding ties sessions to.
+// Addresses and user agents change legitimately, with mobile networks and
+// browser updates, so binding trades some spurious logouts for making stolen
+// cookies harder to replay.
+type Binding struct {
+	// IPv4Prefix and IPv6Prefix, if positive, are how many leading bits of
+	// the client's address must stay the same, such as 24 or 64. They can't
+	// be longer than the address, 32 and 128 bits; sessions can't be bound
+	// or checked with ErrBindingPrefix if they are.
+	IPv4Prefix, IPv6Prefix int
+
+	// UserAgent binds sessions to the User-Agent header.
+	UserAgent bool
+
+	// ClientIP, if set, returns the client's address, for deployments
+	// behind a proxy. It defaults to the host part of RemoteAddr.
+	ClientIP func(r *http.Request) string
+}
+
+// hash returns a hash of r's attributes picked by b.
+func (b *Binding) hash(r *http.Request) ([]byte, error) {
+	if b.IPv4Prefix > 32 || b.IPv6Prefix > 128 {
+		return nil, ErrBindingPrefix
+	}
+
+	h := sha256.New()
+
+	if b.IPv4Prefix > 0 || b.IPv6Prefix > 0 {
+		addr := r.RemoteAddr
+		if b.ClientIP != nil {
+			addr = b.ClientIP(r)
+		} else if host, _, err := net.SplitHostPort(addr); err == nil {
+			addr = host
+		}
+
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return nil, ErrNoClientAddr
+		}
+
+		if ip4 := ip.To4(); ip4 != nil {
+			if b.IPv4Prefix > 0 {
+				h.Write([]byte("ip4\x00"))
+				h.Write(ip4.Mask(net.CIDRMask(b.IPv4Prefix, 32)))
+			}
+		} else if b.IPv6Prefix > 0 {
+			h.Write([]byte("ip6\x00"))
+			h.Write(ip.Mask(net.CIDRMask(b.IPv6Prefix, 128)))
+		}
+	}
+
+	if b.UserAgent {
+		h.Write([]byte("ua\x00"))
+		h.Write([]byte(r.UserAgent()))
+	}
+
+	return h.Sum(nil), nil
+}
+
+// bindClient records the hash of the request's attributes in ss. Without a
+// request, a session that's already bound keeps its binding.
+func (s *Store) bindClient(r *http.Request, ss *Session) error {
+	if r == nil {
+		if len(ss.binding) != 0 {
+			return nil
+		}
+
+		return ErrNoBindingRequest
+	}
+
+	h, err := s.Binding.hash(r)
+	if err != nil {
+		return err
+	}
+
+	ss.binding = h
+
+	return nil
+}
+
+func (s *Store) checkClient(r *http.Request, ss *Session) error {
+	h, err := s.Binding.hash(r)
+	if err != nil {
+		return err
+	}
+
+	if subtle.ConstantTimeCompare(h, ss.binding) != 1 {
+		return ErrBindingMismatch
+	}
+
+	return nil
+}
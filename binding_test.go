@@ -0,0 +1,101 @@
+package cookiesession_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+// from returns a request from addr with the given User-Agent.
+func from(addr, ua string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = addr
+	r.Header.Set("User-Agent", ua)
+
+	return r
+}
+
+func TestBinding(t *testing.T) {
+	s, _ := newStore(t)
+	s.Binding = &cookiesession.Binding{IPv4Prefix: 24, IPv6Prefix: 64, UserAgent: true}
+
+	for name, tc := range map[string]struct {
+		saved *http.Request
+		r     *http.Request
+		err   error
+	}{
+		"same client":      {saved: from("192.0.2.1:1234", "browser"), r: from("192.0.2.1:4321", "browser")},
+		"same ipv4 prefix": {saved: from("192.0.2.1:1234", "browser"), r: from("192.0.2.200:1234", "browser")},
+		"other ipv4":       {saved: from("192.0.2.1:1234", "browser"), r: from("198.51.100.1:1234", "browser"), err: cookiesession.ErrBindingMismatch},
+		"same ipv6 prefix": {saved: from("[2001:db8::1]:1234", "browser"), r: from("[2001:db8::ffff]:1234", "browser")},
+		"other ipv6":       {saved: from("[2001:db8::1]:1234", "browser"), r: from("[2001:db8:1::1]:1234", "browser"), err: cookiesession.ErrBindingMismatch},
+		"other agent":      {saved: from("192.0.2.1:1234", "browser"), r: from("192.0.2.1:1234", "curl"), err: cookiesession.ErrBindingMismatch},
+		"no address":       {saved: from("192.0.2.1:1234", "browser"), r: from("", "browser"), err: cookiesession.ErrNoClientAddr},
+	} {
+		ss := cookiesession.NewSession()
+		ss.SetBytes([]byte("state"))
+
+		rec := httptest.NewRecorder()
+		if err := s.SaveFor(rec, tc.saved, ss); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		c := rec.Result().Cookies()[0]
+		tc.r.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+
+		if _, err := s.GetE(tc.r); err != tc.err {
+			t.Errorf("%s: expected %v, got %v", name, tc.err, err)
+		}
+	}
+}
+
+func TestBindingClientIP(t *testing.T) {
+	s, _ := newStore(t)
+	s.Binding = &cookiesession.Binding{
+		IPv4Prefix: 32,
+		ClientIP:   func(r *http.Request) string { return r.Header.Get("X-Real-IP") },
+	}
+
+	saved := from("10.0.0.1:1234", "")
+	saved.Header.Set("X-Real-IP", "192.0.2.1")
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("state"))
+
+	rec := httptest.NewRecorder()
+	if err := s.SaveFor(rec, saved, ss); err != nil {
+		t.Fatal(err)
+	}
+
+	c := rec.Result().Cookies()[0]
+
+	r := from("10.0.0.2:1234", "")
+	r.Header.Set("X-Real-IP", "192.0.2.1")
+	r.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+	if _, err := s.GetE(r); err != nil {
+		t.Fatalf("expected the proxy's client address to be used, got %v", err)
+	}
+}
+
+func TestBindingPrefixTooLong(t *testing.T) {
+	for name, b := range map[string]*cookiesession.Binding{
+		"ipv4": {IPv4Prefix: 33},
+		"ipv6": {IPv6Prefix: 129},
+	} {
+		s, _ := newStore(t)
+		s.Binding = b
+
+		ss := cookiesession.NewSession()
+		ss.SetBytes([]byte("state"))
+
+		rec := httptest.NewRecorder()
+		if err := s.SaveFor(rec, from("192.0.2.1:1234", ""), ss); err != cookiesession.ErrBindingPrefix {
+			t.Errorf("%s: expected %v, got %v", name, cookiesession.ErrBindingPrefix, err)
+		}
+		if len(rec.Result().Cookies()) != 0 {
+			t.Errorf("%s: expected no cookie to be set", name)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+// Package chisession loads and saves cookiesession sessions for chi routers.
+package chisession
+
+import (
+	"net/http"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+// Middleware returns middleware for chi's Use that loads each request's
+// session and saves it just before the response headers are sent, as
+// Store.Middleware does.
+func Middleware(s *cookiesession.Store) func(http.Handler) http.Handler {
+	return s.Middleware
+}
+
+// Get returns the session that Middleware loaded for r, or nil if there
+// isn't one.
+func Get(r *http.Request) *cookiesession.Session {
+	return cookiesession.FromContext(r.Context())
+}
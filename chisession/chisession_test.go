@@ -0,0 +1,47 @@
+package chisession_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"fknsrs.biz/p/cookiesession/chisession"
+	"fknsrs.biz/p/cookiesession/cookiesessiontest"
+)
+
+func TestMiddleware(t *testing.T) {
+	s := cookiesessiontest.NewStore("sess", "chi")
+
+	router := chi.NewRouter()
+	router.Use(chisession.Middleware(s))
+	router.Get("/set", func(rw http.ResponseWriter, r *http.Request) {
+		chisession.Get(r).SetBytes([]byte("hello"))
+		rw.Write([]byte("ok"))
+	})
+	router.Get("/get", func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write(chisession.Get(r).State)
+	})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/set", nil))
+
+	if got := cookiesessiontest.ExtractSession(t, s, rec); string(got.State) != "hello" {
+		t.Fatalf("expected the saved state, got %q", got.State)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/get", nil)
+	for _, c := range rec.Result().Cookies() {
+		r.AddCookie(c)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, r)
+
+	if rec.Body.String() != "hello" {
+		t.Fatalf("expected the session to be loaded, got %q", rec.Body)
+	} else if len(rec.Result().Cookies()) != 0 {
+		t.Fatal("expected an unchanged session not to be saved again")
+	}
+}
@@ -0,0 +1,127 @@
+package cookiesession
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrChunkedTooLarge = errors.New("cookie value would be larger than MaxChunkedSize")
+	ErrMissingChunk    = errors.New("session cookie is missing one of its chunks")
+)
+
+// DefaultMaxChunkedSize is the default for Store.MaxChunkedSize.
+const DefaultMaxChunkedSize = 16 * 1024
+
+// chunkManifest prefixes the value of the main cookie of a session that's
+// been split into chunks, followed by the number of chunks. Neither base64
+// nor JWE values can contain a colon, so it can't be mistaken for a value.
+const chunkManifest = "chunks:"
+
+func (s *Store) chunkName(i int) string {
+	return s.Name + "." + strconv.Itoa(i)
+}
+
+func (s *Store) maxChunkedSize() int {
+	if s.MaxChunkedSize > 0 {
+		return s.MaxChunkedSize
+	}
+
+	return DefaultMaxChunkedSize
+}
+
+// maxChunks returns how many chunks a value can be split into at most.
+func (s *Store) maxChunks() int {
+	return (s.maxChunkedSize() + s.ChunkSize - 1) / s.ChunkSize
+}
+
+// chunk splits c into a manifest cookie and the chunks it names, if its value
+// is longer than ChunkSize. Otherwise it returns c alone.
+func (s *Store) chunk(c *http.Cookie) ([]*http.Cookie, error) {
+	if s.ChunkSize <= 0 || len(c.Value) <= s.ChunkSize {
+		return []*http.Cookie{c}, nil
+	}
+
+	if len(c.Value) > s.maxChunkedSize() {
+		return nil, ErrChunkedTooLarge
+	}
+
+	var chunks []*http.Cookie
+	for i, value := 0, c.Value; value != ""; i++ {
+		n := s.ChunkSize
+		if n > len(value) {
+			n = len(value)
+		}
+
+		chunk := *c
+		chunk.Name = s.chunkName(i)
+		chunk.Value = value[:n]
+		chunks = append(chunks, &chunk)
+
+		value = value[n:]
+	}
+
+	manifest := *c
+	manifest.Value = chunkManifest + strconv.Itoa(len(chunks))
+
+	return append([]*http.Cookie{&manifest}, chunks...), nil
+}
+
+// unchunk returns value, or if it's a manifest, the value reassembled from
+// the chunks on r that it names.
+func (s *Store) unchunk(r *http.Request, value string) (string, error) {
+	if !strings.HasPrefix(value, chunkManifest) {
+		return value, nil
+	}
+
+	if s.ChunkSize <= 0 {
+		return "", ErrMalformed
+	}
+
+	n, err := strconv.Atoi(strings.TrimPrefix(value, chunkManifest))
+	if err != nil || n <= 0 || n > s.maxChunks() {
+		return "", ErrMalformed
+	}
+
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		c, err := r.Cookie(s.chunkName(i))
+		if err != nil {
+			return "", ErrMissingChunk
+		}
+
+		if b.Len()+len(c.Value) > s.maxChunkedSize() {
+			return "", ErrChunkedTooLarge
+		}
+
+		b.WriteString(c.Value)
+	}
+
+	return b.String(), nil
+}
+
+// staleChunks returns cookies deleting the chunks on r beyond the first n,
+// left over from a session that's since shrunk. Without r, every chunk that
+// could exist is deleted.
+func (s *Store) staleChunks(r *http.Request, n int) []*http.Cookie {
+	if s.ChunkSize <= 0 {
+		return nil
+	}
+
+	var stale []*http.Cookie
+	for i := n; i < s.maxChunks(); i++ {
+		if r != nil {
+			if _, err := r.Cookie(s.chunkName(i)); err != nil {
+				continue
+			}
+		}
+
+		c := s.deletion(s.path())
+		c.Name = s.chunkName(i)
+		stale = append(stale, c)
+	}
+
+	return stale
+}
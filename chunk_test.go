@@ -0,0 +1,200 @@
+package cookiesession_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"fknsrs.biz/p/cookiesession"
+	"fknsrs.biz/p/cookiesession/cookiesessiontest"
+)
+
+// bulky returns n bytes of state that doesn't compress.
+func bulky(t *testing.T, n int) []byte {
+	t.Helper()
+
+	state := make([]byte, n)
+	if _, err := io.ReadFull(cookiesessiontest.NewReader(t.Name()), state); err != nil {
+		t.Fatal(err)
+	}
+
+	return state
+}
+
+// chunked saves a session with 3000 bytes of state with s and returns it
+// along with the cookies that were set.
+func chunked(t *testing.T, s *cookiesession.Store) (*cookiesession.Session, []*http.Cookie) {
+	t.Helper()
+
+	ss := cookiesession.NewSession().WithState(bulky(t, 3000))
+
+	rec := httptest.NewRecorder()
+	if err := s.Save(rec, ss); err != nil {
+		t.Fatal(err)
+	}
+
+	return ss, rec.Result().Cookies()
+}
+
+func TestChunkSize(t *testing.T) {
+	s, _ := newStore(t)
+	s.ChunkSize = 1000
+
+	ss, cookies := chunked(t, s)
+
+	if len(cookies) != 6 || cookies[0].Name != "session" || cookies[0].Value != "chunks:5" {
+		t.Fatalf("expected a manifest naming 5 chunks, got %d cookies starting with %s=%s", len(cookies), cookies[0].Name, cookies[0].Value)
+	}
+	for i, c := range cookies[1:] {
+		if want := "session." + strconv.Itoa(i); c.Name != want || len(c.Value) > s.ChunkSize {
+			t.Errorf("expected chunk %s of at most %d bytes, got %s of %d", want, s.ChunkSize, c.Name, len(c.Value))
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+
+	got, err := s.GetE(r)
+	if err != nil {
+		t.Fatal(err)
+	} else if got.SID != ss.SID || !bytes.Equal(got.State, ss.State) {
+		t.Fatal("expected the session back from its chunks")
+	}
+}
+
+func TestChunkSizeSmallValues(t *testing.T) {
+	s, _ := newStore(t)
+	s.ChunkSize = 1000
+
+	rec := httptest.NewRecorder()
+	if err := s.Save(rec, cookiesession.NewSession().WithState([]byte("state"))); err != nil {
+		t.Fatal(err)
+	}
+
+	if cookies := rec.Result().Cookies(); len(cookies) != 1 || strings.HasPrefix(cookies[0].Value, "chunks:") {
+		t.Fatalf("expected a value that fits to be set as it is, got %d cookies", len(cookies))
+	}
+}
+
+func TestChunksRejected(t *testing.T) {
+	s, _ := newStore(t)
+	s.ChunkSize = 1000
+
+	_, cookies := chunked(t, s)
+
+	for name, tc := range map[string]struct {
+		change func(cookies []*http.Cookie) []*http.Cookie
+		err    error
+	}{
+		"missing chunk": {
+			change: func(cookies []*http.Cookie) []*http.Cookie { return append(cookies[:2:2], cookies[3:]...) },
+			err:    cookiesession.ErrMissingChunk,
+		},
+		"swapped chunks": {
+			change: func(cookies []*http.Cookie) []*http.Cookie {
+				cookies[1].Value, cookies[2].Value = cookies[2].Value, cookies[1].Value
+				return cookies
+			},
+			err: cookiesession.ErrDecryptFailed,
+		},
+		"tampered chunk": {
+			change: func(cookies []*http.Cookie) []*http.Cookie {
+				cookies[3].Value = tamper(t, cookies[3].Value)
+				return cookies
+			},
+			err: cookiesession.ErrDecryptFailed,
+		},
+		"too many chunks": {
+			change: func(cookies []*http.Cookie) []*http.Cookie {
+				cookies[0].Value = "chunks:1000"
+				return cookies
+			},
+			err: cookiesession.ErrMalformed,
+		},
+		"bad count": {
+			change: func(cookies []*http.Cookie) []*http.Cookie {
+				cookies[0].Value = "chunks:-1"
+				return cookies
+			},
+			err: cookiesession.ErrMalformed,
+		},
+	} {
+		copied := make([]*http.Cookie, len(cookies))
+		for i, c := range cookies {
+			c := *c
+			copied[i] = &c
+		}
+
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		for _, c := range tc.change(copied) {
+			r.AddCookie(c)
+		}
+
+		if _, err := s.GetE(r); err != tc.err {
+			t.Errorf("%s: expected %v, got %v", name, tc.err, err)
+		}
+	}
+
+	// A store that doesn't chunk doesn't follow manifests.
+	plain, _ := newStore(t)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+	if _, err := plain.GetE(r); err != cookiesession.ErrMalformed {
+		t.Errorf("expected %v without ChunkSize, got %v", cookiesession.ErrMalformed, err)
+	}
+}
+
+func TestChunkedTooLarge(t *testing.T) {
+	s, _ := newStore(t)
+	s.ChunkSize = 1000
+	s.MaxChunkedSize = 2000
+
+	if err := s.Save(httptest.NewRecorder(), cookiesession.NewSession().WithState(bulky(t, 3000))); err != cookiesession.ErrChunkedTooLarge {
+		t.Fatalf("expected %v, got %v", cookiesession.ErrChunkedTooLarge, err)
+	}
+}
+
+func TestStaleChunks(t *testing.T) {
+	s, _ := newStore(t)
+	s.ChunkSize = 1000
+
+	big, cookies := chunked(t, s)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+
+	big.WithState([]byte("small"))
+
+	rec := httptest.NewRecorder()
+	if err := s.SaveFor(rec, r, big); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted := map[string]bool{}
+	for _, c := range rec.Result().Cookies() {
+		if c.MaxAge < 0 {
+			deleted[c.Name] = true
+		}
+	}
+	for i := 0; i < 5; i++ {
+		if name := "session." + strconv.Itoa(i); !deleted[name] {
+			t.Errorf("expected the stale chunk %s to be deleted", name)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	s.Clear(rec)
+	if n := len(rec.Result().Cookies()); n != 1+(cookiesession.DefaultMaxChunkedSize+999)/1000 {
+		t.Errorf("expected Clear to delete the cookie and every chunk it could have, got %d deletions", n)
+	}
+}
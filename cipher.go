@@ -0,0 +1,152 @@
+package cookiesession
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+var (
+	ErrUnknownCipher = errors.New("value is sealed with an unknown cipher")
+)
+
+// Cipher is the authenticated encryption that seals values, for
+// Store.Cipher. Every cipher takes a 32-byte key and a 24-byte nonce. The
+// built-in ciphers other than Secretbox each seal under their own key derived
+// from the store's, so no key is ever used with two ciphers. Values
+// sealed by any cipher but Secretbox start with its ID and a "~", so that
+// they can be opened with the right cipher while migrating from one to
+// another; IDs mustn't contain a "~".
+type Cipher interface {
+	ID() string
+	Overhead() int
+	Seal(dst, plaintext []byte, nonce *[24]byte, key *[32]byte) []byte
+	Open(dst, sealed []byte, nonce *[24]byte, key *[32]byte) ([]byte, bool)
+}
+
+var (
+	// Secretbox is NaCl's XSalsa20-Poly1305, and the default.
+	Secretbox Cipher = secretboxCipher{}
+
+	// AESGCM is AES-256-GCM with a standard 96-bit IV. Each value is sealed
+	// under a key derived from the first half of its nonce, with the second
+	// half as the IV, so that neither random nor counter nonces ever repeat
+	// an IV under the same key.
+	AESGCM Cipher = aesGCMCipher{}
+
+	// XChaCha20Poly1305 is XChaCha20-Poly1305.
+	XChaCha20Poly1305 Cipher = xchachaCipher{}
+)
+
+type secretboxCipher struct{}
+
+func (secretboxCipher) ID() string    { return "" }
+func (secretboxCipher) Overhead() int { return secretbox.Overhead }
+
+func (secretboxCipher) Seal(dst, plaintext []byte, nonce *[24]byte, key *[32]byte) []byte {
+	return secretbox.Seal(dst, plaintext, nonce, key)
+}
+
+func (secretboxCipher) Open(dst, sealed []byte, nonce *[24]byte, key *[32]byte) ([]byte, bool) {
+	return secretbox.Open(dst, sealed, nonce, key)
+}
+
+type aesGCMCipher struct{}
+
+func (aesGCMCipher) ID() string    { return "aesgcm" }
+func (aesGCMCipher) Overhead() int { return 16 }
+
+func (c aesGCMCipher) aead(key *[32]byte, nonce *[24]byte) cipher.AEAD {
+	subkey := cipherKey(key, c.ID(), nonce[:12])
+
+	aead, err := newGCM(subkey)
+	if err != nil {
+		panic(err)
+	}
+
+	return aead
+}
+
+func (c aesGCMCipher) Seal(dst, plaintext []byte, nonce *[24]byte, key *[32]byte) []byte {
+	return c.aead(key, nonce).Seal(dst, nonce[12:], plaintext, nil)
+}
+
+func (c aesGCMCipher) Open(dst, sealed []byte, nonce *[24]byte, key *[32]byte) ([]byte, bool) {
+	buf, err := c.aead(key, nonce).Open(dst, nonce[12:], sealed, nil)
+
+	return buf, err == nil
+}
+
+type xchachaCipher struct{}
+
+func (xchachaCipher) ID() string    { return "xchacha" }
+func (xchachaCipher) Overhead() int { return 16 }
+
+func (c xchachaCipher) aead(key *[32]byte) cipher.AEAD {
+	subkey := cipherKey(key, c.ID(), nil)
+
+	aead, err := chacha20poly1305.NewX(subkey[:])
+	if err != nil {
+		panic(err)
+	}
+
+	return aead
+}
+
+func (c xchachaCipher) Seal(dst, plaintext []byte, nonce *[24]byte, key *[32]byte) []byte {
+	return c.aead(key).Seal(dst, nonce[:], plaintext, nil)
+}
+
+func (c xchachaCipher) Open(dst, sealed []byte, nonce *[24]byte, key *[32]byte) ([]byte, bool) {
+	buf, err := c.aead(key).Open(dst, nonce[:], sealed, nil)
+
+	return buf, err == nil
+}
+
+// cipherKey derives the key that the cipher with the given id uses under key,
+// mixing in context, if there is any.
+func cipherKey(key *[32]byte, id string, context []byte) [32]byte {
+	mac := hmac.New(sha256.New, key[:])
+	mac.Write([]byte("cookiesession cipher " + id))
+	mac.Write(context)
+
+	var subkey [32]byte
+	copy(subkey[:], mac.Sum(nil))
+
+	return subkey
+}
+
+func (s *Store) cipher() Cipher {
+	if s.Cipher != nil {
+		return s.Cipher
+	}
+
+	return Secretbox
+}
+
+// splitCipher finds the cipher that sealed value from its prefix, and
+// returns it along with the rest of the value.
+func (s *Store) splitCipher(value string) (Cipher, string, error) {
+	i := strings.IndexByte(value, '~')
+	if i < 0 {
+		if c := s.cipher(); c.ID() == "" {
+			return c, value, nil
+		}
+
+		return Secretbox, value, nil
+	}
+
+	id, rest := value[:i], value[i+1:]
+	for _, c := range []Cipher{s.cipher(), AESGCM, XChaCha20Poly1305} {
+		if c.ID() == id {
+			return c, rest, nil
+		}
+	}
+
+	return nil, "", ErrUnknownCipher
+}
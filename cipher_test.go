@@ -0,0 +1,141 @@
+package cookiesession_test
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+var ciphers = map[string]cookiesession.Cipher{
+	"secretbox": cookiesession.Secretbox,
+	"aesgcm":    cookiesession.AESGCM,
+	"xchacha":   cookiesession.XChaCha20Poly1305,
+}
+
+func TestCipherSealOpen(t *testing.T) {
+	key := testKey
+	nonce := [24]byte{1, 2, 3}
+
+	for name, c := range ciphers {
+		sealed := c.Seal(nil, []byte("plaintext"), &nonce, &key)
+		if len(sealed) != len("plaintext")+c.Overhead() {
+			t.Errorf("%s: expected %d bytes of overhead, got %d", name, c.Overhead(), len(sealed)-len("plaintext"))
+		}
+
+		if out, ok := c.Open(nil, sealed, &nonce, &key); !ok || string(out) != "plaintext" {
+			t.Errorf("%s: expected the plaintext back, got %q, %v", name, out, ok)
+		}
+
+		tampered := append([]byte(nil), sealed...)
+		tampered[0] ^= 1
+		if _, ok := c.Open(nil, tampered, &nonce, &key); ok {
+			t.Errorf("%s: expected a tampered value not to open", name)
+		}
+
+		// Every byte of the nonce counts, including those AESGCM
+		// doesn't use as its IV.
+		for _, i := range []int{0, 11, 12, 23} {
+			other := nonce
+			other[i] ^= 1
+			if _, ok := c.Open(nil, sealed, &other, &key); ok {
+				t.Errorf("%s: expected a value not to open with byte %d of its nonce changed", name, i)
+			}
+		}
+
+		for other, o := range ciphers {
+			if other == name {
+				continue
+			}
+			if _, ok := o.Open(nil, sealed, &nonce, &key); ok {
+				t.Errorf("expected a value sealed by %s not to open with %s", name, other)
+			}
+		}
+	}
+}
+
+func TestCipherKeySeparation(t *testing.T) {
+	key := testKey
+	nonce := [24]byte{1, 2, 3}
+
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed := cookiesession.AESGCM.Seal(nil, []byte("plaintext"), &nonce, &key)
+	for _, iv := range [][]byte{nonce[:12], nonce[12:]} {
+		if _, err := gcm.Open(nil, iv, sealed, nil); err == nil {
+			t.Error("expected AESGCM not to seal under the store's key itself")
+		}
+	}
+
+	x, err := chacha20poly1305.NewX(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed = cookiesession.XChaCha20Poly1305.Seal(nil, []byte("plaintext"), &nonce, &key)
+	if _, err := x.Open(nil, nonce[:], sealed, nil); err == nil {
+		t.Error("expected XChaCha20Poly1305 not to seal under the store's key itself")
+	}
+}
+
+func TestStoreCipher(t *testing.T) {
+	for name, c := range ciphers {
+		for _, counter := range []bool{false, true} {
+			s, _ := newStore(t)
+			s.Cipher = c
+			s.CounterNonces = counter
+
+			ss := cookiesession.NewSession().WithState([]byte("state"))
+			v := value(t, s, ss)
+
+			if id := c.ID(); id != "" && !strings.HasPrefix(v, id+"~") {
+				t.Errorf("%s: expected the value to name its cipher, got %q", name, v)
+			}
+
+			if got, err := s.Decode(v); err != nil {
+				t.Errorf("%s: %s", name, err)
+			} else if got.SID != ss.SID || string(got.State) != "state" {
+				t.Errorf("%s: expected the session to round-trip, got %+v", name, got)
+			}
+		}
+	}
+}
+
+func TestStoreCipherMigration(t *testing.T) {
+	old, _ := newStore(t)
+	old.Cipher = cookiesession.AESGCM
+
+	ss := cookiesession.NewSession().WithState([]byte("state"))
+	v := value(t, old, ss)
+
+	s, _ := newStore(t)
+	s.Cipher = cookiesession.XChaCha20Poly1305
+	if got, err := s.Decode(v); err != nil || got.SID != ss.SID {
+		t.Errorf("expected a value sealed with another built-in cipher to open while migrating, got %v", err)
+	}
+
+	sealed := strings.TrimPrefix(v, "aesgcm~")
+	for name, relabelled := range map[string]string{
+		"xchacha":   "xchacha~" + sealed,
+		"secretbox": sealed,
+	} {
+		if _, err := s.Decode(relabelled); err != cookiesession.ErrDecryptFailed {
+			t.Errorf("expected an aesgcm value relabelled as %s to fail to decrypt, got %v", name, err)
+		}
+	}
+
+	if _, err := s.Decode("rot13~" + sealed); err != cookiesession.ErrUnknownCipher {
+		t.Errorf("expected %v for an unknown cipher, got %v", cookiesession.ErrUnknownCipher, err)
+	}
+}
@@ -0,0 +1,73 @@
+package cookiesession
+
+import (
+	"errors"
+)
+
+var (
+	ErrAudienceMismatch = errors.New("session audience doesn't match")
+	ErrInvalidClaim     = errors.New("session has an invalid reserved claim")
+)
+
+// Reserved claims are checked by Store.Get when present. ClaimExpiry holds a
+// Unix time after which the session is rejected, and ClaimAudience holds a
+// string that must match Store.Audience when that's set.
+const (
+	ClaimExpiry   = "exp"
+	ClaimAudience = "aud"
+)
+
+// SetClaim sets a claim on the session. Claims are managed by the library and
+// stored separately from State, which stays entirely up to the application.
+// They're encoded as JSON, so values should be JSON friendly.
+func (s *Session) SetClaim(key string, value interface{}) {
+	s.mustBeWritable()
+
+	if s.Claims == nil {
+		s.Claims = make(map[string]interface{})
+	}
+
+	s.Claims[key] = value
+	s.dirty = true
+}
+
+// GetClaim returns the value of a claim. Claims decoded from a cookie have
+// the types that encoding/json produces, so numbers are float64.
+func (s *Session) GetClaim(key string) (interface{}, bool) {
+	v, ok := s.Claims[key]
+	return v, ok
+}
+
+func (s *Store) checkClaims(ss *Session) error {
+	if v, ok := ss.Claims[ClaimExpiry]; ok {
+		var exp int64
+
+		switch v := v.(type) {
+		case float64:
+			exp = int64(v)
+		case int:
+			exp = int64(v)
+		case int64:
+			exp = v
+		default:
+			return ErrInvalidClaim
+		}
+
+		if s.now().Add(-s.clockSkew()).Unix() > exp {
+			return ErrExpired
+		}
+	}
+
+	if v, ok := ss.Claims[ClaimAudience]; ok && s.Audience != "" {
+		aud, ok := v.(string)
+		if !ok {
+			return ErrInvalidClaim
+		}
+
+		if aud != s.Audience {
+			return ErrAudienceMismatch
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package cookiesession_test
+
+import (
+	"testing"
+	"time"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+func TestClaims(t *testing.T) {
+	s, _ := newStore(t)
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("state"))
+	ss.SetClaim("roles", []string{"admin", "billing"})
+	ss.SetClaim("tenant", "acme")
+
+	got, err := s.GetE(save(t, s, ss))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, ok := got.GetClaim("tenant"); !ok || v != "acme" {
+		t.Errorf("expected the tenant claim, got %v", v)
+	}
+	if v, ok := got.GetClaim("roles"); !ok {
+		t.Error("expected the roles claim")
+	} else if roles, ok := v.([]interface{}); !ok || len(roles) != 2 || roles[0] != "admin" || roles[1] != "billing" {
+		t.Errorf("expected the roles to round-trip, got %#v", v)
+	}
+	if _, ok := got.GetClaim("missing"); ok {
+		t.Error("expected no claim for a missing key")
+	}
+
+	if string(got.Bytes()) != "state" {
+		t.Errorf("expected claims to leave State alone, got %q", got.Bytes())
+	}
+}
+
+func TestClaimExpiry(t *testing.T) {
+	s, clock := newStore(t)
+
+	ss := cookiesession.NewSession()
+	ss.SetClaim(cookiesession.ClaimExpiry, epoch.Add(10*time.Minute).Unix())
+
+	r := save(t, s, ss)
+
+	if _, err := s.GetE(r); err != nil {
+		t.Fatalf("expected the session before its exp claim, got %v", err)
+	}
+
+	clock.Advance(20 * time.Minute)
+
+	if _, err := s.GetE(r); err != cookiesession.ErrExpired {
+		t.Fatalf("expected %v after the exp claim, got %v", cookiesession.ErrExpired, err)
+	}
+}
+
+func TestClaimAudience(t *testing.T) {
+	s, _ := newStore(t)
+	s.Audience = "api"
+
+	ss := cookiesession.NewSession()
+	ss.SetClaim(cookiesession.ClaimAudience, "api")
+	if _, err := s.GetE(save(t, s, ss)); err != nil {
+		t.Errorf("expected a matching audience to be accepted, got %v", err)
+	}
+
+	ss = cookiesession.NewSession()
+	ss.SetClaim(cookiesession.ClaimAudience, "admin")
+	if _, err := s.GetE(save(t, s, ss)); err != cookiesession.ErrAudienceMismatch {
+		t.Errorf("expected %v, got %v", cookiesession.ErrAudienceMismatch, err)
+	}
+
+	ss = cookiesession.NewSession()
+	ss.SetClaim(cookiesession.ClaimAudience, 42)
+	if _, err := s.GetE(save(t, s, ss)); err != cookiesession.ErrInvalidClaim {
+		t.Errorf("expected %v for a non-string audience, got %v", cookiesession.ErrInvalidClaim, err)
+	}
+}
@@ -0,0 +1,51 @@
+package cookiesession
+
+import (
+	"errors"
+)
+
+var (
+	ErrStoreClosed = errors.New("store is closed")
+)
+
+// Close zeroes all of the store's key material, including its old, ring,
+// signing, metadata and handoff keys, and forgets its nonce state.
+// The store can't be used afterwards; loading and saving sessions return
+// ErrStoreClosed. Secret is a string and can't be wiped, so clear any other
+// copies of it separately.
+func (s *Store) Close() {
+	mu := s.lock()
+	mu.Lock()
+	wipe(s.Key[:])
+	for i := range s.OldKeys {
+		wipe(s.OldKeys[i][:])
+	}
+	wipe(s.SigningKey)
+	wipe(s.MetadataKey)
+	wipe(s.HandoffKey[:])
+	for id := range s.KeyRing {
+		s.KeyRing[id] = [32]byte{}
+	}
+
+	s.OldKeys = nil
+	s.SigningKey = nil
+	s.MetadataKey = nil
+	s.Secret = ""
+	s.closed = true
+	mu.Unlock()
+
+	noncesMu.Lock()
+	s.nonces = nil
+	s.counter = nil
+	noncesMu.Unlock()
+
+	if s.DecodeCache != nil {
+		s.DecodeCache.Purge()
+	}
+}
+
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
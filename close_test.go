@@ -0,0 +1,83 @@
+package cookiesession_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+func TestClose(t *testing.T) {
+	s, _ := newStore(t)
+	s.OldKeys = [][32]byte{{1}}
+	signing := []byte("signing key")
+	s.SigningKey = signing
+
+	r := save(t, s, cookiesession.NewSession().WithState([]byte("state")))
+
+	old := &s.OldKeys[0]
+
+	s.Close()
+
+	if s.Key != ([32]byte{}) {
+		t.Errorf("expected the key to be zeroed, got %x", s.Key)
+	}
+	if *old != ([32]byte{}) || s.OldKeys != nil {
+		t.Errorf("expected the old keys to be zeroed and dropped, got %x", *old)
+	}
+	for _, c := range signing {
+		if c != 0 {
+			t.Fatalf("expected the signing key to be zeroed, got %q", signing)
+		}
+	}
+
+	if _, err := s.GetE(r); err != cookiesession.ErrStoreClosed {
+		t.Errorf("expected %v from Get, got %v", cookiesession.ErrStoreClosed, err)
+	}
+	if err := s.Save(httptest.NewRecorder(), cookiesession.NewSession().WithState([]byte("state"))); err != cookiesession.ErrStoreClosed {
+		t.Errorf("expected %v from Save, got %v", cookiesession.ErrStoreClosed, err)
+	}
+}
+
+func TestCloseWipesEverySecret(t *testing.T) {
+	s, _ := newStore(t)
+	s.AddRotatedSecret("rotated secret")
+	s.KeyRing = map[string][32]byte{"a": {1}, "b": {2}}
+	s.ActiveKeyID = "a"
+	s.SigningKey = []byte("signing key")
+	s.MetadataKey = []byte("metadata key")
+	s.HandoffKey = [32]byte{3}
+
+	rotated := &s.OldKeys[0]
+	signing, metadata := s.SigningKey, s.MetadataKey
+
+	s.Close()
+
+	for name, key := range map[string][32]byte{
+		"Key":         s.Key,
+		"rotated key": *rotated,
+		"KeyRing[a]":  s.KeyRing["a"],
+		"KeyRing[b]":  s.KeyRing["b"],
+		"HandoffKey":  s.HandoffKey,
+	} {
+		if key != ([32]byte{}) {
+			t.Errorf("expected %s to be zeroed, got %x", name, key)
+		}
+	}
+
+	for name, key := range map[string][]byte{
+		"SigningKey":  signing,
+		"MetadataKey": metadata,
+	} {
+		for _, c := range key {
+			if c != 0 {
+				t.Errorf("expected %s to be zeroed, got %q", name, key)
+				break
+			}
+		}
+	}
+
+	if s.OldKeys != nil || s.SigningKey != nil || s.MetadataKey != nil || s.Secret != "" {
+		t.Error("expected Close to drop the store's references to its secrets")
+	}
+}
@@ -0,0 +1,129 @@
+package cookiesession
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+)
+
+// Codec serializes the structured values kept by Session.SetEncodedValue.
+// JSONCodec and GobCodec are built in; anything else, such as msgpack, can be
+// plugged in by implementing it.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type GobCodec struct{}
+
+func (GobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (GobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// SetEncodedValue stores v under key in State, encoded with the store's
+// Codec, and marks the session dirty. State holds a map of every key's
+// encoded value, which isn't the format used by Values and Store.SetValues,
+// so the two shouldn't be mixed in one session. Keys outside the store's
+// AllowedValueKeys are rejected with ErrDisallowedKey.
+func (s *Session) SetEncodedValue(key string, v interface{}) error {
+	if s.readOnly {
+		return ErrReadOnly
+	}
+
+	if s.store != nil && !s.store.allowedValueKey(key) {
+		return ErrDisallowedKey
+	}
+
+	values, err := s.codecValues()
+	if err != nil {
+		return err
+	}
+
+	codec := s.codec()
+
+	b, err := codec.Marshal(v)
+	if err != nil {
+		return errors.New("couldn't encode value: " + err.Error())
+	}
+	values[key] = b
+
+	state, err := codec.Marshal(values)
+	if err != nil {
+		return errors.New("couldn't encode state: " + err.Error())
+	}
+
+	s.State = state
+	s.dirty = true
+
+	return nil
+}
+
+// GetEncodedValue decodes the value stored under key by SetEncodedValue into
+// v, reporting whether there was one.
+func (s *Session) GetEncodedValue(key string, v interface{}) (bool, error) {
+	values, err := s.codecValues()
+	if err != nil {
+		return false, err
+	}
+
+	b, ok := values[key]
+	if !ok {
+		return false, nil
+	}
+
+	if err := s.codec().Unmarshal(b, v); err != nil {
+		return false, &StatePayloadError{Len: len(b), Err: err}
+	}
+
+	return true, nil
+}
+
+func (s *Session) codecValues() (map[string][]byte, error) {
+	values := make(map[string][]byte)
+	if len(s.State) == 0 {
+		return values, nil
+	}
+
+	if err := s.codec().Unmarshal(s.State, &values); err != nil {
+		return nil, &StatePayloadError{Len: len(s.State), Err: err}
+	}
+
+	return values, nil
+}
+
+// codec returns the Codec of the store the session came from, or JSONCodec.
+func (s *Session) codec() Codec {
+	if s.store != nil {
+		return s.store.codec()
+	}
+
+	return JSONCodec{}
+}
+
+func (s *Store) codec() Codec {
+	if s.Codec != nil {
+		return s.Codec
+	}
+
+	return JSONCodec{}
+}
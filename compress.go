@@ -0,0 +1,113 @@
+package cookiesession
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+)
+
+var (
+	ErrUnknownCompression = errors.New("value is compressed with an unknown compressor")
+)
+
+// formatCompressed marks a plaintext holding a compressed session. It's
+// followed by the compressor's ID and the compressed encoding.
+const formatCompressed = 3
+
+// maxDecompressedSize caps how far a compressed session can expand, so that
+// a small value can't be made to decompress into something enormous.
+const maxDecompressedSize = 1 << 20
+
+// Compressor compresses sessions before they're sealed, for Store.Compression.
+// Each compressor needs its own ID, which is stored in the value so that it
+// can be decompressed with the right one; IDs below 16 are reserved for this
+// package and its subpackages, such as zstdcompress, which uses 2. Other
+// algorithms can be used by implementing it.
+type Compressor interface {
+	ID() byte
+	Compress(b []byte) ([]byte, error)
+	NewReader(r io.Reader) (io.Reader, error)
+}
+
+// GzipCompression compresses sessions with gzip.
+var GzipCompression Compressor = gzipCompressor{}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) ID() byte { return 1 }
+
+func (gzipCompressor) Compress(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (gzipCompressor) NewReader(r io.Reader) (io.Reader, error) {
+	return gzip.NewReader(r)
+}
+
+// compress compresses buf with the store's Compression, or returns nil if
+// that wouldn't make it any smaller.
+func (s *Store) compress(buf []byte) ([]byte, error) {
+	if s.Compression == nil || s.PadTo > 0 {
+		return nil, nil
+	}
+
+	b, err := s.Compression.Compress(buf)
+	if err != nil {
+		return nil, errors.New("couldn't compress session: " + err.Error())
+	}
+
+	if len(b)+2 >= len(buf) {
+		return nil, nil
+	}
+
+	return append([]byte{formatCompressed, s.Compression.ID()}, b...), nil
+}
+
+// decompress reverses compress. Gzip can always be decompressed, so that
+// Compression can be turned off without losing sessions.
+func (s *Store) decompress(buf []byte) ([]byte, error) {
+	if len(buf) == 0 || buf[0] != formatCompressed {
+		return buf, nil
+	}
+
+	if len(buf) < 2 {
+		return nil, ErrMalformed
+	}
+
+	var c Compressor
+	switch {
+	case s.Compression != nil && s.Compression.ID() == buf[1]:
+		c = s.Compression
+	case buf[1] == GzipCompression.ID():
+		c = GzipCompression
+	default:
+		return nil, ErrUnknownCompression
+	}
+
+	r, err := c.NewReader(bytes.NewReader(buf[2:]))
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	b, err := io.ReadAll(io.LimitReader(r, maxDecompressedSize+1))
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	if len(b) > maxDecompressedSize {
+		return nil, ErrMalformed
+	}
+
+	return b, nil
+}
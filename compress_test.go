@@ -0,0 +1,137 @@
+package cookiesession_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+// compressible is State that's worth compressing.
+var compressible = []byte(strings.Repeat(`{"item":"widget","qty":1},`, 40))
+
+// deflate is a Compressor of its own, using raw DEFLATE.
+type deflate struct{}
+
+func (deflate) ID() byte { return 16 }
+
+func (deflate) Compress(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (deflate) NewReader(r io.Reader) (io.Reader, error) {
+	return flate.NewReader(r), nil
+}
+
+func TestCompression(t *testing.T) {
+	s, _ := newStore(t)
+	plain := value(t, s, cookiesession.NewSession().WithState(compressible))
+
+	s.Compression = cookiesession.GzipCompression
+	v := value(t, s, cookiesession.NewSession().WithState(compressible))
+
+	if len(v) >= len(plain) {
+		t.Fatalf("expected gzip to shrink the value, got %d bytes against %d", len(v), len(plain))
+	}
+
+	if got, err := s.Decode(v); err != nil || !bytes.Equal(got.State, compressible) {
+		t.Fatalf("expected the compressed value to decode, got %v", err)
+	}
+	if got, err := s.Decode(plain); err != nil || !bytes.Equal(got.State, compressible) {
+		t.Fatalf("expected an uncompressed value to still decode, got %v", err)
+	}
+
+	s.Compression = nil
+	if got, err := s.Decode(v); err != nil || !bytes.Equal(got.State, compressible) {
+		t.Fatalf("expected gzip values to decode with Compression unset, got %v", err)
+	}
+}
+
+func TestCompressionOnlyWhenSmaller(t *testing.T) {
+	s, _ := newStore(t)
+	state := bulky(t, 200)
+
+	plain := value(t, s, cookiesession.NewSession().WithState(state))
+
+	s.Compression = cookiesession.GzipCompression
+	v := value(t, s, cookiesession.NewSession().WithState(state))
+
+	if len(v) != len(plain) {
+		t.Fatalf("expected state that doesn't compress to be left alone, got %d bytes against %d", len(v), len(plain))
+	}
+
+	s.Compression = nil
+	if _, err := s.Decode(v); err != nil {
+		t.Fatalf("expected the value to be uncompressed, got %v", err)
+	}
+}
+
+func TestCompressionIgnoredWithPadTo(t *testing.T) {
+	s, _ := newStore(t)
+	s.PadTo = 64
+	plain := value(t, s, cookiesession.NewSession().WithState(compressible))
+
+	s.Compression = cookiesession.GzipCompression
+	if v := value(t, s, cookiesession.NewSession().WithState(compressible)); len(v) != len(plain) {
+		t.Fatalf("expected PadTo to turn compression off, got %d bytes against %d", len(v), len(plain))
+	}
+}
+
+func TestCustomCompressor(t *testing.T) {
+	s, _ := newStore(t)
+	s.Compression = deflate{}
+
+	v := value(t, s, cookiesession.NewSession().WithState(compressible))
+	if got, err := s.Decode(v); err != nil || !bytes.Equal(got.State, compressible) {
+		t.Fatalf("expected the custom compressor to be used both ways, got %v", err)
+	}
+
+	s.Compression = cookiesession.GzipCompression
+	if _, err := s.Decode(v); err != cookiesession.ErrUnknownCompression {
+		t.Fatalf("expected %v without the compressor, got %v", cookiesession.ErrUnknownCompression, err)
+	}
+}
+
+func TestDecompressionLimit(t *testing.T) {
+	s, _ := newStore(t)
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(make([]byte, 2<<20))
+	w.Close()
+
+	v, err := s.SealPlaintext(append([]byte{3, 1}, buf.Bytes()...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Decode(v); err != cookiesession.ErrMalformed {
+		t.Fatalf("expected %v for a value that decompresses too far, got %v", cookiesession.ErrMalformed, err)
+	}
+
+	v, err = s.SealPlaintext([]byte{3, 1, 'n', 'o', 't', ' ', 'g', 'z'})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Decode(v); err != cookiesession.ErrMalformed {
+		t.Fatalf("expected %v for a value that isn't gzip, got %v", cookiesession.ErrMalformed, err)
+	}
+}
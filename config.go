@@ -0,0 +1,195 @@
+package cookiesession
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// lock returns the lock guarding the parts of the store's configuration that
+// the setters below change, so that they can be changed while requests are in
+// flight. Changing the fields directly isn't safe once a Store is in use. The
+// lock is shared by copies made with WithName, Clone and Scope, and is only
+// held while those fields are copied, never while callbacks such as TTLFunc
+// run, so callbacks are free to use the setters.
+func (s *Store) lock() *sync.RWMutex {
+	if mu, ok := s.mu.Load().(*sync.RWMutex); ok {
+		return mu
+	}
+
+	s.mu.CompareAndSwap(nil, new(sync.RWMutex))
+
+	return s.mu.Load().(*sync.RWMutex)
+}
+
+// settings is a copy of the cookie attributes that the setters change.
+type settings struct {
+	ttl              time.Duration
+	secure, httpOnly bool
+	path, domain     string
+	sameSite         http.SameSite
+	partitioned      bool
+}
+
+func (s *Store) settings() settings {
+	mu := s.lock()
+	mu.RLock()
+	defer mu.RUnlock()
+
+	path := "/"
+	if s.OmitPath {
+		path = ""
+	} else if s.Path != "" {
+		path = s.Path
+	}
+
+	return settings{
+		ttl:         s.TTL,
+		secure:      s.Secure,
+		httpOnly:    s.HttpOnly,
+		path:        path,
+		domain:      s.Domain,
+		sameSite:    s.SameSite,
+		partitioned: s.Partitioned,
+	}
+}
+
+// keyAt returns a copy of Key if i is zero, or of OldKeys[i-1] otherwise, and
+// false once i is past the last of them.
+func (s *Store) keyAt(i int) ([32]byte, bool) {
+	mu := s.lock()
+	mu.RLock()
+	defer mu.RUnlock()
+
+	switch {
+	case i == 0:
+		return s.Key, true
+	case i <= len(s.OldKeys):
+		return s.OldKeys[i-1], true
+	}
+
+	return [32]byte{}, false
+}
+
+// keys returns a copy of Key followed by OldKeys.
+func (s *Store) keys() [][32]byte {
+	mu := s.lock()
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return append([][32]byte{s.Key}, s.OldKeys...)
+}
+
+// signingKey returns a copy of SigningKey, or nil if there isn't one.
+func (s *Store) signingKey() []byte {
+	mu := s.lock()
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if len(s.SigningKey) == 0 {
+		return nil
+	}
+
+	return append([]byte(nil), s.SigningKey...)
+}
+
+func (s *Store) isClosed() bool {
+	mu := s.lock()
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return s.closed
+}
+
+// SetKeys replaces the store's key and old keys. The store keeps its own
+// copy of oldKeys.
+func (s *Store) SetKeys(key [32]byte, oldKeys [][32]byte) {
+	oldKeys = append([][32]byte(nil), oldKeys...)
+
+	mu := s.lock()
+	mu.Lock()
+	s.Key = key
+	s.OldKeys = oldKeys
+	mu.Unlock()
+
+	if s.DecodeCache != nil {
+		s.DecodeCache.Purge()
+	}
+}
+
+// SetSigningKey replaces the store's signing key. The store keeps its own
+// copy of key.
+func (s *Store) SetSigningKey(key []byte) {
+	if key != nil {
+		key = append([]byte(nil), key...)
+	}
+
+	mu := s.lock()
+	mu.Lock()
+	defer mu.Unlock()
+
+	s.SigningKey = key
+}
+
+// SetSecure sets whether cookies get the Secure attribute.
+func (s *Store) SetSecure(secure bool) {
+	mu := s.lock()
+	mu.Lock()
+	defer mu.Unlock()
+
+	s.Secure = secure
+}
+
+// SetHttpOnly sets whether cookies get the HttpOnly attribute.
+func (s *Store) SetHttpOnly(httpOnly bool) {
+	mu := s.lock()
+	mu.Lock()
+	defer mu.Unlock()
+
+	s.HttpOnly = httpOnly
+}
+
+// SetTTL changes how long sessions last.
+func (s *Store) SetTTL(ttl time.Duration) {
+	mu := s.lock()
+	mu.Lock()
+	defer mu.Unlock()
+
+	s.TTL = ttl
+}
+
+// SetPath sets the path cookies are set for.
+func (s *Store) SetPath(path string) {
+	mu := s.lock()
+	mu.Lock()
+	defer mu.Unlock()
+
+	s.Path = path
+}
+
+// SetDomain sets the domain cookies are set for.
+func (s *Store) SetDomain(domain string) {
+	mu := s.lock()
+	mu.Lock()
+	defer mu.Unlock()
+
+	s.Domain = domain
+}
+
+// SetSameSite sets the cookies' SameSite attribute.
+func (s *Store) SetSameSite(mode http.SameSite) {
+	mu := s.lock()
+	mu.Lock()
+	defer mu.Unlock()
+
+	s.SameSite = mode
+}
+
+// SetPartitioned sets whether cookies get the Partitioned attribute.
+func (s *Store) SetPartitioned(partitioned bool) {
+	mu := s.lock()
+	mu.Lock()
+	defer mu.Unlock()
+
+	s.Partitioned = partitioned
+}
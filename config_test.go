@@ -0,0 +1,219 @@
+package cookiesession_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+// TestSetters is meant to be run with -race, mutating the store's
+// configuration while sessions are read and written.
+func TestSetters(t *testing.T) {
+	s, _ := newStore(t)
+	s.TTLFunc = func(ss *cookiesession.Session) time.Duration {
+		s.SetSecure(len(ss.State)%2 == 0)
+		return time.Hour
+	}
+
+	r := save(t, s, cookiesession.NewSession().WithState([]byte("state")))
+	key := s.Key
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 50; j++ {
+				s.Get(r)
+				if err := s.Save(httptest.NewRecorder(), cookiesession.NewSession().WithState([]byte("state"))); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for j := 0; j < 50; j++ {
+			s.SetKeys([32]byte{byte(j)}, [][32]byte{key})
+			s.SetSigningKey([]byte{byte(j)})
+			s.SetSecure(j%2 == 0)
+			s.SetHttpOnly(j%2 == 1)
+			s.SetTTL(time.Duration(j+1) * time.Hour)
+			s.SetPath("/" + strings.Repeat("a", j%3))
+			s.SetDomain(strings.Repeat("a", j%3))
+			s.SetSameSite(http.SameSite(j % 4))
+			s.SetPartitioned(j%2 == 0)
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for j := 0; j < 50; j++ {
+			s.Clone("clone").Get(r)
+			s.WithName("other").Get(r)
+			s.Scope("scope", time.Hour).Get(r)
+		}
+	}()
+
+	wg.Wait()
+
+	if s.Key != [32]byte{49} || s.TTL != 50*time.Hour {
+		t.Errorf("expected the last settings to stick, got key %x and TTL %s", s.Key, s.TTL)
+	}
+}
+
+// TestCloneCopiesEveryField sets every exported field of a store and checks
+// that Clone and WithName carry all of them over, so that a new field can't
+// be forgotten.
+func TestCloneCopiesEveryField(t *testing.T) {
+	interfaces := map[reflect.Type]interface{}{
+		reflect.TypeOf((*cookiesession.IDGenerator)(nil)).Elem(): cookiesession.UUIDv7,
+		reflect.TypeOf((*cookiesession.Cipher)(nil)).Elem():      cookiesession.AESGCM,
+		reflect.TypeOf((*cookiesession.Compressor)(nil)).Elem():  cookiesession.GzipCompression,
+		reflect.TypeOf((*cookiesession.Codec)(nil)).Elem():       cookiesession.GobCodec{},
+		reflect.TypeOf((*cookiesession.Revoker)(nil)).Elem():     cookiesession.NewDenylist(time.Hour),
+		reflect.TypeOf((*cookiesession.Backend)(nil)).Elem():     &cookiesession.MemoryBackend{},
+		reflect.TypeOf((*cookiesession.StateCodec)(nil)).Elem():  identityCodec{},
+		reflect.TypeOf((*io.Reader)(nil)).Elem():                 strings.NewReader(""),
+	}
+
+	s := &cookiesession.Store{}
+	v := reflect.ValueOf(s).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f, field := v.Field(i), v.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		switch f.Kind() {
+		case reflect.String:
+			f.SetString(field.Name)
+		case reflect.Bool:
+			f.SetBool(true)
+		case reflect.Int, reflect.Int64:
+			f.SetInt(int64(i + 1))
+		case reflect.Uint:
+			f.SetUint(uint64(i + 1))
+		case reflect.Array:
+			f.Index(0).SetUint(uint64(i + 1))
+		case reflect.Slice:
+			f.Set(reflect.MakeSlice(f.Type(), 1, 1))
+		case reflect.Map:
+			f.Set(reflect.MakeMap(f.Type()))
+		case reflect.Func:
+			f.Set(reflect.MakeFunc(f.Type(), func([]reflect.Value) []reflect.Value { return nil }))
+		case reflect.Ptr:
+			f.Set(reflect.New(f.Type().Elem()))
+		case reflect.Interface:
+			iv, ok := interfaces[f.Type()]
+			if !ok {
+				t.Fatalf("no test value for %s of type %s", field.Name, f.Type())
+			}
+			f.Set(reflect.ValueOf(iv))
+		default:
+			t.Fatalf("no test value for %s of kind %s", field.Name, f.Kind())
+		}
+	}
+
+	for name, n := range map[string]*cookiesession.Store{
+		"Clone":    s.Clone(s.Name),
+		"WithName": s.WithName(s.Name),
+	} {
+		nv := reflect.ValueOf(n).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+
+			want, got := v.Field(i), nv.Field(i)
+			if want.Kind() == reflect.Interface && want.Elem().Kind() == reflect.Func {
+				want, got = want.Elem(), got.Elem()
+			}
+
+			if want.Kind() == reflect.Func {
+				if got.Pointer() != want.Pointer() {
+					t.Errorf("%s: expected %s to be copied", name, field.Name)
+				}
+			} else if !reflect.DeepEqual(got.Interface(), want.Interface()) {
+				t.Errorf("%s: expected %s to be copied, got %v", name, field.Name, got.Interface())
+			}
+		}
+	}
+}
+
+func TestCloneOwnsSlices(t *testing.T) {
+	s, _ := newStore(t)
+	s.OldKeys = [][32]byte{{1}}
+	s.SigningKey = []byte("signing")
+	s.KeyRing = map[string][32]byte{"a": {1}}
+
+	n := s.Clone("other")
+	s.OldKeys[0] = [32]byte{2}
+	s.SigningKey[0] = 'S'
+	s.KeyRing["b"] = [32]byte{2}
+
+	if n.OldKeys[0] != [32]byte{1} || string(n.SigningKey) != "signing" || len(n.KeyRing) != 1 {
+		t.Fatalf("expected the clone to have its own slices and key ring, got %v, %q and %v", n.OldKeys, n.SigningKey, n.KeyRing)
+	}
+}
+
+func TestSetKeysCopiesOldKeys(t *testing.T) {
+	s, _ := newStore(t)
+
+	oldKeys := [][32]byte{{1}, {2}}
+	s.SetKeys([32]byte{3}, oldKeys)
+	oldKeys[0] = [32]byte{9}
+
+	if s.OldKeys[0] != [32]byte{1} {
+		t.Fatalf("expected SetKeys to keep its own copy of oldKeys, got %v", s.OldKeys)
+	}
+
+	key := []byte("signing")
+	s.SetSigningKey(key)
+	key[0] = 'S'
+
+	if string(s.SigningKey) != "signing" {
+		t.Fatalf("expected SetSigningKey to keep its own copy of key, got %q", s.SigningKey)
+	}
+}
+
+func TestCookieSetters(t *testing.T) {
+	s, _ := newStore(t)
+	s.SetPath("/app")
+	s.SetDomain("example.com")
+	s.SetSameSite(http.SameSiteStrictMode)
+
+	rec := httptest.NewRecorder()
+	if err := s.Save(rec, cookiesession.NewSession().WithState([]byte("state"))); err != nil {
+		t.Fatal(err)
+	}
+
+	c := rec.Result().Cookies()[0]
+	if c.Path != "/app" || c.Domain != "example.com" || c.SameSite != http.SameSiteStrictMode {
+		t.Fatalf("expected the cookie to carry the attributes set, got %+v", c)
+	}
+
+	if opts := s.CookieOptions(); opts.Path != "/app" || opts.Domain != "example.com" || opts.SameSite != http.SameSiteStrictMode {
+		t.Fatalf("expected CookieOptions to report the attributes set, got %+v", opts)
+	}
+
+	s.SetPartitioned(true)
+	if !s.CookieOptions().Partitioned {
+		t.Fatal("expected SetPartitioned to make cookies Partitioned")
+	}
+}
@@ -0,0 +1,71 @@
+package cookiesession
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// CookieOptions describes the attributes of a session cookie as plain data,
+// for frameworks that build cookies with something other than net/http.
+type CookieOptions struct {
+	Path        string
+	Domain      string
+	SameSite    http.SameSite
+	Secure      bool
+	Partitioned bool
+	HTTPOnly    bool
+	MaxAge      int
+	Expires     time.Time
+	Extra       []string
+}
+
+// CookieOptions returns the attributes that Save gives cookies. Expires
+// depends on when the session is saved, so it's left zero; see EncodeCookie.
+func (s *Store) CookieOptions() CookieOptions {
+	cfg := s.settings()
+
+	opts := CookieOptions{
+		Path:        cfg.path,
+		Domain:      cfg.domain,
+		SameSite:    cfg.sameSite,
+		Secure:      cfg.secure,
+		Partitioned: cfg.partitioned,
+		HTTPOnly:    cfg.httpOnly,
+		MaxAge:      maxAge(cfg.ttl),
+		Extra:       s.ExtraAttributes,
+	}
+
+	if s.SessionCookie {
+		opts.MaxAge = 0
+	}
+
+	return opts
+}
+
+// EncodeCookie prepares ss for saving exactly as Save does, but returns the
+// cookie's name, value and attributes instead of writing it anywhere.
+func (s *Store) EncodeCookie(ss *Session) (name, value string, opts CookieOptions, err error) {
+	c, next, err := s.cookie(nil, ss)
+	if err != nil {
+		return "", "", CookieOptions{}, err
+	}
+
+	if err := s.commit(context.Background(), ss, next); err != nil {
+		return "", "", CookieOptions{}, err
+	}
+
+	opts = CookieOptions{
+		Path:        c.Path,
+		Domain:      c.Domain,
+		SameSite:    c.SameSite,
+		Secure:      c.Secure,
+		Partitioned: isPartitioned(c),
+		HTTPOnly:    c.HttpOnly,
+		MaxAge:      c.MaxAge,
+		Expires:     c.Expires,
+		Extra:       s.ExtraAttributes,
+	}
+
+	return c.Name, c.Value, opts, nil
+}
@@ -0,0 +1,79 @@
+package cookiesession_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+func TestCookieOptions(t *testing.T) {
+	s, _ := newStore(t)
+	s.Path = "/app"
+	s.Domain = "example.com"
+	s.SameSite = http.SameSiteStrictMode
+	s.Secure = true
+	s.HttpOnly = true
+	s.Partitioned = true
+	s.ExtraAttributes = []string{"Priority=High"}
+
+	opts := s.CookieOptions()
+
+	if opts.Path != "/app" || opts.Domain != "example.com" || opts.SameSite != http.SameSiteStrictMode {
+		t.Errorf("expected the store's path, domain and SameSite, got %+v", opts)
+	}
+	if !opts.Secure || !opts.HTTPOnly || !opts.Partitioned {
+		t.Errorf("expected Secure, HTTPOnly and Partitioned, got %+v", opts)
+	}
+	if opts.MaxAge != int(time.Hour/time.Second) {
+		t.Errorf("expected a MaxAge of an hour, got %d", opts.MaxAge)
+	}
+	if len(opts.Extra) != 1 || opts.Extra[0] != "Priority=High" {
+		t.Errorf("expected the extra attributes, got %v", opts.Extra)
+	}
+	if !opts.Expires.IsZero() {
+		t.Errorf("expected no Expires, got %s", opts.Expires)
+	}
+
+	s.SessionCookie = true
+	if opts := s.CookieOptions(); opts.MaxAge != 0 {
+		t.Errorf("expected no MaxAge for a session cookie, got %d", opts.MaxAge)
+	}
+}
+
+func TestEncodeCookie(t *testing.T) {
+	s, _ := newStore(t)
+	s.Domain = "example.com"
+	s.SameSite = http.SameSiteLaxMode
+	s.Secure = true
+	s.HttpOnly = true
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("state"))
+
+	name, v, opts, err := s.EncodeCookie(ss)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name != s.Name {
+		t.Errorf("expected the cookie to be named %q, got %q", s.Name, name)
+	}
+	if opts.Domain != "example.com" || opts.SameSite != http.SameSiteLaxMode || !opts.Secure || !opts.HTTPOnly {
+		t.Errorf("expected the store's attributes, got %+v", opts)
+	}
+	if opts.MaxAge != s.CookieOptions().MaxAge {
+		t.Errorf("expected the same MaxAge as CookieOptions, got %d", opts.MaxAge)
+	}
+	if !opts.Expires.Equal(epoch.Add(time.Hour)) {
+		t.Errorf("expected the cookie to expire in an hour, got %s", opts.Expires)
+	}
+
+	got, err := s.Decode(v)
+	if err != nil {
+		t.Fatal(err)
+	} else if got.SID != ss.SID || string(got.Bytes()) != "state" {
+		t.Errorf("expected the value to decode to the session, got %+v", got)
+	}
+}
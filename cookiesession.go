@@ -1,13 +1,20 @@
 package cookiesession
 
 import (
+	"context"
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/binary"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/satori/go.uuid"
@@ -15,23 +22,414 @@ import (
 )
 
 var (
-	ErrTooShort = errors.New("encoded session data is too short")
+	ErrTooShort         = errors.New("encoded session data is too short")
+	ErrDecryptFailed    = errors.New("couldn't decrypt session data")
+	ErrExpired          = errors.New("session has expired")
+	ErrNameMismatch     = errors.New("session was sealed for a different cookie name")
+	ErrMalformed        = errors.New("encoded session data is malformed")
+	ErrUnknownVersion   = errors.New("encoded session data has an unknown format version")
+	ErrEpochMismatch    = errors.New("session epoch doesn't match the user's current epoch")
+	ErrInvalidAttribute = errors.New("cookie attribute contains invalid characters")
+	ErrInvalidTTL       = errors.New("ttl must be positive unless using session cookies")
+	ErrBadSignature     = errors.New("session signature is invalid")
+	ErrSessionNotValid  = errors.New("session is neither valid nor modified")
+	ErrReplayed         = errors.New("session sequence number is stale")
+	ErrReadOnly         = errors.New("session is read-only")
+	ErrBadEncoding      = errors.New("session value isn't valid base64")
+	ErrFutureSession    = errors.New("session was saved in the future")
+	ErrNoStore          = errors.New("session didn't come from a store")
+	ErrPrefixRules      = errors.New("cookie attributes break the rules for its __Host- or __Secure- prefix")
 )
 
 type Session struct {
-	Valid   bool
-	Time    time.Time
-	SID     uuid.UUID
-	UID     uuid.UUID
-	RealUID uuid.UUID
-	State   []byte
+	Valid     bool
+	Stale     bool
+	Time      time.Time
+	Created   time.Time
+	ExpiresAt time.Time
+	SID       uuid.UUID
+	UID       uuid.UUID
+	RealUID   uuid.UUID
+	Epoch     uint32
+	Seq       uint32
+	Claims    map[string]interface{}
+	State     []byte
+
+	// Auth is how and when the user authenticated, one record per method;
+	// see RecordAuth.
+	Auth []AuthRecord
+
+	// ImpersonatedAt is when the session started impersonating UID, if it
+	// is; see Impersonate.
+	ImpersonatedAt time.Time
+
+	sections map[string][]byte
+	flashes  []Flash
+	certHash []byte
+	binding  []byte
+	buf      []byte
+	store    *Store
+	dirty    bool
+	readOnly bool
+	guarded  bool
+	stateSum [32]byte
+
+	// rememberSeq is the counter of the remember-me cookie the session was
+	// restored from, or last saved with SaveRemember.
+	rememberSeq uint32
+}
+
+// NewSession returns an empty session with a fresh SID, for building
+// sessions outside of a request.
+func NewSession() *Session {
+	var s *Store
+
+	return &Session{SID: s.newID()}
+}
+
+// WithUID sets both UID and RealUID to uid, and returns s.
+func (s *Session) WithUID(uid uuid.UUID) *Session {
+	s.mustBeWritable()
+
+	s.UID = uid
+	s.RealUID = uid
+	s.dirty = true
+
+	return s
+}
+
+// SetUID sets UID and marks the session dirty. RealUID is set too, unless
+// the session is impersonating another user, in which case RealUID is left
+// as the genuine identity.
+func (s *Session) SetUID(uid uuid.UUID) {
+	s.mustBeWritable()
+
+	if s.RealUID == uuid.Nil || s.RealUID == s.UID {
+		s.RealUID = uid
+	}
+	s.UID = uid
+	s.dirty = true
+}
+
+func (s *Session) WithState(state []byte) *Session {
+	s.mustBeWritable()
+
+	s.State = state
+	s.dirty = true
+
+	return s
+}
+
+// Save saves the session with the Store it came from, like Store.Save. Only
+// sessions returned by Get and its variants know their Store; any other
+// session gives ErrNoStore.
+func (s *Session) Save(rw http.ResponseWriter) error {
+	if s.store == nil {
+		return ErrNoStore
+	}
+
+	return s.store.Save(rw, s)
+}
+
+// Anonymous reports whether the session has no user, which is the case for
+// every fresh session until a UID is set.
+func (s *Session) Anonymous() bool {
+	return s.UID == uuid.Nil
+}
+
+// Bytes returns a copy of State that's safe to modify.
+func (s *Session) Bytes() []byte {
+	return append([]byte(nil), s.State...)
+}
+
+// SetBytes sets State to a copy of b and marks the session dirty.
+func (s *Session) SetBytes(b []byte) {
+	s.mustBeWritable()
+
+	s.State = append([]byte(nil), b...)
+	s.dirty = true
 }
 
+// MarkDirty records that the session has changed and needs to be saved.
+func (s *Session) MarkDirty() {
+	s.mustBeWritable()
+
+	s.dirty = true
+}
+
+// Dirty reports whether the session has been changed since it was loaded or
+// last saved.
+func (s *Session) Dirty() bool {
+	return s.dirty
+}
+
+// Freeze makes the session read-only. Afterwards, methods that change it
+// panic with ErrReadOnly, or return it if they return errors, and saving it
+// fails with ErrReadOnly. Direct changes to its fields can't be caught, but
+// will never be saved.
+func (s *Session) Freeze() {
+	s.readOnly = true
+}
+
+// Frozen reports whether Freeze has been called on the session.
+func (s *Session) Frozen() bool {
+	return s.readOnly
+}
+
+func (s *Session) mustBeWritable() {
+	if s.readOnly {
+		panic(ErrReadOnly)
+	}
+}
+
+// MergeState replaces State with the result of resolve, which is given the
+// current State and other's State, and marks the session dirty. It's meant
+// for carrying state across a change of session, such as when an anonymous
+// session is linked to an account at login.
+func (s *Session) MergeState(other *Session, resolve func(existing, incoming []byte) []byte) {
+	s.mustBeWritable()
+
+	s.State = resolve(s.State, other.State)
+	s.dirty = true
+}
+
+// StartedAt returns when the session was first saved.
+func (s *Session) StartedAt() time.Time {
+	if s.Created.IsZero() {
+		return s.Time
+	}
+
+	return s.Created
+}
+
+// LastSeen returns when the session was most recently saved.
+func (s *Session) LastSeen() time.Time {
+	return s.Time
+}
+
+// Scrub returns a copy of the session that's safe to log. State is replaced
+// by a description of its length and hash, RealUID is zeroed, and sections
+// are dropped. The session itself isn't modified.
+func (s *Session) Scrub() Session {
+	c := *s
+
+	sum := sha256.Sum256(s.State)
+	c.State = []byte(fmt.Sprintf("[redacted: %d bytes, sha256 %x]", len(s.State), sum[:8]))
+	c.RealUID = uuid.Nil
+	c.sections = nil
+	c.flashes = nil
+	c.certHash = nil
+	c.binding = nil
+	c.buf = nil
+
+	return c
+}
+
+// String summarises the session for logs. It never includes State itself.
+// Its age is by the clock of the store it came from, if any.
+func (s *Session) String() string {
+	now := time.Now()
+	if s.store != nil {
+		now = s.store.now()
+	}
+
+	return fmt.Sprintf("session %s (uid %s, age %s, %d bytes of state)", s.SID, s.UID, now.Sub(s.Time).Truncate(time.Second), len(s.State))
+}
+
+// Versioned encodings start with a non-zero version byte. The legacy encoding
+// starts with a big-endian Unix timestamp, whose first byte is zero for any
+// time this package could have written.
+const (
+	formatLegacy = 0
+	formatV1     = 1
+)
+
+// FormatVersion is the version of the binary encoding that MarshalBinary
+// writes. UnmarshalBinary reads it and every earlier version, including the
+// unversioned legacy encoding.
+const FormatVersion = formatV1
+
+// In versioned encodings, the fixed header is followed by a list of optional
+// fields, each a tag byte, a uvarint length, and a value. The list ends with
+// fieldEnd, and everything after it is the session state. Unknown tags are
+// skipped so that fields can be added without breaking older readers, and
+// fixed-size fields may grow, with readers using only the leading bytes they
+// know about.
+const (
+	fieldEnd      = 0
+	fieldEpoch    = 1
+	fieldSection  = 2
+	fieldCreated  = 3
+	fieldClaims   = 4
+	fieldCertHash = 5
+	fieldExpires  = 6
+	fieldSeq      = 7
+	fieldPad      = 8
+	fieldAuth     = 9
+	fieldImpAt    = 11
+	fieldFlashes  = 12
+	fieldBinding  = 13
+	fieldRemember = 14
+)
+
+// UnmarshalBinary decodes both the legacy and versioned encodings. Fields
+// missing from older encodings get defaults: Created falls back to Time, and
+// everything else is left zero.
 func (s *Session) UnmarshalBinary(data []byte) error {
+	if len(data) > 0 && data[0] != formatLegacy {
+		return s.unmarshalVersioned(data)
+	}
+
 	if len(data) < 8+16+16+16 {
 		return ErrTooShort
 	}
 
+	if err := s.unmarshalHeader(data[:56]); err != nil {
+		return err
+	}
+
+	s.Created = s.Time
+	s.ExpiresAt = time.Time{}
+	s.Epoch = 0
+	s.Seq = 0
+	s.Auth = nil
+	s.ImpersonatedAt = time.Time{}
+	s.Claims = nil
+	s.sections = nil
+	s.flashes = nil
+	s.certHash = nil
+	s.binding = nil
+	s.rememberSeq = 0
+	s.State = data[56:]
+
+	return nil
+}
+
+func (s *Session) unmarshalVersioned(data []byte) error {
+	if data[0] != formatV1 {
+		return ErrUnknownVersion
+	}
+
+	if len(data) < 1+8+16+16+16 {
+		return ErrTooShort
+	}
+
+	var epoch, seq, rememberSeq uint32
+	var created, expiresAt, impersonatedAt time.Time
+	var auth []AuthRecord
+	var claims map[string]interface{}
+	var sections map[string][]byte
+	var flashes []Flash
+	var certHash, binding []byte
+
+	rest := data[57:]
+	for {
+		if len(rest) == 0 {
+			return ErrTooShort
+		}
+
+		tag := rest[0]
+		rest = rest[1:]
+
+		if tag == fieldEnd {
+			break
+		}
+
+		n, l := binary.Uvarint(rest)
+		if l <= 0 || n > uint64(len(rest)-l) {
+			return ErrTooShort
+		}
+
+		value := rest[l : l+int(n)]
+		rest = rest[l+int(n):]
+
+		switch tag {
+		case fieldEpoch:
+			if len(value) < 4 {
+				return ErrMalformed
+			}
+			epoch = binary.BigEndian.Uint32(value)
+		case fieldSeq:
+			if len(value) < 4 {
+				return ErrMalformed
+			}
+			seq = binary.BigEndian.Uint32(value)
+		case fieldRemember:
+			if len(value) < 4 {
+				return ErrMalformed
+			}
+			rememberSeq = binary.BigEndian.Uint32(value)
+		case fieldSection:
+			n, l := binary.Uvarint(value)
+			if l <= 0 || n > uint64(len(value)-l) {
+				return ErrMalformed
+			}
+			if sections == nil {
+				sections = make(map[string][]byte)
+			}
+			sections[string(value[l:l+int(n)])] = value[l+int(n):]
+		case fieldCreated:
+			if len(value) < 8 {
+				return ErrMalformed
+			}
+			created = time.Unix(int64(binary.BigEndian.Uint64(value)), 0)
+		case fieldExpires:
+			if len(value) < 8 {
+				return ErrMalformed
+			}
+			expiresAt = time.Unix(int64(binary.BigEndian.Uint64(value)), 0)
+		case fieldAuth:
+			var err error
+			if auth, err = unmarshalAuth(value); err != nil {
+				return err
+			}
+		case fieldImpAt:
+			if len(value) < 8 {
+				return ErrMalformed
+			}
+			impersonatedAt = time.Unix(int64(binary.BigEndian.Uint64(value)), 0)
+		case fieldFlashes:
+			var err error
+			if flashes, err = unmarshalFlashes(value); err != nil {
+				return err
+			}
+		case fieldClaims:
+			if err := json.Unmarshal(value, &claims); err != nil {
+				return ErrMalformed
+			}
+		case fieldCertHash:
+			certHash = value
+		case fieldBinding:
+			binding = value
+		}
+	}
+
+	if err := s.unmarshalHeader(data[1:57]); err != nil {
+		return err
+	}
+
+	if created.IsZero() {
+		created = s.Time
+	}
+
+	s.Created = created
+	s.ExpiresAt = expiresAt
+	s.Epoch = epoch
+	s.Seq = seq
+	s.Auth = auth
+	s.ImpersonatedAt = impersonatedAt
+	s.Claims = claims
+	s.sections = sections
+	s.flashes = flashes
+	s.certHash = certHash
+	s.binding = binding
+	s.rememberSeq = rememberSeq
+	s.State = rest
+
+	return nil
+}
+
+func (s *Session) unmarshalHeader(data []byte) error {
 	sid, err := uuid.FromBytes(data[8:24])
 	if err != nil {
 		return err
@@ -52,111 +450,2409 @@ func (s *Session) UnmarshalBinary(data []byte) error {
 	s.SID = sid
 	s.UID = uid
 	s.RealUID = realUID
-	s.State = data[56:]
 
 	return nil
 }
 
 func (s *Session) MarshalBinary() ([]byte, error) {
-	buf := make([]byte, 8)
+	return s.marshalTo(nil, 0)
+}
+
+// MarshalBinaryTo appends the encoding of s to dst, growing it if necessary,
+// and returns the extended buffer.
+func (s *Session) MarshalBinaryTo(dst []byte) ([]byte, error) {
+	return s.marshalTo(dst, 0)
+}
+
+// marshalTo appends the encoding of s to dst, adding a padding field if
+// padTo is positive so that the encoding's length is a multiple of it.
+func (s *Session) marshalTo(dst []byte, padTo int) ([]byte, error) {
+	var claims []byte
+	if len(s.Claims) > 0 {
+		b, err := json.Marshal(s.Claims)
+		if err != nil {
+			return nil, errors.New("couldn't encode claims: " + err.Error())
+		}
+
+		claims = b
+	}
+
+	size := s.marshalSize()
+	if claims != nil {
+		size += fieldSize(len(claims))
+	}
+	if padTo > 0 {
+		size += padTo + 3
+	}
 
-	binary.BigEndian.PutUint64(buf, uint64(s.Time.Unix()))
+	start := len(dst)
+	if cap(dst)-start < size {
+		grown := make([]byte, start, start+size)
+		copy(grown, dst)
+		dst = grown
+	}
+
+	buf := dst[:start+9]
+
+	buf[start] = formatV1
+	binary.BigEndian.PutUint64(buf[start+1:], uint64(s.Time.Unix()))
 	buf = append(buf, s.SID[:]...)
 	buf = append(buf, s.UID[:]...)
 	buf = append(buf, s.RealUID[:]...)
+
+	if s.Epoch != 0 {
+		var epoch [4]byte
+		binary.BigEndian.PutUint32(epoch[:], s.Epoch)
+		buf = appendField(buf, fieldEpoch, epoch[:])
+	}
+
+	if s.Seq != 0 {
+		var seq [4]byte
+		binary.BigEndian.PutUint32(seq[:], s.Seq)
+		buf = appendField(buf, fieldSeq, seq[:])
+	}
+
+	if s.rememberSeq != 0 {
+		var rememberSeq [4]byte
+		binary.BigEndian.PutUint32(rememberSeq[:], s.rememberSeq)
+		buf = appendField(buf, fieldRemember, rememberSeq[:])
+	}
+
+	if !s.Created.IsZero() {
+		var created [8]byte
+		binary.BigEndian.PutUint64(created[:], uint64(s.Created.Unix()))
+		buf = appendField(buf, fieldCreated, created[:])
+	}
+
+	if !s.ExpiresAt.IsZero() {
+		var expiresAt [8]byte
+		binary.BigEndian.PutUint64(expiresAt[:], uint64(s.ExpiresAt.Unix()))
+		buf = appendField(buf, fieldExpires, expiresAt[:])
+	}
+
+	if len(s.Auth) != 0 {
+		buf = appendField(buf, fieldAuth, marshalAuth(s.Auth))
+	}
+
+	if !s.ImpersonatedAt.IsZero() {
+		var impersonatedAt [8]byte
+		binary.BigEndian.PutUint64(impersonatedAt[:], uint64(s.ImpersonatedAt.Unix()))
+		buf = appendField(buf, fieldImpAt, impersonatedAt[:])
+	}
+
+	if len(s.flashes) != 0 {
+		buf = appendField(buf, fieldFlashes, marshalFlashes(s.flashes))
+	}
+
+	if claims != nil {
+		buf = appendField(buf, fieldClaims, claims)
+	}
+
+	if len(s.certHash) != 0 {
+		buf = appendField(buf, fieldCertHash, s.certHash)
+	}
+
+	if len(s.binding) != 0 {
+		buf = appendField(buf, fieldBinding, s.binding)
+	}
+
+	for _, name := range s.sectionNames() {
+		buf = appendField(buf, fieldSection, bindName(name, s.sections[name]))
+	}
+
+	if padTo > 0 {
+		buf = appendPad(buf, len(buf)-start+1+len(s.State), padTo)
+	}
+
+	buf = append(buf, fieldEnd)
 	buf = append(buf, s.State...)
 
 	return buf, nil
 }
 
-type Store struct {
-	Name, Secret     string
-	HttpOnly, Secure bool
-	TTL              time.Duration
-	Key              [32]byte
+// appendPad appends the smallest padding field that makes size, the length
+// the encoding would otherwise have, a multiple of padTo.
+func appendPad(buf []byte, size, padTo int) []byte {
+	for m := 2; ; m++ {
+		if (size+m)%padTo != 0 {
+			continue
+		}
+
+		for l := 1; l <= 2; l++ {
+			if n := m - 1 - l; n >= 0 && uvarintSize(n) == l {
+				return appendField(buf, fieldPad, make([]byte, n))
+			}
+		}
+	}
 }
 
-func New(name, secret string, ttl time.Duration) *Store {
-	var key [32]byte
-	h := sha256.New()
-	h.Write([]byte(secret))
-	copy(key[:], h.Sum(nil))
+// MarshalSize returns the number of bytes MarshalBinary would produce. Claims
+// still have to be encoded to find their size, and if they can't be encoded,
+// they aren't counted.
+func (s *Session) MarshalSize() int {
+	n := s.marshalSize()
 
-	return &Store{
-		Name:   name,
-		Secret: secret,
-		TTL:    ttl,
-		Key:    key,
+	if len(s.Claims) > 0 {
+		if b, err := json.Marshal(s.Claims); err == nil {
+			n += fieldSize(len(b))
+		}
 	}
+
+	return n
 }
 
-func (s *Store) Get(r *http.Request) Session {
-	c, err := r.Cookie(s.Name)
-	if err != nil {
-		return Session{SID: uuid.NewV4()}
-	} else if c == nil {
-		return Session{SID: uuid.NewV4()}
+// marshalSize returns the length of the versioned encoding of s, apart from
+// its claims, so that MarshalBinary can allocate exactly once.
+func (s *Session) marshalSize() int {
+	n := 1 + 8 + 16 + 16 + 16
+
+	if s.Epoch != 0 {
+		n += fieldSize(4)
 	}
 
-	encrypted, err := base64.StdEncoding.DecodeString(c.Value)
-	if err != nil {
-		return Session{SID: uuid.NewV4()}
+	if s.Seq != 0 {
+		n += fieldSize(4)
 	}
 
-	var nonce [24]byte
-	copy(nonce[:], encrypted[:24])
+	if s.rememberSeq != 0 {
+		n += fieldSize(4)
+	}
 
-	buf, ok := secretbox.Open(nil, encrypted[24:], &nonce, &s.Key)
-	if !ok {
-		return Session{SID: uuid.NewV4()}
+	if !s.Created.IsZero() {
+		n += fieldSize(8)
 	}
 
-	var ss Session
-	if err := ss.UnmarshalBinary(buf); err != nil {
-		return Session{SID: uuid.NewV4()}
+	if !s.ExpiresAt.IsZero() {
+		n += fieldSize(8)
 	}
 
-	if time.Now().Sub(ss.Time) > s.TTL {
-		return Session{SID: uuid.NewV4()}
+	if len(s.Auth) != 0 {
+		m := 0
+		for _, a := range s.Auth {
+			m += uvarintSize(len(a.Method)) + len(a.Method) + 8
+		}
+		n += fieldSize(m)
 	}
 
-	return ss
-}
+	if !s.ImpersonatedAt.IsZero() {
+		n += fieldSize(8)
+	}
 
-func (s *Store) Save(rw http.ResponseWriter, ss *Session) error {
-	var nonce [24]byte
-	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
-		return errors.New("couldn't get random nonce: " + err.Error())
+	if len(s.flashes) != 0 {
+		n += fieldSize(len(marshalFlashes(s.flashes)))
 	}
 
-	ss.Time = time.Now()
+	if len(s.certHash) != 0 {
+		n += fieldSize(len(s.certHash))
+	}
 
-	buf, err := ss.MarshalBinary()
-	if err != nil {
-		return errors.New("couldn't encode session: " + err.Error())
+	if len(s.binding) != 0 {
+		n += fieldSize(len(s.binding))
 	}
 
-	http.SetCookie(rw, &http.Cookie{
-		Path:     "/",
-		HttpOnly: s.HttpOnly,
-		Secure:   s.Secure,
-		Name:     s.Name,
-		Expires:  ss.Time.Add(s.TTL),
-		MaxAge:   int(s.TTL / time.Second),
-		Value:    base64.StdEncoding.EncodeToString(secretbox.Seal(nonce[:], buf, &nonce, &s.Key)),
-	})
+	for name, sealed := range s.sections {
+		n += fieldSize(uvarintSize(len(name)) + len(name) + len(sealed))
+	}
 
-	return nil
+	return n + 1 + len(s.State)
 }
 
-func (s *Store) Clear(rw http.ResponseWriter) {
-	http.SetCookie(rw, &http.Cookie{
-		Path:     "/",
-		HttpOnly: s.HttpOnly,
-		Secure:   s.Secure,
-		Name:     s.Name,
-		Expires:  time.Unix(0, 0),
-		MaxAge:   -1,
-		Value:    "",
-	})
+func fieldSize(n int) int {
+	return 1 + uvarintSize(n) + n
+}
+
+func uvarintSize(n int) int {
+	var l [binary.MaxVarintLen64]byte
+
+	return binary.PutUvarint(l[:], uint64(n))
+}
+
+func appendField(buf []byte, tag byte, value []byte) []byte {
+	var l [binary.MaxVarintLen64]byte
+
+	buf = append(buf, tag)
+	buf = append(buf, l[:binary.PutUvarint(l[:], uint64(len(value)))]...)
+	buf = append(buf, value...)
+
+	return buf
+}
+
+const (
+	DefaultMaxOldKeys = 2
+	DefaultClockSkew  = time.Minute
+)
+
+// MaxCookieAge is the longest lifetime Save will give a cookie. Browsers cap
+// cookie lifetimes at 400 days, so anything longer would be cut short anyway.
+// Sessions themselves can still last longer on the server side, but Save logs
+// a warning the first time it has to shorten a cookie.
+const MaxCookieAge = 400 * 24 * time.Hour
+
+// maxAge converts d to a cookie Max-Age, clamped to MaxCookieAge, which also
+// keeps it well within an int on 32-bit platforms.
+func maxAge(d time.Duration) int {
+	if d > MaxCookieAge {
+		d = MaxCookieAge
+	}
+
+	return int(d / time.Second)
+}
+
+type Store struct {
+	Name, Secret     string
+	HttpOnly, Secure bool
+	OmitPath         bool
+	BindName         bool
+	StrictFormat     bool
+	ExtraAttributes  []string
+	TTL              time.Duration
+	SessionCookie    bool
+	AllowInvalidSave bool
+	Audience         string
+	Key              [32]byte
+	OldKeys          [][32]byte
+	MaxOldKeys       int
+
+	// IDGenerator makes the SIDs of new sessions, from Rand and the store's
+	// clock. It defaults to UUIDv4; see also WithUUIDv7.
+	IDGenerator IDGenerator
+
+	// Now, if set, replaces time.Now for timestamping sessions and checking
+	// their expiry, so that tests can control time.
+	Now func() time.Time
+
+	// KeyDerivation, if set, turns secrets into keys in place of SHA-256,
+	// for New (given WithKeyDerivation), Rotate and AddRotatedSecret.
+	// Changing it doesn't re-derive Key or OldKeys.
+	KeyDerivation KeyDerivation
+
+	// Path and Domain set the cookie's attributes of the same names. Path
+	// defaults to "/", and OmitPath takes precedence over it.
+	Path, Domain string
+
+	// SameSite sets the cookie's SameSite attribute. It's left off by
+	// default, unless AutoSecure adds it.
+	SameSite http.SameSite
+
+	// Partitioned sets the cookie's Partitioned attribute, so that browsers
+	// keep it when the site is embedded by others but third-party cookies
+	// are blocked, in a separate jar for each top-level site. Browsers also
+	// require Secure for it.
+	Partitioned bool
+
+	// Environment, if set, is mixed into every key, so that values sealed
+	// in one environment fail to decrypt in another even when the two share
+	// a secret. Changing it invalidates every existing value.
+	Environment string
+
+	// KeyRing, if set, replaces Key and OldKeys with keys named by stable
+	// ids. Values are sealed with the key named by ActiveKeyID, and carry
+	// that id in the clear so they can be opened with the right key however
+	// the ring changes, or rejected with ErrUnknownKeyID once their key is
+	// removed. Values sealed before the ring was set can't be opened.
+	KeyRing     map[string][32]byte
+	ActiveKeyID string
+
+	// SigningKey, if set, adds an HMAC-SHA256 under a second secret over
+	// each sealed value. It's checked before anything is decrypted, so
+	// forging a value needs both keys.
+	SigningKey []byte
+
+	// PublicExpiry and PublicSID put each session's expiry and SID in
+	// plaintext in front of its sealed value, so that edge infrastructure
+	// can read them with ReadMetadata without the key. They're bound into
+	// the sealed plaintext, so values whose metadata has been changed are
+	// rejected with ErrBadMetadata. MetadataKey, if set, adds an HMAC over
+	// the metadata and the value under a key that can be given to the edge,
+	// so it can trust the metadata too.
+	PublicExpiry, PublicSID bool
+	MetadataKey             []byte
+
+	// TTLFunc, if set, overrides TTL per session, for both the expiry check
+	// and the cookie's lifetime, so that e.g. each tenant can have its own
+	// session policy.
+	TTLFunc func(ss *Session) time.Duration
+
+	// TimeGranularity is what Save rounds each session's Time down to, so
+	// that sessions saved within the same interval have the same Time. It
+	// defaults to, and can't be less than, one second.
+	TimeGranularity time.Duration
+
+	// PreserveTime stops Save from resetting Time once it's been set, so
+	// that TTL counts from when the session was first saved rather than
+	// from its last save, making it an absolute lifetime.
+	PreserveTime bool
+
+	// GracePeriod extends how long sessions are accepted past their TTL.
+	// Sessions in the grace period are marked Stale, so handlers can ask the
+	// user to re-authenticate gently instead of logging them out mid-action.
+	GracePeriod time.Duration
+
+	// IdleTimeout and AbsoluteTimeout, if set, expire sessions that haven't
+	// been saved for IdleTimeout, and sessions created more than
+	// AbsoluteTimeout ago no matter how active they've been. They apply on
+	// top of TTL, without any GracePeriod, and cookies are given lifetimes
+	// that end no later than either of them.
+	IdleTimeout, AbsoluteTimeout time.Duration
+
+	// RenewEvery is how old a session's cookie has to be before Touch and
+	// SaveIfChanged reissue it, so that active users' sessions are kept
+	// alive without a Set-Cookie header on every response. It defaults to
+	// half the session's TTL.
+	RenewEvery time.Duration
+
+	// ClockSkew is how far apart servers' clocks are allowed to be when
+	// comparing times they've written. Zero means DefaultClockSkew, and a
+	// negative value disables the allowance.
+	ClockSkew time.Duration
+
+	// AutoSecure sets each cookie's Secure attribute from whether the
+	// request came over TLS, instead of from Secure, and adds SameSite=Lax
+	// over TLS if SameSite isn't set, so that the same configuration works over plain HTTP in
+	// development. Behind a proxy that terminates TLS every request looks
+	// insecure, so set Secure instead there. Saving needs the request, so
+	// use SaveFor.
+	AutoSecure bool
+
+	// BindTLS binds sessions to the TLS client certificate of the request
+	// that saved them, and rejects them when presented with any other
+	// certificate or none at all. Saving needs the request, so use SaveFor.
+	BindTLS bool
+
+	// RequireSecure makes Get reject session cookies presented over plain
+	// HTTP with ErrInsecureTransport, in case a misconfigured proxy forwards
+	// requests that a Secure cookie shouldn't have been sent with. IsSecure,
+	// if set, decides whether a request is secure instead of checking r.TLS,
+	// for proxies that terminate TLS and set X-Forwarded-Proto.
+	RequireSecure bool
+	IsSecure      func(r *http.Request) bool
+
+	// Binding, if set, binds sessions to a hash of the attributes it picks
+	// from the request that saved them, such as the client's network and
+	// User-Agent, and rejects them with ErrBindingMismatch when presented
+	// by a request that doesn't match. Saving needs the request, so use
+	// SaveFor.
+	Binding *Binding
+
+	// Rand is the source of nonces, defaulting to crypto/rand. Nonces must
+	// never repeat under the same key, so anything other than a CSPRNG is
+	// only suitable for tests. DetectNonceReuse makes sealing fail if one
+	// of the last NonceReuseWindow nonces comes up again, to catch a broken
+	// source before it does damage.
+	Rand             io.Reader
+	DetectNonceReuse bool
+
+	// CounterNonces builds nonces from a random 12-byte prefix, read once,
+	// and a counter, instead of reading 24 random bytes for every save. The
+	// prefix and counter live only in memory and are shared by copies of the
+	// store, so nonces stay unique until the process restarts; a restarted
+	// process gets a new prefix. A deterministic Rand would hand every
+	// process the same prefix, so this must only be used with a CSPRNG.
+	CounterNonces bool
+
+	// UserEpoch, if set, returns the current epoch for a user. Save stamps it
+	// into the session and Get rejects sessions whose epoch doesn't match,
+	// so bumping a user's epoch invalidates all of their existing cookies.
+	// This only requires the application to store a single integer per user.
+	UserEpoch func(ctx context.Context, uid uuid.UUID) (uint32, error)
+
+	// CheckSeq, if set, is given the SID and sequence number of each session
+	// Get loads, and rejects it with ErrReplayed by returning false. Save
+	// increments the sequence number, so recording the last one issued for
+	// each SID and accepting only that one stops old cookies being replayed.
+	// That's a single integer per live session, and entries can be dropped
+	// once the session would have expired anyway.
+	CheckSeq func(sid uuid.UUID, seq uint32) bool
+
+	// LegacyDecoder, if set, is given the plaintext of any value that
+	// decrypts but doesn't decode, so that sessions written in some other
+	// format can still be read during a migration. Sessions it decodes are
+	// marked dirty, and saving them rewrites them in the current format.
+	LegacyDecoder func(plaintext []byte) (*Session, bool)
+
+	// Cipher is what seals values, and defaults to Secretbox. Values sealed
+	// with any of the built-in ciphers can be opened whatever it's set to,
+	// so that it can be changed without logging everyone out.
+	Cipher Cipher
+
+	// Compression, if set, compresses sessions before they're sealed,
+	// whenever that makes them smaller. Gzip-compressed sessions can always
+	// be read, even with Compression unset. It's ignored when PadTo is set,
+	// since compression would undo the padding, and like padding it leaks
+	// something about State through the cookie's length, so beware of
+	// compressing secrets alongside data an attacker controls.
+	Compression Compressor
+
+	// ChunkSize, if positive, splits cookie values longer than it across
+	// cookies named like "session.0", "session.1" and so on, with the
+	// session cookie itself naming how many there are, so that sessions can
+	// outgrow what browsers store in a single cookie. MaxChunkedSize limits
+	// the total length of a split value, and defaults to
+	// DefaultMaxChunkedSize. Only the Save variants split values; SaveFor
+	// also deletes chunks left over from a larger session.
+	ChunkSize      int
+	MaxChunkedSize int
+
+	// MaxSize is the largest cookie, name and value together, that the
+	// Save variants will write, defaulting to MaxCookieSize. Browsers
+	// silently drop cookies that are too big, so Save returns ErrTooLarge
+	// instead; with ChunkSize set, it applies to each chunk. A negative
+	// MaxSize turns the check off.
+	MaxSize int
+
+	// Encoding is how sealed values are encoded, defaulting to
+	// base64.StdEncoding. base64.RawURLEncoding avoids characters that
+	// some proxies and cookie parsers mangle, and is shorter. Values in
+	// either alphabet, padded or not, are read whatever it's set to, so it
+	// can be changed without logging anyone out.
+	Encoding *base64.Encoding
+
+	// Codec encodes the values kept by Session.SetEncodedValue. It defaults
+	// to JSONCodec.
+	Codec Codec
+
+	// DecodeCache, if set, keeps recently decoded sessions so that repeated
+	// requests with the same cookie skip opening it again. DecodeInto
+	// doesn't use it.
+	DecodeCache *DecodeCache
+
+	// CompactJWE seals sessions as compact JWEs, using direct encryption
+	// with A256GCM under JWEKey, instead of the native format, for
+	// consumers that only speak JOSE. The payload has the standard sub, iat
+	// and exp claims, plus sid and the native session encoding as
+	// "cookiesession". SigningKey and PadTo's privacy aren't applied to the
+	// outer token. Tokens from Seal are unaffected.
+	CompactJWE bool
+
+	// PadTo, if positive, pads each session so that its encoding is a
+	// multiple of PadTo bytes long, so that cookie lengths don't give away
+	// how much state a session holds. Values already differ from each other
+	// because of their random nonces.
+	PadTo int
+
+	// MaxFlashes, if positive, is how many flash messages a session keeps.
+	// AddFlash drops the oldest once there are more, so that a handler
+	// adding them in a loop can't grow the cookie until browsers drop it.
+	MaxFlashes int
+
+	// CSRFHeader and CSRFField are where VerifyCSRF looks for the token,
+	// defaulting to DefaultCSRFHeader and DefaultCSRFField.
+	CSRFHeader, CSRFField string
+
+	// AuthSections names the sections that hold data tied to the privileges
+	// a session had before Regenerate, such as a step-up proof, which
+	// Regenerate removes. RegenerateFlags adjusts what else it keeps.
+	AuthSections    []string
+	RegenerateFlags RegenerateFlags
+
+	// MaxImpersonation, if positive, is how long a session can impersonate
+	// another user. Once it's up, loading the session stops the
+	// impersonation and marks the session dirty, so saving it puts the real
+	// user back in their own session.
+	MaxImpersonation time.Duration
+
+	// Revoker, if set, is asked whether each session has been revoked,
+	// so that stolen cookies can be rejected before they expire.
+	Revoker Revoker
+
+	// Backend, if set, keeps State server-side instead of in the cookie. Save
+	// stores it under the session's SID and Get loads it again, rejecting
+	// the session if that fails, so deleting it from the backend revokes the
+	// session. StateCodec isn't used with a Backend.
+	Backend Backend
+
+	// StateCodec, if set, is applied to State just before a session is
+	// sealed and just after it's opened.
+	StateCodec StateCodec
+
+	// AllowedValueKeys, if set, limits the keys SetValues, SetValue and
+	// Session.SetEncodedValue will store, as a guard against bloating the
+	// cookie or storing secrets in it by accident.
+	AllowedValueKeys []string
+
+	// AltHeader, if set, names a request header that Get reads the session
+	// value from when there's no session cookie, for deployments behind a
+	// CDN that strips cookies. Save still sets a cookie.
+	AltHeader string
+
+	// BearerAuth makes Get read the session from an "Authorization: Bearer"
+	// header when there's no session cookie, so that API clients can use
+	// values from Token.
+	BearerAuth bool
+
+	// HandoffKey is the key that Export and Import seal handoff tokens
+	// with, shared by services that hand users to each other instead of
+	// their cookie keys. Tokens last HandoffTTL, defaulting to
+	// DefaultHandoffTTL, and Export addresses them to HandoffAudience,
+	// which must be the importing store's Audience.
+	HandoffKey      [32]byte
+	HandoffTTL      time.Duration
+	HandoffAudience string
+
+	// RememberName names the cookie written by SaveRemember, defaulting to
+	// the store's name followed by "_remember". CheckRemember, if set, is
+	// given the UID and counter from each remember-me cookie before a
+	// session is restored from it, and can reject the cookie with an error.
+	RememberName  string
+	CheckRemember func(ctx context.Context, uid uuid.UUID, counter uint32) error
+
+	// OnError, if set, is called for each session cookie Get rejects, with a
+	// short reason suitable for a metrics label. Values sealed under this key
+	// but presented under another cookie name (with BindName set) are
+	// reported as "name_mismatch", so swap attempts can be told apart from
+	// cookies that are merely corrupt ("decrypt_failed") or old ("expired").
+	OnError func(r *http.Request, reason string, err error)
+
+	// OnCreate, OnDecodeError, OnExpire, OnSave and OnClear, if set, are
+	// called as sessions go through their lifecycle, for audit logging and
+	// alerting. OnCreate gets each fresh session that Get and its variants
+	// hand out in place of a usable one. OnDecodeError gets each cookie
+	// rejected for any reason other than expiry, and OnExpire gets each
+	// expired session, without its State. OnSave gets each session after
+	// it's saved, and OnClear is called when the cookie is cleared. The
+	// request is nil where the method called doesn't take one.
+	OnCreate      func(r *http.Request, ss *Session)
+	OnDecodeError func(r *http.Request, err error)
+	OnExpire      func(r *http.Request, ss *Session)
+	OnSave        func(r *http.Request, ss *Session)
+	OnClear       func(r *http.Request)
+
+	// BeforeSave, if set, is called with each cookie just before it's
+	// written, so it can be adjusted per request. The request is only
+	// available when saving with SaveFor; otherwise it's nil.
+	BeforeSave func(r *http.Request, c *http.Cookie)
+
+	// GuardState is a debugging aid. Sessions loaded by Get get their own
+	// copy of State, and Save logs a warning if State was changed without
+	// MarkDirty being called.
+	GuardState bool
+	Logger     *log.Logger
+
+	mu      atomic.Value
+	nonces  *nonceSet
+	counter *nonceCounter
+	closed  bool
+
+	warnedAge uint32
+}
+
+func New(name, secret string, ttl time.Duration, opts ...Option) *Store {
+	s := &Store{
+		Name:   name,
+		Secret: secret,
+		TTL:    ttl,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.Key = s.deriveKey(secret)
+	s.lock()
+
+	return s
+}
+
+// Validate reports whether the Store's configuration is usable. A TTL of
+// zero or less would make every session expire immediately, so it's only
+// allowed with SessionCookie, where it means the cookie lasts as long as the
+// browser session and isn't expired by the server. An AbsoluteTimeout shorter
+// than TTL or IdleTimeout is also rejected, since it would silently override
+// them, and so are attributes that browsers would reject the cookie for given
+// its name prefix.
+func (s *Store) Validate() error {
+	cfg := s.settings()
+
+	if cfg.ttl <= 0 && s.TTLFunc == nil && !s.SessionCookie {
+		return ErrInvalidTTL
+	}
+
+	if s.AbsoluteTimeout > 0 && (s.AbsoluteTimeout < cfg.ttl || s.AbsoluteTimeout < s.IdleTimeout) {
+		return ErrInvalidTTL
+	}
+
+	if err := s.checkPrefixRules(cfg); err != nil {
+		return err
+	}
+
+	if s.KeyRing != nil {
+		if _, _, err := s.activeKey(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func deriveKey(secret string) [32]byte {
+	var key [32]byte
+	h := sha256.New()
+	h.Write([]byte(secret))
+	copy(key[:], h.Sum(nil))
+
+	return key
+}
+
+// Clone returns a copy of the store that uses newName for its cookie. The
+// copy has its own slices and key ring, so changing one store's keys or
+// attributes afterwards doesn't affect the other, but both share nonce state
+// since they share a key.
+func (s *Store) Clone(newName string) *Store {
+	n := s.copy()
+	n.Name = newName
+	n.OldKeys = append([][32]byte(nil), n.OldKeys...)
+	n.SigningKey = append([]byte(nil), n.SigningKey...)
+	n.ExtraAttributes = append([]string(nil), n.ExtraAttributes...)
+	n.AuthSections = append([]string(nil), n.AuthSections...)
+	if n.AllowedValueKeys != nil {
+		n.AllowedValueKeys = append([]string{}, n.AllowedValueKeys...)
+	}
+
+	if n.KeyRing != nil {
+		ring := make(map[string][32]byte, len(n.KeyRing))
+		for id, key := range n.KeyRing {
+			ring[id] = key
+		}
+		n.KeyRing = ring
+	}
+
+	return n
+}
+
+// Scope returns a copy of the store, as with Clone, for a separate logical
+// session kept in the cookie name, such as preferences alongside a login,
+// with a TTL of its own. It doesn't derive the key again, but name is mixed
+// into it like Environment, so that cookies from one scope aren't accepted
+// by another or by the original store.
+func (s *Store) Scope(name string, ttl time.Duration) *Store {
+	n := s.Clone(name)
+	n.TTL = ttl
+	n.TTLFunc = nil
+	n.RememberName = ""
+	n.Environment = s.Environment + "\x00" + name
+
+	return n
+}
+
+// WithName returns a shallow copy of the store that uses name for its cookie.
+// Key is copied by value, but slices such as OldKeys are shared with the
+// original; use Clone for a copy that can be changed independently.
+func (s *Store) WithName(name string) *Store {
+	n := s.copy()
+	n.Name = name
+
+	return n
+}
+
+// copy returns a shallow copy of the store, made field by field under the
+// configuration lock rather than by copying the struct, since the lock, the
+// nonce state and the age warning are changed concurrently by requests in
+// flight. The copy shares the lock and nonce state.
+func (s *Store) copy() *Store {
+	mu := s.lock()
+	mu.RLock()
+	defer mu.RUnlock()
+
+	n := &Store{
+		Name:             s.Name,
+		Secret:           s.Secret,
+		HttpOnly:         s.HttpOnly,
+		Secure:           s.Secure,
+		OmitPath:         s.OmitPath,
+		BindName:         s.BindName,
+		StrictFormat:     s.StrictFormat,
+		ExtraAttributes:  s.ExtraAttributes,
+		TTL:              s.TTL,
+		SessionCookie:    s.SessionCookie,
+		AllowInvalidSave: s.AllowInvalidSave,
+		Audience:         s.Audience,
+		Key:              s.Key,
+		OldKeys:          s.OldKeys,
+		MaxOldKeys:       s.MaxOldKeys,
+		IDGenerator:      s.IDGenerator,
+		Now:              s.Now,
+		KeyDerivation:    s.KeyDerivation,
+		Path:             s.Path,
+		Domain:           s.Domain,
+		SameSite:         s.SameSite,
+		Partitioned:      s.Partitioned,
+		Environment:      s.Environment,
+		KeyRing:          s.KeyRing,
+		ActiveKeyID:      s.ActiveKeyID,
+		SigningKey:       s.SigningKey,
+		PublicExpiry:     s.PublicExpiry,
+		PublicSID:        s.PublicSID,
+		MetadataKey:      s.MetadataKey,
+		TTLFunc:          s.TTLFunc,
+		TimeGranularity:  s.TimeGranularity,
+		PreserveTime:     s.PreserveTime,
+		GracePeriod:      s.GracePeriod,
+		IdleTimeout:      s.IdleTimeout,
+		AbsoluteTimeout:  s.AbsoluteTimeout,
+		RenewEvery:       s.RenewEvery,
+		ClockSkew:        s.ClockSkew,
+		AutoSecure:       s.AutoSecure,
+		BindTLS:          s.BindTLS,
+		RequireSecure:    s.RequireSecure,
+		IsSecure:         s.IsSecure,
+		Binding:          s.Binding,
+		Rand:             s.Rand,
+		DetectNonceReuse: s.DetectNonceReuse,
+		CounterNonces:    s.CounterNonces,
+		UserEpoch:        s.UserEpoch,
+		CheckSeq:         s.CheckSeq,
+		LegacyDecoder:    s.LegacyDecoder,
+		Cipher:           s.Cipher,
+		Compression:      s.Compression,
+		ChunkSize:        s.ChunkSize,
+		MaxChunkedSize:   s.MaxChunkedSize,
+		MaxSize:          s.MaxSize,
+		Encoding:         s.Encoding,
+		Codec:            s.Codec,
+		DecodeCache:      s.DecodeCache,
+		CompactJWE:       s.CompactJWE,
+		PadTo:            s.PadTo,
+		MaxFlashes:       s.MaxFlashes,
+		CSRFHeader:       s.CSRFHeader,
+		CSRFField:        s.CSRFField,
+		AuthSections:     s.AuthSections,
+		RegenerateFlags:  s.RegenerateFlags,
+		MaxImpersonation: s.MaxImpersonation,
+		Revoker:          s.Revoker,
+		Backend:          s.Backend,
+		StateCodec:       s.StateCodec,
+		AllowedValueKeys: s.AllowedValueKeys,
+		AltHeader:        s.AltHeader,
+		BearerAuth:       s.BearerAuth,
+		HandoffKey:       s.HandoffKey,
+		HandoffTTL:       s.HandoffTTL,
+		HandoffAudience:  s.HandoffAudience,
+		RememberName:     s.RememberName,
+		CheckRemember:    s.CheckRemember,
+		OnError:          s.OnError,
+		OnCreate:         s.OnCreate,
+		OnDecodeError:    s.OnDecodeError,
+		OnExpire:         s.OnExpire,
+		OnSave:           s.OnSave,
+		OnClear:          s.OnClear,
+		BeforeSave:       s.BeforeSave,
+		GuardState:       s.GuardState,
+		Logger:           s.Logger,
+		closed:           s.closed,
+		warnedAge:        atomic.LoadUint32(&s.warnedAge),
+	}
+
+	n.mu.Store(mu)
+
+	noncesMu.Lock()
+	n.nonces, n.counter = s.nonces, s.counter
+	noncesMu.Unlock()
+
+	return n
+}
+
+// Namespaced returns a copy of the store, as with WithName, whose cookie name
+// is prefixed with prefix, to keep related cookies grouped and easy to tell
+// apart. A __Host- or __Secure- prefix stays at the front of the name.
+func (s *Store) Namespaced(prefix string) *Store {
+	for _, p := range []string{"__Host-", "__Secure-"} {
+		if strings.HasPrefix(s.Name, p) {
+			return s.WithName(p + prefix + strings.TrimPrefix(s.Name, p))
+		}
+	}
+
+	return s.WithName(prefix + s.Name)
+}
+
+// Rotate makes newSecret the primary secret. The previous key is kept at the
+// front of OldKeys so existing sessions can still be read, and OldKeys is
+// trimmed to MaxOldKeys (or DefaultMaxOldKeys if that's zero).
+func (s *Store) Rotate(newSecret string) {
+	key := s.deriveKey(newSecret)
+
+	mu := s.lock()
+	mu.Lock()
+	defer mu.Unlock()
+
+	oldKeys := append([][32]byte{s.Key}, s.OldKeys...)
+
+	max := s.MaxOldKeys
+	if max == 0 {
+		max = DefaultMaxOldKeys
+	}
+	if len(oldKeys) > max {
+		oldKeys = oldKeys[:max]
+	}
+
+	s.OldKeys = oldKeys
+	s.Secret = newSecret
+	s.Key = key
+}
+
+// AddRotatedSecret adds a key derived from secret to the end of OldKeys, so
+// that sessions sealed under a secret that's since been replaced can still be
+// read. Save keeps sealing with Key. Unlike Rotate, it doesn't trim OldKeys.
+func (s *Store) AddRotatedSecret(secret string) {
+	key := s.deriveKey(secret)
+
+	mu := s.lock()
+	mu.Lock()
+	defer mu.Unlock()
+
+	s.OldKeys = append(s.OldKeys, key)
+}
+
+// now returns the current time from Now, if it's set.
+func (s *Store) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+
+	return time.Now()
+}
+
+// newID returns a fresh SID from IDGenerator. s may be nil, for sessions that
+// don't belong to a store.
+func (s *Store) newID() uuid.UUID {
+	switch {
+	case s == nil:
+		return UUIDv4.NewID(rand.Reader, time.Now())
+	case s.IDGenerator != nil:
+		return s.IDGenerator.NewID(s.rand(), s.now())
+	}
+
+	return UUIDv4.NewID(s.rand(), s.now())
+}
+
+// ttl returns the lifetime of ss, from TTLFunc if it's set.
+func (s *Store) ttl(ss *Session) time.Duration {
+	if s.TTLFunc != nil {
+		return s.TTLFunc(ss)
+	}
+
+	return s.settings().ttl
+}
+
+func (s *Store) timeGranularity() time.Duration {
+	if s.TimeGranularity < time.Second {
+		return time.Second
+	}
+
+	return s.TimeGranularity
+}
+
+func (s *Store) clockSkew() time.Duration {
+	switch {
+	case s.ClockSkew == 0:
+		return DefaultClockSkew
+	case s.ClockSkew < 0:
+		return 0
+	}
+
+	return s.ClockSkew
+}
+
+func (s *Store) rand() io.Reader {
+	if s.Rand != nil {
+		return s.Rand
+	}
+
+	return rand.Reader
+}
+
+func (s *Store) fresh() Session {
+	return Session{SID: s.newID(), store: s}
+}
+
+func (s *Store) path() string {
+	return s.settings().path
+}
+
+func (s *Store) Get(r *http.Request) Session {
+	ss, _ := s.GetContext(r.Context(), r)
+
+	return ss
+}
+
+// GetContext is like Get, but passes ctx to any callbacks involved in loading
+// the session and reports why an existing cookie couldn't be used. A request
+// without a session cookie gets a fresh session and no error.
+func (s *Store) GetContext(ctx context.Context, r *http.Request) (Session, error) {
+	ss, ok, err := s.load(ctx, r)
+	if !ok || err != nil {
+		return s.created(r), err
+	}
+
+	return ss, nil
+}
+
+// GetE is like Get, but reports why an existing cookie couldn't be used, as
+// one of the package's errors such as ErrExpired, ErrDecryptFailed or
+// ErrMalformed, so that tampering can be told apart from a new visitor. A
+// request without a session cookie gets a fresh session and no error.
+func (s *Store) GetE(r *http.Request) (Session, error) {
+	return s.GetContext(r.Context(), r)
+}
+
+// TryGet is like Get, but when the request has no usable session it returns
+// false instead of minting a fresh session, leaving that to the caller. A
+// session restored from a remember-me cookie is new, so it's returned along
+// with false.
+func (s *Store) TryGet(r *http.Request) (Session, bool) {
+	ss, ok, err := s.load(r.Context(), r)
+	if !ok || err != nil {
+		return Session{}, false
+	}
+
+	return ss, ss.Valid
+}
+
+// GetOrCreate is like Get, but also reports whether the session was freshly
+// created because the request had no usable session, which includes
+// sessions restored from a remember-me cookie.
+func (s *Store) GetOrCreate(r *http.Request) (Session, bool) {
+	ss, ok, err := s.load(r.Context(), r)
+	if !ok || err != nil {
+		return s.created(r), true
+	}
+
+	return ss, !ss.Valid
+}
+
+// GetFromQuery is like Get, but reads the session from the named query
+// parameter instead of the cookie, for one-time links such as magic logins.
+// URLs end up in logs, browser history and Referer headers, so only use this
+// with short-lived, single-use tokens, and save the session as a cookie
+// straight away.
+func (s *Store) GetFromQuery(r *http.Request, param string) Session {
+	value := r.URL.Query().Get(param)
+	if value == "" {
+		return s.created(r)
+	}
+
+	ss, err := s.loadValue(r.Context(), r, value)
+	if err != nil {
+		return s.created(r)
+	}
+
+	return ss
+}
+
+// altValue returns the session value carried by r outside of the cookie, in
+// AltHeader or, with BearerAuth, the Authorization header.
+func (s *Store) altValue(r *http.Request) string {
+	if s.AltHeader != "" {
+		if value := r.Header.Get(s.AltHeader); value != "" {
+			return value
+		}
+	}
+
+	if s.BearerAuth {
+		if auth := r.Header.Get("Authorization"); len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+			return strings.TrimSpace(auth[7:])
+		}
+	}
+
+	return ""
+}
+
+// Token prepares ss for saving exactly as Save does, but returns the sealed
+// value on its own, for clients that carry the session in an Authorization
+// header instead of a cookie. Values are never split into chunks.
+func (s *Store) Token(ss *Session) (string, error) {
+	c, next, err := s.cookie(nil, ss)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.commit(context.Background(), ss, next); err != nil {
+		return "", err
+	}
+
+	return c.Value, nil
+}
+
+// GetFromToken decodes a session from a value made by Token or Save, and
+// checks it like Get would, reporting why it can't be used if it can't.
+// Checks that need the request, like BindTLS, fail.
+func (s *Store) GetFromToken(token string) (Session, error) {
+	r := &http.Request{Header: http.Header{}}
+
+	ss, err := s.loadValue(context.Background(), r, token)
+	if err != nil {
+		return s.fresh(), err
+	}
+
+	return ss, nil
+}
+
+// HasCookie reports whether the request carries a non-empty session value
+// anywhere Get would look for one: the session cookie, the remember-me
+// cookie, AltHeader or, with BearerAuth, the Authorization header. Nothing is
+// decrypted, so the value may still turn out to be unusable.
+func (s *Store) HasCookie(r *http.Request) bool {
+	for _, c := range r.Cookies() {
+		if (c.Name == s.Name || c.Name == s.rememberName()) && c.Value != "" {
+			return true
+		}
+	}
+
+	return s.altValue(r) != ""
+}
+
+// load decodes the session from the request's cookie. It returns false if
+// the request has no session cookie at all. Overlapping paths or domains can
+// lead to a request carrying several cookies with the same name, in which
+// case the first one holding a usable session wins, and otherwise the error
+// from the first one is returned.
+func (s *Store) load(ctx context.Context, r *http.Request) (Session, bool, error) {
+	if s.isClosed() {
+		return Session{}, false, ErrStoreClosed
+	}
+
+	var found bool
+	var firstErr error
+
+	for _, c := range r.Cookies() {
+		if c.Name != s.Name {
+			continue
+		}
+
+		found = true
+
+		value, err := s.unchunk(r, c.Value)
+		if err == nil {
+			var ss Session
+			if ss, err = s.loadValue(ctx, r, value); err == nil {
+				return ss, true, nil
+			}
+
+			s.rejected(r, &ss, err)
+		} else {
+			s.rejected(r, nil, err)
+		}
+
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if !found {
+		if ss, ok := s.remembered(ctx, r); ok {
+			return ss, true, nil
+		}
+
+		if value := s.altValue(r); value != "" {
+			ss, err := s.loadValue(ctx, r, value)
+			if err == nil {
+				return ss, true, nil
+			}
+
+			s.rejected(r, &ss, err)
+
+			return Session{}, true, err
+		}
+	}
+
+	return Session{}, found, firstErr
+}
+
+// loadValue decodes value for r. Like decode, it returns expired sessions
+// along with ErrExpired.
+func (s *Store) loadValue(ctx context.Context, r *http.Request, value string) (Session, error) {
+	if s.RequireSecure {
+		if err := s.checkTransport(r); err != nil {
+			return Session{}, err
+		}
+	}
+
+	ss, err := s.decode(ctx, value)
+	if err != nil {
+		return ss, err
+	}
+
+	if err := s.accept(r, &ss); err != nil {
+		return Session{}, err
+	}
+
+	return ss, nil
+}
+
+// accept checks a decoded and checked session against r's TLS and client
+// bindings, and ties it to the store, wiping its State if it's rejected.
+func (s *Store) accept(r *http.Request, ss *Session) error {
+	if s.BindTLS {
+		if err := s.checkTLS(r, ss); err != nil {
+			if s.Backend == nil {
+				wipe(ss.State)
+			}
+			return err
+		}
+	}
+
+	if s.Binding != nil {
+		if err := s.checkClient(r, ss); err != nil {
+			if s.Backend == nil {
+				wipe(ss.State)
+			}
+			return err
+		}
+	}
+
+	if s.GuardState {
+		guardState(ss)
+	}
+
+	ss.store = s
+
+	return nil
+}
+
+// decode decodes value and checks it. Expired sessions are returned along
+// with ErrExpired, without their State, for OnExpire.
+func (s *Store) decode(ctx context.Context, value string) (Session, error) {
+	ss, err := s.DecodeValue(value)
+	if err != nil {
+		return Session{}, err
+	}
+
+	if err := s.check(ctx, &ss); err != nil {
+		wipe(ss.State)
+		if errors.Is(err, ErrExpired) {
+			ss.State = nil
+			return ss, err
+		}
+		return Session{}, err
+	}
+
+	return ss, nil
+}
+
+// Decode decrypts and decodes a cookie value, and checks that the session is
+// still acceptable in the same way that Get does, apart from anything that
+// needs the request itself.
+func (s *Store) Decode(value string) (Session, error) {
+	ss, err := s.decode(context.Background(), value)
+	if err != nil {
+		return Session{}, err
+	}
+
+	return ss, nil
+}
+
+// DecodeAll decodes each of values like Decode, returning the sessions and
+// errors in slices parallel to values.
+func (s *Store) DecodeAll(values []string) ([]Session, []error) {
+	sessions := make([]Session, len(values))
+	errs := make([]error, len(values))
+
+	scratch := make([]byte, 0, 512)
+
+	for i, value := range values {
+		ss, b, err := s.decodeValue(scratch, value)
+		scratch = b
+
+		if err == nil {
+			err = s.check(context.Background(), &ss)
+		}
+
+		if err != nil {
+			wipe(ss.State)
+			errs[i] = err
+			continue
+		}
+
+		sessions[i] = ss
+	}
+
+	return sessions, errs
+}
+
+// DecodeInto is like Decode, but resets and fills in ss rather than
+// returning a new session, and reuses the buffer from the last time ss was
+// decoded into where it's big enough. The decoded State refers to that
+// buffer, so it's only good until ss is next passed to DecodeInto; copy it if
+// it needs to live longer.
+func (s *Store) DecodeInto(value string, ss *Session) error {
+	if s.CompactJWE || s.publicMetadata() {
+		out, err := s.Decode(value)
+		if err != nil {
+			*ss = Session{buf: ss.buf}
+			return err
+		}
+
+		out.buf = ss.buf
+		*ss = out
+
+		return nil
+	}
+
+	*ss = Session{buf: ss.buf}
+
+	size := decodedLen(len(value))
+	if size < 24+secretbox.Overhead {
+		return ErrTooShort
+	}
+
+	if cap(ss.buf) < size+size-24-secretbox.Overhead {
+		ss.buf = make([]byte, size+size-24-secretbox.Overhead)
+	}
+
+	buf, err := s.openInto(purposeSession, ss.buf[:size], ss.buf[size:size], value)
+	if err != nil {
+		return err
+	}
+
+	if err := s.unmarshalValue(buf, ss); err != nil {
+		wipe(ss.buf)
+		*ss = Session{buf: ss.buf}
+		return err
+	}
+
+	if err := s.check(context.Background(), ss); err != nil {
+		wipe(ss.buf)
+		*ss = Session{buf: ss.buf}
+		return err
+	}
+
+	return nil
+}
+
+// Verify reports whether value is a session sealed by this store that hasn't
+// expired, and returns its SID. It's cheaper than Decode for callers that
+// only need to know a cookie is authentic: it doesn't consult UserEpoch,
+// CheckSeq or claims, and the decrypted state is wiped rather than returned.
+func (s *Store) Verify(value string) (uuid.UUID, bool) {
+	ss, err := s.peek(value)
+	if err != nil {
+		return uuid.UUID{}, false
+	}
+
+	return ss.SID, true
+}
+
+// UID returns the UID of the request's session, checking its age and its
+// TLS and client bindings but, like Verify, nothing else. It's meant for
+// authorization middleware that only needs to know who the user is.
+func (s *Store) UID(r *http.Request) (uuid.UUID, bool) {
+	for _, c := range r.Cookies() {
+		if c.Name != s.Name {
+			continue
+		}
+
+		ss, err := s.peek(c.Value)
+		if err != nil {
+			continue
+		}
+
+		if s.BindTLS && s.checkTLS(r, &ss) != nil {
+			continue
+		}
+
+		if s.Binding != nil && s.checkClient(r, &ss) != nil {
+			continue
+		}
+
+		return ss.UID, true
+	}
+
+	return uuid.UUID{}, false
+}
+
+// peek decodes value and checks its age, wiping its State.
+func (s *Store) peek(value string) (Session, error) {
+	ss, _, err := s.decodeValue(nil, value)
+	if err != nil {
+		return Session{}, err
+	}
+
+	wipe(ss.State)
+	ss.State = nil
+
+	if err := s.checkExpiry(&ss); err != nil {
+		return Session{}, err
+	}
+
+	return ss, nil
+}
+
+// CanDecode reports whether s can read sessions saved by other, by sealing a
+// probe session with other and opening it with s. It's meant for startup
+// checks in deployments where several services share cookies, where a
+// mismatched key or option would otherwise only show up as logged out users.
+func (s *Store) CanDecode(other *Store) bool {
+	probe := Session{SID: other.newID(), Time: s.now(), State: []byte("probe")}
+
+	value, err := other.encode(&probe)
+	if err != nil {
+		return false
+	}
+
+	ss, err := s.DecodeValue(value)
+
+	if err != nil || ss.SID != probe.SID {
+		return false
+	}
+
+	// With a Backend, State never makes it into the cookie.
+	return other.Backend != nil || string(ss.State) == "probe"
+}
+
+// DecodeValue decrypts and decodes a cookie value, without checking whether
+// the session has expired or consulting any callbacks. It's meant for
+// inspecting values offline; the session expires at ss.Time.Add(s.TTL).
+func (s *Store) DecodeValue(value string) (Session, error) {
+	ss, _, err := s.decodeValue(nil, value)
+
+	return ss, err
+}
+
+// decodeValue opens value with openPayload and decodes the session inside.
+func (s *Store) decodeValue(scratch []byte, value string) (Session, []byte, error) {
+	var scope [32]byte
+	if s.DecodeCache != nil {
+		scope = s.cacheScope()
+		if ss, ok := s.DecodeCache.get(scope, value, s.now()); ok {
+			return ss, scratch, nil
+		}
+	}
+
+	buf, scratch, err := s.openPayload(scratch, value)
+	if err != nil {
+		return Session{}, scratch, err
+	}
+
+	var ss Session
+	if err := s.unmarshalValue(buf, &ss); err != nil {
+		wipe(buf)
+		return Session{}, scratch, err
+	}
+
+	if s.DecodeCache != nil {
+		s.DecodeCache.add(scope, value, ss, s.now())
+	}
+
+	return ss, scratch, nil
+}
+
+// openPayload reverses sealPayload as far as the name binding, checking
+// public metadata and opening the value as a JWE or with openValue.
+func (s *Store) openPayload(scratch []byte, value string) ([]byte, []byte, error) {
+	var meta string
+	if s.publicMetadata() {
+		var err error
+		if _, meta, value, err = splitMetadata(value, s.MetadataKey); err != nil {
+			return nil, scratch, err
+		}
+	}
+
+	var buf []byte
+	var err error
+	if s.CompactJWE {
+		buf, err = s.openJWE(value)
+	} else {
+		buf, scratch, err = s.openValue(purposeSession, scratch, value)
+	}
+	if err != nil {
+		return nil, scratch, err
+	}
+
+	if s.publicMetadata() {
+		plain := buf
+		if buf, err = unbindName(meta, buf); err != nil {
+			wipe(plain)
+			if err == ErrNameMismatch {
+				err = ErrBadMetadata
+			}
+			return nil, scratch, err
+		}
+	}
+
+	return buf, scratch, nil
+}
+
+// unmarshalValue decodes the plaintext of a cookie value into ss.
+func (s *Store) unmarshalValue(buf []byte, ss *Session) error {
+	buf, err := s.unbind(buf)
+	if err != nil {
+		return err
+	}
+
+	if s.StrictFormat && len(buf) > 0 && buf[0] == formatLegacy {
+		return ErrUnknownVersion
+	}
+
+	if err := ss.UnmarshalBinary(buf); err != nil {
+		if s.LegacyDecoder == nil {
+			return err
+		}
+
+		legacy, ok := s.LegacyDecoder(buf)
+		if !ok {
+			return err
+		}
+
+		b := ss.buf
+		*ss = *legacy
+		ss.buf = b
+		ss.Valid = true
+		ss.dirty = true
+
+		return nil
+	}
+
+	return s.decodeState(ss)
+}
+
+// unbind checks and strips the cookie name that BindName binds plaintexts
+// to, and decompresses what's left.
+func (s *Store) unbind(buf []byte) ([]byte, error) {
+	if s.BindName {
+		var err error
+		if buf, err = unbindName(s.Name, buf); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.decompress(buf)
+}
+
+// decodeState reverses the StateCodec applied by marshal.
+func (s *Store) decodeState(ss *Session) error {
+	if s.StateCodec != nil && s.Backend == nil {
+		state, err := s.StateCodec.Decode(ss.State)
+		if err != nil {
+			return errors.New("couldn't decode state: " + err.Error())
+		}
+
+		ss.State = state
+	}
+
+	return nil
+}
+
+// check reports whether a decoded session is still acceptable.
+func (s *Store) check(ctx context.Context, ss *Session) error {
+	if err := s.checkExpiry(ss); err != nil {
+		return err
+	}
+
+	if s.UserEpoch != nil {
+		epoch, err := s.UserEpoch(ctx, ss.UID)
+		if err != nil {
+			return fmt.Errorf("couldn't get user epoch: %w", err)
+		}
+
+		if ss.Epoch != epoch {
+			return ErrEpochMismatch
+		}
+	}
+
+	if s.MaxImpersonation > 0 && ss.IsImpersonating() && s.now().Sub(ss.ImpersonatedAt) > s.MaxImpersonation {
+		ss.StopImpersonating()
+	}
+
+	if s.CheckSeq != nil && !s.CheckSeq(ss.SID, ss.Seq) {
+		return ErrReplayed
+	}
+
+	if s.Revoker != nil && s.Revoker.IsRevoked(ss.SID) {
+		return ErrRevoked
+	}
+
+	if err := s.checkClaims(ss); err != nil {
+		return err
+	}
+
+	if s.Backend != nil {
+		state, err := s.Backend.Load(ctx, ss.SID)
+		if err != nil {
+			return fmt.Errorf("couldn't load session state: %w", err)
+		}
+
+		ss.State = state
+	}
+
+	return nil
+}
+
+// checkExpiry reports whether a decoded session has expired. A session with
+// an explicit ExpiresAt lasts until then, regardless of TTL. Sessions saved
+// further in the future than ClockSkew allows, by a server whose clock was
+// wrong, are rejected too, since otherwise they'd last far longer than TTL.
+func (s *Store) checkExpiry(ss *Session) error {
+	if ss.Time.After(s.now().Add(s.clockSkew())) {
+		return ErrFutureSession
+	}
+
+	if !ss.ExpiresAt.IsZero() {
+		if s.now().After(ss.ExpiresAt.Add(s.clockSkew())) {
+			return ErrExpired
+		}
+	} else if ttl := s.ttl(ss); ttl > 0 || !s.SessionCookie {
+		if age := s.now().Sub(ss.Time); age > ttl+s.clockSkew()+s.GracePeriod {
+			return ErrExpired
+		} else if age > ttl+s.clockSkew() {
+			ss.Stale = true
+		}
+	}
+
+	if d := s.timeoutDeadline(ss); !d.IsZero() && s.now().After(d.Add(s.clockSkew())) {
+		return ErrExpired
+	}
+
+	return nil
+}
+
+// timeoutDeadline returns when ss runs out of IdleTimeout or AbsoluteTimeout,
+// whichever comes first, or the zero time if neither is set.
+func (s *Store) timeoutDeadline(ss *Session) time.Time {
+	var d time.Time
+
+	if s.IdleTimeout > 0 {
+		d = ss.Time.Add(s.IdleTimeout)
+	}
+
+	if s.AbsoluteTimeout > 0 && !ss.Created.IsZero() {
+		if a := ss.Created.Add(s.AbsoluteTimeout); d.IsZero() || a.Before(d) {
+			d = a
+		}
+	}
+
+	return d
+}
+
+// openValue base64 decodes value into scratch, growing it if necessary,
+// decrypts it under the key for purpose, and returns scratch for reuse. The plaintext gets its own
+// allocation, since a decoded session's State refers to it. Without scratch,
+// the decoded value and the plaintext share one allocation.
+func (s *Store) openValue(purpose string, scratch []byte, value string) ([]byte, []byte, error) {
+	size := decodedLen(len(value))
+	if size < 24+secretbox.Overhead {
+		return nil, scratch, ErrTooShort
+	}
+
+	var raw, out []byte
+	if scratch != nil {
+		if cap(scratch) < size {
+			scratch = make([]byte, size)
+		}
+
+		raw = scratch[:size]
+		out = make([]byte, 0, size-24-secretbox.Overhead)
+	} else {
+		raw = make([]byte, size+size-24-secretbox.Overhead)
+		raw, out = raw[:size], raw[size:size]
+	}
+
+	buf, err := s.openInto(purpose, raw, out, value)
+
+	return buf, scratch, err
+}
+
+// openInto base64 decodes value into raw, which must be big enough, then
+// verifies and decrypts it under the key for purpose, appending the plaintext
+// to out.
+func (s *Store) openInto(purpose string, raw, out []byte, value string) ([]byte, error) {
+	if s.isClosed() {
+		return nil, ErrStoreClosed
+	}
+
+	c, value, err := s.splitCipher(value)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := valueEncoding(value).Decode(raw, []byte(value))
+	if err != nil {
+		return nil, ErrBadEncoding
+	} else if n < 24+secretbox.Overhead {
+		return nil, ErrTooShort
+	}
+
+	if sk := s.signingKey(); sk != nil {
+		defer wipe(sk)
+
+		if n < 24+secretbox.Overhead+sha256.Size {
+			return nil, ErrTooShort
+		}
+
+		if n -= sha256.Size; !verify(sk, raw[:n], raw[n:n+sha256.Size]) {
+			return nil, ErrBadSignature
+		}
+	}
+
+	if s.KeyRing != nil {
+		key, encrypted, err := s.ringKey(raw[:n])
+		if err != nil {
+			return nil, err
+		} else if len(encrypted) < 24+secretbox.Overhead {
+			return nil, ErrTooShort
+		}
+
+		var nonce [24]byte
+		copy(nonce[:], encrypted[:24])
+
+		key = s.purposeKey(key, purpose)
+		buf, ok := c.Open(out, encrypted[24:], &nonce, &key)
+		if !ok {
+			return nil, ErrDecryptFailed
+		}
+
+		return buf, nil
+	}
+
+	buf, ok := s.openBox(purpose, c, out, raw[:n])
+	if !ok {
+		return nil, ErrDecryptFailed
+	}
+
+	return buf, nil
+}
+
+// openBox decrypts encrypted with c under the key for purpose derived from
+// Key, falling back to each of OldKeys in turn, and appends the plaintext to
+// out. The leading 24 bytes are
+// the nonce. It isn't covered by the MAC directly, but each cipher derives
+// its authentication from it, so a nonce taken from any other value makes
+// Open fail rather than produce garbage.
+func (s *Store) openBox(purpose string, c Cipher, out, encrypted []byte) ([]byte, bool) {
+	var nonce [24]byte
+	copy(nonce[:], encrypted[:24])
+
+	for i := 0; ; i++ {
+		key, ok := s.keyAt(i)
+		if !ok {
+			return nil, false
+		}
+
+		key = s.purposeKey(key, purpose)
+		if buf, ok := c.Open(out, encrypted[24:], &nonce, &key); ok {
+			return buf, true
+		}
+	}
+}
+
+// envKey returns key mixed with Environment, if it's set, so that values
+// sealed for one environment can't be opened in another.
+func (s *Store) envKey(key [32]byte) [32]byte {
+	if s.Environment == "" {
+		return key
+	}
+
+	mac := hmac.New(sha256.New, key[:])
+	mac.Write([]byte(s.Environment))
+	copy(key[:], mac.Sum(nil))
+
+	return key
+}
+
+// Values sealed for different purposes are sealed under different keys, so
+// that one can never be passed off as another. Sessions use the store's key
+// as it is, so that existing cookies stay readable.
+const (
+	purposeSession  = ""
+	purposeToken    = "token"
+	purposeRemember = "remember"
+)
+
+// purposeKey returns key mixed with Environment, as envKey does, and then
+// with purpose, if it isn't purposeSession.
+func (s *Store) purposeKey(key [32]byte, purpose string) [32]byte {
+	key = s.envKey(key)
+	if purpose == purposeSession {
+		return key
+	}
+
+	mac := hmac.New(sha256.New, key[:])
+	mac.Write([]byte("cookiesession " + purpose))
+	copy(key[:], mac.Sum(nil))
+
+	return key
+}
+
+// bindName prefixes buf with the length-prefixed name, so that once sealed
+// the value can't be replayed under another name sharing the key.
+func bindName(name string, buf []byte) []byte {
+	out := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(name)+len(buf))
+	out = out[:binary.PutUvarint(out, uint64(len(name)))]
+	out = append(out, name...)
+	out = append(out, buf...)
+
+	return out
+}
+
+func unbindName(name string, buf []byte) ([]byte, error) {
+	n, l := binary.Uvarint(buf)
+	if l <= 0 || n > uint64(len(buf)-l) {
+		return nil, ErrTooShort
+	}
+
+	if string(buf[l:l+int(n)]) != name {
+		return nil, ErrNameMismatch
+	}
+
+	return buf[l+int(n):], nil
+}
+
+// marshal returns the binary encoding of ss, padded to a multiple of padTo,
+// with State left out if it's kept by the Backend or encoded with StateCodec
+// otherwise.
+func (s *Store) marshal(ss *Session, padTo int) ([]byte, error) {
+	if s.Backend != nil {
+		c := *ss
+		c.State = nil
+		ss = &c
+	} else if s.StateCodec != nil {
+		state, err := s.StateCodec.Encode(ss.State)
+		if err != nil {
+			return nil, errors.New("couldn't encode state: " + err.Error())
+		}
+
+		c := *ss
+		c.State = state
+		ss = &c
+	}
+
+	buf, err := ss.marshalTo(nil, padTo)
+	if err != nil {
+		return nil, errors.New("couldn't encode session: " + err.Error())
+	}
+
+	return buf, nil
+}
+
+func (s *Store) encode(ss *Session) (string, error) {
+	buf, err := s.marshal(ss, s.PadTo)
+	if err != nil {
+		return "", err
+	}
+
+	return s.sealPayload(ss, buf)
+}
+
+// sealPayload compresses, binds and seals buf, a marshalled session or
+// multi-session, wiping it. ss supplies the public metadata and JWE claims.
+func (s *Store) sealPayload(ss *Session, buf []byte) (string, error) {
+	compressed, err := s.compress(buf)
+	if err != nil {
+		wipe(buf)
+		return "", err
+	}
+	if compressed != nil {
+		wipe(buf)
+		buf = compressed
+	}
+
+	if s.BindName {
+		bound := bindName(s.Name, buf)
+		wipe(buf)
+		buf = bound
+	}
+
+	var meta string
+	if s.publicMetadata() {
+		meta = s.metadata(ss)
+
+		bound := bindName(meta, buf)
+		wipe(buf)
+		buf = bound
+	}
+
+	var value string
+	if s.CompactJWE {
+		value, err = s.sealJWE(ss, buf)
+	} else {
+		value, err = s.sealValue(purposeSession, buf)
+	}
+	wipe(buf)
+
+	if err == nil && s.publicMetadata() {
+		value = s.addMetadata(meta, value)
+	}
+
+	return value, err
+}
+
+// sealValue encrypts buf under a random nonce, with the key for purpose, and
+// returns the base64 encoding of the nonce and ciphertext. The sealed bytes are written into the tail of the
+// same allocation that the encoding is written into.
+func (s *Store) sealValue(purpose string, buf []byte) (string, error) {
+	if s.isClosed() {
+		return "", ErrStoreClosed
+	}
+
+	nonce, err := s.nonce()
+	if err != nil {
+		return "", errors.New("couldn't get random nonce: " + err.Error())
+	}
+
+	if s.DetectNonceReuse && !s.nonceSet().add(nonce) {
+		return "", ErrNonceReuse
+	}
+
+	key, prefix, err := s.activeKey()
+	if err != nil {
+		return "", err
+	}
+	key = s.purposeKey(key, purpose)
+
+	c := s.cipher()
+	id := c.ID()
+	if id != "" {
+		id += "~"
+	}
+
+	sk := s.signingKey()
+	defer wipe(sk)
+
+	n := len(prefix) + 24 + len(buf) + c.Overhead()
+	if sk != nil {
+		n += sha256.Size
+	}
+	enc := s.encoding()
+	e := len(id) + enc.EncodedLen(n)
+
+	out := make([]byte, e+n)
+	sealed := append(append(out[e:e], prefix...), nonce[:]...)
+	sealed = c.Seal(sealed, buf, &nonce, &key)
+	if sk != nil {
+		sealed = sign(sk, sealed)
+	}
+	copy(out, id)
+	enc.Encode(out[len(id):e], sealed)
+
+	return string(out[:e]), nil
+}
+
+// sign appends an HMAC of sealed under key, the store's SigningKey.
+func sign(key, sealed []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(sealed)
+
+	return mac.Sum(sealed)
+}
+
+func verify(key, sealed, sum []byte) bool {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(sealed)
+
+	return hmac.Equal(mac.Sum(nil), sum)
+}
+
+// MintFor returns a cookie value for a new session belonging to uid, as if it
+// had been saved age ago. It's meant for tests of services that consume
+// these cookies, such as checking that near-expiry sessions are handled.
+func (s *Store) MintFor(uid uuid.UUID, state []byte, age time.Duration) (string, error) {
+	ss := s.fresh()
+	ss.Valid = true
+	ss.UID = uid
+	ss.RealUID = uid
+	ss.State = state
+	ss.Time = s.now().Add(-age)
+	ss.Created = ss.Time
+
+	if s.UserEpoch != nil {
+		epoch, err := s.UserEpoch(context.Background(), uid)
+		if err != nil {
+			return "", fmt.Errorf("couldn't get user epoch: %w", err)
+		}
+
+		ss.Epoch = epoch
+	}
+
+	return s.encode(&ss)
+}
+
+// EncodedSize returns the length of the cookie value that Save would produce
+// for ss, without writing anything or changing ss, so that it can be checked
+// against MaxSize before committing to a change.
+func (s *Store) EncodedSize(ss *Session) (int, error) {
+	c := *ss
+	if err := s.prepare(nil, &c); err != nil {
+		return 0, err
+	}
+
+	value, err := s.encode(&c)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(value), nil
+}
+
+// Save writes ss to rw as a cookie. Like any header, the cookie has to be set
+// before the response body is written, or net/http will silently drop it;
+// see SaveChecked for a way to catch that mistake.
+func (s *Store) Save(rw http.ResponseWriter, ss *Session) error {
+	_, err := s.saveToHeader(rw.Header(), nil, ss)
+
+	return err
+}
+
+// SaveFor is like Save, but makes the request available to BeforeSave.
+func (s *Store) SaveFor(rw http.ResponseWriter, r *http.Request, ss *Session) error {
+	_, err := s.saveToHeader(rw.Header(), r, ss)
+
+	return err
+}
+
+// SaveToHeader is like Save, but adds the Set-Cookie header to h instead of
+// a ResponseWriter's headers.
+func (s *Store) SaveToHeader(h http.Header, ss *Session) error {
+	_, err := s.saveToHeader(h, nil, ss)
+
+	return err
+}
+
+// SaveSession is like Save, but also returns the cookie it wrote, which is
+// mostly useful in tests. ExtraAttributes aren't part of the returned cookie.
+func (s *Store) SaveSession(rw http.ResponseWriter, ss *Session) (*http.Cookie, error) {
+	return s.saveToHeader(rw.Header(), nil, ss)
+}
+
+// SaveIfAbsent saves ss like SaveFor only if r doesn't already carry a valid
+// session, and reports whether it did. An existing cookie is left exactly as
+// it is, so its expiry isn't extended.
+func (s *Store) SaveIfAbsent(rw http.ResponseWriter, r *http.Request, ss *Session) (bool, error) {
+	if _, ok := s.TryGet(r); ok {
+		return false, nil
+	}
+
+	if err := s.SaveFor(rw, r, ss); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// SaveIfChanged saves ss like Save only if it's dirty or its cookie is due
+// to be refreshed, and reports whether it did, so that requests which don't
+// change the session don't each get a Set-Cookie header. A cookie is due to
+// be refreshed once it's older than RenewEvery, or if that's not set, once
+// half its lifetime has passed.
+func (s *Store) SaveIfChanged(rw http.ResponseWriter, ss *Session) (bool, error) {
+	return s.SaveIfChangedFor(rw, nil, ss)
+}
+
+// SaveIfChangedFor is like SaveIfChanged, but makes the request available as
+// SaveFor does.
+func (s *Store) SaveIfChangedFor(rw http.ResponseWriter, r *http.Request, ss *Session) (bool, error) {
+	if !ss.dirty && !s.refreshDue(ss) {
+		return false, nil
+	}
+
+	if err := s.SaveFor(rw, r, ss); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// refreshDue reports whether ss's cookie should be reissued to keep it from
+// expiring. Sessions with a fixed expiry or no lifetime never are.
+func (s *Store) refreshDue(ss *Session) bool {
+	if !ss.Valid || !ss.ExpiresAt.IsZero() {
+		return false
+	}
+
+	ttl := s.ttl(ss)
+
+	if s.RenewEvery > 0 {
+		return s.now().Sub(ss.Time) >= s.RenewEvery
+	}
+
+	return ttl > 0 && s.now().Sub(ss.Time) > ttl/2
+}
+
+// Touch reissues ss's cookie if it's due to be refreshed, as described for
+// SaveIfChanged, extending its lifetime, and reports whether it did. It
+// doesn't look at whether the session is dirty.
+func (s *Store) Touch(rw http.ResponseWriter, ss *Session) (bool, error) {
+	if !s.refreshDue(ss) {
+		return false, nil
+	}
+
+	if err := s.Save(rw, ss); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (s *Store) saveToHeader(h http.Header, r *http.Request, ss *Session) (*http.Cookie, error) {
+	c, next, err := s.cookie(r, ss)
+	if err != nil {
+		return nil, err
+	}
+
+	cookies, err := s.fitted(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.commit(contextOf(r), ss, next); err != nil {
+		return nil, err
+	}
+
+	s.addCookies(h, r, cookies)
+
+	if s.OnSave != nil {
+		s.OnSave(r, ss)
+	}
+
+	return cookies[0], nil
+}
+
+// fitted splits c into chunks if ChunkSize calls for it, and checks that
+// each of them fits in MaxSize.
+func (s *Store) fitted(c *http.Cookie) ([]*http.Cookie, error) {
+	cookies, err := s.chunk(c)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range cookies {
+		if !s.fits(c.Name, c.Value) {
+			return nil, ErrTooLarge
+		}
+	}
+
+	return cookies, nil
+}
+
+// addCookies adds Set-Cookie headers for cookies, with ExtraAttributes, along
+// with deletions for the chunks on r that they no longer use.
+func (s *Store) addCookies(h http.Header, r *http.Request, cookies []*http.Cookie) {
+	// Without the request there's no telling which chunks a shrunk session
+	// left behind, but they're ignored without a manifest naming them.
+	if r != nil {
+		cookies = append(cookies, s.staleChunks(r, len(cookies)-1)...)
+	}
+
+	for _, c := range cookies {
+		v := cookieString(c)
+		if v == "" {
+			continue
+		}
+
+		for _, attr := range s.ExtraAttributes {
+			v += "; " + attr
+		}
+
+		h.Add("Set-Cookie", v)
+	}
+}
+
+// cookie returns the cookie that would carry ss once saved, along with a copy
+// of ss stamped for saving. ss itself isn't changed until the copy is passed
+// to commit, so that a cookie that turns out not to fit changes nothing.
+//
+// Saving a fresh session that nothing has been done to is almost always a
+// mistake, so sessions must either be valid (loaded from a cookie or already
+// saved) or dirty, unless AllowInvalidSave is set.
+func (s *Store) cookie(r *http.Request, ss *Session) (*http.Cookie, *Session, error) {
+	next, err := s.stamp(r, ss)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	value, err := s.encode(next)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return s.finishCookie(r, next, value), next, nil
+}
+
+// stamp checks that ss can be saved and returns a copy of it prepared for
+// saving for r.
+func (s *Store) stamp(r *http.Request, ss *Session) (*Session, error) {
+	if ss.readOnly {
+		return nil, ErrReadOnly
+	}
+
+	if !ss.Valid && !ss.dirty && !s.AllowInvalidSave {
+		return nil, ErrSessionNotValid
+	}
+
+	for _, attr := range s.ExtraAttributes {
+		if !validAttribute(attr) {
+			return nil, ErrInvalidAttribute
+		}
+	}
+
+	if s.GuardState {
+		s.checkGuard(ss)
+	}
+
+	next := *ss
+	if err := s.prepare(r, &next); err != nil {
+		return nil, err
+	}
+
+	return &next, nil
+}
+
+// finishCookie returns the cookie carrying value for ss, as adjusted by
+// BeforeSave.
+func (s *Store) finishCookie(r *http.Request, ss *Session, value string) *http.Cookie {
+	c := s.newCookie(r, ss, value)
+
+	if s.BeforeSave != nil {
+		s.BeforeSave(r, c)
+	}
+
+	return c
+}
+
+// commit stores next's state with the Backend, if there is one, and then
+// makes ss the saved session next, valid and no longer dirty.
+func (s *Store) commit(ctx context.Context, ss, next *Session) error {
+	if s.Backend != nil {
+		if err := s.Backend.Store(ctx, next.SID, next.State); err != nil {
+			return fmt.Errorf("couldn't store session state: %w", err)
+		}
+	}
+
+	if next.guarded {
+		next.stateSum = sha256.Sum256(next.State)
+	}
+
+	next.Valid = true
+	next.dirty = false
+	*ss = *next
+
+	return nil
+}
+
+// contextOf returns r's context, or the background context if there's no
+// request.
+func contextOf(r *http.Request) context.Context {
+	if r == nil {
+		return context.Background()
+	}
+
+	return r.Context()
+}
+
+// prepare stamps ss as it's saved for r: with the user's current epoch, its
+// TLS and client bindings, the time, and the next sequence number.
+func (s *Store) prepare(r *http.Request, ss *Session) error {
+	if s.UserEpoch != nil {
+		epoch, err := s.UserEpoch(contextOf(r), ss.UID)
+		if err != nil {
+			return fmt.Errorf("couldn't get user epoch: %w", err)
+		}
+
+		ss.Epoch = epoch
+	}
+
+	if s.BindTLS {
+		if err := s.bindTLS(r, ss); err != nil {
+			return err
+		}
+	}
+
+	if s.Binding != nil {
+		if err := s.bindClient(r, ss); err != nil {
+			return err
+		}
+	}
+
+	if !s.PreserveTime || ss.Time.IsZero() {
+		ss.Time = s.now().Truncate(s.timeGranularity())
+	}
+	if ss.Created.IsZero() {
+		ss.Created = ss.Time
+	}
+	ss.Seq++
+
+	return nil
+}
+
+// newCookie builds the cookie carrying value, the encoding of ss.
+func (s *Store) newCookie(r *http.Request, ss *Session, value string) *http.Cookie {
+	cfg := s.settings()
+	ttl := s.ttl(ss)
+
+	c := &http.Cookie{
+		Path:     cfg.path,
+		Domain:   cfg.domain,
+		HttpOnly: cfg.httpOnly,
+		Secure:   cfg.secure,
+		SameSite: cfg.sameSite,
+		Name:     s.Name,
+		Expires:  ss.Time.Add(ttl),
+		MaxAge:   maxAge(ttl),
+		Value:    value,
+	}
+
+	setPartitioned(c, cfg.partitioned)
+
+	if s.SessionCookie {
+		c.Expires = time.Time{}
+		c.MaxAge = 0
+	}
+
+	if !ss.ExpiresAt.IsZero() {
+		c.Expires = ss.ExpiresAt
+		c.MaxAge = maxAge(ss.ExpiresAt.Sub(ss.Time))
+		if c.MaxAge <= 0 {
+			c.MaxAge = -1
+		}
+	}
+
+	if d := s.timeoutDeadline(ss); !d.IsZero() && !c.Expires.IsZero() && d.Before(c.Expires) {
+		c.Expires = d
+		c.MaxAge = maxAge(d.Sub(ss.Time))
+		if c.MaxAge <= 0 {
+			c.MaxAge = -1
+		}
+	}
+
+	if s.AutoSecure && r != nil {
+		c.Secure = r.TLS != nil
+		if c.Secure && c.SameSite == 0 {
+			c.SameSite = http.SameSiteLaxMode
+		}
+	}
+
+	if limit := ss.Time.Add(MaxCookieAge); c.Expires.After(limit) {
+		c.Expires = limit
+
+		if atomic.CompareAndSwapUint32(&s.warnedAge, 0, 1) {
+			s.logf("cookiesession: cookie %q outlives browsers' %s cap on cookie lifetimes, so it will expire early", s.Name, MaxCookieAge)
+		}
+	}
+
+	return c
+}
+
+func (s *Store) Clear(rw http.ResponseWriter) {
+	s.clear(rw, nil)
+}
+
+func (s *Store) clear(rw http.ResponseWriter, r *http.Request) {
+	setCookie(rw, s.deletion(s.path()))
+
+	for _, c := range s.staleChunks(nil, 0) {
+		setCookie(rw, c)
+	}
+
+	if s.OnClear != nil {
+		s.OnClear(r)
+	}
+}
+
+// ClearFromRequest deletes the session cookie like Clear, but only if r
+// carries one, and also deletes it from the root path if the store isn't
+// configured to use it. Browsers don't say where a cookie was set, so this
+// is a best effort at catching cookies left over from older configurations.
+func (s *Store) ClearFromRequest(rw http.ResponseWriter, r *http.Request) {
+	if _, err := r.Cookie(s.Name); err != nil {
+		return
+	}
+
+	if s.path() != "/" {
+		setCookie(rw, s.deletion("/"))
+	}
+
+	s.clear(rw, r)
+}
+
+// deletion returns a cookie that deletes the session cookie set at path.
+func (s *Store) deletion(path string) *http.Cookie {
+	cfg := s.settings()
+
+	c := &http.Cookie{
+		Path:     path,
+		Domain:   cfg.domain,
+		HttpOnly: cfg.httpOnly,
+		Secure:   cfg.secure,
+		SameSite: cfg.sameSite,
+		Name:     s.Name,
+		Expires:  time.Unix(0, 0),
+		MaxAge:   -1,
+		Value:    "",
+	}
+
+	setPartitioned(c, cfg.partitioned)
+	applyPrefixRules(c)
+
+	return c
+}
+
+// Rename moves the request's session from the Store's cookie name to newName,
+// writing the new cookie and deleting the old one in the same response. It
+// does nothing if the request has no valid session. The Store itself isn't
+// changed, so once the rename is rolled out it should be configured with
+// newName.
+func (s *Store) Rename(rw http.ResponseWriter, r *http.Request, newName string) error {
+	ss, ok := s.TryGet(r)
+	if !ok {
+		return nil
+	}
+
+	if err := s.Clone(newName).SaveFor(rw, r, &ss); err != nil {
+		return err
+	}
+
+	s.Clear(rw)
+
+	return nil
+}
+
+// setCookie adds c to rw's headers, like http.SetCookie.
+func setCookie(rw http.ResponseWriter, c *http.Cookie) {
+	if v := cookieString(c); v != "" {
+		rw.Header().Add("Set-Cookie", v)
+	}
+}
+
+// validAttribute reports whether attr can be safely appended to a Set-Cookie
+// header as a single attribute.
+func validAttribute(attr string) bool {
+	if attr == "" {
+		return false
+	}
+
+	for i := 0; i < len(attr); i++ {
+		if c := attr[i]; c < 0x20 || c == 0x7f || c == ';' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// checkPrefixRules reports whether the cookie attributes in cfg follow the
+// rules browsers enforce for the store's name prefix.
+func (s *Store) checkPrefixRules(cfg settings) error {
+	switch {
+	case strings.HasPrefix(s.Name, "__Host-"):
+		if !cfg.secure || cfg.path != "/" || cfg.domain != "" {
+			return ErrPrefixRules
+		}
+	case strings.HasPrefix(s.Name, "__Secure-"):
+		if !cfg.secure {
+			return ErrPrefixRules
+		}
+	}
+
+	return nil
+}
+
+// applyPrefixRules forces the attributes browsers require for cookies with
+// the __Secure- and __Host- name prefixes. Without them, a browser ignores
+// the cookie entirely, which for a deletion means the session lingers.
+func applyPrefixRules(c *http.Cookie) {
+	switch {
+	case strings.HasPrefix(c.Name, "__Host-"):
+		c.Secure = true
+		c.Path = "/"
+		c.Domain = ""
+	case strings.HasPrefix(c.Name, "__Secure-"):
+		c.Secure = true
+	}
 }
@@ -0,0 +1,2437 @@
+package cookiesession_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/satori/go.uuid"
+
+	"fknsrs.biz/p/cookiesession"
+	"fknsrs.biz/p/cookiesession/cookiesessiontest"
+)
+
+// epoch is when every test's clock starts.
+var epoch = time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+// newStore returns a deterministic store for tests, named "session", whose
+// clock only moves when the test moves it.
+func newStore(t *testing.T) (*cookiesession.Store, *cookiesessiontest.Clock) {
+	t.Helper()
+
+	clock := cookiesessiontest.NewClock(epoch)
+
+	s := cookiesessiontest.NewStore("session", t.Name())
+	s.Now = clock.Now
+
+	return s, clock
+}
+
+// request returns a request carrying the cookies that rec was given, as a
+// browser would send them back.
+func request(rec *httptest.ResponseRecorder) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range rec.Result().Cookies() {
+		if c.MaxAge >= 0 {
+			r.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+		}
+	}
+
+	return r
+}
+
+// save saves ss with s, failing the test if it can't, and returns a request
+// carrying the cookie.
+func save(t *testing.T, s *cookiesession.Store, ss *cookiesession.Session) *http.Request {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	if err := s.Save(rec, ss); err != nil {
+		t.Fatalf("couldn't save session: %s", err)
+	}
+
+	return request(rec)
+}
+
+// value saves ss with s and returns its cookie value.
+func value(t *testing.T, s *cookiesession.Store, ss *cookiesession.Session) string {
+	t.Helper()
+
+	c, err := save(t, s, ss).Cookie(s.Name)
+	if err != nil {
+		t.Fatalf("expected a %q cookie: %s", s.Name, err)
+	}
+
+	return c.Value
+}
+
+// counter returns an ID generator that hands out 1, 2, 3 and so on.
+func counter() cookiesession.IDGenerator {
+	var n byte
+
+	return cookiesession.IDGeneratorFunc(func(io.Reader, time.Time) uuid.UUID {
+		n++
+		return uuid.UUID{15: n}
+	})
+}
+
+func TestIDGenerator(t *testing.T) {
+	s, _ := newStore(t)
+	s.IDGenerator = counter()
+
+	ss := s.Get(httptest.NewRequest(http.MethodGet, "/", nil))
+	if want := (uuid.UUID{15: 1}); ss.SID != want {
+		t.Fatalf("expected SID %s, got %s", want, ss.SID)
+	}
+
+	ss.RegenerateID()
+	if want := (uuid.UUID{15: 2}); ss.SID != want {
+		t.Fatalf("expected SID %s after RegenerateID, got %s", want, ss.SID)
+	}
+
+	ss.SetBytes([]byte("state"))
+
+	got := s.Get(save(t, s, &ss))
+	if want := (uuid.UUID{15: 2}); got.SID != want {
+		t.Fatalf("expected the saved SID %s, got %s", want, got.SID)
+	}
+}
+
+func TestNewIDDeterministic(t *testing.T) {
+	a := cookiesessiontest.NewStore("session", "seed")
+	b := cookiesessiontest.NewStore("session", "seed")
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	for i := 0; i < 3; i++ {
+		if x, y := a.Get(r).SID, b.Get(r).SID; x != y {
+			t.Fatalf("expected stores with the same Rand to make the same SIDs, got %s and %s", x, y)
+		} else if x.Version() != uuid.V4 {
+			t.Fatalf("expected a version 4 SID, got version %d", x.Version())
+		}
+	}
+}
+
+func TestOmitPath(t *testing.T) {
+	s, _ := newStore(t)
+	s.OmitPath = true
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("state"))
+
+	rec := httptest.NewRecorder()
+	if err := s.Save(rec, ss); err != nil {
+		t.Fatal(err)
+	}
+	s.Clear(rec)
+
+	headers := rec.Header()["Set-Cookie"]
+	if len(headers) != 2 {
+		t.Fatalf("expected a cookie and its deletion, got %q", headers)
+	}
+
+	for _, h := range headers {
+		if strings.Contains(h, "Path=") {
+			t.Errorf("expected no Path attribute, got %q", h)
+		}
+	}
+}
+
+func TestPathDefault(t *testing.T) {
+	s, _ := newStore(t)
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("state"))
+
+	rec := httptest.NewRecorder()
+	if err := s.Save(rec, ss); err != nil {
+		t.Fatal(err)
+	}
+
+	if h := rec.Header().Get("Set-Cookie"); !strings.Contains(h, "; Path=/;") {
+		t.Fatalf("expected Path=/, got %q", h)
+	}
+}
+
+func TestEncodedSize(t *testing.T) {
+	for _, compression := range []cookiesession.Compressor{nil, cookiesession.GzipCompression} {
+		s, _ := newStore(t)
+		s.Compression = compression
+
+		ss := cookiesession.NewSession()
+		ss.SetBytes([]byte(strings.Repeat("compressible ", 40)))
+
+		before := *ss
+
+		n, err := s.EncodedSize(ss)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ss.Seq != before.Seq || !ss.Time.Equal(before.Time) || !ss.Created.Equal(before.Created) {
+			t.Fatal("expected EncodedSize to leave the session alone")
+		}
+
+		if got := len(value(t, s, ss)); got != n {
+			t.Errorf("expected EncodedSize to match Save with compression %v: got %d, saved %d", compression, n, got)
+		}
+	}
+}
+
+func TestBindName(t *testing.T) {
+	a, _ := newStore(t)
+	a.BindName = true
+	b := a.WithName("preferences")
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("state"))
+
+	swapped := httptest.NewRequest(http.MethodGet, "/", nil)
+	swapped.AddCookie(&http.Cookie{Name: b.Name, Value: value(t, a, ss)})
+
+	if _, err := b.GetE(swapped); err != cookiesession.ErrNameMismatch {
+		t.Fatalf("expected %v, got %v", cookiesession.ErrNameMismatch, err)
+	}
+
+	got, err := a.GetE(save(t, a, ss))
+	if err != nil {
+		t.Fatal(err)
+	} else if string(got.State) != "state" {
+		t.Fatalf("expected the session under its own name, got %q", got.State)
+	}
+}
+
+func TestWithoutBindName(t *testing.T) {
+	a, _ := newStore(t)
+	b := a.WithName("preferences")
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("state"))
+
+	swapped := httptest.NewRequest(http.MethodGet, "/", nil)
+	swapped.AddCookie(&http.Cookie{Name: b.Name, Value: value(t, a, ss)})
+
+	if _, err := b.GetE(swapped); err != nil {
+		t.Fatalf("expected values to move between names without BindName, got %v", err)
+	}
+}
+
+func TestUserEpoch(t *testing.T) {
+	s, _ := newStore(t)
+
+	uid := uuid.UUID{1}
+	epochs := map[uuid.UUID]uint32{uid: 3}
+	s.UserEpoch = func(ctx context.Context, uid uuid.UUID) (uint32, error) {
+		return epochs[uid], nil
+	}
+
+	ss := cookiesession.NewSession()
+	ss.SetUID(uid)
+
+	r := save(t, s, ss)
+
+	got, err := s.GetE(r)
+	if err != nil {
+		t.Fatalf("expected the current epoch to be accepted, got %v", err)
+	} else if got.Epoch != 3 {
+		t.Fatalf("expected epoch 3 in the session, got %d", got.Epoch)
+	}
+
+	epochs[uid]++
+
+	if _, err := s.GetE(r); err != cookiesession.ErrEpochMismatch {
+		t.Fatalf("expected %v for a stale epoch, got %v", cookiesession.ErrEpochMismatch, err)
+	}
+}
+
+func TestUserEpochError(t *testing.T) {
+	s, _ := newStore(t)
+
+	ss := cookiesession.NewSession()
+	ss.SetUID(uuid.UUID{1})
+	r := save(t, s, ss)
+
+	failure := errors.New("epoch store is down")
+	s.UserEpoch = func(ctx context.Context, uid uuid.UUID) (uint32, error) {
+		return 0, failure
+	}
+
+	if _, err := s.GetE(r); !errors.Is(err, failure) {
+		t.Fatalf("expected the callback's error, got %v", err)
+	}
+}
+
+func TestNewSession(t *testing.T) {
+	s, _ := newStore(t)
+
+	uid := uuid.UUID{1}
+
+	ss := cookiesession.NewSession().WithUID(uid).WithState([]byte("state"))
+	if ss.SID == uuid.Nil {
+		t.Fatal("expected a SID")
+	} else if ss.Valid || !ss.Time.IsZero() {
+		t.Fatal("expected an unsaved session")
+	} else if ss.RealUID != uid {
+		t.Fatalf("expected RealUID %s, got %s", uid, ss.RealUID)
+	}
+
+	got, err := s.GetE(save(t, s, ss))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.SID != ss.SID || got.UID != uid || got.RealUID != uid || string(got.State) != "state" {
+		t.Fatalf("expected the built session back, got %+v", got)
+	} else if !got.Valid || !got.Time.Equal(epoch) {
+		t.Fatalf("expected a valid session saved at %s, got %+v", epoch, got)
+	}
+}
+
+func TestNewSessionUnique(t *testing.T) {
+	if a, b := cookiesession.NewSession(), cookiesession.NewSession(); a.SID == b.SID {
+		t.Fatal("expected each session to get its own SID")
+	}
+}
+
+func TestClearPrefixedCookie(t *testing.T) {
+	s, _ := newStore(t)
+	s.Name = "__Host-session"
+	s.Path = "/app"
+	s.Domain = "example.com"
+
+	rec := httptest.NewRecorder()
+	s.Clear(rec)
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected one deletion cookie, got %d", len(cookies))
+	}
+
+	c := cookies[0]
+	if !c.Secure || c.Path != "/" || c.Domain != "" || c.MaxAge >= 0 {
+		t.Fatalf("expected a Secure deletion at Path=/ with no Domain, got %q", rec.Header().Get("Set-Cookie"))
+	}
+
+	s.Name = "__Secure-session"
+
+	rec = httptest.NewRecorder()
+	s.Clear(rec)
+
+	if c := rec.Result().Cookies()[0]; !c.Secure || c.Path != "/app" || c.Domain != "example.com" {
+		t.Fatalf("expected a Secure deletion keeping Path and Domain, got %q", rec.Header().Get("Set-Cookie"))
+	}
+}
+
+func TestRotate(t *testing.T) {
+	s := cookiesession.New("session", "first", time.Hour)
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("state"))
+
+	before := value(t, s, ss)
+
+	s.Rotate("second")
+
+	after := value(t, s, ss)
+
+	for _, v := range []string{before, after} {
+		if _, err := s.Decode(v); err != nil {
+			t.Fatalf("expected values from before and after the rotation to decode, got %v", err)
+		}
+	}
+
+	if _, err := cookiesession.New("session", "first", time.Hour).Decode(after); err != cookiesession.ErrDecryptFailed {
+		t.Fatalf("expected new values to be sealed with the new secret, got %v", err)
+	}
+}
+
+func TestAddRotatedSecret(t *testing.T) {
+	ss := cookiesession.NewSession().WithState([]byte("state"))
+	legacy := value(t, cookiesession.New("session", "retired", time.Hour), ss)
+
+	s := cookiesession.New("session", "current", time.Hour)
+	if _, err := s.Decode(legacy); err != cookiesession.ErrDecryptFailed {
+		t.Fatalf("expected a value under an unknown secret to be rejected, got %v", err)
+	}
+
+	for i := 0; i < cookiesession.DefaultMaxOldKeys+1; i++ {
+		s.AddRotatedSecret(fmt.Sprintf("unrelated %d", i))
+	}
+	s.AddRotatedSecret("retired")
+
+	if len(s.OldKeys) != cookiesession.DefaultMaxOldKeys+2 {
+		t.Fatalf("expected AddRotatedSecret not to trim OldKeys, got %d", len(s.OldKeys))
+	}
+
+	if got, err := s.Decode(legacy); err != nil || string(got.State) != "state" {
+		t.Fatalf("expected a value under the added secret to decode, got %v", err)
+	}
+
+	fresh := value(t, s, cookiesession.NewSession().WithState([]byte("state")))
+	if _, err := cookiesession.New("session", "current", time.Hour).Decode(fresh); err != nil {
+		t.Fatalf("expected new values to stay sealed under the current secret, got %v", err)
+	}
+}
+
+func TestRotateTrims(t *testing.T) {
+	s := cookiesession.New("session", "first", time.Hour)
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("state"))
+
+	first := value(t, s, ss)
+
+	for _, secret := range []string{"second", "third"} {
+		s.Rotate(secret)
+	}
+
+	if len(s.OldKeys) != cookiesession.DefaultMaxOldKeys {
+		t.Fatalf("expected %d old keys, got %d", cookiesession.DefaultMaxOldKeys, len(s.OldKeys))
+	} else if _, err := s.Decode(first); err != nil {
+		t.Fatalf("expected the first value to decode while its key is kept, got %v", err)
+	}
+
+	s.Rotate("fourth")
+
+	if len(s.OldKeys) != cookiesession.DefaultMaxOldKeys {
+		t.Fatalf("expected %d old keys, got %d", cookiesession.DefaultMaxOldKeys, len(s.OldKeys))
+	} else if _, err := s.Decode(first); err != cookiesession.ErrDecryptFailed {
+		t.Fatalf("expected the first value to be rejected once its key is trimmed, got %v", err)
+	}
+
+	s.MaxOldKeys = 1
+	s.Rotate("fifth")
+
+	if len(s.OldKeys) != 1 {
+		t.Fatalf("expected MaxOldKeys to limit the old keys to 1, got %d", len(s.OldKeys))
+	}
+}
+
+func TestGetContextCancelled(t *testing.T) {
+	s, _ := newStore(t)
+
+	ss := cookiesession.NewSession()
+	ss.SetUID(uuid.UUID{1})
+	r := save(t, s, ss)
+
+	// A slow provider that only gives up when its context does.
+	s.UserEpoch = func(ctx context.Context, uid uuid.UUID) (uint32, error) {
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(time.Minute):
+			return 0, nil
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := s.GetContext(ctx, r); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the cancellation to abort loading, got %v", err)
+	}
+
+	got := s.Get(r.WithContext(ctx))
+	if got.Valid || got.SID == ss.SID {
+		t.Fatal("expected Get to use the request's context and hand out a fresh session")
+	}
+}
+
+func TestSaveToHeader(t *testing.T) {
+	s, _ := newStore(t)
+	s.ExtraAttributes = []string{"Priority=High"}
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("state"))
+
+	h := http.Header{}
+	h.Add("Set-Cookie", "other=1")
+
+	if err := s.SaveToHeader(h, ss); err != nil {
+		t.Fatal(err)
+	}
+
+	cookies := h["Set-Cookie"]
+	if len(cookies) != 2 || cookies[0] != "other=1" {
+		t.Fatalf("expected the session cookie after the existing one, got %q", cookies)
+	} else if !strings.HasPrefix(cookies[1], "session=") || !strings.HasSuffix(cookies[1], "; Priority=High") {
+		t.Fatalf("expected a complete session cookie, got %q", cookies[1])
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Cookie", strings.SplitN(cookies[1], ";", 2)[0])
+
+	if got, err := s.GetE(r); err != nil || string(got.State) != "state" {
+		t.Fatalf("expected the session back, got %q, %v", got.State, err)
+	}
+}
+
+// benchSession returns a session with a typical amount of state.
+func benchSession() *cookiesession.Session {
+	ss := cookiesession.NewSession()
+	ss.SetUID(uuid.UUID{1})
+	ss.SetBytes([]byte(strings.Repeat("x", 256)))
+
+	return ss
+}
+
+func BenchmarkSave(b *testing.B) {
+	s := cookiesession.New("session", "secret", time.Hour)
+	ss := benchSession()
+	h := http.Header{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := s.SaveToHeader(h, ss); err != nil {
+			b.Fatal(err)
+		}
+		delete(h, "Set-Cookie")
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	s := cookiesession.New("session", "secret", time.Hour)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if err := cookiesessiontest.InjectSession(r, s, benchSession()); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if ss := s.Get(r); !ss.Valid {
+			b.Fatal("expected a valid session")
+		}
+	}
+}
+
+func BenchmarkRoundTrip(b *testing.B) {
+	s := cookiesession.New("session", "secret", time.Hour)
+	ss := benchSession()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		v, err := s.Token(ss)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if _, err := s.Decode(v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// tamper flips a bit in the sealed bytes of v.
+func tamper(t *testing.T, v string) string {
+	t.Helper()
+
+	b, err := base64.StdEncoding.DecodeString(v)
+	if err != nil {
+		t.Fatalf("couldn't decode value: %s", err)
+	}
+
+	b[len(b)/2] ^= 1
+
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func TestDecodeValue(t *testing.T) {
+	s, clock := newStore(t)
+
+	ss := cookiesession.NewSession()
+	ss.SetUID(uuid.UUID{1})
+	ss.SetBytes([]byte("secret state"))
+
+	v := value(t, s, ss)
+
+	clock.Advance(2 * time.Hour)
+
+	if _, err := s.Decode(v); err != cookiesession.ErrExpired {
+		t.Fatalf("expected Decode to enforce the TTL, got %v", err)
+	}
+
+	got, err := s.DecodeValue(v)
+	if err != nil {
+		t.Fatalf("expected DecodeValue to ignore the TTL, got %v", err)
+	} else if got.SID != ss.SID || !got.Time.Equal(epoch) || string(got.State) != "secret state" {
+		t.Fatalf("expected the full session, got %+v", got)
+	}
+
+	if _, err := s.DecodeValue(tamper(t, v)); err != cookiesession.ErrDecryptFailed {
+		t.Fatalf("expected %v for a tampered value, got %v", cookiesession.ErrDecryptFailed, err)
+	}
+
+	str := got.String()
+	if strings.Contains(str, "secret state") {
+		t.Fatalf("expected String to leave out State, got %q", str)
+	} else if !strings.Contains(str, ss.SID.String()) || !strings.Contains(str, "12 bytes of state") {
+		t.Fatalf("expected String to summarise the session, got %q", str)
+	}
+}
+
+func TestStringUsesStoreClock(t *testing.T) {
+	s, clock := newStore(t)
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("state"))
+	r := save(t, s, ss)
+
+	clock.Advance(30 * time.Minute)
+
+	got, err := s.GetE(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if str := got.String(); !strings.Contains(str, "age 30m0s") {
+		t.Fatalf("expected String to age the session by the store's clock, got %q", str)
+	}
+}
+
+func TestExtraAttributes(t *testing.T) {
+	s, _ := newStore(t)
+	s.ExtraAttributes = []string{"Priority=High"}
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("state"))
+
+	rec := httptest.NewRecorder()
+	if err := s.Save(rec, ss); err != nil {
+		t.Fatal(err)
+	}
+
+	if h := rec.Header().Get("Set-Cookie"); !strings.HasSuffix(h, "; Priority=High") {
+		t.Fatalf("expected the extra attribute, got %q", h)
+	}
+
+	for _, attr := range []string{"Priority=High\r\nX-Injected: 1", "a; Domain=evil.example", ""} {
+		s.ExtraAttributes = []string{attr}
+
+		rec := httptest.NewRecorder()
+		if err := s.Save(rec, ss); err != cookiesession.ErrInvalidAttribute {
+			t.Errorf("expected %v for %q, got %v", cookiesession.ErrInvalidAttribute, attr, err)
+		} else if len(rec.Header()) != 0 {
+			t.Errorf("expected nothing written for %q, got %q", attr, rec.Header())
+		}
+	}
+}
+
+func TestStartedAtLastSeen(t *testing.T) {
+	s, clock := newStore(t)
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("state"))
+
+	got := s.Get(save(t, s, ss))
+	if !got.StartedAt().Equal(epoch) || !got.LastSeen().Equal(epoch) {
+		t.Fatalf("expected both times to be %s after the first save, got %s and %s", epoch, got.StartedAt(), got.LastSeen())
+	}
+
+	clock.Advance(10 * time.Minute)
+	got.MarkDirty()
+
+	got = s.Get(save(t, s, &got))
+	if !got.StartedAt().Equal(epoch) {
+		t.Errorf("expected StartedAt to stay %s, got %s", epoch, got.StartedAt())
+	}
+	if want := epoch.Add(10 * time.Minute); !got.LastSeen().Equal(want) {
+		t.Errorf("expected LastSeen to move to %s, got %s", want, got.LastSeen())
+	}
+}
+
+// legacy returns the unversioned encoding of a session saved at tm, as the
+// first releases of this package wrote it.
+func legacy(tm time.Time, sid, uid uuid.UUID, state string) []byte {
+	b := make([]byte, 8, 56+len(state))
+	binary.BigEndian.PutUint64(b, uint64(tm.Unix()))
+	b = append(b, sid.Bytes()...)
+	b = append(b, uid.Bytes()...)
+	b = append(b, uid.Bytes()...)
+
+	return append(b, state...)
+}
+
+func TestStrictFormat(t *testing.T) {
+	s, _ := newStore(t)
+
+	old, err := s.SealPlaintext(legacy(epoch, uuid.UUID{1}, uuid.UUID{2}, "legacy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("current"))
+	current := value(t, s, ss)
+
+	got, err := s.Decode(old)
+	if err != nil {
+		t.Fatalf("expected legacy values to be read by default, got %v", err)
+	} else if got.SID != (uuid.UUID{1}) || string(got.State) != "legacy" || !got.Created.Equal(epoch) {
+		t.Fatalf("expected the legacy session, got %+v", got)
+	}
+
+	s.StrictFormat = true
+
+	if _, err := s.Decode(old); err != cookiesession.ErrUnknownVersion {
+		t.Fatalf("expected %v for a legacy value in strict mode, got %v", cookiesession.ErrUnknownVersion, err)
+	}
+
+	if got, err := s.Decode(current); err != nil || string(got.State) != "current" {
+		t.Fatalf("expected versioned values in strict mode, got %q, %v", got.State, err)
+	}
+}
+
+func TestBeforeSave(t *testing.T) {
+	s, _ := newStore(t)
+	s.BeforeSave = func(r *http.Request, c *http.Cookie) {
+		if r != nil {
+			c.Domain = r.Host
+		}
+	}
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("state"))
+
+	r := httptest.NewRequest(http.MethodGet, "http://tenant.example.com/", nil)
+
+	rec := httptest.NewRecorder()
+	if err := s.SaveFor(rec, r, ss); err != nil {
+		t.Fatal(err)
+	}
+
+	if c := rec.Result().Cookies()[0]; c.Domain != "tenant.example.com" {
+		t.Fatalf("expected the hook's per-request Domain, got %q", rec.Header().Get("Set-Cookie"))
+	}
+
+	rec = httptest.NewRecorder()
+	if err := s.Save(rec, ss); err != nil {
+		t.Fatal(err)
+	}
+
+	if c := rec.Result().Cookies()[0]; c.Domain != "" {
+		t.Fatalf("expected no Domain without a request, got %q", rec.Header().Get("Set-Cookie"))
+	}
+}
+
+func TestMergeState(t *testing.T) {
+	anonymous := cookiesession.NewSession().WithState([]byte("cart"))
+
+	account := cookiesession.Session{Valid: true, State: []byte("prefs")}
+	account.MergeState(anonymous, func(existing, incoming []byte) []byte {
+		return append(append(append([]byte(nil), existing...), '+'), incoming...)
+	})
+
+	if string(account.State) != "prefs+cart" {
+		t.Fatalf("expected the concatenated state, got %q", account.State)
+	} else if !account.Dirty() {
+		t.Fatal("expected the merged session to be dirty")
+	}
+
+	account = cookiesession.Session{Valid: true, State: []byte("prefs")}
+	account.MergeState(anonymous, func(existing, incoming []byte) []byte {
+		return incoming
+	})
+
+	if string(account.State) != "cart" {
+		t.Fatalf("expected the incoming state, got %q", account.State)
+	} else if string(anonymous.State) != "cart" {
+		t.Fatalf("expected the other session to be left alone, got %q", anonymous.State)
+	}
+}
+
+func TestTryGet(t *testing.T) {
+	s, _ := newStore(t)
+
+	minted := 0
+	s.IDGenerator = cookiesession.IDGeneratorFunc(func(io.Reader, time.Time) uuid.UUID {
+		minted++
+		return uuid.UUID{1}
+	})
+
+	if ss, ok := s.TryGet(httptest.NewRequest(http.MethodGet, "/", nil)); ok || ss.SID != uuid.Nil {
+		t.Fatalf("expected no session, got %+v", ss)
+	} else if minted != 0 {
+		t.Fatalf("expected TryGet not to mint a SID, minted %d", minted)
+	}
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("state"))
+
+	if got, ok := s.TryGet(save(t, s, ss)); !ok || got.SID != ss.SID {
+		t.Fatalf("expected the saved session, got %+v", got)
+	}
+}
+
+func BenchmarkGetNoCookie(b *testing.B) {
+	s := cookiesession.New("session", "secret", time.Hour)
+	r := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		s.Get(r)
+	}
+}
+
+func BenchmarkTryGetNoCookie(b *testing.B) {
+	s := cookiesession.New("session", "secret", time.Hour)
+	r := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		s.TryGet(r)
+	}
+}
+
+func TestValidateTTL(t *testing.T) {
+	for name, tc := range map[string]struct {
+		ttl  time.Duration
+		opts []cookiesession.Option
+		err  error
+	}{
+		"positive":                 {ttl: time.Hour},
+		"zero":                     {ttl: 0, err: cookiesession.ErrInvalidTTL},
+		"negative":                 {ttl: -time.Hour, err: cookiesession.ErrInvalidTTL},
+		"zero with session cookie": {ttl: 0, opts: []cookiesession.Option{cookiesession.WithSessionCookie()}},
+	} {
+		if err := cookiesession.New("session", "secret", tc.ttl, tc.opts...).Validate(); err != tc.err {
+			t.Errorf("%s: expected %v, got %v", name, tc.err, err)
+		}
+	}
+}
+
+func TestValidateAbsoluteTimeout(t *testing.T) {
+	s := cookiesession.New("session", "secret", time.Hour)
+
+	s.AbsoluteTimeout = 24 * time.Hour
+	if err := s.Validate(); err != nil {
+		t.Errorf("expected an AbsoluteTimeout longer than TTL to be fine, got %v", err)
+	}
+
+	s.AbsoluteTimeout = time.Minute
+	if err := s.Validate(); err != cookiesession.ErrInvalidTTL {
+		t.Errorf("expected %v for an AbsoluteTimeout shorter than TTL, got %v", cookiesession.ErrInvalidTTL, err)
+	}
+
+	s.AbsoluteTimeout = 2 * time.Hour
+	s.IdleTimeout = 3 * time.Hour
+	if err := s.Validate(); err != cookiesession.ErrInvalidTTL {
+		t.Errorf("expected %v for an AbsoluteTimeout shorter than IdleTimeout, got %v", cookiesession.ErrInvalidTTL, err)
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	s := cookiesessiontest.NewStore("session", "FuzzDecode")
+	clock := cookiesessiontest.NewClock(epoch)
+	s.Now = clock.Now
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("state"))
+
+	_, v, _, err := s.EncodeCookie(ss)
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	f.Add(v, legacy(epoch, ss.SID, uuid.Nil, "state"))
+	f.Add(v[:len(v)/2], legacy(epoch, ss.SID, uuid.Nil, "")[:20])
+	f.Add("", []byte{})
+	f.Add("====", []byte{0xff})
+	f.Add(strings.Repeat("A", 4096), make([]byte, 56))
+
+	f.Fuzz(func(t *testing.T, value string, plaintext []byte) {
+		check := func(ss cookiesession.Session, err error) {
+			if err == nil && !ss.Valid {
+				t.Fatalf("expected a valid session or an error, got %+v", ss)
+			}
+		}
+
+		check(s.Decode(value))
+
+		sealed, err := s.SealPlaintext(plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		check(s.Decode(sealed))
+	})
+}
+
+func TestDecodeAll(t *testing.T) {
+	s, clock := newStore(t)
+
+	old := cookiesession.NewSession()
+	old.SetBytes([]byte("old"))
+	expired := value(t, s, old)
+
+	clock.Advance(2 * time.Hour)
+
+	a, b := cookiesession.NewSession(), cookiesession.NewSession()
+	a.SetBytes([]byte("first"))
+	b.SetBytes([]byte("second"))
+
+	sessions, errs := s.DecodeAll([]string{value(t, s, a), expired, "garbage", value(t, s, b)})
+	if len(sessions) != 4 || len(errs) != 4 {
+		t.Fatalf("expected 4 results, got %d sessions and %d errors", len(sessions), len(errs))
+	}
+
+	if errs[0] != nil || sessions[0].SID != a.SID || string(sessions[0].Bytes()) != "first" {
+		t.Errorf("expected the first session, got %+v, %v", sessions[0], errs[0])
+	}
+	if errs[1] != cookiesession.ErrExpired {
+		t.Errorf("expected %v for the expired value, got %v", cookiesession.ErrExpired, errs[1])
+	}
+	if errs[2] == nil || sessions[2].Valid {
+		t.Errorf("expected an error for the garbage value, got %+v", sessions[2])
+	}
+	if errs[3] != nil || sessions[3].SID != b.SID || string(sessions[3].Bytes()) != "second" {
+		t.Errorf("expected the second session, got %+v, %v", sessions[3], errs[3])
+	}
+}
+
+func TestScrub(t *testing.T) {
+	secret := "password=hunter2"
+
+	ss := cookiesession.Session{
+		Valid:   true,
+		Time:    epoch,
+		SID:     uuid.UUID{1},
+		UID:     uuid.UUID{2},
+		RealUID: uuid.UUID{3},
+		State:   []byte(secret),
+	}
+
+	c := ss.Scrub()
+
+	if strings.Contains(string(c.State), "hunter2") {
+		t.Errorf("expected no raw state in the scrubbed copy, got %q", c.State)
+	} else if !strings.Contains(string(c.State), "16 bytes") {
+		t.Errorf("expected the state's length in the scrubbed copy, got %q", c.State)
+	}
+	if c.RealUID != uuid.Nil {
+		t.Errorf("expected RealUID to be masked, got %s", c.RealUID)
+	}
+	if c.SID != ss.SID || c.UID != ss.UID {
+		t.Errorf("expected the IDs to be kept, got %s and %s", c.SID, c.UID)
+	}
+
+	if string(ss.State) != secret || ss.RealUID != (uuid.UUID{3}) {
+		t.Errorf("expected the original to be unmodified, got %+v", ss)
+	}
+
+	if strings.Contains(ss.String(), "hunter2") {
+		t.Errorf("expected String not to include state, got %q", ss.String())
+	}
+}
+
+func TestGracePeriod(t *testing.T) {
+	s, clock := newStore(t)
+	s.ClockSkew = -1
+	s.GracePeriod = 10 * time.Minute
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("state"))
+	r := save(t, s, ss)
+
+	for _, tc := range []struct {
+		name  string
+		at    time.Duration
+		stale bool
+		err   error
+	}{
+		{name: "fresh", at: 59 * time.Minute},
+		{name: "within grace", at: 65 * time.Minute, stale: true},
+		{name: "beyond grace", at: 71 * time.Minute, err: cookiesession.ErrExpired},
+	} {
+		clock.Set(epoch.Add(tc.at))
+
+		got, err := s.GetE(r)
+		if err != tc.err {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.err, err)
+		} else if err == nil && got.Stale != tc.stale {
+			t.Errorf("%s: expected Stale to be %v", tc.name, tc.stale)
+		}
+	}
+}
+
+func TestMintFor(t *testing.T) {
+	s, _ := newStore(t)
+	s.ClockSkew = -1
+
+	get := func(v string) (cookiesession.Session, error) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.AddCookie(&http.Cookie{Name: s.Name, Value: v})
+
+		return s.GetE(r)
+	}
+
+	uid := uuid.UUID{7}
+
+	v, err := s.MintFor(uid, []byte("state"), 59*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ss, err := get(v)
+	if err != nil {
+		t.Fatalf("expected a near-expiry session to be accepted, got %v", err)
+	}
+	if ss.UID != uid || string(ss.Bytes()) != "state" {
+		t.Errorf("expected the minted uid and state, got %s and %q", ss.UID, ss.Bytes())
+	}
+	if !ss.Time.Equal(epoch.Add(-59 * time.Minute)) {
+		t.Errorf("expected the session to have been saved 59 minutes ago, got %s", ss.Time)
+	}
+
+	v, err = s.MintFor(uid, nil, s.TTL+time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := get(v); err != cookiesession.ErrExpired {
+		t.Fatalf("expected %v for a session minted past its TTL, got %v", cookiesession.ErrExpired, err)
+	}
+}
+
+func TestDuplicateCookies(t *testing.T) {
+	s, clock := newStore(t)
+
+	stale := cookiesession.NewSession()
+	stale.SetBytes([]byte("stale"))
+	expired := value(t, s, stale)
+
+	clock.Advance(2 * time.Hour)
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("current"))
+	current := value(t, s, ss)
+
+	for name, values := range map[string][]string{
+		"garbage first": {"garbage", current},
+		"expired first": {expired, current},
+		"valid first":   {current, expired},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		for _, v := range values {
+			r.AddCookie(&http.Cookie{Name: s.Name, Value: v})
+		}
+
+		got, err := s.GetE(r)
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		} else if got.SID != ss.SID || string(got.Bytes()) != "current" {
+			t.Errorf("%s: expected the usable session, got %+v", name, got)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: s.Name, Value: expired})
+	r.AddCookie(&http.Cookie{Name: s.Name, Value: "garbage"})
+
+	if _, err := s.GetE(r); err != cookiesession.ErrExpired {
+		t.Errorf("expected the first cookie's error, %v, got %v", cookiesession.ErrExpired, err)
+	}
+}
+
+func TestRename(t *testing.T) {
+	s, _ := newStore(t)
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("state"))
+	r := save(t, s, ss)
+
+	rec := httptest.NewRecorder()
+	if err := s.Rename(rec, r, "sid"); err != nil {
+		t.Fatal(err)
+	}
+
+	cookies := map[string]*http.Cookie{}
+	for _, c := range rec.Result().Cookies() {
+		cookies[c.Name] = c
+	}
+
+	if len(cookies) != 2 {
+		t.Fatalf("expected two cookies, got %v", rec.Header()["Set-Cookie"])
+	}
+	if c := cookies["session"]; c == nil || c.MaxAge >= 0 {
+		t.Errorf("expected the old cookie to be deleted, got %v", c)
+	}
+	if c := cookies["sid"]; c == nil || c.Value == "" {
+		t.Fatalf("expected a new cookie, got %v", c)
+	}
+
+	n := s.Clone("sid")
+	if got, err := n.GetE(request(rec)); err != nil {
+		t.Fatal(err)
+	} else if got.SID != ss.SID || string(got.Bytes()) != "state" {
+		t.Errorf("expected the session under its new name, got %+v", got)
+	}
+
+	rec = httptest.NewRecorder()
+	if err := s.Rename(rec, httptest.NewRequest(http.MethodGet, "/", nil), "sid"); err != nil {
+		t.Fatal(err)
+	} else if len(rec.Header()["Set-Cookie"]) != 0 {
+		t.Errorf("expected nothing to be written without a session, got %v", rec.Header()["Set-Cookie"])
+	}
+}
+
+func TestBytes(t *testing.T) {
+	var ss cookiesession.Session
+
+	in := []byte("state")
+	ss.SetBytes(in)
+	in[0] = 'S'
+
+	if string(ss.State) != "state" {
+		t.Errorf("expected SetBytes to keep a copy, got %q", ss.State)
+	} else if !ss.Dirty() {
+		t.Error("expected SetBytes to mark the session dirty")
+	}
+
+	out := ss.Bytes()
+	out[0] = 'S'
+
+	if string(ss.State) != "state" || string(ss.Bytes()) != "state" {
+		t.Errorf("expected Bytes to return a copy, got %q", ss.State)
+	}
+}
+
+func TestClockSkew(t *testing.T) {
+	s, clock := newStore(t)
+
+	// Sessions saved by a server whose clock is ahead of ours.
+	clock.Set(epoch.Add(30 * time.Second))
+	nearFuture := save(t, s, cookiesession.NewSession().WithState([]byte("near")))
+
+	clock.Set(epoch.Add(2 * time.Minute))
+	farFuture := save(t, s, cookiesession.NewSession().WithState([]byte("far")))
+
+	clock.Set(epoch)
+
+	if _, err := s.GetE(nearFuture); err != nil {
+		t.Errorf("expected a session slightly in the future to be accepted, got %v", err)
+	}
+	if _, err := s.GetE(farFuture); err != cookiesession.ErrFutureSession {
+		t.Errorf("expected %v beyond the skew allowance, got %v", cookiesession.ErrFutureSession, err)
+	}
+
+	r := save(t, s, cookiesession.NewSession().WithState([]byte("edge")))
+
+	clock.Set(epoch.Add(s.TTL + 30*time.Second))
+	if _, err := s.GetE(r); err != nil {
+		t.Errorf("expected a session slightly past its TTL to be accepted, got %v", err)
+	}
+
+	clock.Set(epoch.Add(s.TTL + 90*time.Second))
+	if _, err := s.GetE(r); err != cookiesession.ErrExpired {
+		t.Errorf("expected %v beyond the skew allowance, got %v", cookiesession.ErrExpired, err)
+	}
+
+	s.ClockSkew = -1
+	clock.Set(epoch.Add(s.TTL + time.Second))
+	if _, err := s.GetE(r); err != cookiesession.ErrExpired {
+		t.Errorf("expected %v with skew disabled, got %v", cookiesession.ErrExpired, err)
+	}
+}
+
+func TestHasCookie(t *testing.T) {
+	s, _ := newStore(t)
+	s.AltHeader = "X-Session"
+	s.BearerAuth = true
+
+	minted := 0
+	s.IDGenerator = cookiesession.IDGeneratorFunc(func(io.Reader, time.Time) uuid.UUID {
+		minted++
+		return uuid.UUID{1}
+	})
+
+	for _, tc := range []struct {
+		name string
+		set  func(r *http.Request)
+		want bool
+	}{
+		{name: "absent", set: func(r *http.Request) {}},
+		{name: "other cookie", set: func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "other", Value: "x"}) }},
+		{name: "empty", set: func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "session", Value: ""}) }},
+		{name: "present", set: func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "session", Value: "x"}) }, want: true},
+		{name: "remember", set: func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "session_remember", Value: "x"}) }, want: true},
+		{name: "alt header", set: func(r *http.Request) { r.Header.Set("X-Session", "x") }, want: true},
+		{name: "bearer", set: func(r *http.Request) { r.Header.Set("Authorization", "Bearer x") }, want: true},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		tc.set(r)
+
+		if got := s.HasCookie(r); got != tc.want {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+
+	if minted != 0 {
+		t.Errorf("expected HasCookie not to mint a SID, minted %d", minted)
+	}
+}
+
+func TestSigningKey(t *testing.T) {
+	s, _ := newStore(t)
+	s.SigningKey = []byte("signing key")
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("state"))
+	v := value(t, s, ss)
+
+	if got, err := s.Decode(v); err != nil {
+		t.Fatal(err)
+	} else if got.SID != ss.SID || string(got.Bytes()) != "state" {
+		t.Errorf("expected the signed session, got %+v", got)
+	}
+
+	if _, err := s.Decode(tamper(t, v)); err != cookiesession.ErrBadSignature {
+		t.Errorf("expected %v for tampered ciphertext, got %v", cookiesession.ErrBadSignature, err)
+	}
+
+	o, _ := newStore(t)
+	o.SigningKey = []byte("another signing key")
+	if _, err := o.Decode(v); err != cookiesession.ErrBadSignature {
+		t.Errorf("expected %v under the wrong signing key, got %v", cookiesession.ErrBadSignature, err)
+	}
+
+	o.SigningKey = nil
+	if _, err := o.Decode(v); err == nil {
+		t.Error("expected a signed value to be rejected without the signing key")
+	}
+}
+
+func TestSaveUntouched(t *testing.T) {
+	s, _ := newStore(t)
+
+	untouched := s.Get(httptest.NewRequest(http.MethodGet, "/", nil))
+	if err := s.Save(httptest.NewRecorder(), &untouched); err != cookiesession.ErrSessionNotValid {
+		t.Fatalf("expected %v saving an untouched session, got %v", cookiesession.ErrSessionNotValid, err)
+	}
+
+	modified := s.Get(httptest.NewRequest(http.MethodGet, "/", nil))
+	modified.SetBytes([]byte("state"))
+	if err := s.Save(httptest.NewRecorder(), &modified); err != nil {
+		t.Fatalf("expected a modified session to be saved, got %v", err)
+	}
+
+	loaded := s.Get(save(t, s, cookiesession.NewSession().WithState([]byte("state"))))
+	if err := s.Save(httptest.NewRecorder(), &loaded); err != nil {
+		t.Fatalf("expected a loaded session to be saved, got %v", err)
+	}
+
+	s.AllowInvalidSave = true
+	if err := s.Save(httptest.NewRecorder(), &untouched); err != nil {
+		t.Fatalf("expected AllowInvalidSave to allow saving an untouched session, got %v", err)
+	}
+}
+
+func TestExpiresAt(t *testing.T) {
+	s, clock := newStore(t)
+
+	cookie := func(ss *cookiesession.Session) *http.Cookie {
+		rec := httptest.NewRecorder()
+		if err := s.Save(rec, ss); err != nil {
+			t.Fatal(err)
+		}
+
+		return rec.Result().Cookies()[0]
+	}
+
+	rolling := cookie(cookiesession.NewSession().WithState([]byte("state")))
+	if rolling.MaxAge != int(s.TTL/time.Second) || !rolling.Expires.Equal(epoch.Add(s.TTL)) {
+		t.Errorf("expected the cookie to last for TTL, got Max-Age %d and Expires %s", rolling.MaxAge, rolling.Expires)
+	}
+
+	ss := cookiesession.NewSession().WithState([]byte("state"))
+	ss.ExpiresAt = epoch.Add(30 * 24 * time.Hour)
+
+	remembered := cookie(ss)
+	if remembered.MaxAge != 30*24*60*60 || !remembered.Expires.Equal(ss.ExpiresAt) {
+		t.Errorf("expected the cookie to last until ExpiresAt, got Max-Age %d and Expires %s", remembered.MaxAge, remembered.Expires)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: remembered.Name, Value: remembered.Value})
+
+	clock.Advance(10 * 24 * time.Hour)
+	if _, err := s.GetE(r); err != nil {
+		t.Errorf("expected the session to outlive TTL until ExpiresAt, got %v", err)
+	}
+
+	clock.Advance(21 * 24 * time.Hour)
+	if _, err := s.GetE(r); err != cookiesession.ErrExpired {
+		t.Errorf("expected %v after ExpiresAt, got %v", cookiesession.ErrExpired, err)
+	}
+}
+
+func TestDecodeInto(t *testing.T) {
+	s, _ := newStore(t)
+
+	a := cookiesession.NewSession().WithState([]byte("first session"))
+	a.SetUID(uuid.UUID{1})
+	b := cookiesession.NewSession().WithState([]byte("second"))
+
+	var ss cookiesession.Session
+
+	if err := s.DecodeInto(value(t, s, a), &ss); err != nil {
+		t.Fatal(err)
+	} else if ss.SID != a.SID || ss.UID != a.UID || string(ss.State) != "first session" {
+		t.Fatalf("expected the first session, got %+v", ss)
+	}
+
+	if err := s.DecodeInto(value(t, s, b), &ss); err != nil {
+		t.Fatal(err)
+	} else if ss.SID != b.SID || ss.UID != uuid.Nil || string(ss.State) != "second" {
+		t.Fatalf("expected the second session with nothing left of the first, got %+v", ss)
+	}
+
+	if err := s.DecodeInto("garbage", &ss); err == nil {
+		t.Fatal("expected an error for a garbage value")
+	} else if ss.Valid || ss.SID != uuid.Nil || ss.State != nil {
+		t.Fatalf("expected the session to be reset after an error, got %+v", ss)
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	s := cookiesession.New("session", "secret", time.Hour)
+
+	v, err := s.Token(benchSession())
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := s.Decode(v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeInto(b *testing.B) {
+	s := cookiesession.New("session", "secret", time.Hour)
+
+	v, err := s.Token(benchSession())
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var ss cookiesession.Session
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := s.DecodeInto(v, &ss); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestCheckSeq(t *testing.T) {
+	s, _ := newStore(t)
+
+	issued := map[uuid.UUID]uint32{}
+	s.CheckSeq = func(sid uuid.UUID, seq uint32) bool {
+		return issued[sid] == seq
+	}
+
+	ss := cookiesession.NewSession().WithState([]byte("state"))
+
+	first := save(t, s, ss)
+	issued[ss.SID] = ss.Seq
+
+	if got, err := s.GetE(first); err != nil {
+		t.Fatalf("expected the current sequence number to be accepted, got %v", err)
+	} else if got.Seq != 1 {
+		t.Errorf("expected the first save to issue sequence number 1, got %d", got.Seq)
+	}
+
+	ss.MarkDirty()
+	second := save(t, s, ss)
+	issued[ss.SID] = ss.Seq
+
+	if got, err := s.GetE(second); err != nil {
+		t.Fatalf("expected the current sequence number to be accepted, got %v", err)
+	} else if got.Seq != 2 {
+		t.Errorf("expected the second save to issue sequence number 2, got %d", got.Seq)
+	}
+
+	if _, err := s.GetE(first); err != cookiesession.ErrReplayed {
+		t.Fatalf("expected %v for a stale sequence number, got %v", cookiesession.ErrReplayed, err)
+	}
+}
+
+func TestUnmarshalBinaryLayouts(t *testing.T) {
+	sid, uid := uuid.UUID{1}, uuid.UUID{2}
+
+	// v1 is the versioned header with whatever optional fields it has.
+	v1 := func(fields ...[]byte) []byte {
+		b := append([]byte{cookiesession.FormatVersion}, legacy(epoch, sid, uid, "")...)
+		for _, f := range fields {
+			b = append(b, f...)
+		}
+
+		return append(append(b, 0), "state"...)
+	}
+
+	created := make([]byte, 12)
+	binary.BigEndian.PutUint64(created, uint64(epoch.Add(-time.Hour).Unix()))
+
+	for _, tc := range []struct {
+		name    string
+		data    []byte
+		created time.Time
+	}{
+		{name: "legacy", data: legacy(epoch, sid, uid, "state"), created: epoch},
+		{name: "versioned without created", data: v1(), created: epoch},
+		{name: "versioned with a longer created", data: v1(append([]byte{3, 12}, created...)), created: epoch.Add(-time.Hour)},
+		{name: "versioned with an unknown field", data: v1([]byte{200, 3, 'a', 'b', 'c'}), created: epoch},
+	} {
+		var ss cookiesession.Session
+		if err := ss.UnmarshalBinary(tc.data); err != nil {
+			t.Errorf("%s: %s", tc.name, err)
+			continue
+		}
+
+		if ss.SID != sid || ss.UID != uid || !ss.Time.Equal(epoch) || string(ss.State) != "state" {
+			t.Errorf("%s: expected the header and state, got %+v", tc.name, ss)
+		}
+		if !ss.Created.Equal(tc.created) {
+			t.Errorf("%s: expected Created to be %s, got %s", tc.name, tc.created, ss.Created)
+		}
+	}
+
+	in := cookiesession.Session{Time: epoch, Created: epoch.Add(-time.Hour), SID: sid, UID: uid, RealUID: uid, State: []byte("state")}
+
+	b, err := in.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out cookiesession.Session
+	if err := out.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	} else if !out.Created.Equal(in.Created) || out.SID != sid || string(out.State) != "state" {
+		t.Errorf("expected the current layout to round-trip, got %+v", out)
+	}
+}
+
+func TestGetOrCreate(t *testing.T) {
+	s, clock := newStore(t)
+
+	ss := cookiesession.NewSession().WithState([]byte("state"))
+	r := save(t, s, ss)
+
+	if got, created := s.GetOrCreate(r); created {
+		t.Error("expected an existing session not to be created")
+	} else if got.SID != ss.SID || !got.Valid {
+		t.Errorf("expected the existing session, got %+v", got)
+	}
+
+	if got, created := s.GetOrCreate(httptest.NewRequest(http.MethodGet, "/", nil)); !created {
+		t.Error("expected a session to be created without a cookie")
+	} else if got.Valid || got.SID == uuid.Nil {
+		t.Errorf("expected a fresh session, got %+v", got)
+	}
+
+	clock.Advance(2 * time.Hour)
+
+	if got, created := s.GetOrCreate(r); !created {
+		t.Error("expected a session to be created in place of an expired one")
+	} else if got.SID == ss.SID || got.State != nil {
+		t.Errorf("expected a fresh session, got %+v", got)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	s, clock := newStore(t)
+
+	ss := cookiesession.NewSession().WithState([]byte("state"))
+	v := value(t, s, ss)
+
+	for _, tc := range []struct {
+		name  string
+		value string
+		at    time.Duration
+	}{
+		{name: "fresh", value: v},
+		{name: "tampered", value: tamper(t, v)},
+		{name: "garbage", value: "garbage"},
+		{name: "expired", value: v, at: 2 * time.Hour},
+	} {
+		clock.Set(epoch.Add(tc.at))
+
+		full, err := s.Decode(tc.value)
+		sid, ok := s.Verify(tc.value)
+
+		if ok != (err == nil) {
+			t.Errorf("%s: expected Verify to agree with Decode's %v, got %v", tc.name, err, ok)
+		} else if ok && (sid != full.SID || sid != ss.SID) {
+			t.Errorf("%s: expected SID %s, got %s", tc.name, full.SID, sid)
+		} else if !ok && sid != uuid.Nil {
+			t.Errorf("%s: expected no SID, got %s", tc.name, sid)
+		}
+	}
+}
+
+func TestTTLFunc(t *testing.T) {
+	s, clock := newStore(t)
+	s.ClockSkew = -1
+
+	short, long := uuid.UUID{1}, uuid.UUID{2}
+	s.TTLFunc = func(ss *cookiesession.Session) time.Duration {
+		if ss.UID == short {
+			return time.Hour
+		}
+
+		return 8 * time.Hour
+	}
+
+	issue := func(uid uuid.UUID) *http.Cookie {
+		ss := cookiesession.NewSession().WithState([]byte("state"))
+		ss.SetUID(uid)
+
+		rec := httptest.NewRecorder()
+		if err := s.Save(rec, ss); err != nil {
+			t.Fatal(err)
+		}
+
+		return rec.Result().Cookies()[0]
+	}
+
+	a, b := issue(short), issue(long)
+
+	if a.MaxAge != 60*60 || b.MaxAge != 8*60*60 {
+		t.Errorf("expected cookie lifetimes of 1 and 8 hours, got %d and %d seconds", a.MaxAge, b.MaxAge)
+	}
+
+	clock.Advance(2 * time.Hour)
+
+	for _, tc := range []struct {
+		c   *http.Cookie
+		err error
+	}{
+		{c: a, err: cookiesession.ErrExpired},
+		{c: b, err: nil},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.AddCookie(&http.Cookie{Name: tc.c.Name, Value: tc.c.Value})
+
+		if _, err := s.GetE(r); err != tc.err {
+			t.Errorf("expected %v after two hours, got %v", tc.err, err)
+		}
+	}
+}
+
+func TestGetFromQuery(t *testing.T) {
+	s, _ := newStore(t)
+
+	ss := cookiesession.NewSession().WithState([]byte("magic"))
+	v := value(t, s, ss)
+
+	query := func(q string) *http.Request {
+		return httptest.NewRequest(http.MethodGet, "/login?"+q, nil)
+	}
+
+	if got := s.GetFromQuery(query("token="+url.QueryEscape(v)), "token"); !got.Valid || got.SID != ss.SID || string(got.Bytes()) != "magic" {
+		t.Errorf("expected the session from the query, got %+v", got)
+	}
+
+	for name, q := range map[string]string{
+		"absent":    "other=" + url.QueryEscape(v),
+		"empty":     "token=",
+		"malformed": "token=garbage",
+		"tampered":  "token=" + url.QueryEscape(tamper(t, v)),
+	} {
+		if got := s.GetFromQuery(query(q), "token"); got.Valid || got.SID == ss.SID {
+			t.Errorf("%s: expected a fresh session, got %+v", name, got)
+		}
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	s, _ := newStore(t)
+
+	frozen := func() *cookiesession.Session {
+		in := cookiesession.NewSession().WithState([]byte("state"))
+		in.AddFlash("info", "hello")
+
+		ss := s.Get(save(t, s, in))
+		ss.Freeze()
+
+		return &ss
+	}
+
+	for name, mutate := range map[string]func(ss *cookiesession.Session){
+		"SetBytes":      func(ss *cookiesession.Session) { ss.SetBytes([]byte("changed")) },
+		"WithState":     func(ss *cookiesession.Session) { ss.WithState([]byte("changed")) },
+		"SetUID":        func(ss *cookiesession.Session) { ss.SetUID(uuid.UUID{1}) },
+		"WithUID":       func(ss *cookiesession.Session) { ss.WithUID(uuid.UUID{1}) },
+		"MarkDirty":     func(ss *cookiesession.Session) { ss.MarkDirty() },
+		"RegenerateID":  func(ss *cookiesession.Session) { ss.RegenerateID() },
+		"Impersonate":   func(ss *cookiesession.Session) { ss.Impersonate(uuid.UUID{1}) },
+		"SetClaim":      func(ss *cookiesession.Session) { ss.SetClaim("role", "admin") },
+		"AddFlash":      func(ss *cookiesession.Session) { ss.AddFlash("info", "again") },
+		"Flashes":       func(ss *cookiesession.Session) { ss.Flashes() },
+		"RecordAuth":    func(ss *cookiesession.Session) { ss.RecordAuth("pwd", epoch) },
+		"RemoveSection": func(ss *cookiesession.Session) { ss.RemoveSection("a") },
+		"MergeState": func(ss *cookiesession.Session) {
+			ss.MergeState(cookiesession.NewSession(), func(existing, incoming []byte) []byte { return incoming })
+		},
+	} {
+		ss := frozen()
+
+		func() {
+			defer func() {
+				if err := recover(); err != cookiesession.ErrReadOnly {
+					t.Errorf("%s: expected a panic with %v, got %v", name, cookiesession.ErrReadOnly, err)
+				}
+			}()
+
+			mutate(ss)
+		}()
+
+		if string(ss.State) != "state" || ss.Dirty() {
+			t.Errorf("%s: expected the frozen session to be unchanged, got %+v", name, ss)
+		}
+	}
+
+	ss := frozen()
+
+	if err := ss.EncodeState(map[string]string{"a": "b"}); err != cookiesession.ErrReadOnly {
+		t.Errorf("expected %v from EncodeState, got %v", cookiesession.ErrReadOnly, err)
+	}
+	if err := ss.SetEncodedValue("a", "b"); err != cookiesession.ErrReadOnly {
+		t.Errorf("expected %v from SetEncodedValue, got %v", cookiesession.ErrReadOnly, err)
+	}
+	if err := ss.SetSection("a", []byte("b"), [32]byte{}); err != cookiesession.ErrReadOnly {
+		t.Errorf("expected %v from SetSection, got %v", cookiesession.ErrReadOnly, err)
+	}
+	if err := s.Save(httptest.NewRecorder(), ss); err != cookiesession.ErrReadOnly {
+		t.Errorf("expected %v from Save, got %v", cookiesession.ErrReadOnly, err)
+	}
+
+	if !ss.Frozen() {
+		t.Error("expected the session to report being frozen")
+	}
+}
+
+func TestClone(t *testing.T) {
+	s, _ := newStore(t)
+	s.OldKeys = [][32]byte{{1}}
+	s.ExtraAttributes = []string{"Priority=High"}
+
+	n := s.Clone("flash")
+
+	ss := cookiesession.NewSession().WithState([]byte("state"))
+
+	rec := httptest.NewRecorder()
+	if err := n.Save(rec, ss); err != nil {
+		t.Fatal(err)
+	}
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "flash" {
+		t.Fatalf("expected a single cookie named flash, got %v", rec.Header()["Set-Cookie"])
+	}
+
+	if got, err := n.GetE(request(rec)); err != nil {
+		t.Fatal(err)
+	} else if got.SID != ss.SID || string(got.Bytes()) != "state" {
+		t.Errorf("expected the clone to read its own cookie, got %+v", got)
+	}
+
+	if s.Name != "session" {
+		t.Errorf("expected the original's name to be unchanged, got %q", s.Name)
+	}
+
+	n.OldKeys[0] = [32]byte{2}
+	n.ExtraAttributes[0] = "Priority=Low"
+	if s.OldKeys[0] != ([32]byte{1}) || s.ExtraAttributes[0] != "Priority=High" {
+		t.Errorf("expected changes to the clone not to affect the original, got %x and %v", s.OldKeys[0], s.ExtraAttributes)
+	}
+}
+
+func TestMarshalBinaryGolden(t *testing.T) {
+	ss := cookiesession.Session{
+		Time:    epoch,
+		Created: epoch.Add(-time.Hour),
+		SID:     uuid.UUID{1},
+		UID:     uuid.UUID{2},
+		RealUID: uuid.UUID{2},
+		Epoch:   3,
+		Seq:     4,
+		State:   []byte("st\x00te"),
+	}
+
+	want := "01" + // version
+		"0000000065e1c340" + // time
+		"01000000000000000000000000000000" + // sid
+		"02000000000000000000000000000000" + // uid
+		"02000000000000000000000000000000" + // real uid
+		"010400000003" + // epoch
+		"070400000004" + // seq
+		"03080000000065e1b530" + // created
+		"00" + // end of fields
+		"7374007465" // state
+
+	b, err := ss.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	} else if got := hex.EncodeToString(b); got != want {
+		t.Fatalf("expected\n%s\ngot\n%s", want, got)
+	}
+
+	var out cookiesession.Session
+	if err := out.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	} else if out.Epoch != 3 || out.Seq != 4 || !out.Created.Equal(ss.Created) || string(out.State) != "st\x00te" {
+		t.Errorf("expected the golden encoding to decode, got %+v", out)
+	}
+
+	var old cookiesession.Session
+	if err := old.UnmarshalBinary(legacy(epoch, ss.SID, ss.UID, "st\x00te")); err != nil {
+		t.Fatal(err)
+	} else if old.SID != ss.SID || old.Epoch != 0 || old.Seq != 0 || string(old.State) != "st\x00te" {
+		t.Errorf("expected the legacy encoding to decode, got %+v", old)
+	}
+}
+
+func TestSetUID(t *testing.T) {
+	alice, bob, carol := uuid.UUID{1}, uuid.UUID{2}, uuid.UUID{3}
+
+	var ss cookiesession.Session
+	ss.SetUID(alice)
+
+	if ss.UID != alice || ss.RealUID != alice || !ss.Dirty() {
+		t.Fatalf("expected both UID and RealUID to be set and the session dirty, got %s and %s", ss.UID, ss.RealUID)
+	}
+
+	ss.SetUID(bob)
+	if ss.UID != bob || ss.RealUID != bob {
+		t.Fatalf("expected a new login to replace both, got %s and %s", ss.UID, ss.RealUID)
+	}
+
+	ss.Impersonate(carol)
+	ss.SetUID(alice)
+	if ss.UID != alice || ss.RealUID != bob {
+		t.Fatalf("expected an impersonation to keep RealUID, got %s and %s", ss.UID, ss.RealUID)
+	}
+}
+
+func TestSaveSession(t *testing.T) {
+	s, _ := newStore(t)
+	s.Domain = "example.com"
+	s.SameSite = http.SameSiteLaxMode
+	s.Secure = true
+	s.HttpOnly = true
+
+	rec := httptest.NewRecorder()
+
+	c, err := s.SaveSession(rec, cookiesession.NewSession().WithState([]byte("state")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected one cookie, got %v", rec.Header()["Set-Cookie"])
+	}
+
+	p := cookies[0]
+	if c.Name != p.Name || c.Value != p.Value || c.Path != p.Path || c.Domain != p.Domain {
+		t.Errorf("expected the returned cookie to match the header, got %+v and %+v", c, p)
+	}
+	if c.MaxAge != p.MaxAge || !c.Expires.Equal(p.Expires) {
+		t.Errorf("expected the lifetimes to match, got %d, %s and %d, %s", c.MaxAge, c.Expires, p.MaxAge, p.Expires)
+	}
+	if c.Secure != p.Secure || c.HttpOnly != p.HttpOnly || c.SameSite != p.SameSite {
+		t.Errorf("expected the attributes to match, got %+v and %+v", c, p)
+	}
+}
+
+func TestOnErrorNameMismatch(t *testing.T) {
+	a, _ := newStore(t)
+	a.BindName = true
+	b := a.WithName("preferences")
+
+	var reasons []string
+	b.OnError = func(r *http.Request, reason string, err error) {
+		reasons = append(reasons, reason)
+	}
+
+	v := value(t, a, cookiesession.NewSession().WithState([]byte("state")))
+
+	for _, presented := range []string{v, tamper(t, v)} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.AddCookie(&http.Cookie{Name: b.Name, Value: presented})
+		b.Get(r)
+	}
+
+	if len(reasons) != 2 || reasons[0] != "name_mismatch" || reasons[1] != "decrypt_failed" {
+		t.Fatalf("expected a swapped cookie to be told apart from a corrupt one, got %v", reasons)
+	}
+}
+
+func TestTimeGranularity(t *testing.T) {
+	s, clock := newStore(t)
+	s.TimeGranularity = time.Minute
+
+	ss := cookiesession.NewSession().WithState([]byte("state"))
+
+	stamp := func() time.Time {
+		ss.MarkDirty()
+		if err := s.Save(httptest.NewRecorder(), ss); err != nil {
+			t.Fatal(err)
+		}
+
+		return ss.Time
+	}
+
+	clock.Set(epoch.Add(5 * time.Second))
+	first := stamp()
+
+	clock.Set(epoch.Add(50 * time.Second))
+	second := stamp()
+
+	if !first.Equal(epoch) || !second.Equal(first) {
+		t.Errorf("expected saves within a minute to share a Time, got %s and %s", first, second)
+	}
+
+	clock.Set(epoch.Add(61 * time.Second))
+	if third := stamp(); !third.Equal(epoch.Add(time.Minute)) {
+		t.Errorf("expected a save in the next minute to move Time on, got %s", third)
+	}
+
+	s.TimeGranularity = 0
+	clock.Set(epoch.Add(90*time.Second + 500*time.Millisecond))
+	if fourth := stamp(); !fourth.Equal(epoch.Add(90 * time.Second)) {
+		t.Errorf("expected the default to round to the second, got %s", fourth)
+	}
+}
+
+func TestMaxAgeOverflow(t *testing.T) {
+	s, _ := newStore(t)
+	s.TTL = 100 * 365 * 24 * time.Hour
+
+	rec := httptest.NewRecorder()
+	if err := s.Save(rec, cookiesession.NewSession().WithState([]byte("state"))); err != nil {
+		t.Fatal(err)
+	}
+
+	if c := rec.Result().Cookies()[0]; c.MaxAge != int(cookiesession.MaxCookieAge/time.Second) {
+		t.Fatalf("expected Max-Age to be clamped to %d, got %d", int(cookiesession.MaxCookieAge/time.Second), c.MaxAge)
+	}
+	if opts := s.CookieOptions(); opts.MaxAge != int(cookiesession.MaxCookieAge/time.Second) {
+		t.Fatalf("expected CookieOptions to clamp Max-Age too, got %d", opts.MaxAge)
+	}
+}
+
+func TestMaxCookieAge(t *testing.T) {
+	s, clock := newStore(t)
+	s.TTL = 2 * 365 * 24 * time.Hour
+
+	var buf bytes.Buffer
+	s.Logger = log.New(&buf, "", 0)
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		if err := s.Save(rec, cookiesession.NewSession().WithState([]byte("state"))); err != nil {
+			t.Fatal(err)
+		}
+
+		c := rec.Result().Cookies()[0]
+		if !c.Expires.Equal(epoch.Add(cookiesession.MaxCookieAge)) {
+			t.Errorf("expected Expires to be clamped to 400 days, got %s", c.Expires)
+		}
+		if c.MaxAge != 400*24*60*60 {
+			t.Errorf("expected Max-Age to be clamped to 400 days, got %d", c.MaxAge)
+		}
+	}
+
+	if n := strings.Count(buf.String(), "outlives browsers'"); n != 1 {
+		t.Errorf("expected a single warning, got %d: %q", n, buf.String())
+	}
+
+	r := save(t, s, cookiesession.NewSession().WithState([]byte("state")))
+	clock.Advance(500 * 24 * time.Hour)
+
+	if _, err := s.GetE(r); err != nil {
+		t.Errorf("expected the server to still honour the longer TTL, got %v", err)
+	}
+}
+
+func TestWithName(t *testing.T) {
+	s, _ := newStore(t)
+	n := s.WithName("preferences")
+
+	if s.Name != "session" || n.Name != "preferences" {
+		t.Fatalf("expected the original to keep its name, got %q and %q", s.Name, n.Name)
+	}
+
+	for _, store := range []*cookiesession.Store{s, n} {
+		ss := cookiesession.NewSession().WithState([]byte("state"))
+
+		rec := httptest.NewRecorder()
+		if err := store.Save(rec, ss); err != nil {
+			t.Fatal(err)
+		}
+
+		if c := rec.Result().Cookies(); len(c) != 1 || c[0].Name != store.Name {
+			t.Errorf("expected a cookie named %q, got %v", store.Name, rec.Header()["Set-Cookie"])
+		}
+		if got, err := store.GetE(request(rec)); err != nil || got.SID != ss.SID {
+			t.Errorf("%s: expected the store to read its own cookie, got %+v, %v", store.Name, got, err)
+		}
+	}
+}
+
+func TestSwappedNonce(t *testing.T) {
+	s, _ := newStore(t)
+
+	raw := func(v string) []byte {
+		b, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return b
+	}
+
+	a := raw(value(t, s, cookiesession.NewSession().WithState([]byte("aaaa"))))
+	b := raw(value(t, s, cookiesession.NewSession().WithState([]byte("bbbb"))))
+
+	if len(a) != len(b) {
+		t.Fatalf("expected tokens of the same length, got %d and %d", len(a), len(b))
+	}
+
+	swapped := append(append([]byte(nil), a[:24]...), b[24:]...)
+
+	if _, err := s.Decode(base64.StdEncoding.EncodeToString(swapped)); err != cookiesession.ErrDecryptFailed {
+		t.Fatalf("expected %v for one token's nonce on another's ciphertext, got %v", cookiesession.ErrDecryptFailed, err)
+	}
+}
+
+func TestNamespaced(t *testing.T) {
+	s, _ := newStore(t)
+	n := s.Namespaced("admin-")
+
+	if n.Name != "admin-session" || s.Name != "session" {
+		t.Fatalf("expected admin-session alongside session, got %q and %q", n.Name, s.Name)
+	}
+
+	ss := cookiesession.NewSession().WithState([]byte("state"))
+
+	rec := httptest.NewRecorder()
+	if err := n.Save(rec, ss); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := n.GetE(request(rec)); err != nil || got.SID != ss.SID {
+		t.Errorf("expected the namespaced cookie to round-trip, got %+v, %v", got, err)
+	}
+
+	rec = httptest.NewRecorder()
+	n.Clear(rec)
+	if c := rec.Result().Cookies(); len(c) != 1 || c[0].Name != "admin-session" || c[0].MaxAge >= 0 {
+		t.Errorf("expected Clear to delete the namespaced cookie, got %v", rec.Header()["Set-Cookie"])
+	}
+
+	s.Name = "__Host-session"
+	if n := s.Namespaced("admin-"); n.Name != "__Host-admin-session" {
+		t.Errorf("expected the prefix to stay first, got %q", n.Name)
+	}
+}
+
+func TestLegacyDecoder(t *testing.T) {
+	s, _ := newStore(t)
+
+	sid, uid := uuid.UUID{1}, uuid.UUID{2}
+
+	// The fork's format was a JSON object sealed in place of the binary one.
+	type forkSession struct {
+		SID   uuid.UUID `json:"sid"`
+		UID   uuid.UUID `json:"uid"`
+		Time  int64     `json:"time"`
+		State string    `json:"state"`
+	}
+
+	plaintext, err := json.Marshal(forkSession{SID: sid, UID: uid, Time: epoch.Unix(), State: "cart"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := s.SealPlaintext(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: s.Name, Value: v})
+
+	if _, err := s.GetE(r); err == nil {
+		t.Fatal("expected the fork's format to be rejected without a LegacyDecoder")
+	}
+
+	s.LegacyDecoder = func(plaintext []byte) (*cookiesession.Session, bool) {
+		var fs forkSession
+		if err := json.Unmarshal(plaintext, &fs); err != nil {
+			return nil, false
+		}
+
+		at := time.Unix(fs.Time, 0)
+
+		return &cookiesession.Session{SID: fs.SID, UID: fs.UID, RealUID: fs.UID, Time: at, Created: at, State: []byte(fs.State)}, true
+	}
+
+	ss, err := s.GetE(r)
+	if err != nil {
+		t.Fatal(err)
+	} else if ss.SID != sid || ss.UID != uid || string(ss.State) != "cart" || !ss.Valid {
+		t.Fatalf("expected the fork's session, got %+v", ss)
+	} else if !ss.Dirty() {
+		t.Fatal("expected a legacy session to be marked dirty so it's rewritten")
+	}
+
+	rec := httptest.NewRecorder()
+	if saved, err := s.SaveIfChanged(rec, &ss); err != nil {
+		t.Fatal(err)
+	} else if !saved {
+		t.Fatal("expected the legacy session to be saved")
+	}
+
+	upgraded, _ := newStore(t)
+	if got, err := upgraded.GetE(request(rec)); err != nil {
+		t.Fatalf("expected the rewritten cookie to decode without a LegacyDecoder, got %v", err)
+	} else if got.SID != sid || string(got.State) != "cart" {
+		t.Errorf("expected the upgraded session, got %+v", got)
+	}
+}
+
+func TestUID(t *testing.T) {
+	s, clock := newStore(t)
+
+	ss := cookiesession.NewSession().WithState([]byte("state"))
+	ss.SetUID(uuid.UUID{7})
+	v := value(t, s, ss)
+
+	for _, tc := range []struct {
+		name  string
+		value string
+		at    time.Duration
+	}{
+		{name: "valid", value: v},
+		{name: "no cookie"},
+		{name: "garbage", value: "garbage"},
+		{name: "tampered", value: tamper(t, v)},
+		{name: "expired", value: v, at: 2 * time.Hour},
+	} {
+		clock.Set(epoch.Add(tc.at))
+
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tc.value != "" {
+			r.AddCookie(&http.Cookie{Name: s.Name, Value: tc.value})
+		}
+
+		full, err := s.GetE(r)
+		uid, ok := s.UID(r)
+
+		if ok != (err == nil && full.Valid) {
+			t.Errorf("%s: expected UID to agree with Get's %v, got %v", tc.name, err, ok)
+		} else if ok && uid != full.UID {
+			t.Errorf("%s: expected UID %s, got %s", tc.name, full.UID, uid)
+		} else if !ok && uid != uuid.Nil {
+			t.Errorf("%s: expected no UID, got %s", tc.name, uid)
+		}
+	}
+}
+
+func TestSaveIfAbsent(t *testing.T) {
+	s, clock := newStore(t)
+
+	rec := httptest.NewRecorder()
+	if wrote, err := s.SaveIfAbsent(rec, httptest.NewRequest(http.MethodGet, "/", nil), cookiesession.NewSession().WithState([]byte("state"))); err != nil {
+		t.Fatal(err)
+	} else if !wrote || len(rec.Result().Cookies()) != 1 {
+		t.Fatalf("expected a cookie to be written when there was none, got %v", rec.Header()["Set-Cookie"])
+	}
+
+	r := request(rec)
+
+	rec = httptest.NewRecorder()
+	if wrote, err := s.SaveIfAbsent(rec, r, cookiesession.NewSession().WithState([]byte("other"))); err != nil {
+		t.Fatal(err)
+	} else if wrote || len(rec.Header()["Set-Cookie"]) != 0 {
+		t.Fatalf("expected nothing to be written over a valid cookie, got %v", rec.Header()["Set-Cookie"])
+	}
+
+	clock.Advance(2 * time.Hour)
+
+	rec = httptest.NewRecorder()
+	if wrote, err := s.SaveIfAbsent(rec, r, cookiesession.NewSession().WithState([]byte("other"))); err != nil {
+		t.Fatal(err)
+	} else if !wrote {
+		t.Fatal("expected a cookie to be written in place of an expired one")
+	}
+}
+
+func TestPreserveTime(t *testing.T) {
+	s, clock := newStore(t)
+	s.PreserveTime = true
+
+	r := save(t, s, cookiesession.NewSession().WithState([]byte("state")))
+
+	for i := 0; i < 3; i++ {
+		clock.Advance(10 * time.Minute)
+
+		ss := s.Get(r)
+		ss.SetBytes([]byte("changed"))
+
+		r = save(t, s, &ss)
+
+		if got := s.Get(r); !got.Time.Equal(epoch) {
+			t.Fatalf("expected Time to stay at the first save, got %s after save %d", got.Time, i+2)
+		}
+	}
+
+	clock.Set(epoch.Add(s.TTL + 2*time.Minute))
+	if _, err := s.GetE(r); err != cookiesession.ErrExpired {
+		t.Fatalf("expected TTL to count from the first save, got %v", err)
+	}
+
+	s.PreserveTime = false
+	ss := cookiesession.NewSession().WithState([]byte("state"))
+	ss.Time = epoch
+	if err := s.Save(httptest.NewRecorder(), ss); err != nil {
+		t.Fatal(err)
+	} else if !ss.Time.Equal(clock.Now()) {
+		t.Fatalf("expected Save to reset Time without PreserveTime, got %s", ss.Time)
+	}
+}
+
+func TestClearFromRequest(t *testing.T) {
+	s, _ := newStore(t)
+	s.Path = "/app"
+
+	r := save(t, s, cookiesession.NewSession().WithState([]byte("state")))
+
+	rec := httptest.NewRecorder()
+	s.ClearFromRequest(rec, r)
+
+	paths := map[string]bool{}
+	for _, c := range rec.Result().Cookies() {
+		if c.Name != s.Name || c.MaxAge >= 0 || c.Value != "" {
+			t.Errorf("expected only deletions of %q, got %s", s.Name, c)
+		}
+		paths[c.Path] = true
+	}
+
+	if !paths["/app"] || !paths["/"] {
+		t.Errorf("expected deletions at both the configured path and the root, got %v", rec.Header()["Set-Cookie"])
+	}
+
+	rec = httptest.NewRecorder()
+	s.ClearFromRequest(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if len(rec.Header()["Set-Cookie"]) != 0 {
+		t.Errorf("expected nothing to be cleared without a cookie, got %v", rec.Header()["Set-Cookie"])
+	}
+}
+
+func TestBadEncoding(t *testing.T) {
+	s, _ := newStore(t)
+
+	var reasons []string
+	s.OnError = func(r *http.Request, reason string, err error) {
+		reasons = append(reasons, reason)
+	}
+
+	undecryptable := base64.StdEncoding.EncodeToString(make([]byte, 64))
+
+	for _, tc := range []struct {
+		value string
+		err   error
+	}{
+		{value: strings.Repeat("not*base64!", 10), err: cookiesession.ErrBadEncoding},
+		{value: undecryptable, err: cookiesession.ErrDecryptFailed},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.AddCookie(&http.Cookie{Name: s.Name, Value: tc.value})
+
+		if _, err := s.GetE(r); err != tc.err {
+			t.Errorf("expected %v, got %v", tc.err, err)
+		}
+	}
+
+	if len(reasons) != 2 || reasons[0] != "bad_encoding" || reasons[1] != "decrypt_failed" {
+		t.Errorf("expected distinct reasons, got %v", reasons)
+	}
+}
+
+func TestAnonymous(t *testing.T) {
+	s, _ := newStore(t)
+
+	ss := s.Get(httptest.NewRequest(http.MethodGet, "/", nil))
+	if !ss.Anonymous() || ss.UID != uuid.Nil {
+		t.Fatalf("expected a fresh session to be anonymous, got uid %s", ss.UID)
+	}
+
+	ss.SetBytes([]byte("cart"))
+	if got := s.Get(save(t, s, &ss)); !got.Anonymous() {
+		t.Fatalf("expected a saved anonymous session to stay anonymous, got uid %s", got.UID)
+	}
+
+	ss.SetUID(uuid.UUID{1})
+	if ss.Anonymous() {
+		t.Fatal("expected SetUID to make the session authenticated")
+	}
+
+	if got := s.Get(save(t, s, &ss)); got.Anonymous() || got.UID != (uuid.UUID{1}) {
+		t.Fatalf("expected the authenticated session to load with its uid, got %s", got.UID)
+	}
+}
+
+func TestPadTo(t *testing.T) {
+	s, _ := newStore(t)
+	s.PadTo = 64
+
+	lengths := map[int]bool{}
+	for _, state := range []string{"", "", "a little state", strings.Repeat("x", 40)} {
+		ss := cookiesession.NewSession().WithState([]byte(state))
+		v := value(t, s, ss)
+		lengths[len(v)] = true
+
+		got, err := s.Decode(v)
+		if err != nil {
+			t.Fatal(err)
+		} else if got.SID != ss.SID || string(got.State) != state {
+			t.Errorf("expected padded state %q to decode, got %q", state, got.State)
+		}
+	}
+
+	if len(lengths) != 1 {
+		t.Errorf("expected every cookie to be the same length, got %v", lengths)
+	}
+
+	s.PadTo = 0
+	short := value(t, s, cookiesession.NewSession().WithState([]byte("a")))
+	long := value(t, s, cookiesession.NewSession().WithState([]byte(strings.Repeat("x", 40))))
+	if len(short) == len(long) {
+		t.Error("expected lengths to differ without PadTo")
+	}
+}
+
+func TestAltHeader(t *testing.T) {
+	s, _ := newStore(t)
+	s.AltHeader = "X-Session"
+
+	ss := cookiesession.NewSession().WithState([]byte("state"))
+	v := value(t, s, ss)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Session", v)
+
+	if got, err := s.GetE(r); err != nil {
+		t.Fatal(err)
+	} else if got.SID != ss.SID || string(got.State) != "state" {
+		t.Fatalf("expected the session from the header, got %+v", got)
+	}
+
+	other := cookiesession.NewSession().WithState([]byte("cookie"))
+	r.AddCookie(&http.Cookie{Name: s.Name, Value: value(t, s, other)})
+	if got := s.Get(r); got.SID != other.SID {
+		t.Errorf("expected the cookie to win over the header, got %s", got.SID)
+	}
+
+	s.AltHeader = ""
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Session", v)
+	if got := s.Get(r); got.Valid {
+		t.Error("expected the header to be ignored without AltHeader")
+	}
+}
+
+func TestMarshalBinaryTo(t *testing.T) {
+	ss := cookiesession.Session{
+		Time:    epoch,
+		Created: epoch,
+		SID:     uuid.UUID{1},
+		UID:     uuid.UUID{2},
+		RealUID: uuid.UUID{2},
+		Claims:  map[string]interface{}{"role": "admin"},
+		State:   []byte("state"),
+	}
+
+	want, err := ss.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := ss.MarshalBinaryTo(nil); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(got, want) {
+		t.Errorf("expected MarshalBinaryTo(nil) to match MarshalBinary, got %x", got)
+	}
+
+	for _, dst := range [][]byte{[]byte("prefix"), make([]byte, 3, 1024)} {
+		prefix := append([]byte(nil), dst...)
+
+		got, err := ss.MarshalBinaryTo(dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(got[:len(prefix)], prefix) || !bytes.Equal(got[len(prefix):], want) {
+			t.Errorf("expected the encoding appended after %q, got %x", prefix, got)
+		}
+	}
+}
+
+func TestFutureSession(t *testing.T) {
+	s, _ := newStore(t)
+
+	for _, tc := range []struct {
+		ahead time.Duration
+		err   error
+	}{
+		{ahead: 30 * time.Second, err: nil},
+		{ahead: 2 * time.Hour, err: cookiesession.ErrFutureSession},
+	} {
+		v, err := s.MintFor(uuid.UUID{1}, nil, -tc.ahead)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := s.Decode(v); err != tc.err {
+			t.Errorf("%s ahead: expected %v, got %v", tc.ahead, tc.err, err)
+		}
+	}
+
+	s.ClockSkew = 3 * time.Hour
+	if v, err := s.MintFor(uuid.UUID{1}, nil, -2*time.Hour); err != nil {
+		t.Fatal(err)
+	} else if _, err := s.Decode(v); err != nil {
+		t.Errorf("expected a larger ClockSkew to allow it, got %v", err)
+	}
+}
+
+func TestAutoSecure(t *testing.T) {
+	s, _ := newStore(t)
+	s.AutoSecure = true
+
+	cookie := func(target string) *http.Cookie {
+		rec := httptest.NewRecorder()
+		if err := s.SaveFor(rec, httptest.NewRequest(http.MethodGet, target, nil), cookiesession.NewSession().WithState([]byte("state"))); err != nil {
+			t.Fatal(err)
+		}
+
+		return rec.Result().Cookies()[0]
+	}
+
+	if c := cookie("https://example.com/"); !c.Secure || c.SameSite != http.SameSiteLaxMode {
+		t.Errorf("expected Secure and SameSite=Lax over https, got %s", c)
+	}
+	if c := cookie("http://localhost/"); c.Secure || c.SameSite != 0 {
+		t.Errorf("expected neither Secure nor SameSite over http, got %s", c)
+	}
+
+	s.SameSite = http.SameSiteStrictMode
+	if c := cookie("https://example.com/"); c.SameSite != http.SameSiteStrictMode {
+		t.Errorf("expected a configured SameSite to be kept, got %s", c)
+	}
+}
+
+func TestSessionSave(t *testing.T) {
+	s, _ := newStore(t)
+
+	got, err := s.GetE(save(t, s, cookiesession.NewSession().WithState([]byte("state"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got.WithState([]byte("changed"))
+
+	rec := httptest.NewRecorder()
+	if err := got.Save(rec); err != nil {
+		t.Fatal(err)
+	}
+
+	if again, err := s.GetE(request(rec)); err != nil {
+		t.Fatal(err)
+	} else if again.SID != got.SID || string(again.State) != "changed" {
+		t.Errorf("expected the session saved with its store, got %+v", again)
+	}
+
+	if err := cookiesession.NewSession().WithState([]byte("state")).Save(httptest.NewRecorder()); err != cookiesession.ErrNoStore {
+		t.Errorf("expected %v for a session without a store, got %v", cookiesession.ErrNoStore, err)
+	}
+}
+
+func TestMarshalSize(t *testing.T) {
+	for name, configure := range map[string]func(ss *cookiesession.Session){
+		"empty":       func(ss *cookiesession.Session) {},
+		"small state": func(ss *cookiesession.Session) { ss.WithState([]byte("state")) },
+		"large state": func(ss *cookiesession.Session) { ss.WithState(bytes.Repeat([]byte{1}, 20000)) },
+		"times": func(ss *cookiesession.Session) {
+			ss.Created = epoch
+			ss.ExpiresAt = epoch.Add(time.Hour)
+			ss.Epoch, ss.Seq = 3, 200
+		},
+		"auth": func(ss *cookiesession.Session) {
+			ss.RecordAuth("pwd", epoch)
+			ss.RecordAuth(strings.Repeat("m", 200), epoch)
+		},
+		"flashes": func(ss *cookiesession.Session) {
+			ss.AddFlash("info", strings.Repeat("hello ", 50))
+			ss.AddFlash("error", "")
+		},
+		"claims": func(ss *cookiesession.Session) {
+			ss.SetClaim("role", "admin")
+			ss.SetClaim("n", 42)
+		},
+		"sections": func(ss *cookiesession.Session) {
+			if err := ss.SetSection("alpha", bytes.Repeat([]byte{2}, 300), [32]byte{1}); err != nil {
+				t.Fatal(err)
+			}
+		},
+		"impersonating": func(ss *cookiesession.Session) {
+			ss.SetUID(uuid.UUID{1})
+			ss.Impersonate(uuid.UUID{2})
+		},
+	} {
+		ss := cookiesession.NewSession()
+		ss.Time = epoch
+		configure(ss)
+
+		b, err := ss.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		if n := ss.MarshalSize(); n != len(b) {
+			t.Errorf("%s: expected MarshalSize to be %d, got %d", name, len(b), n)
+		}
+	}
+}
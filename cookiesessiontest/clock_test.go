@@ -0,0 +1,53 @@
+package cookiesessiontest_test
+
+import (
+	"testing"
+	"time"
+
+	"fknsrs.biz/p/cookiesession"
+	"fknsrs.biz/p/cookiesession/cookiesessiontest"
+)
+
+var epoch = time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+func TestClock(t *testing.T) {
+	c := cookiesessiontest.NewClock(epoch)
+	if !c.Now().Equal(epoch) {
+		t.Fatalf("expected the clock to start at %s, got %s", epoch, c.Now())
+	}
+
+	c.Advance(90 * time.Minute)
+	if want := epoch.Add(90 * time.Minute); !c.Now().Equal(want) {
+		t.Errorf("expected %s after Advance, got %s", want, c.Now())
+	}
+
+	c.Set(epoch)
+	if !c.Now().Equal(epoch) {
+		t.Errorf("expected %s after Set, got %s", epoch, c.Now())
+	}
+}
+
+func TestClockExpiry(t *testing.T) {
+	c := cookiesessiontest.NewClock(epoch)
+
+	s := cookiesessiontest.NewStore("session", t.Name())
+	s.Now = c.Now
+
+	name, value, _, err := s.EncodeCookie(cookiesession.NewSession().WithState([]byte("state")))
+	if err != nil {
+		t.Fatal(err)
+	} else if name != "session" {
+		t.Fatalf("expected the store's cookie name, got %q", name)
+	}
+
+	if ss, err := s.Decode(value); err != nil {
+		t.Fatal(err)
+	} else if !ss.Time.Equal(epoch) {
+		t.Errorf("expected the session stamped with the clock's time, got %s", ss.Time)
+	}
+
+	c.Advance(2 * time.Hour)
+	if _, err := s.Decode(value); err != cookiesession.ErrExpired {
+		t.Errorf("expected %v once the clock passes the TTL, got %v", cookiesession.ErrExpired, err)
+	}
+}
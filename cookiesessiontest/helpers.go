@@ -0,0 +1,97 @@
+package cookiesessiontest
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+// NewStore returns a Store for tests whose key, nonces and SIDs all come
+// from seed, so that the same test always produces the same cookies. It
+// must never be used outside tests.
+func NewStore(name, seed string) *cookiesession.Store {
+	s := cookiesession.NewWithKey(name, sha256.Sum256([]byte("cookiesessiontest key "+seed)), time.Hour)
+	s.Rand = NewReader(seed)
+
+	return s
+}
+
+// NewReader returns a reader of an endless deterministic stream of bytes
+// derived from seed, for use in place of random numbers in tests. It's safe
+// for concurrent use.
+func NewReader(seed string) io.Reader {
+	return &reader{seed: sha256.Sum256([]byte(seed))}
+}
+
+type reader struct {
+	mu    sync.Mutex
+	seed  [32]byte
+	n     uint64
+	block []byte
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := 0; i < len(p); {
+		if len(r.block) == 0 {
+			var ctr [8]byte
+			binary.BigEndian.PutUint64(ctr[:], r.n)
+			r.n++
+
+			sum := sha256.Sum256(append(r.seed[:], ctr[:]...))
+			r.block = sum[:]
+		}
+
+		n := copy(p[i:], r.block)
+		r.block = r.block[n:]
+		i += n
+	}
+
+	return len(p), nil
+}
+
+// InjectSession adds a cookie carrying ss, saved by s, to r, as if a browser
+// had sent it.
+func InjectSession(r *http.Request, s *cookiesession.Store, ss *cookiesession.Session) error {
+	name, value, _, err := s.EncodeCookie(ss)
+	if err != nil {
+		return err
+	}
+
+	r.AddCookie(&http.Cookie{Name: name, Value: value})
+
+	return nil
+}
+
+// ExtractSession returns the session that a handler saved with s to rec,
+// failing the test if there isn't one or it can't be decoded.
+func ExtractSession(t testing.TB, s *cookiesession.Store, rec *httptest.ResponseRecorder) cookiesession.Session {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range rec.Result().Cookies() {
+		if c.MaxAge >= 0 {
+			r.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+		}
+	}
+
+	if !s.HasCookie(r) {
+		t.Fatalf("cookiesessiontest: response has no %q cookie", s.Name)
+	}
+
+	ss, err := s.GetE(r)
+	if err != nil {
+		t.Fatalf("cookiesessiontest: couldn't decode %q cookie: %s", s.Name, err)
+	}
+
+	return ss
+}
@@ -0,0 +1,98 @@
+package cookiesessiontest_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/satori/go.uuid"
+
+	"fknsrs.biz/p/cookiesession"
+	"fknsrs.biz/p/cookiesession/cookiesessiontest"
+)
+
+func TestNewReader(t *testing.T) {
+	read := func(r io.Reader, n int) []byte {
+		b := make([]byte, n)
+		if _, err := io.ReadFull(r, b); err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	a, b := cookiesessiontest.NewReader("seed"), cookiesessiontest.NewReader("seed")
+
+	// Reads of different sizes still give the same stream.
+	first := append(read(a, 10), read(a, 90)...)
+	if !bytes.Equal(first, read(b, 100)) {
+		t.Error("expected readers with the same seed to give the same bytes")
+	}
+
+	if bytes.Equal(read(cookiesessiontest.NewReader("other"), 100), first) {
+		t.Error("expected readers with different seeds to differ")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			read(a, 64)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestNewStore(t *testing.T) {
+	save := func(seed string) string {
+		s := cookiesessiontest.NewStore("session", seed)
+		s.Now = cookiesessiontest.NewClock(epoch).Now
+
+		ss := cookiesession.NewSession().WithState([]byte("state"))
+		ss.SID = uuid.UUID{1}
+
+		_, value, _, err := s.EncodeCookie(ss)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return value
+	}
+
+	if save("seed") != save("seed") {
+		t.Error("expected stores with the same seed to produce the same cookies")
+	}
+	if save("seed") == save("other") {
+		t.Error("expected stores with different seeds to produce different cookies")
+	}
+}
+
+func TestInjectExtractSession(t *testing.T) {
+	s := cookiesessiontest.NewStore("session", t.Name())
+
+	in := cookiesession.NewSession().WithState([]byte("state"))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if err := cookiesessiontest.InjectSession(r, s, in); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := s.Middleware(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		ss := cookiesession.FromContext(r.Context())
+		if ss.SID != in.SID || string(ss.State) != "state" {
+			t.Errorf("expected the injected session, got %+v", ss)
+		}
+
+		ss.WithState([]byte("changed"))
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+
+	if out := cookiesessiontest.ExtractSession(t, s, rec); out.SID != in.SID || string(out.State) != "changed" {
+		t.Errorf("expected the handler's session, got %+v", out)
+	}
+}
@@ -0,0 +1,135 @@
+package cookiesession
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+)
+
+var (
+	ErrMissingCSRFToken = errors.New("request has no csrf token")
+	ErrBadCSRFToken     = errors.New("csrf token doesn't match the session")
+)
+
+const (
+	DefaultCSRFHeader = "X-CSRF-Token"
+	DefaultCSRFField  = "csrf_token"
+)
+
+// CSRFToken returns the session's CSRF token, to be embedded in forms or
+// sent back in a header. Tokens aren't stored in the cookie; they're derived
+// from the SID under the store's key, so they change whenever the SID does,
+// such as on Regenerate. A session that hasn't been saved yet is marked
+// dirty, so that the SID its token is derived from sticks. Sessions that
+// don't know their Store have no token.
+func (s *Session) CSRFToken() string {
+	if s.store == nil {
+		return ""
+	}
+
+	if !s.Valid && !s.readOnly {
+		s.dirty = true
+	}
+
+	return s.store.CSRFToken(s)
+}
+
+// CSRFToken returns ss's CSRF token; see Session.CSRFToken.
+func (s *Store) CSRFToken(ss *Session) string {
+	key, _, err := s.activeKey()
+	if err != nil {
+		return ""
+	}
+
+	return base64.RawURLEncoding.EncodeToString(s.csrfSum(key, ss))
+}
+
+func (s *Store) csrfSum(key [32]byte, ss *Session) []byte {
+	key = s.envKey(key)
+
+	sub := hmac.New(sha256.New, key[:])
+	sub.Write([]byte("cookiesession csrf"))
+
+	mac := hmac.New(sha256.New, sub.Sum(nil))
+	mac.Write(ss.SID.Bytes())
+
+	return mac.Sum(nil)
+}
+
+// VerifyCSRF checks the CSRF token sent with r, in the CSRFHeader header or
+// else the CSRFField form field, against the request's session, which is
+// taken from Middleware if it's in use.
+func (s *Store) VerifyCSRF(r *http.Request) error {
+	ss := FromContext(r.Context())
+	if ss == nil {
+		loaded, err := s.GetE(r)
+		if err != nil {
+			return err
+		}
+		ss = &loaded
+	}
+
+	token := r.Header.Get(s.csrfHeader())
+	if token == "" {
+		token = r.PostFormValue(s.csrfField())
+	}
+	if token == "" {
+		return ErrMissingCSRFToken
+	}
+
+	sum, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return ErrBadCSRFToken
+	}
+
+	var keys [][32]byte
+	if s.KeyRing != nil {
+		keys = s.ringKeys()
+	} else {
+		keys = s.keys()
+	}
+
+	for _, key := range keys {
+		if hmac.Equal(sum, s.csrfSum(key, ss)) {
+			return nil
+		}
+	}
+
+	return ErrBadCSRFToken
+}
+
+// CSRFMiddleware rejects requests with unsafe methods, anything but GET,
+// HEAD, OPTIONS and TRACE, whose CSRF token doesn't pass VerifyCSRF, with
+// 403 Forbidden. It should be inside Middleware, if that's in use.
+func (s *Store) CSRFMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		default:
+			if err := s.VerifyCSRF(r); err != nil {
+				http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+		}
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+func (s *Store) csrfHeader() string {
+	if s.CSRFHeader != "" {
+		return s.CSRFHeader
+	}
+
+	return DefaultCSRFHeader
+}
+
+func (s *Store) csrfField() string {
+	if s.CSRFField != "" {
+		return s.CSRFField
+	}
+
+	return DefaultCSRFField
+}
@@ -0,0 +1,209 @@
+package cookiesession_test
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+// csrf saves a new session with s and returns it, along with a request
+// carrying its cookie.
+func csrf(t *testing.T, s *cookiesession.Store) (cookiesession.Session, *http.Request) {
+	t.Helper()
+
+	ss := s.Get(httptest.NewRequest(http.MethodGet, "/", nil))
+	ss.SetBytes([]byte("state"))
+
+	r := save(t, s, &ss)
+
+	return ss, r
+}
+
+// post returns a POST request carrying r's cookies and form as its body.
+func post(r *http.Request, form url.Values) *http.Request {
+	p := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	p.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, c := range r.Cookies() {
+		p.AddCookie(c)
+	}
+
+	return p
+}
+
+// flipped returns token with one bit of its MAC flipped.
+func flipped(t *testing.T, token string) string {
+	t.Helper()
+
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		t.Fatalf("couldn't decode token: %s", err)
+	}
+
+	b[len(b)/2] ^= 1
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func TestCSRFToken(t *testing.T) {
+	s, _ := newStore(t)
+
+	ss, r := csrf(t, s)
+
+	token := ss.CSRFToken()
+	if token == "" {
+		t.Fatal("expected a token")
+	}
+
+	loaded := s.Get(r)
+	if loaded.CSRFToken() != token {
+		t.Fatal("expected the token to stay the same while the SID does")
+	}
+
+	other, _ := csrf(t, s)
+	if other.CSRFToken() == token {
+		t.Fatal("expected each session to have its own token")
+	}
+
+	if cookiesession.NewSession().CSRFToken() != "" {
+		t.Fatal("expected a session without a store to have no token")
+	}
+
+	fresh := s.Get(httptest.NewRequest(http.MethodGet, "/", nil))
+	fresh.CSRFToken()
+	if !fresh.Dirty() {
+		t.Fatal("expected asking an unsaved session for its token to mark it dirty")
+	}
+}
+
+func TestVerifyCSRF(t *testing.T) {
+	s, _ := newStore(t)
+
+	ss, r := csrf(t, s)
+	token := ss.CSRFToken()
+
+	header := post(r, nil)
+	header.Header.Set(cookiesession.DefaultCSRFHeader, token)
+	if err := s.VerifyCSRF(header); err != nil {
+		t.Fatalf("expected the token in the header to pass, got %v", err)
+	}
+
+	if err := s.VerifyCSRF(post(r, url.Values{cookiesession.DefaultCSRFField: {token}})); err != nil {
+		t.Fatalf("expected the token in the form to pass, got %v", err)
+	}
+
+	if err := s.VerifyCSRF(post(r, nil)); err != cookiesession.ErrMissingCSRFToken {
+		t.Fatalf("expected %v without a token, got %v", cookiesession.ErrMissingCSRFToken, err)
+	}
+
+	for _, bad := range []string{"not base64!", token[1:], flipped(t, token)} {
+		if err := s.VerifyCSRF(post(r, url.Values{cookiesession.DefaultCSRFField: {bad}})); err != cookiesession.ErrBadCSRFToken {
+			t.Errorf("expected %v for %q, got %v", cookiesession.ErrBadCSRFToken, bad, err)
+		}
+	}
+
+	other, _ := csrf(t, s)
+	if err := s.VerifyCSRF(post(r, url.Values{cookiesession.DefaultCSRFField: {other.CSRFToken()}})); err != cookiesession.ErrBadCSRFToken {
+		t.Fatalf("expected another session's token to be rejected, got %v", err)
+	}
+}
+
+func TestVerifyCSRFCustomNames(t *testing.T) {
+	s, _ := newStore(t)
+	s.CSRFHeader = "X-Token"
+	s.CSRFField = "token"
+
+	ss, r := csrf(t, s)
+	token := ss.CSRFToken()
+
+	header := post(r, nil)
+	header.Header.Set("X-Token", token)
+	if err := s.VerifyCSRF(header); err != nil {
+		t.Fatalf("expected the token in CSRFHeader to pass, got %v", err)
+	}
+
+	if err := s.VerifyCSRF(post(r, url.Values{"token": {token}})); err != nil {
+		t.Fatalf("expected the token in CSRFField to pass, got %v", err)
+	}
+
+	if err := s.VerifyCSRF(post(r, url.Values{cookiesession.DefaultCSRFField: {token}})); err != cookiesession.ErrMissingCSRFToken {
+		t.Fatalf("expected the default field to be ignored, got %v", err)
+	}
+}
+
+func TestVerifyCSRFOldKey(t *testing.T) {
+	s, _ := newStore(t)
+
+	ss, r := csrf(t, s)
+	token := ss.CSRFToken()
+
+	s.Rotate("new secret")
+
+	if err := s.VerifyCSRF(post(r, url.Values{cookiesession.DefaultCSRFField: {token}})); err != nil {
+		t.Fatalf("expected a token under an old key to pass, got %v", err)
+	}
+
+	loaded := s.Get(r)
+	if loaded.CSRFToken() == token {
+		t.Fatal("expected new tokens to be made under the new key")
+	}
+
+	loaded.SetBytes([]byte("resaved"))
+	r = save(t, s, &loaded)
+
+	s.SetKeys(s.Key, nil)
+	if err := s.VerifyCSRF(post(r, url.Values{cookiesession.DefaultCSRFField: {token}})); err != cookiesession.ErrBadCSRFToken {
+		t.Fatalf("expected a token under a dropped key to be rejected, got %v", err)
+	}
+}
+
+func TestCSRFMiddleware(t *testing.T) {
+	s, _ := newStore(t)
+
+	ss, r := csrf(t, s)
+	token := ss.CSRFToken()
+
+	var served int
+	h := s.Middleware(s.CSRFMiddleware(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		served++
+	})))
+
+	for _, method := range []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace} {
+		safe := httptest.NewRequest(method, "/", nil)
+		for _, c := range r.Cookies() {
+			safe.AddCookie(c)
+		}
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, safe)
+		if rec.Code != http.StatusOK {
+			t.Errorf("expected %s without a token to pass, got %d", method, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, post(r, nil))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a POST without a token to be forbidden, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, post(r, url.Values{cookiesession.DefaultCSRFField: {flipped(t, token)}}))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a POST with a bad token to be forbidden, got %d", rec.Code)
+	}
+
+	if served != 4 {
+		t.Fatalf("expected only the safe requests to reach the handler, got %d", served)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, post(r, url.Values{cookiesession.DefaultCSRFField: {token}}))
+	if rec.Code != http.StatusOK || served != 5 {
+		t.Fatalf("expected a POST with the token to pass, got %d", rec.Code)
+	}
+}
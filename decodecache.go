@@ -0,0 +1,195 @@
+package cookiesession
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DecodeCache is a bounded LRU cache of recently decoded cookie values, so
+// that a burst of requests carrying the same cookie only has to open it once.
+// Hits still go through the same expiry, epoch and replay checks as a fresh
+// decode, so a cached session is never accepted once its token isn't.
+// Entries are keyed by the store's name, keys, key ring, Environment and
+// BindName as well as the cookie value, so a value stops hitting the cache as
+// soon as those change in a way that could stop it decoding.
+type DecodeCache struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	ll    *list.List
+	items map[[32]byte]*list.Element
+}
+
+type decodeCacheEntry struct {
+	key     [32]byte
+	ss      Session
+	expires time.Time
+}
+
+// NewDecodeCache returns a cache holding at most size sessions, each for no
+// longer than ttl as measured by the Now of the store using it.
+func NewDecodeCache(size int, ttl time.Duration) *DecodeCache {
+	return &DecodeCache{
+		size:  size,
+		ttl:   ttl,
+		ll:    list.New(),
+		items: make(map[[32]byte]*list.Element, size),
+	}
+}
+
+// Purge empties the cache, wiping the sessions in it.
+func (c *DecodeCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for e := c.ll.Front(); e != nil; e = e.Next() {
+		wipe(e.Value.(*decodeCacheEntry).ss.State)
+	}
+
+	c.ll.Init()
+	c.items = make(map[[32]byte]*list.Element, c.size)
+}
+
+// Len returns the number of sessions in the cache.
+func (c *DecodeCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.ll.Len()
+}
+
+func (c *DecodeCache) get(scope [32]byte, value string, now time.Time) (Session, bool) {
+	key := decodeCacheKey(scope, value)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[key]
+	if !ok {
+		return Session{}, false
+	}
+
+	entry := e.Value.(*decodeCacheEntry)
+	if now.After(entry.expires) || (!entry.ss.ExpiresAt.IsZero() && now.After(entry.ss.ExpiresAt)) {
+		c.remove(e)
+		return Session{}, false
+	}
+
+	c.ll.MoveToFront(e)
+
+	return cloneSession(entry.ss), true
+}
+
+func (c *DecodeCache) add(scope [32]byte, value string, ss Session, now time.Time) {
+	if c.size <= 0 {
+		return
+	}
+
+	key := decodeCacheKey(scope, value)
+	entry := &decodeCacheEntry{key: key, ss: cloneSession(ss), expires: now.Add(c.ttl)}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		c.remove(e)
+	}
+
+	c.items[key] = c.ll.PushFront(entry)
+
+	for c.ll.Len() > c.size {
+		c.remove(c.ll.Back())
+	}
+}
+
+func (c *DecodeCache) remove(e *list.Element) {
+	entry := c.ll.Remove(e).(*decodeCacheEntry)
+	delete(c.items, entry.key)
+	wipe(entry.ss.State)
+}
+
+// decodeCacheKey hashes the store's cacheScope in with value.
+func decodeCacheKey(scope [32]byte, value string) [32]byte {
+	h := sha256.New()
+	h.Write(scope[:])
+	h.Write([]byte(value))
+
+	var key [32]byte
+	copy(key[:], h.Sum(nil))
+
+	return key
+}
+
+// cacheScope hashes together everything about the store that decides whether
+// and how a value decodes, since stores made with Clone or WithName share
+// their cache, and the key ring, Environment and BindName are plain fields
+// that can change without the cache hearing about it.
+func (s *Store) cacheScope() [32]byte {
+	h := sha256.New()
+	h.Write([]byte(s.Name))
+	h.Write([]byte{0})
+	h.Write([]byte(s.Environment))
+	h.Write([]byte{0})
+
+	if s.BindName {
+		h.Write([]byte{1})
+	} else {
+		h.Write([]byte{0})
+	}
+
+	for i := 0; ; i++ {
+		key, ok := s.keyAt(i)
+		if !ok {
+			break
+		}
+		h.Write(key[:])
+	}
+
+	ids := make([]string, 0, len(s.KeyRing))
+	for id := range s.KeyRing {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		key := s.KeyRing[id]
+		h.Write([]byte(id))
+		h.Write([]byte{0})
+		h.Write(key[:])
+	}
+
+	var scope [32]byte
+	copy(scope[:], h.Sum(nil))
+
+	return scope
+}
+
+// cloneSession returns a copy of ss that shares no memory with it.
+func cloneSession(ss Session) Session {
+	c := ss
+	c.State = append([]byte(nil), ss.State...)
+	c.certHash = append([]byte(nil), ss.certHash...)
+	c.binding = append([]byte(nil), ss.binding...)
+	c.Auth = append([]AuthRecord(nil), ss.Auth...)
+	c.flashes = append([]Flash(nil), ss.flashes...)
+	c.buf = nil
+
+	if ss.Claims != nil {
+		c.Claims = make(map[string]interface{}, len(ss.Claims))
+		for k, v := range ss.Claims {
+			c.Claims[k] = v
+		}
+	}
+
+	if ss.sections != nil {
+		c.sections = make(map[string][]byte, len(ss.sections))
+		for k, v := range ss.sections {
+			c.sections[k] = append([]byte(nil), v...)
+		}
+	}
+
+	return c
+}
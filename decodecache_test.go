@@ -0,0 +1,143 @@
+package cookiesession_test
+
+import (
+	"testing"
+	"time"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+func TestDecodeCache(t *testing.T) {
+	s, clock := newStore(t)
+	s.DecodeCache = cookiesession.NewDecodeCache(2, time.Minute)
+
+	ss := cookiesession.NewSession().WithState([]byte("state"))
+	r := save(t, s, ss)
+
+	got, err := s.GetE(r)
+	if err != nil {
+		t.Fatal(err)
+	} else if s.DecodeCache.Len() != 1 {
+		t.Fatalf("expected the session to be cached, got %d entries", s.DecodeCache.Len())
+	}
+
+	// A hit hands out a copy, so changing it leaves the cache alone.
+	got.State[0] = 'X'
+	if again, err := s.GetE(r); err != nil {
+		t.Fatal(err)
+	} else if again.SID != ss.SID || string(again.State) != "state" {
+		t.Errorf("expected an unchanged copy from the cache, got %+v", again)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := s.GetE(save(t, s, cookiesession.NewSession().WithState([]byte("other")))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := s.DecodeCache.Len(); n != 2 {
+		t.Errorf("expected the cache bounded to 2 entries, got %d", n)
+	}
+
+	s.DecodeCache.Purge()
+	if n := s.DecodeCache.Len(); n != 0 {
+		t.Errorf("expected an empty cache after Purge, got %d", n)
+	}
+
+	clock.Advance(2 * time.Hour)
+	if _, err := s.GetE(r); err != cookiesession.ErrExpired {
+		t.Errorf("expected %v for an expired session, got %v", cookiesession.ErrExpired, err)
+	}
+}
+
+func TestDecodeCacheExpired(t *testing.T) {
+	s, clock := newStore(t)
+	s.DecodeCache = cookiesession.NewDecodeCache(8, 24*time.Hour)
+
+	r := save(t, s, cookiesession.NewSession().WithState([]byte("state")))
+	if _, err := s.GetE(r); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(59 * time.Minute)
+	if _, err := s.GetE(r); err != nil {
+		t.Fatalf("expected the cached session before it expires, got %v", err)
+	}
+
+	clock.Advance(time.Hour)
+	if _, err := s.GetE(r); err != cookiesession.ErrExpired {
+		t.Errorf("expected %v once the session expired, even though it's cached, got %v", cookiesession.ErrExpired, err)
+	}
+
+	s.SetKeys([32]byte{9}, nil)
+	clock.Set(epoch)
+	if _, err := s.GetE(r); err != cookiesession.ErrDecryptFailed {
+		t.Errorf("expected %v once the keys change, got %v", cookiesession.ErrDecryptFailed, err)
+	}
+}
+
+func TestDecodeCacheRevokedKey(t *testing.T) {
+	s, _ := newStore(t)
+	s.DecodeCache = cookiesession.NewDecodeCache(8, time.Hour)
+	s.KeyRing = map[string][32]byte{"kms-a": {1}, "kms-b": {2}}
+	s.ActiveKeyID = "kms-a"
+
+	r := save(t, s, cookiesession.NewSession().WithState([]byte("state")))
+	if _, err := s.GetE(r); err != nil {
+		t.Fatal(err)
+	}
+
+	delete(s.KeyRing, "kms-a")
+	s.ActiveKeyID = "kms-b"
+
+	if _, err := s.GetE(r); err != cookiesession.ErrUnknownKeyID {
+		t.Errorf("expected %v as soon as the key is removed from the ring, got %v", cookiesession.ErrUnknownKeyID, err)
+	}
+}
+
+func TestDecodeCacheConfigChanges(t *testing.T) {
+	for name, change := range map[string]func(s *cookiesession.Store){
+		"environment": func(s *cookiesession.Store) { s.Environment = "staging" },
+		"bind name":   func(s *cookiesession.Store) { s.BindName = !s.BindName },
+		"old keys":    func(s *cookiesession.Store) { s.OldKeys = nil; s.Key = [32]byte{9} },
+	} {
+		s, _ := newStore(t)
+		s.DecodeCache = cookiesession.NewDecodeCache(8, time.Hour)
+
+		r := save(t, s, cookiesession.NewSession().WithState([]byte("state")))
+		if _, err := s.GetE(r); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		change(s)
+
+		if _, err := s.GetE(r); err == nil {
+			t.Errorf("%s: expected the cached session to be rejected once the store changed", name)
+		}
+	}
+}
+
+func BenchmarkGetDecodeCache(b *testing.B) {
+	for name, cache := range map[string]*cookiesession.DecodeCache{
+		"uncached": nil,
+		"cached":   cookiesession.NewDecodeCache(64, time.Minute),
+	} {
+		b.Run(name, func(b *testing.B) {
+			s := cookiesession.New("session", "benchmark secret", time.Hour)
+			s.DecodeCache = cache
+
+			v, err := s.Token(benchSession())
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if _, err := s.Decode(v); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
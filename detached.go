@@ -0,0 +1,44 @@
+package cookiesession
+
+import (
+	"crypto/ed25519"
+	"errors"
+)
+
+var (
+	ErrInvalidPrivateKey = errors.New("ed25519 private key has the wrong length")
+)
+
+// SignSession returns a detached Ed25519 signature over the binary form of
+// ss, which anyone with the public key can check with
+// VerifySessionSignature. It's unrelated to the cookie's own encryption, and
+// is meant for keeping a verifiable record of a session alongside audit logs.
+// Since MarshalBinary includes Time, sign the session after it was last
+// saved.
+func SignSession(ss *Session, priv ed25519.PrivateKey) ([]byte, error) {
+	if len(priv) != ed25519.PrivateKeySize {
+		return nil, ErrInvalidPrivateKey
+	}
+
+	buf, err := ss.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	return ed25519.Sign(priv, buf), nil
+}
+
+// VerifySessionSignature reports whether sig is a signature made by
+// SignSession over ss with the private key matching pub.
+func VerifySessionSignature(ss *Session, sig []byte, pub ed25519.PublicKey) bool {
+	if len(pub) != ed25519.PublicKeySize {
+		return false
+	}
+
+	buf, err := ss.MarshalBinary()
+	if err != nil {
+		return false
+	}
+
+	return ed25519.Verify(pub, buf, sig)
+}
@@ -0,0 +1,54 @@
+package cookiesession_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"testing"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+func TestSignSession(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(bytes.NewReader(make([]byte, ed25519.SeedSize)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ss := cookiesession.NewSession().WithState([]byte("state"))
+	ss.Time = epoch
+
+	sig, err := cookiesession.SignSession(ss, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cookiesession.VerifySessionSignature(ss, sig, pub) {
+		t.Fatal("expected the signature to verify")
+	}
+
+	tampered := append([]byte(nil), sig...)
+	tampered[0] ^= 1
+	if cookiesession.VerifySessionSignature(ss, tampered, pub) {
+		t.Error("expected a tampered signature not to verify")
+	}
+
+	other, _, err := ed25519.GenerateKey(bytes.NewReader(bytes.Repeat([]byte{1}, ed25519.SeedSize)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cookiesession.VerifySessionSignature(ss, sig, other) {
+		t.Error("expected the signature not to verify with another public key")
+	}
+
+	ss.WithState([]byte("changed"))
+	if cookiesession.VerifySessionSignature(ss, sig, pub) {
+		t.Error("expected the signature not to verify once the session changed")
+	}
+
+	if _, err := cookiesession.SignSession(ss, priv[:16]); err != cookiesession.ErrInvalidPrivateKey {
+		t.Errorf("expected %v for a short private key, got %v", cookiesession.ErrInvalidPrivateKey, err)
+	}
+	if cookiesession.VerifySessionSignature(ss, sig, pub[:16]) {
+		t.Error("expected a short public key not to verify")
+	}
+}
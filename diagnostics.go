@@ -0,0 +1,143 @@
+package cookiesession
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SessionDiagnostics describes what a Store makes of a request's session
+// cookie, for debugging endpoints. It never includes State or key material.
+type SessionDiagnostics struct {
+	Present       bool
+	ValidEncoding bool
+	Decrypted     bool
+
+	// KeyIndex is 0 if the session opened with Key, i+1 if it opened with
+	// OldKeys[i], and -1 if it didn't open or the store uses a KeyRing, in
+	// which case KeyID names the key instead.
+	KeyIndex int
+	KeyID    string
+
+	Session   Session
+	Expired   bool
+	Remaining time.Duration
+	Err       error
+}
+
+// DecodeRequest reports on the first session cookie in r, going through each
+// step of decoding it in turn. Session is scrubbed as by Session.Scrub.
+func (s *Store) DecodeRequest(r *http.Request) SessionDiagnostics {
+	d := SessionDiagnostics{KeyIndex: -1}
+
+	c, err := r.Cookie(s.Name)
+	if err != nil {
+		d.Err = err
+		return d
+	}
+
+	d.Present = true
+
+	value, err := s.unchunk(r, c.Value)
+	if err != nil {
+		d.Err = err
+		return d
+	}
+
+	kid, err := s.checkEncoding(value)
+	if err != nil {
+		d.Err = err
+		return d
+	}
+
+	d.ValidEncoding = true
+
+	ss, err := s.DecodeValue(value)
+	if err != nil {
+		d.Err = err
+		return d
+	}
+
+	d.Decrypted = true
+	d.Session = ss.Scrub()
+	wipe(ss.State)
+
+	if s.KeyRing != nil {
+		d.KeyID = kid
+	} else {
+		for i, key := range s.keys() {
+			probe := s.WithName(s.Name)
+			probe.Key = key
+			probe.OldKeys = nil
+			probe.DecodeCache = nil
+
+			if _, err := probe.DecodeValue(value); err == nil {
+				d.KeyIndex = i
+				break
+			}
+		}
+	}
+
+	if !ss.ExpiresAt.IsZero() {
+		d.Remaining = ss.ExpiresAt.Sub(s.now())
+	} else if ttl := s.ttl(&ss); ttl > 0 {
+		d.Remaining = ss.Time.Add(ttl).Sub(s.now())
+	}
+
+	d.Err = s.check(r.Context(), &ss)
+	d.Expired = d.Err == ErrExpired
+
+	return d
+}
+
+// checkEncoding reports whether value, an unchunked cookie value, is encoded
+// the way decodeValue expects, and returns the id of the key it names if it's
+// sealed under a KeyRing.
+func (s *Store) checkEncoding(value string) (string, error) {
+	if s.publicMetadata() {
+		var err error
+		if _, _, value, err = splitMetadata(value, s.MetadataKey); err != nil {
+			return "", err
+		}
+	}
+
+	if s.CompactJWE {
+		parts := strings.Split(value, ".")
+		if len(parts) != 5 {
+			return "", ErrInvalidJWE
+		}
+
+		for _, part := range parts {
+			if _, err := base64.RawURLEncoding.DecodeString(part); err != nil {
+				return "", ErrBadEncoding
+			}
+		}
+
+		var header jweHeader
+		if b, err := base64.RawURLEncoding.DecodeString(parts[0]); err == nil {
+			json.Unmarshal(b, &header)
+		}
+
+		return header.Kid, nil
+	}
+
+	_, value, err := s.splitCipher(value)
+	if err != nil {
+		return "", err
+	}
+
+	raw, err := valueEncoding(value).DecodeString(value)
+	if err != nil {
+		return "", ErrBadEncoding
+	}
+
+	if s.KeyRing == nil {
+		return "", nil
+	}
+
+	kid, _, _ := keyID(raw)
+
+	return kid, nil
+}
@@ -0,0 +1,79 @@
+package cookiesession_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+func TestDecodeRequest(t *testing.T) {
+	s, clock := newStore(t)
+
+	ss := cookiesession.NewSession().WithState([]byte("secret state"))
+	r := save(t, s, ss)
+
+	clock.Advance(15 * time.Minute)
+
+	d := s.DecodeRequest(r)
+	if !d.Present || !d.ValidEncoding || !d.Decrypted || d.Err != nil {
+		t.Fatalf("expected a valid session, got %+v", d)
+	}
+	if d.KeyIndex != 0 {
+		t.Errorf("expected the session to open with Key, got index %d", d.KeyIndex)
+	}
+	if d.Session.SID != ss.SID || strings.Contains(string(d.Session.State), "secret state") {
+		t.Errorf("expected the scrubbed session, got %+v", d.Session)
+	}
+	if d.Expired || d.Remaining != 45*time.Minute {
+		t.Errorf("expected 45m remaining, got %s (expired %v)", d.Remaining, d.Expired)
+	}
+
+	clock.Advance(time.Hour)
+
+	d = s.DecodeRequest(r)
+	if !d.Decrypted || !d.Expired || d.Err != cookiesession.ErrExpired || d.Remaining >= 0 {
+		t.Errorf("expected an expired session, got %+v", d)
+	}
+}
+
+func TestDecodeRequestOldKey(t *testing.T) {
+	s, _ := newStore(t)
+	r := save(t, s, cookiesession.NewSession().WithState([]byte("state")))
+
+	old := s.Key
+	s.Key = [32]byte{9}
+	s.OldKeys = [][32]byte{{8}, old}
+
+	if d := s.DecodeRequest(r); !d.Decrypted || d.KeyIndex != 2 {
+		t.Errorf("expected the session to open with the second old key, got %+v", d)
+	}
+}
+
+func TestDecodeRequestInvalid(t *testing.T) {
+	s, _ := newStore(t)
+
+	d := s.DecodeRequest(httptest.NewRequest(http.MethodGet, "/", nil))
+	if d.Present || d.Err != http.ErrNoCookie || d.KeyIndex != -1 {
+		t.Errorf("expected a missing cookie, got %+v", d)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: s.Name, Value: tamper(t, value(t, s, cookiesession.NewSession().WithState([]byte("state"))))})
+
+	d = s.DecodeRequest(r)
+	if !d.Present || !d.ValidEncoding || d.Decrypted || d.Err != cookiesession.ErrDecryptFailed || d.KeyIndex != -1 {
+		t.Errorf("expected a tampered cookie to fail to decrypt, got %+v", d)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: s.Name, Value: "not*base64!not*base64!not*base64!not*base64!not*base64!not*base64!"})
+
+	d = s.DecodeRequest(r)
+	if !d.Present || d.ValidEncoding || d.Err != cookiesession.ErrBadEncoding {
+		t.Errorf("expected a badly encoded cookie, got %+v", d)
+	}
+}
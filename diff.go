@@ -0,0 +1,45 @@
+package cookiesession
+
+import (
+	"bytes"
+)
+
+// SessionChange describes what changed between two versions of a session, in
+// a form that's safe to log: it never includes State itself.
+type SessionChange struct {
+	SID                  bool
+	UID                  bool
+	RealUID              bool
+	ImpersonationStarted bool
+	ImpersonationStopped bool
+	State                bool
+	OldStateLen          int
+	NewStateLen          int
+	Valid                bool
+	Epoch                bool
+}
+
+// Changed reports whether anything changed at all.
+func (c SessionChange) Changed() bool {
+	return c.SID || c.UID || c.RealUID || c.State || c.Valid || c.Epoch
+}
+
+// Diff compares s to prev, usually a copy taken before a handler ran.
+// Impersonation starts and stops as IsImpersonating reports it.
+func (s *Session) Diff(prev *Session) SessionChange {
+	wasImpersonating := prev.IsImpersonating()
+	isImpersonating := s.IsImpersonating()
+
+	return SessionChange{
+		SID:                  s.SID != prev.SID,
+		UID:                  s.UID != prev.UID,
+		RealUID:              s.RealUID != prev.RealUID,
+		ImpersonationStarted: isImpersonating && !wasImpersonating,
+		ImpersonationStopped: wasImpersonating && !isImpersonating,
+		State:                !bytes.Equal(s.State, prev.State),
+		OldStateLen:          len(prev.State),
+		NewStateLen:          len(s.State),
+		Valid:                s.Valid != prev.Valid,
+		Epoch:                s.Epoch != prev.Epoch,
+	}
+}
@@ -0,0 +1,78 @@
+package cookiesession_test
+
+import (
+	"testing"
+
+	"github.com/satori/go.uuid"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+func TestDiff(t *testing.T) {
+	alice, bob := uuid.UUID{1}, uuid.UUID{2}
+
+	base := cookiesession.Session{Valid: true, SID: uuid.UUID{9}, UID: alice, RealUID: alice, State: []byte("state")}
+
+	for _, tc := range []struct {
+		name   string
+		change func(ss *cookiesession.Session)
+		want   cookiesession.SessionChange
+	}{
+		{
+			name:   "nothing",
+			change: func(ss *cookiesession.Session) {},
+			want:   cookiesession.SessionChange{OldStateLen: 5, NewStateLen: 5},
+		},
+		{
+			name:   "login as someone else",
+			change: func(ss *cookiesession.Session) { ss.UID, ss.RealUID = bob, bob },
+			want:   cookiesession.SessionChange{UID: true, RealUID: true, OldStateLen: 5, NewStateLen: 5},
+		},
+		{
+			name:   "impersonation started",
+			change: func(ss *cookiesession.Session) { ss.UID = bob },
+			want:   cookiesession.SessionChange{UID: true, ImpersonationStarted: true, OldStateLen: 5, NewStateLen: 5},
+		},
+		{
+			name:   "state",
+			change: func(ss *cookiesession.Session) { ss.State = []byte("longer state") },
+			want:   cookiesession.SessionChange{State: true, OldStateLen: 5, NewStateLen: 12},
+		},
+	} {
+		ss := base
+		tc.change(&ss)
+
+		got := ss.Diff(&base)
+		if got != tc.want {
+			t.Errorf("%s: expected %+v, got %+v", tc.name, tc.want, got)
+		}
+		if got.Changed() != (tc.name != "nothing") {
+			t.Errorf("%s: expected Changed to be %v", tc.name, tc.name != "nothing")
+		}
+	}
+}
+
+func TestDiffImpersonationStopped(t *testing.T) {
+	prev := cookiesession.Session{UID: uuid.UUID{2}, RealUID: uuid.UUID{1}}
+	ss := cookiesession.Session{UID: uuid.UUID{1}, RealUID: uuid.UUID{1}}
+
+	got := ss.Diff(&prev)
+	if !got.ImpersonationStopped || got.ImpersonationStarted || !got.UID || got.RealUID {
+		t.Fatalf("expected impersonation to have stopped, got %+v", got)
+	}
+}
+
+func TestDiffWithoutRealUID(t *testing.T) {
+	prev := cookiesession.Session{}
+	ss := cookiesession.Session{UID: uuid.UUID{1}}
+
+	got := ss.Diff(&prev)
+	if got.ImpersonationStarted || got.ImpersonationStopped || !got.UID {
+		t.Fatalf("expected a login without RealUID not to count as impersonation, got %+v", got)
+	}
+
+	prev, ss = ss, cookiesession.Session{}
+	if got := ss.Diff(&prev); got.ImpersonationStarted || got.ImpersonationStopped {
+		t.Fatalf("expected a logout without RealUID not to count as impersonation, got %+v", got)
+	}
+}
@@ -0,0 +1,45 @@
+// Package echosession loads and saves cookiesession sessions for Echo.
+package echosession
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+// ContextKey is the echo.Context key that Middleware stores the session
+// under.
+const ContextKey = "cookiesession"
+
+// Middleware returns Echo middleware that loads each request's session into
+// the echo.Context, where handlers can get it with Get, and saves it just
+// before the response headers are sent, as Store.Middleware does. A handler
+// that returns an error has its session saved before Echo's error handler
+// writes the response.
+func Middleware(s *cookiesession.Store) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			var err error
+
+			s.Middleware(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				c.SetRequest(r)
+				c.SetResponse(echo.NewResponse(rw, c.Echo()))
+				c.Set(ContextKey, cookiesession.FromContext(r.Context()))
+
+				err = next(c)
+			})).ServeHTTP(c.Response(), c.Request())
+
+			return err
+		}
+	}
+}
+
+// Get returns the session that Middleware loaded for c, or nil if there
+// isn't one.
+func Get(c echo.Context) *cookiesession.Session {
+	ss, _ := c.Get(ContextKey).(*cookiesession.Session)
+
+	return ss
+}
@@ -0,0 +1,68 @@
+package echosession_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"fknsrs.biz/p/cookiesession/cookiesessiontest"
+	"fknsrs.biz/p/cookiesession/echosession"
+)
+
+func TestMiddleware(t *testing.T) {
+	s := cookiesessiontest.NewStore("sess", "echo")
+
+	e := echo.New()
+	e.Use(echosession.Middleware(s))
+	e.GET("/set", func(c echo.Context) error {
+		echosession.Get(c).SetBytes([]byte("hello"))
+		return c.String(http.StatusOK, "ok")
+	})
+	e.GET("/get", func(c echo.Context) error {
+		return c.String(http.StatusOK, string(echosession.Get(c).State))
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/set", nil))
+
+	if got := cookiesessiontest.ExtractSession(t, s, rec); string(got.State) != "hello" {
+		t.Fatalf("expected the saved state, got %q", got.State)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/get", nil)
+	for _, c := range rec.Result().Cookies() {
+		r.AddCookie(c)
+	}
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, r)
+
+	if rec.Body.String() != "hello" {
+		t.Fatalf("expected the session to be loaded, got %q", rec.Body)
+	} else if len(rec.Result().Cookies()) != 0 {
+		t.Fatal("expected an unchanged session not to be saved again")
+	}
+}
+
+func TestMiddlewareError(t *testing.T) {
+	s := cookiesessiontest.NewStore("sess", "echo")
+
+	e := echo.New()
+	e.Use(echosession.Middleware(s))
+	e.GET("/", func(c echo.Context) error {
+		echosession.Get(c).SetBytes([]byte("hello"))
+		return errors.New("failed")
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected the error handler's response, got %d", rec.Code)
+	} else if got := cookiesessiontest.ExtractSession(t, s, rec); string(got.State) != "hello" {
+		t.Fatalf("expected the saved state, got %q", got.State)
+	}
+}
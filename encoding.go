@@ -0,0 +1,36 @@
+package cookiesession
+
+import (
+	"encoding/base64"
+	"strings"
+)
+
+func (s *Store) encoding() *base64.Encoding {
+	if s.Encoding != nil {
+		return s.Encoding
+	}
+
+	return base64.StdEncoding
+}
+
+// valueEncoding works out which of the standard or URL-safe alphabets, with
+// or without padding, value was encoded with, so that values written before
+// Encoding changed can still be read.
+func valueEncoding(value string) *base64.Encoding {
+	enc := base64.StdEncoding
+	if strings.ContainsAny(value, "-_") {
+		enc = base64.URLEncoding
+	}
+
+	if len(value)%4 != 0 && !strings.HasSuffix(value, "=") {
+		enc = enc.WithPadding(base64.NoPadding)
+	}
+
+	return enc
+}
+
+// decodedLen is the most bytes a value of length n can decode to, in any
+// of the encodings valueEncoding recognises.
+func decodedLen(n int) int {
+	return base64.RawStdEncoding.DecodedLen(n)
+}
@@ -0,0 +1,15 @@
+package cookiesession
+
+// SealPlaintext seals plaintext as a session cookie value, so that tests can
+// make values in encodings this package no longer writes.
+func (s *Store) SealPlaintext(plaintext []byte) (string, error) {
+	return s.sealValue(purposeSession, plaintext)
+}
+
+// Len returns how many revocations d is holding, expired or not.
+func (d *Denylist) Len() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return len(d.revoked)
+}
@@ -0,0 +1,71 @@
+// Package fibersession loads and saves cookiesession sessions for Fiber.
+package fibersession
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+// LocalsKey is the fiber.Ctx Locals key that New stores the session under.
+const LocalsKey = "cookiesession"
+
+// New returns a Fiber handler that loads each request's session into the
+// context's Locals, where handlers can get it with Get, and saves it once
+// the rest of the chain has run if it's dirty or due to be renewed, as with
+// SaveIfChanged. Fiber doesn't send anything until then, so the cookie is
+// never too late. Save errors are logged, as Store.Middleware does.
+func New(s *cookiesession.Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req http.Request
+		if err := fasthttpadaptor.ConvertRequest(c.Context(), &req, true); err != nil {
+			return errors.New("couldn't convert request: " + err.Error())
+		}
+
+		r := req.WithContext(c.UserContext())
+
+		ss, _ := s.GetContext(r.Context(), r)
+		c.Locals(LocalsKey, &ss)
+
+		err := c.Next()
+
+		w := headerWriter{}
+		if _, saveErr := s.SaveIfChangedFor(w, r, &ss); saveErr != nil {
+			logf(s, "cookiesession: couldn't save session %q: %s", s.Name, saveErr)
+		}
+
+		for _, v := range w.Header().Values("Set-Cookie") {
+			c.Response().Header.Add(fiber.HeaderSetCookie, v)
+		}
+
+		return err
+	}
+}
+
+// Get returns the session that New loaded for c, or nil if there isn't one.
+func Get(c *fiber.Ctx) *cookiesession.Session {
+	ss, _ := c.Locals(LocalsKey).(*cookiesession.Session)
+
+	return ss
+}
+
+// headerWriter collects the headers that a save sets, to be copied to the
+// fasthttp response.
+type headerWriter http.Header
+
+func (w headerWriter) Header() http.Header         { return http.Header(w) }
+func (w headerWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w headerWriter) WriteHeader(int)             {}
+
+func logf(s *cookiesession.Store, format string, v ...interface{}) {
+	if s.Logger != nil {
+		s.Logger.Printf(format, v...)
+	} else {
+		log.Printf(format, v...)
+	}
+}
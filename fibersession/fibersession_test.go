@@ -0,0 +1,63 @@
+package fibersession_test
+
+import (
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"fknsrs.biz/p/cookiesession"
+	"fknsrs.biz/p/cookiesession/fibersession"
+)
+
+func TestNew(t *testing.T) {
+	s := cookiesession.NewWithKey("sess", sha256.Sum256([]byte("fiber")), time.Hour)
+
+	app := fiber.New()
+	app.Use(fibersession.New(s))
+	app.Get("/set", func(c *fiber.Ctx) error {
+		fibersession.Get(c).SetBytes([]byte("hello"))
+		return c.SendString("ok")
+	})
+	app.Get("/get", func(c *fiber.Ctx) error {
+		return c.Send(fibersession.Get(c).State)
+	})
+
+	res, err := app.Test(httptest.NewRequest(http.MethodGet, "/set", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cookies := res.Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "sess" {
+		t.Fatalf("expected a session cookie, got %v", cookies)
+	}
+
+	ss, err := s.Decode(cookies[0].Value)
+	if err != nil {
+		t.Fatal(err)
+	} else if string(ss.State) != "hello" {
+		t.Fatalf("expected the saved state, got %q", ss.State)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/get", nil)
+	r.AddCookie(cookies[0])
+
+	res, err = app.Test(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	} else if string(body) != "hello" {
+		t.Fatalf("expected the session to be loaded, got %q", body)
+	} else if len(res.Cookies()) != 0 {
+		t.Fatal("expected an unchanged session not to be saved again")
+	}
+}
@@ -0,0 +1,84 @@
+package cookiesession
+
+import (
+	"encoding/binary"
+)
+
+// Flash is a one-time message for the user, such as a notice that a form was
+// saved, to be shown on the next page they see.
+type Flash struct {
+	Kind    string
+	Message string
+}
+
+// AddFlash adds a flash message of the given kind, such as "error" or
+// "info", and marks the session dirty. Flashes are kept in the cookie until
+// they're read with Flashes. If that would make more than the store's
+// MaxFlashes, the oldest are dropped.
+func (s *Session) AddFlash(kind, message string) {
+	s.mustBeWritable()
+
+	s.flashes = append(s.flashes, Flash{Kind: kind, Message: message})
+	s.dirty = true
+
+	if max := s.maxFlashes(); max > 0 && len(s.flashes) > max {
+		s.flashes = append([]Flash(nil), s.flashes[len(s.flashes)-max:]...)
+	}
+}
+
+// maxFlashes returns the MaxFlashes of the store the session came from, or
+// zero if it didn't come from one.
+func (s *Session) maxFlashes() int {
+	if s.store == nil {
+		return 0
+	}
+
+	return s.store.MaxFlashes
+}
+
+// Flashes returns the session's flash messages and removes them, marking the
+// session dirty if there were any, so that the next Save drops them.
+func (s *Session) Flashes() []Flash {
+	flashes := s.flashes
+	if len(flashes) == 0 {
+		return nil
+	}
+
+	s.mustBeWritable()
+
+	s.flashes = nil
+	s.dirty = true
+
+	return flashes
+}
+
+// marshalFlashes encodes flashes as a uvarint-prefixed kind and message each.
+func marshalFlashes(flashes []Flash) []byte {
+	var buf []byte
+	for _, f := range flashes {
+		buf = append(buf, bindName(f.Kind, nil)...)
+		buf = append(buf, bindName(f.Message, nil)...)
+	}
+
+	return buf
+}
+
+func unmarshalFlashes(value []byte) ([]Flash, error) {
+	var flashes []Flash
+	var strs [2]string
+
+	for len(value) > 0 {
+		for i := range strs {
+			n, l := binary.Uvarint(value)
+			if l <= 0 || n > uint64(len(value)-l) {
+				return nil, ErrMalformed
+			}
+			strs[i] = string(value[l : l+int(n)])
+			value = value[l+int(n):]
+		}
+
+		flashes = append(flashes, Flash{Kind: strs[0], Message: strs[1]})
+	}
+
+	return flashes, nil
+}
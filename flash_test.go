@@ -0,0 +1,54 @@
+package cookiesession_test
+
+import (
+	"testing"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+func TestMaxFlashes(t *testing.T) {
+	s, _ := newStore(t)
+	s.MaxFlashes = 3
+
+	got, err := s.GetE(save(t, s, cookiesession.NewSession().WithState([]byte("state"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, message := range []string{"one", "two", "three", "four", "five"} {
+		got.AddFlash("info", message)
+	}
+
+	got, err = s.GetE(save(t, s, &got))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flashes := got.Flashes()
+	if len(flashes) != 3 {
+		t.Fatalf("expected the flashes bounded to 3, got %d", len(flashes))
+	}
+	for i, want := range []string{"three", "four", "five"} {
+		if flashes[i].Message != want {
+			t.Errorf("%d: expected the newest flashes to be kept, got %q", i, flashes[i].Message)
+		}
+	}
+}
+
+func TestMaxFlashesUnset(t *testing.T) {
+	s, _ := newStore(t)
+
+	ss := cookiesession.NewSession()
+	for i := 0; i < 50; i++ {
+		ss.AddFlash("info", "again")
+	}
+
+	got, err := s.GetE(save(t, s, ss))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(got.Flashes()); n != 50 {
+		t.Errorf("expected every flash to be kept without a limit, got %d", n)
+	}
+}
@@ -0,0 +1,156 @@
+// Package gorillastore adapts a cookiesession.Store to the gorilla/sessions
+// Store interface, so code written against gorilla/sessions can use
+// cookiesession's encryption and wire format.
+package gorillastore
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/satori/go.uuid"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+type Store struct {
+	Store   *cookiesession.Store
+	Options *sessions.Options
+}
+
+var _ sessions.Store = (*Store)(nil)
+
+// sessionKey is the key in a gorilla session's Values under which New keeps
+// the cookiesession.Session it was decoded from, so that Save keeps its SID,
+// creation time, user and the rest instead of starting a new one. It isn't
+// saved with the other values.
+type sessionKey struct{}
+
+// Session returns the cookiesession.Session underlying session, or nil if it
+// didn't come from a Store's New.
+func Session(session *sessions.Session) *cookiesession.Session {
+	ss, _ := session.Values[sessionKey{}].(*cookiesession.Session)
+
+	return ss
+}
+
+func New(store *cookiesession.Store) *Store {
+	path := store.Path
+	if path == "" && !store.OmitPath {
+		path = "/"
+	}
+
+	return &Store{
+		Store: store,
+		Options: &sessions.Options{
+			Path:     path,
+			Domain:   store.Domain,
+			SameSite: store.SameSite,
+			MaxAge:   int(store.TTL / time.Second),
+			Secure:   store.Secure,
+			HttpOnly: store.HttpOnly,
+		},
+	}
+}
+
+// store returns a copy of the underlying Store using the given cookie name and
+// as much of opts as it can represent.
+func (s *Store) store(name string, opts *sessions.Options) *cookiesession.Store {
+	cs := s.Store.Clone(name)
+
+	if opts != nil {
+		cs.OmitPath = opts.Path == ""
+		cs.Path = opts.Path
+		cs.Domain = opts.Domain
+		cs.SameSite = opts.SameSite
+		cs.Secure = opts.Secure
+		cs.HttpOnly = opts.HttpOnly
+
+		if opts.MaxAge > 0 {
+			cs.TTL = time.Duration(opts.MaxAge) * time.Second
+		}
+	}
+
+	return cs
+}
+
+func (s *Store) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+func (s *Store) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	opts := *s.Options
+	session.Options = &opts
+	session.IsNew = true
+
+	ss := s.store(name, session.Options).Get(r)
+	session.ID = ss.SID.String()
+
+	if !ss.Valid {
+		session.Values[sessionKey{}] = &ss
+		return session, nil
+	}
+
+	if len(ss.State) > 0 {
+		if err := gob.NewDecoder(bytes.NewReader(ss.State)).Decode(&session.Values); err != nil {
+			return session, errors.New("couldn't decode session values: " + err.Error())
+		}
+	}
+
+	session.Values[sessionKey{}] = &ss
+	session.IsNew = false
+
+	return session, nil
+}
+
+func (s *Store) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	cs := s.store(session.Name(), session.Options)
+
+	if session.Options != nil && session.Options.MaxAge < 0 {
+		cs.ClearFromRequest(w, r)
+		return nil
+	}
+
+	ss := Session(session)
+	if ss == nil {
+		ss = cookiesession.NewSession()
+	}
+
+	if session.ID == "" {
+		session.ID = ss.SID.String()
+	} else if sid, err := uuid.FromString(session.ID); err != nil {
+		return errors.New("couldn't parse session id: " + err.Error())
+	} else {
+		ss.SID = sid
+	}
+
+	values := make(map[interface{}]interface{}, len(session.Values))
+	for k, v := range session.Values {
+		if _, ok := k.(sessionKey); !ok {
+			values[k] = v
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(values); err != nil {
+		return errors.New("couldn't encode session values: " + err.Error())
+	}
+
+	ss.SetBytes(buf.Bytes())
+
+	if err := cs.SaveFor(w, r, ss); err != nil {
+		return err
+	}
+
+	if session.Values == nil {
+		session.Values = make(map[interface{}]interface{})
+	}
+
+	session.Values[sessionKey{}] = ss
+
+	return nil
+}
@@ -0,0 +1,207 @@
+package gorillastore_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/satori/go.uuid"
+
+	"fknsrs.biz/p/cookiesession"
+	"fknsrs.biz/p/cookiesession/cookiesessiontest"
+	"fknsrs.biz/p/cookiesession/gorillastore"
+)
+
+// carry returns a request carrying the cookies that rec was given.
+func carry(rec *httptest.ResponseRecorder) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range rec.Result().Cookies() {
+		if c.MaxAge >= 0 {
+			r.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+		}
+	}
+
+	return r
+}
+
+func TestSaveKeepsSession(t *testing.T) {
+	clock := cookiesessiontest.NewClock(time.Unix(1700000000, 0))
+
+	cs := cookiesessiontest.NewStore("sess", "keeps")
+	cs.Now = clock.Now
+	gs := gorillastore.New(cs)
+
+	uid := uuid.NewV4()
+
+	ss := cookiesession.NewSession()
+	ss.SetUID(uid)
+
+	rec := httptest.NewRecorder()
+	if err := cs.Save(rec, ss); err != nil {
+		t.Fatal(err)
+	}
+
+	created := cookiesessiontest.ExtractSession(t, cs, rec).Created
+
+	clock.Advance(time.Minute)
+
+	session, err := gs.New(carry(rec), "sess")
+	if err != nil {
+		t.Fatal(err)
+	} else if session.IsNew {
+		t.Fatal("expected the existing session")
+	} else if session.ID != ss.SID.String() {
+		t.Fatalf("expected ID %s, got %s", ss.SID, session.ID)
+	}
+
+	if got := gorillastore.Session(session); got == nil || got.UID != uid {
+		t.Fatalf("expected the decoded session for %s, got %v", uid, got)
+	}
+
+	session.Values["a"] = "b"
+
+	r := carry(rec)
+	rec = httptest.NewRecorder()
+	if err := gs.Save(r, rec, session); err != nil {
+		t.Fatal(err)
+	}
+
+	saved := cookiesessiontest.ExtractSession(t, cs, rec)
+	if saved.SID != ss.SID {
+		t.Errorf("expected SID %s, got %s", ss.SID, saved.SID)
+	}
+	if saved.UID != uid {
+		t.Errorf("expected UID %s, got %s", uid, saved.UID)
+	}
+	if !saved.Created.Equal(created) {
+		t.Errorf("expected Created %s, got %s", created, saved.Created)
+	}
+
+	session, err = gs.New(carry(rec), "sess")
+	if err != nil {
+		t.Fatal(err)
+	} else if session.Values["a"] != "b" {
+		t.Fatalf("expected a=b, got %v", session.Values)
+	}
+}
+
+func TestSaveMintsID(t *testing.T) {
+	cs := cookiesessiontest.NewStore("sess", "mints")
+	gs := gorillastore.New(cs)
+
+	session := sessions.NewSession(gs, "sess")
+	session.Values["a"] = "b"
+
+	rec := httptest.NewRecorder()
+	if err := gs.Save(httptest.NewRequest(http.MethodGet, "/", nil), rec, session); err != nil {
+		t.Fatal(err)
+	}
+
+	if session.ID == "" {
+		t.Fatal("expected Save to mint an ID")
+	}
+
+	saved := cookiesessiontest.ExtractSession(t, cs, rec)
+	if saved.SID.String() != session.ID {
+		t.Fatalf("expected SID %s, got %s", session.ID, saved.SID)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	cs := cookiesessiontest.NewStore("sess", "round-trip")
+	var gs sessions.Store = gorillastore.New(cs)
+
+	session, err := gs.Get(httptest.NewRequest(http.MethodGet, "/", nil), "sess")
+	if err != nil {
+		t.Fatal(err)
+	} else if !session.IsNew {
+		t.Fatal("expected a new session without a cookie")
+	}
+
+	session.Values["name"] = "alice"
+	session.Values[42] = []string{"a", "b"}
+
+	rec := httptest.NewRecorder()
+	if err := session.Save(httptest.NewRequest(http.MethodGet, "/", nil), rec); err != nil {
+		t.Fatal(err)
+	}
+
+	session, err = gs.Get(carry(rec), "sess")
+	if err != nil {
+		t.Fatal(err)
+	} else if session.IsNew {
+		t.Fatal("expected the saved session")
+	}
+
+	if session.Values["name"] != "alice" {
+		t.Errorf("expected name=alice, got %v", session.Values["name"])
+	}
+	if v, ok := session.Values[42].([]string); !ok || len(v) != 2 || v[1] != "b" {
+		t.Errorf("expected 42=[a b], got %v", session.Values[42])
+	}
+}
+
+func TestOptions(t *testing.T) {
+	cs := cookiesessiontest.NewStore("sess", "options")
+	cs.Path = "/app"
+	gs := gorillastore.New(cs)
+
+	if gs.Options.Path != "/app" || gs.Options.MaxAge != 3600 {
+		t.Fatalf("expected options from the store, got %+v", gs.Options)
+	}
+
+	session, err := gs.New(httptest.NewRequest(http.MethodGet, "/", nil), "sess")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session.Options.Path = "/other"
+	session.Options.MaxAge = 60
+	session.Options.HttpOnly = true
+	session.Values["a"] = "b"
+
+	rec := httptest.NewRecorder()
+	if err := gs.Save(httptest.NewRequest(http.MethodGet, "/", nil), rec, session); err != nil {
+		t.Fatal(err)
+	}
+
+	c := rec.Result().Cookies()[0]
+	if c.Path != "/other" || c.MaxAge != 60 || !c.HttpOnly {
+		t.Fatalf("expected the session's options on the cookie, got %q", rec.Header().Get("Set-Cookie"))
+	}
+	if gs.Options.Path != "/app" {
+		t.Fatal("expected the store's options to be left alone")
+	}
+}
+
+func TestDelete(t *testing.T) {
+	cs := cookiesessiontest.NewStore("sess", "delete")
+	gs := gorillastore.New(cs)
+
+	session, err := gs.New(httptest.NewRequest(http.MethodGet, "/", nil), "sess")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.Values["a"] = "b"
+
+	rec := httptest.NewRecorder()
+	if err := gs.Save(httptest.NewRequest(http.MethodGet, "/", nil), rec, session); err != nil {
+		t.Fatal(err)
+	}
+
+	r := carry(rec)
+
+	session.Options.MaxAge = -1
+
+	rec = httptest.NewRecorder()
+	if err := gs.Save(r, rec, session); err != nil {
+		t.Fatal(err)
+	}
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].MaxAge >= 0 || cookies[0].Value != "" {
+		t.Fatalf("expected the cookie to be deleted, got %q", rec.Header()["Set-Cookie"])
+	}
+}
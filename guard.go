@@ -0,0 +1,32 @@
+package cookiesession
+
+import (
+	"crypto/sha256"
+	"log"
+)
+
+// guardState gives ss its own copy of State and remembers its checksum, so
+// that checkGuard can spot changes made without MarkDirty.
+func guardState(ss *Session) {
+	ss.State = append([]byte(nil), ss.State...)
+	ss.stateSum = sha256.Sum256(ss.State)
+	ss.guarded = true
+}
+
+func (s *Store) checkGuard(ss *Session) {
+	if !ss.guarded {
+		return
+	}
+
+	if sum := sha256.Sum256(ss.State); !ss.dirty && sum != ss.stateSum {
+		s.logf("cookiesession: state of session %s was changed without calling MarkDirty", ss.SID)
+	}
+}
+
+func (s *Store) logf(format string, v ...interface{}) {
+	if s.Logger != nil {
+		s.Logger.Printf(format, v...)
+	} else {
+		log.Printf(format, v...)
+	}
+}
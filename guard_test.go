@@ -0,0 +1,67 @@
+package cookiesession_test
+
+import (
+	"bytes"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+func TestGuardState(t *testing.T) {
+	s, _ := newStore(t)
+	s.GuardState = true
+
+	var buf bytes.Buffer
+	s.Logger = log.New(&buf, "", 0)
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("state"))
+	r := save(t, s, ss)
+
+	got := s.Get(r)
+	if err := s.Save(httptest.NewRecorder(), &got); err != nil {
+		t.Fatal(err)
+	} else if buf.Len() != 0 {
+		t.Fatalf("expected no warning for an untouched session, got %q", buf.String())
+	}
+
+	got = s.Get(r)
+	got.State[0] = 'S'
+	if err := s.Save(httptest.NewRecorder(), &got); err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(buf.String(), "without calling MarkDirty") {
+		t.Fatalf("expected a warning for state changed in place, got %q", buf.String())
+	}
+
+	buf.Reset()
+
+	got = s.Get(r)
+	got.State[0] = 'S'
+	got.MarkDirty()
+	if err := s.Save(httptest.NewRecorder(), &got); err != nil {
+		t.Fatal(err)
+	} else if buf.Len() != 0 {
+		t.Fatalf("expected no warning after MarkDirty, got %q", buf.String())
+	}
+}
+
+func TestGuardStateOff(t *testing.T) {
+	s, _ := newStore(t)
+
+	var buf bytes.Buffer
+	s.Logger = log.New(&buf, "", 0)
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("state"))
+
+	got := s.Get(save(t, s, ss))
+	got.State[0] = 'S'
+	if err := s.Save(httptest.NewRecorder(), &got); err != nil {
+		t.Fatal(err)
+	} else if buf.Len() != 0 {
+		t.Fatalf("expected no warning without GuardState, got %q", buf.String())
+	}
+}
@@ -0,0 +1,123 @@
+package cookiesession
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+var (
+	ErrNoHandoffKey = errors.New("store has no HandoffKey")
+)
+
+// DefaultHandoffTTL is how long tokens from Export last if HandoffTTL isn't
+// set.
+const DefaultHandoffTTL = time.Minute
+
+// Export seals ss as a short-lived handoff token for the service named by
+// HandoffAudience, whose store must share HandoffKey, so that a user logged
+// in to one service can be logged in to another without the services
+// sharing their cookie keys. The token is encrypted and expires after
+// HandoffTTL, but nothing stops it being used more than once until then,
+// so pass it straight to Import.
+func (s *Store) Export(ss *Session) (string, error) {
+	if s.isClosed() {
+		return "", ErrStoreClosed
+	}
+
+	if s.HandoffKey == ([32]byte{}) {
+		return "", ErrNoHandoffKey
+	}
+
+	b, err := ss.MarshalBinary()
+	if err != nil {
+		return "", errors.New("couldn't encode session: " + err.Error())
+	}
+
+	ttl := s.HandoffTTL
+	if ttl <= 0 {
+		ttl = DefaultHandoffTTL
+	}
+
+	buf := make([]byte, 8, 8+binary.MaxVarintLen64+len(s.HandoffAudience)+len(b))
+	binary.BigEndian.PutUint64(buf, uint64(s.now().Add(ttl).Unix()))
+	buf = append(buf, bindName(s.HandoffAudience, b)...)
+	wipe(b)
+
+	nonce, err := s.nonce()
+	if err != nil {
+		wipe(buf)
+		return "", errors.New("couldn't get random nonce: " + err.Error())
+	}
+
+	sealed := secretbox.Seal(nonce[:], buf, &nonce, &s.HandoffKey)
+	wipe(buf)
+
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Import opens a token made by Export for this store's Audience, and returns
+// the session it carries as a new session for this store: it gets a fresh
+// SID and is marked dirty, so that saving it logs the user in here. Bindings
+// to the exporting request, such as BindTLS's, aren't carried over.
+func (s *Store) Import(token string) (Session, error) {
+	if s.isClosed() {
+		return Session{}, ErrStoreClosed
+	}
+
+	if s.HandoffKey == ([32]byte{}) {
+		return Session{}, ErrNoHandoffKey
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return Session{}, ErrBadEncoding
+	} else if len(raw) < 24+secretbox.Overhead+8 {
+		return Session{}, ErrTooShort
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], raw)
+
+	buf, ok := secretbox.Open(nil, raw[24:], &nonce, &s.HandoffKey)
+	if !ok {
+		return Session{}, ErrDecryptFailed
+	} else if len(buf) < 8 {
+		return Session{}, ErrTooShort
+	}
+
+	if s.now().Unix() > int64(binary.BigEndian.Uint64(buf)) {
+		wipe(buf)
+		return Session{}, ErrExpired
+	}
+
+	b, err := unbindName(s.Audience, buf[8:])
+	if err == ErrNameMismatch {
+		wipe(buf)
+		return Session{}, ErrAudienceMismatch
+	} else if err != nil {
+		wipe(buf)
+		return Session{}, err
+	}
+
+	var ss Session
+	if err := ss.UnmarshalBinary(b); err != nil {
+		wipe(buf)
+		return Session{}, err
+	}
+
+	ss.SID = s.newID()
+	ss.Time = time.Time{}
+	ss.Created = time.Time{}
+	ss.Seq = 0
+	ss.Valid = false
+	ss.certHash = nil
+	ss.binding = nil
+	ss.store = s
+	ss.dirty = true
+
+	return ss, nil
+}
@@ -0,0 +1,117 @@
+package cookiesession_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/satori/go.uuid"
+
+	"fknsrs.biz/p/cookiesession"
+	"fknsrs.biz/p/cookiesession/cookiesessiontest"
+)
+
+// handoffStores returns an exporting and an importing store that share a
+// handoff key but not their cookie keys.
+func handoffStores(t *testing.T) (*cookiesession.Store, *cookiesession.Store, *cookiesessiontest.Clock) {
+	t.Helper()
+
+	from, clock := newStore(t)
+	from.HandoffKey = [32]byte{7}
+	from.HandoffAudience = "billing"
+
+	to := cookiesession.New("session", "another secret", time.Hour)
+	to.Now = clock.Now
+	to.HandoffKey = [32]byte{7}
+	to.Audience = "billing"
+
+	return from, to, clock
+}
+
+func TestExportImport(t *testing.T) {
+	from, to, clock := handoffStores(t)
+
+	ss := cookiesession.NewSession().WithUID(uuid.UUID{1}).WithState([]byte("state"))
+	ss.SetClaim("role", "admin")
+	save(t, from, ss)
+
+	token, err := from.Export(ss)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := to.Import(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.UID != ss.UID || string(got.State) != "state" || got.Claims["role"] != "admin" {
+		t.Errorf("expected the user, state and claims to be carried over, got %+v", got)
+	}
+	if got.SID == ss.SID || got.Valid || !got.Dirty() || got.Seq != 0 {
+		t.Errorf("expected a new, unsaved session, got %+v", got)
+	}
+
+	if _, err := to.GetE(save(t, to, &got)); err != nil {
+		t.Errorf("expected the imported session to save and load with the importing store, got %v", err)
+	}
+
+	clock.Advance(2 * time.Minute)
+	if _, err := to.Import(token); err != cookiesession.ErrExpired {
+		t.Errorf("expected %v once the token outlives HandoffTTL, got %v", cookiesession.ErrExpired, err)
+	}
+}
+
+func TestImportRejects(t *testing.T) {
+	from, to, _ := handoffStores(t)
+
+	token, err := from.Export(cookiesession.NewSession().WithUID(uuid.UUID{1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, _, _ := handoffStores(t)
+	other.Audience = "support"
+	if _, err := other.Import(token); err != cookiesession.ErrAudienceMismatch {
+		t.Errorf("expected %v for another audience, got %v", cookiesession.ErrAudienceMismatch, err)
+	}
+
+	other.Audience = "billing"
+	other.HandoffKey = [32]byte{8}
+	if _, err := other.Import(token); err != cookiesession.ErrDecryptFailed {
+		t.Errorf("expected %v under another handoff key, got %v", cookiesession.ErrDecryptFailed, err)
+	}
+
+	if _, err := to.Import(value(t, from, cookiesession.NewSession().WithState([]byte("state")))); err == nil {
+		t.Error("expected a session cookie not to import as a handoff token")
+	}
+
+	none, _ := newStore(t)
+	if _, err := none.Export(cookiesession.NewSession()); err != cookiesession.ErrNoHandoffKey {
+		t.Errorf("expected %v exporting without a handoff key, got %v", cookiesession.ErrNoHandoffKey, err)
+	}
+	if _, err := none.Import(token); err != cookiesession.ErrNoHandoffKey {
+		t.Errorf("expected %v importing without a handoff key, got %v", cookiesession.ErrNoHandoffKey, err)
+	}
+}
+
+func TestExportImportClosed(t *testing.T) {
+	from, to, _ := handoffStores(t)
+
+	token, err := from.Export(cookiesession.NewSession().WithUID(uuid.UUID{1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from.Close()
+	to.Close()
+
+	if _, err := from.Export(cookiesession.NewSession().WithUID(uuid.UUID{1})); err != cookiesession.ErrStoreClosed {
+		t.Errorf("expected %v exporting from a closed store, got %v", cookiesession.ErrStoreClosed, err)
+	}
+	if _, err := to.Import(token); err != cookiesession.ErrStoreClosed {
+		t.Errorf("expected %v importing into a closed store, got %v", cookiesession.ErrStoreClosed, err)
+	}
+
+	if from.HandoffKey != ([32]byte{}) || to.HandoffKey != ([32]byte{}) {
+		t.Error("expected Close to wipe the handoff key")
+	}
+}
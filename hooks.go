@@ -0,0 +1,34 @@
+package cookiesession
+
+import (
+	"errors"
+	"net/http"
+)
+
+// created returns a fresh session for r, passing it to OnCreate.
+func (s *Store) created(r *http.Request) Session {
+	ss := s.fresh()
+
+	if s.OnCreate != nil {
+		s.OnCreate(r, &ss)
+	}
+
+	return ss
+}
+
+// rejected reports a session cookie on r that couldn't be used because of
+// err to OnError, and to OnExpire or OnDecodeError. ss is what was decoded,
+// if anything.
+func (s *Store) rejected(r *http.Request, ss *Session, err error) {
+	if s.OnError != nil {
+		s.OnError(r, errorReason(err), err)
+	}
+
+	if errors.Is(err, ErrExpired) {
+		if s.OnExpire != nil && ss != nil {
+			s.OnExpire(r, ss)
+		}
+	} else if s.OnDecodeError != nil {
+		s.OnDecodeError(r, err)
+	}
+}
@@ -0,0 +1,183 @@
+package cookiesession_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"fknsrs.biz/p/cookiesession"
+	"fknsrs.biz/p/cookiesession/cookiesessiontest"
+)
+
+// hooks records the calls to a store's lifecycle hooks, along with the
+// request each was given.
+type hooks struct {
+	created  []*cookiesession.Session
+	rejected []error
+	expired  []*cookiesession.Session
+	saved    []*cookiesession.Session
+	cleared  int
+
+	requests []*http.Request
+}
+
+// hooked returns a store whose lifecycle hooks record their calls.
+func hooked(t *testing.T) (*cookiesession.Store, *cookiesessiontest.Clock, *hooks) {
+	t.Helper()
+
+	s, clock := newStore(t)
+	h := &hooks{}
+
+	s.OnCreate = func(r *http.Request, ss *cookiesession.Session) {
+		h.created = append(h.created, ss)
+		h.requests = append(h.requests, r)
+	}
+	s.OnDecodeError = func(r *http.Request, err error) {
+		h.rejected = append(h.rejected, err)
+		h.requests = append(h.requests, r)
+	}
+	s.OnExpire = func(r *http.Request, ss *cookiesession.Session) {
+		h.expired = append(h.expired, ss)
+		h.requests = append(h.requests, r)
+	}
+	s.OnSave = func(r *http.Request, ss *cookiesession.Session) {
+		h.saved = append(h.saved, ss)
+		h.requests = append(h.requests, r)
+	}
+	s.OnClear = func(r *http.Request) {
+		h.cleared++
+		h.requests = append(h.requests, r)
+	}
+
+	return s, clock, h
+}
+
+func TestOnCreate(t *testing.T) {
+	s, _, h := hooked(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	ss := s.Get(r)
+
+	if len(h.created) != 1 || h.created[0].SID != ss.SID || h.requests[0] != r {
+		t.Fatalf("expected OnCreate with the fresh session and its request, got %d calls", len(h.created))
+	}
+
+	ss.SetBytes([]byte("state"))
+	saved := save(t, s, &ss)
+
+	s.Get(saved)
+	if len(h.created) != 1 {
+		t.Fatal("expected no OnCreate for a usable session")
+	}
+
+	saved.Header.Del("Cookie")
+	saved.AddCookie(&http.Cookie{Name: s.Name, Value: "garbage"})
+
+	s.Get(saved)
+	if len(h.created) != 2 {
+		t.Fatal("expected OnCreate for the session handed out in place of an unusable one")
+	}
+}
+
+func TestOnDecodeError(t *testing.T) {
+	s, clock, h := hooked(t)
+
+	v := value(t, s, cookiesession.NewSession().WithState([]byte("state")))
+
+	get := func(v string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.AddCookie(&http.Cookie{Name: s.Name, Value: v})
+		s.Get(r)
+		return r
+	}
+
+	get(v)
+	if len(h.rejected) != 0 {
+		t.Fatalf("expected no OnDecodeError for a usable session, got %v", h.rejected)
+	}
+
+	h.requests = nil
+	r := get(tamper(t, v))
+	if len(h.rejected) != 1 || h.rejected[0] != cookiesession.ErrDecryptFailed || h.requests[0] != r {
+		t.Fatalf("expected OnDecodeError with the tampered cookie's error and request, got %v", h.rejected)
+	}
+
+	clock.Advance(s.TTL + cookiesession.DefaultClockSkew + time.Second)
+	get(v)
+	if len(h.rejected) != 1 {
+		t.Fatalf("expected no OnDecodeError for an expired session, got %v", h.rejected)
+	}
+}
+
+func TestOnExpire(t *testing.T) {
+	s, clock, h := hooked(t)
+
+	ss := cookiesession.NewSession().WithState([]byte("state"))
+	r := save(t, s, ss)
+
+	clock.Advance(s.TTL + cookiesession.DefaultClockSkew + time.Second)
+	h.requests = nil
+	s.Get(r)
+
+	if len(h.expired) != 1 || h.expired[0].SID != ss.SID || h.requests[0] != r {
+		t.Fatalf("expected OnExpire with the expired session and its request, got %d calls", len(h.expired))
+	}
+	if h.expired[0].State != nil {
+		t.Fatalf("expected OnExpire not to see the State, got %q", h.expired[0].State)
+	}
+	if len(h.rejected) != 0 {
+		t.Fatalf("expected no OnDecodeError for an expired session, got %v", h.rejected)
+	}
+}
+
+func TestOnSave(t *testing.T) {
+	s, _, h := hooked(t)
+
+	ss := cookiesession.NewSession().WithState([]byte("state"))
+	if err := s.Save(httptest.NewRecorder(), ss); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(h.saved) != 1 || h.saved[0] != ss || h.requests[0] != nil || h.saved[0].Dirty() {
+		t.Fatalf("expected OnSave with the saved session and no request, got %d calls", len(h.saved))
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if err := s.SaveFor(httptest.NewRecorder(), r, ss); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.saved) != 2 || h.requests[1] != r {
+		t.Fatal("expected OnSave with the request given to SaveFor")
+	}
+
+	big := cookiesession.NewSession().WithState([]byte(strings.Repeat("x", cookiesession.MaxCookieSize)))
+	if err := s.Save(httptest.NewRecorder(), big); err != cookiesession.ErrTooLarge {
+		t.Fatalf("expected %v, got %v", cookiesession.ErrTooLarge, err)
+	}
+	if len(h.saved) != 2 {
+		t.Fatal("expected no OnSave for a session that couldn't be saved")
+	}
+}
+
+func TestOnClear(t *testing.T) {
+	s, _, h := hooked(t)
+
+	s.Clear(httptest.NewRecorder())
+	if h.cleared != 1 || h.requests[0] != nil {
+		t.Fatalf("expected OnClear without a request from Clear, got %d calls", h.cleared)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	s.ClearFromRequest(httptest.NewRecorder(), r)
+	if h.cleared != 1 {
+		t.Fatal("expected no OnClear when there was no cookie to clear")
+	}
+
+	r.AddCookie(&http.Cookie{Name: s.Name, Value: "x"})
+	s.ClearFromRequest(httptest.NewRecorder(), r)
+	if h.cleared != 2 || h.requests[1] != r {
+		t.Fatalf("expected OnClear with the request from ClearFromRequest, got %d calls", h.cleared)
+	}
+}
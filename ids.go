@@ -0,0 +1,75 @@
+package cookiesession
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+// IDGenerator makes the SIDs of new sessions. It's given the store's Rand and
+// clock, so that IDs come from the same sources as everything else the store
+// makes. Like satori/go.uuid's own generators, it should panic if rand fails.
+type IDGenerator interface {
+	NewID(rand io.Reader, now time.Time) uuid.UUID
+}
+
+// IDGeneratorFunc adapts a function to an IDGenerator.
+type IDGeneratorFunc func(rand io.Reader, now time.Time) uuid.UUID
+
+func (f IDGeneratorFunc) NewID(rand io.Reader, now time.Time) uuid.UUID {
+	return f(rand, now)
+}
+
+var (
+	// UUIDv4 makes random version 4 SIDs. It's what stores use by default.
+	UUIDv4 IDGenerator = IDGeneratorFunc(func(rand io.Reader, _ time.Time) uuid.UUID { return NewV4(rand) })
+
+	// UUIDv7 makes time-ordered version 7 SIDs, see NewV7.
+	UUIDv7 IDGenerator = IDGeneratorFunc(NewV7)
+)
+
+// NewV4 returns a version 4 UUID read from rand. It panics if rand fails.
+func NewV4(rand io.Reader) uuid.UUID {
+	var id uuid.UUID
+
+	if _, err := io.ReadFull(rand, id[:]); err != nil {
+		panic(err)
+	}
+
+	id.SetVersion(uuid.V4)
+	id.SetVariant(uuid.VariantRFC4122)
+
+	return id
+}
+
+// NewV7 returns a version 7 UUID for now, whose leading 48 bits are the
+// Unix time in milliseconds and the rest read from rand, so that IDs sort by
+// when they were made. It panics if rand fails.
+func NewV7(rand io.Reader, now time.Time) uuid.UUID {
+	var id uuid.UUID
+
+	if _, err := io.ReadFull(rand, id[6:]); err != nil {
+		panic(err)
+	}
+
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(now.UnixNano()/int64(time.Millisecond)))
+	copy(id[:6], ms[2:])
+
+	id[6] = id[6]&0x0f | 0x70
+	id[8] = id[8]&0x3f | 0x80
+
+	return id
+}
+
+// WithUUIDv7 makes the store give sessions version 7 SIDs, timestamped with
+// the store's clock, so that server-side backends and logs can sort them by
+// creation time. They're 16 bytes like any other SID, so existing cookies
+// are unaffected.
+func WithUUIDv7() Option {
+	return func(s *Store) {
+		s.IDGenerator = UUIDv7
+	}
+}
@@ -0,0 +1,60 @@
+package cookiesession_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/satori/go.uuid"
+
+	"fknsrs.biz/p/cookiesession"
+	"fknsrs.biz/p/cookiesession/cookiesessiontest"
+)
+
+func TestDefaultIDs(t *testing.T) {
+	a, _ := newStore(t)
+	b, _ := newStore(t)
+
+	first := a.Get(httptest.NewRequest(http.MethodGet, "/", nil)).SID
+	if first.Version() != uuid.V4 || first.Variant() != uuid.VariantRFC4122 {
+		t.Errorf("expected a version 4 SID by default, got %s", first)
+	}
+	if other := b.Get(httptest.NewRequest(http.MethodGet, "/", nil)).SID; other != first {
+		t.Errorf("expected SIDs to come from the store's Rand, got %s and %s", first, other)
+	}
+
+	if id := cookiesession.NewSession().SID; id.Version() != uuid.V4 || id == first {
+		t.Errorf("expected a random version 4 SID for a session without a store, got %s", id)
+	}
+}
+
+func TestUUIDv7(t *testing.T) {
+	clock := cookiesessiontest.NewClock(epoch)
+
+	s := cookiesession.New("session", "secret", time.Hour, cookiesession.WithUUIDv7())
+	s.Now = clock.Now
+
+	var ids []uuid.UUID
+	for i := 0; i < 3; i++ {
+		ids = append(ids, s.Get(httptest.NewRequest(http.MethodGet, "/", nil)).SID)
+		clock.Advance(time.Millisecond)
+	}
+
+	for i, id := range ids {
+		if id.Version() != 7 || id.Variant() != uuid.VariantRFC4122 {
+			t.Errorf("%d: expected a version 7 SID, got %s", i, id)
+		}
+	}
+
+	if want := []byte{0x01, 0x8d, 0xf9, 0xe2, 0xb2, 0x00}; !bytes.Equal(ids[0][:6], want) {
+		t.Errorf("expected the SID to start with the clock's time in milliseconds, got %x", ids[0][:6])
+	}
+
+	for i := 1; i < len(ids); i++ {
+		if bytes.Compare(ids[i-1][:], ids[i][:]) >= 0 {
+			t.Errorf("expected SIDs to sort by creation time, got %s before %s", ids[i-1], ids[i])
+		}
+	}
+}
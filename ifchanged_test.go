@@ -0,0 +1,51 @@
+package cookiesession_test
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+func TestSaveIfChanged(t *testing.T) {
+	s, clock := newStore(t)
+
+	ss := cookiesession.NewSession().WithState([]byte("state"))
+
+	rec := httptest.NewRecorder()
+	if err := s.Save(rec, ss); err != nil {
+		t.Fatal(err)
+	}
+	if ss.Dirty() {
+		t.Error("expected a saved session not to be dirty")
+	}
+
+	if saved, err := s.SaveIfChanged(rec, ss); err != nil {
+		t.Fatal(err)
+	} else if saved {
+		t.Error("expected an unchanged session not to be saved again")
+	}
+	if n := len(rec.Result().Header["Set-Cookie"]); n != 1 {
+		t.Errorf("expected exactly one Set-Cookie header, got %d", n)
+	}
+
+	got := s.Get(request(rec))
+	if saved, err := s.SaveIfChanged(httptest.NewRecorder(), &got); err != nil || saved {
+		t.Errorf("expected a loaded session that wasn't changed not to be saved, got %v, %v", saved, err)
+	}
+
+	got.WithState([]byte("changed"))
+	rec = httptest.NewRecorder()
+	if saved, err := s.SaveIfChanged(rec, &got); err != nil || !saved {
+		t.Errorf("expected a changed session to be saved, got %v, %v", saved, err)
+	}
+	if saved, _ := s.SaveIfChanged(rec, &got); saved {
+		t.Error("expected the session to be clean once it was saved")
+	}
+
+	clock.Advance(31 * time.Minute)
+	if saved, err := s.SaveIfChanged(httptest.NewRecorder(), &got); err != nil || !saved {
+		t.Errorf("expected a session past half its lifetime to be refreshed, got %v, %v", saved, err)
+	}
+}
@@ -0,0 +1,58 @@
+package cookiesession
+
+import (
+	"context"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+// Impersonate makes the session act as target, keeping the real user in
+// RealUID, and marks it dirty. Impersonating from within an impersonation
+// switches targets but keeps the original start time.
+func (s *Session) Impersonate(target uuid.UUID) {
+	s.mustBeWritable()
+
+	if !s.IsImpersonating() {
+		s.RealUID = s.UID
+		if s.store != nil {
+			s.ImpersonatedAt = s.store.now()
+		} else {
+			s.ImpersonatedAt = time.Now()
+		}
+	}
+
+	s.UID = target
+	s.dirty = true
+}
+
+// StopImpersonating returns the session to the real user and marks it dirty.
+// It does nothing if the session isn't impersonating anyone.
+func (s *Session) StopImpersonating() {
+	if !s.IsImpersonating() {
+		return
+	}
+
+	s.mustBeWritable()
+
+	s.UID = s.RealUID
+	s.ImpersonatedAt = time.Time{}
+	s.dirty = true
+}
+
+// IsImpersonating reports whether the session is acting as someone other
+// than its real user. Sessions without a RealUID never are.
+func (s *Session) IsImpersonating() bool {
+	return s.RealUID != uuid.Nil && s.UID != s.RealUID
+}
+
+// IdentityFromContext returns the effective and real UIDs of the session
+// that Middleware loaded for ctx, and false if there isn't one.
+func IdentityFromContext(ctx context.Context) (uid, realUID uuid.UUID, ok bool) {
+	ss := FromContext(ctx)
+	if ss == nil {
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return ss.UID, ss.RealUID, true
+}
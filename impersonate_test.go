@@ -0,0 +1,124 @@
+package cookiesession_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/satori/go.uuid"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+func TestImpersonate(t *testing.T) {
+	s, clock := newStore(t)
+
+	alice, bob, carol := uuid.UUID{1}, uuid.UUID{2}, uuid.UUID{3}
+
+	ss := s.Get(httptest.NewRequest(http.MethodGet, "/", nil))
+	ss.SetUID(alice)
+	ss.SetBytes([]byte("state"))
+
+	got := s.Get(save(t, s, &ss))
+	if got.IsImpersonating() {
+		t.Fatal("expected a plain login not to be impersonating")
+	}
+
+	clock.Advance(time.Minute)
+	got.Impersonate(bob)
+
+	if !got.Dirty() || !got.IsImpersonating() || got.UID != bob || got.RealUID != alice {
+		t.Fatalf("expected to act as %s for %s, got %s for %s", bob, alice, got.UID, got.RealUID)
+	}
+	if want := epoch.Add(time.Minute); !got.ImpersonatedAt.Equal(want) {
+		t.Fatalf("expected the impersonation to start at %s by the store's clock, got %s", want, got.ImpersonatedAt)
+	}
+
+	got = s.Get(save(t, s, &got))
+	if got.UID != bob || got.RealUID != alice || !got.ImpersonatedAt.Equal(epoch.Add(time.Minute)) {
+		t.Fatalf("expected the impersonation to survive a round trip, got %s for %s at %s", got.UID, got.RealUID, got.ImpersonatedAt)
+	}
+
+	clock.Advance(time.Minute)
+	got.Impersonate(carol)
+	if got.UID != carol || got.RealUID != alice || !got.ImpersonatedAt.Equal(epoch.Add(time.Minute)) {
+		t.Fatalf("expected switching targets to keep the real user and start time, got %s for %s at %s", got.UID, got.RealUID, got.ImpersonatedAt)
+	}
+
+	got.StopImpersonating()
+	if got.IsImpersonating() || got.UID != alice || got.RealUID != alice || !got.ImpersonatedAt.IsZero() {
+		t.Fatalf("expected to be back to %s, got %s for %s", alice, got.UID, got.RealUID)
+	}
+}
+
+func TestStopImpersonatingNoop(t *testing.T) {
+	s, _ := newStore(t)
+
+	ss := s.Get(httptest.NewRequest(http.MethodGet, "/", nil))
+	ss.SetUID(uuid.UUID{1})
+	ss.SetBytes([]byte("state"))
+
+	got := s.Get(save(t, s, &ss))
+	got.StopImpersonating()
+
+	if got.Dirty() || got.UID != (uuid.UUID{1}) {
+		t.Fatal("expected StopImpersonating to do nothing when not impersonating")
+	}
+}
+
+func TestMaxImpersonation(t *testing.T) {
+	s, clock := newStore(t)
+	s.MaxImpersonation = 10 * time.Minute
+
+	alice, bob := uuid.UUID{1}, uuid.UUID{2}
+
+	ss := s.Get(httptest.NewRequest(http.MethodGet, "/", nil))
+	ss.SetUID(alice)
+	ss.Impersonate(bob)
+	ss.SetBytes([]byte("state"))
+
+	r := save(t, s, &ss)
+
+	clock.Advance(10 * time.Minute)
+	if got := s.Get(r); got.UID != bob || got.Dirty() {
+		t.Fatalf("expected the impersonation to last MaxImpersonation, got %s", got.UID)
+	}
+
+	clock.Advance(time.Second)
+	got := s.Get(r)
+	if got.IsImpersonating() || got.UID != alice || !got.Dirty() {
+		t.Fatalf("expected the impersonation to stop after MaxImpersonation, got %s for %s", got.UID, got.RealUID)
+	}
+
+	if got := s.Get(save(t, s, &got)); got.IsImpersonating() || got.UID != alice {
+		t.Fatalf("expected saving to put %s back in their own session, got %s", alice, got.UID)
+	}
+}
+
+func TestIdentityFromContext(t *testing.T) {
+	s, _ := newStore(t)
+
+	alice, bob := uuid.UUID{1}, uuid.UUID{2}
+
+	ss := s.Get(httptest.NewRequest(http.MethodGet, "/", nil))
+	ss.SetUID(alice)
+	ss.Impersonate(bob)
+	ss.SetBytes([]byte("state"))
+
+	var uid, realUID uuid.UUID
+	var ok bool
+
+	h := s.Middleware(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		uid, realUID, ok = cookiesession.IdentityFromContext(r.Context())
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), save(t, s, &ss))
+	if !ok || uid != bob || realUID != alice {
+		t.Fatalf("expected %s acting for %s, got %s for %s (%v)", bob, alice, uid, realUID, ok)
+	}
+
+	if _, _, ok := cookiesession.IdentityFromContext(httptest.NewRequest(http.MethodGet, "/", nil).Context()); ok {
+		t.Fatal("expected no identity outside the middleware")
+	}
+}
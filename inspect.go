@@ -0,0 +1,45 @@
+package cookiesession
+
+import (
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+// SessionInfo describes a session cookie value for display, leaving out its
+// State.
+type SessionInfo struct {
+	SID      uuid.UUID
+	UID      uuid.UUID
+	Created  time.Time
+	LastSeen time.Time
+	Expired  bool
+	Err      error
+}
+
+// Inspect describes each of values, for showing a user their active
+// sessions. Values that can't be decoded have Err set; expired sessions are
+// still described, with Expired set. No callbacks are consulted.
+func (s *Store) Inspect(values []string) []SessionInfo {
+	infos := make([]SessionInfo, len(values))
+
+	for i, value := range values {
+		ss, err := s.DecodeValue(value)
+		if err != nil {
+			infos[i].Err = err
+			continue
+		}
+
+		wipe(ss.State)
+
+		infos[i] = SessionInfo{
+			SID:      ss.SID,
+			UID:      ss.UID,
+			Created:  ss.StartedAt(),
+			LastSeen: ss.LastSeen(),
+			Expired:  s.checkExpiry(&ss) != nil,
+		}
+	}
+
+	return infos
+}
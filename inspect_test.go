@@ -0,0 +1,45 @@
+package cookiesession_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/satori/go.uuid"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+func TestInspect(t *testing.T) {
+	s, clock := newStore(t)
+
+	old := cookiesession.NewSession().WithState([]byte("old"))
+	old.SetUID(uuid.UUID{1})
+	expired := value(t, s, old)
+
+	clock.Advance(2 * time.Hour)
+
+	current := cookiesession.NewSession().WithState([]byte("current"))
+	current.SetUID(uuid.UUID{1})
+	fresh := value(t, s, current)
+
+	infos := s.Inspect([]string{fresh, expired, "garbage"})
+	if len(infos) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(infos))
+	}
+
+	if i := infos[0]; i.Err != nil || i.Expired || i.SID != current.SID || i.UID != current.UID {
+		t.Errorf("expected the current session, got %+v", i)
+	} else if !i.LastSeen.Equal(epoch.Add(2 * time.Hour)) {
+		t.Errorf("expected it to have been last seen now, got %s", i.LastSeen)
+	}
+
+	if i := infos[1]; i.Err != nil || !i.Expired || i.SID != old.SID {
+		t.Errorf("expected the old session to be described as expired, got %+v", i)
+	} else if !i.Created.Equal(epoch) {
+		t.Errorf("expected it to have been created at the epoch, got %s", i.Created)
+	}
+
+	if i := infos[2]; i.Err == nil || i.SID != uuid.Nil {
+		t.Errorf("expected an error for the garbage value, got %+v", i)
+	}
+}
@@ -0,0 +1,128 @@
+package cookiesession
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+// sessionJSON is the shape of a Session in JSON. It's meant for inspecting
+// and editing sessions out of band, and is unrelated to the cookie format.
+type sessionJSON struct {
+	Valid     bool                   `json:"valid"`
+	Time      string                 `json:"time"`
+	Created   string                 `json:"created"`
+	ExpiresAt string                 `json:"expires_at,omitempty"`
+	SID       uuid.UUID              `json:"sid"`
+	UID       uuid.UUID              `json:"uid"`
+	RealUID   uuid.UUID              `json:"real_uid"`
+	Epoch     uint32                 `json:"epoch"`
+	Seq       uint32                 `json:"seq"`
+	Claims    map[string]interface{} `json:"claims,omitempty"`
+	State     []byte                 `json:"state"`
+
+	Auth []authRecordJSON `json:"auth,omitempty"`
+
+	ImpersonatedAt string `json:"impersonated_at,omitempty"`
+}
+
+type authRecordJSON struct {
+	Method string `json:"method"`
+	At     string `json:"at"`
+}
+
+func (s Session) MarshalJSON() ([]byte, error) {
+	var auth []authRecordJSON
+	for _, a := range s.Auth {
+		auth = append(auth, authRecordJSON{Method: a.Method, At: a.At.Format(time.RFC3339)})
+	}
+
+	return json.Marshal(sessionJSON{
+		Valid:     s.Valid,
+		Time:      s.Time.Format(time.RFC3339),
+		Created:   s.Created.Format(time.RFC3339),
+		ExpiresAt: formatOptionalTime(s.ExpiresAt),
+		SID:       s.SID,
+		UID:       s.UID,
+		RealUID:   s.RealUID,
+		Epoch:     s.Epoch,
+		Seq:       s.Seq,
+		Claims:    s.Claims,
+		State:     s.State,
+
+		Auth: auth,
+
+		ImpersonatedAt: formatOptionalTime(s.ImpersonatedAt),
+	})
+}
+
+func (s *Session) UnmarshalJSON(data []byte) error {
+	var v sessionJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	t, err := time.Parse(time.RFC3339, v.Time)
+	if err != nil {
+		return err
+	}
+
+	created, err := parseOptionalTime(v.Created)
+	if err != nil {
+		return err
+	}
+
+	expiresAt, err := parseOptionalTime(v.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	var auth []AuthRecord
+	for _, a := range v.Auth {
+		at, err := time.Parse(time.RFC3339, a.At)
+		if err != nil {
+			return err
+		}
+
+		auth = append(auth, AuthRecord{Method: a.Method, At: at})
+	}
+
+	impersonatedAt, err := parseOptionalTime(v.ImpersonatedAt)
+	if err != nil {
+		return err
+	}
+
+	s.Valid = v.Valid
+	s.Time = t
+	s.Created = created
+	s.ExpiresAt = expiresAt
+	s.Auth = auth
+	s.ImpersonatedAt = impersonatedAt
+	s.SID = v.SID
+	s.UID = v.UID
+	s.RealUID = v.RealUID
+	s.Epoch = v.Epoch
+	s.Seq = v.Seq
+	s.Claims = v.Claims
+	s.State = v.State
+
+	return nil
+}
+
+// formatOptionalTime formats t as RFC 3339, or as nothing if it's zero.
+func formatOptionalTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+func parseOptionalTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339, s)
+}
@@ -0,0 +1,83 @@
+package cookiesession_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/satori/go.uuid"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+func TestSessionJSON(t *testing.T) {
+	in := cookiesession.Session{
+		Valid:   true,
+		Time:    epoch,
+		Created: epoch.Add(-time.Hour),
+		SID:     uuid.UUID{1},
+		UID:     uuid.UUID{2},
+		RealUID: uuid.UUID{3},
+		State:   []byte{0, 1, 2, 0xff},
+	}
+
+	b, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		`"sid":"` + in.SID.String() + `"`,
+		`"real_uid":"` + in.RealUID.String() + `"`,
+		`"time":"2024-03-01T12:00:00Z"`,
+		`"state":"AAEC/w=="`,
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("expected %s in %s", want, b)
+		}
+	}
+
+	var out cookiesession.Session
+	if err := json.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.SID != in.SID || out.UID != in.UID || out.RealUID != in.RealUID || !out.Valid {
+		t.Errorf("expected the IDs to round-trip, got %+v", out)
+	}
+	if !out.Time.Equal(in.Time) || !out.Created.Equal(in.Created) {
+		t.Errorf("expected the times to round-trip, got %s and %s", out.Time, out.Created)
+	}
+	if !bytes.Equal(out.State, in.State) {
+		t.Errorf("expected the state to round-trip, got %v", out.State)
+	}
+}
+
+func TestSessionJSONNilState(t *testing.T) {
+	b, err := json.Marshal(cookiesession.Session{Time: epoch})
+	if err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(string(b), `"state":null`) {
+		t.Fatalf("expected a null state, got %s", b)
+	}
+
+	var out cookiesession.Session
+	if err := json.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	} else if out.State != nil {
+		t.Fatalf("expected a nil state, got %v", out.State)
+	}
+}
+
+func TestSessionJSONBadTime(t *testing.T) {
+	var out cookiesession.Session
+	if err := json.Unmarshal([]byte(`{"time":"yesterday"}`), &out); err == nil {
+		t.Fatal("expected an error for a malformed time")
+	}
+
+	if err := json.Unmarshal([]byte(`{"time":"2024-03-01T12:00:00Z","created":"last week"}`), &out); err == nil {
+		t.Fatal("expected an error for a malformed created time")
+	}
+}
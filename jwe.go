@@ -0,0 +1,188 @@
+package cookiesession
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+)
+
+var (
+	ErrInvalidJWE = errors.New("value isn't a compact jwe this store can read")
+)
+
+// jweHeader is the protected header of the compact JWEs this package makes.
+type jweHeader struct {
+	Alg string `json:"alg"`
+	Enc string `json:"enc"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// jwePayload is what the JWE carries. The standard claims are there for
+// other JOSE consumers; Session holds the usual binary encoding, so nothing
+// is lost going back through this package.
+type jwePayload struct {
+	Sub     string `json:"sub"`
+	SID     string `json:"sid"`
+	Iat     int64  `json:"iat"`
+	Exp     int64  `json:"exp,omitempty"`
+	Session []byte `json:"cookiesession"`
+}
+
+// JWEKey returns the A256GCM key that CompactJWE tokens are sealed under, for
+// sharing with JOSE consumers. It's derived from the active key, so that the
+// store's key itself is never used with more than one cipher.
+func (s *Store) JWEKey() ([32]byte, error) {
+	key, _, err := s.activeKey()
+	if err != nil {
+		return [32]byte{}, err
+	}
+
+	return s.jweKey(key), nil
+}
+
+func (s *Store) jweKey(key [32]byte) [32]byte {
+	key = s.envKey(key)
+
+	return cipherKey(&key, "jwe", nil)
+}
+
+// sealJWE seals buf, the binary encoding of ss, as a compact JWE using direct
+// key agreement and A256GCM, so that any JOSE library with the key can read
+// it.
+func (s *Store) sealJWE(ss *Session, buf []byte) (string, error) {
+	if s.isClosed() {
+		return "", ErrStoreClosed
+	}
+
+	key, err := s.JWEKey()
+	if err != nil {
+		return "", err
+	}
+
+	header, err := json.Marshal(jweHeader{Alg: "dir", Enc: "A256GCM", Kid: s.ActiveKeyID})
+	if err != nil {
+		return "", err
+	}
+
+	payload := jwePayload{
+		Sub:     ss.UID.String(),
+		SID:     ss.SID.String(),
+		Iat:     ss.Time.Unix(),
+		Session: buf,
+	}
+	if !ss.ExpiresAt.IsZero() {
+		payload.Exp = ss.ExpiresAt.Unix()
+	} else if ttl := s.ttl(ss); ttl > 0 {
+		payload.Exp = ss.Time.Add(ttl).Unix()
+	}
+
+	plaintext, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	defer wipe(plaintext)
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(s.rand(), iv); err != nil {
+		return "", errors.New("couldn't get random nonce: " + err.Error())
+	}
+
+	h := base64.RawURLEncoding.EncodeToString(header)
+	sealed := gcm.Seal(nil, iv, plaintext, []byte(h))
+	ciphertext, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+
+	return strings.Join([]string{
+		h,
+		"",
+		base64.RawURLEncoding.EncodeToString(iv),
+		base64.RawURLEncoding.EncodeToString(ciphertext),
+		base64.RawURLEncoding.EncodeToString(tag),
+	}, "."), nil
+}
+
+// openJWE opens a compact JWE made by sealJWE, returning the binary encoding
+// of the session inside.
+func (s *Store) openJWE(value string) ([]byte, error) {
+	if s.isClosed() {
+		return nil, ErrStoreClosed
+	}
+
+	parts := strings.Split(value, ".")
+	if len(parts) != 5 || parts[1] != "" {
+		return nil, ErrInvalidJWE
+	}
+
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrBadEncoding
+	}
+
+	var header jweHeader
+	if err := json.Unmarshal(rawHeader, &header); err != nil || header.Alg != "dir" || header.Enc != "A256GCM" {
+		return nil, ErrInvalidJWE
+	}
+
+	var segments [3][]byte
+	for i := range segments {
+		if segments[i], err = base64.RawURLEncoding.DecodeString(parts[i+2]); err != nil {
+			return nil, ErrBadEncoding
+		}
+	}
+	iv, sealed := segments[0], append(segments[1], segments[2]...)
+
+	var keys [][32]byte
+	if s.KeyRing != nil {
+		key, ok := s.ringKeyByID(header.Kid)
+		if !ok {
+			return nil, ErrUnknownKeyID
+		}
+		keys = [][32]byte{key}
+	} else {
+		keys = s.keys()
+	}
+
+	for _, key := range keys {
+		gcm, err := newGCM(s.jweKey(key))
+		if err != nil {
+			return nil, err
+		}
+
+		if len(iv) != gcm.NonceSize() {
+			return nil, ErrInvalidJWE
+		}
+
+		plaintext, err := gcm.Open(nil, iv, sealed, []byte(parts[0]))
+		if err != nil {
+			continue
+		}
+
+		var payload jwePayload
+		err = json.Unmarshal(plaintext, &payload)
+		wipe(plaintext)
+		if err != nil {
+			return nil, ErrInvalidJWE
+		}
+
+		return payload.Session, nil
+	}
+
+	return nil, ErrDecryptFailed
+}
+
+func newGCM(key [32]byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
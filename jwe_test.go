@@ -0,0 +1,124 @@
+package cookiesession_test
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/satori/go.uuid"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+// openCompactJWE opens a dir/A256GCM compact JWE the way any JOSE library
+// would, without going through the store.
+func openCompactJWE(t *testing.T, token string, key [32]byte) (map[string]string, map[string]interface{}) {
+	t.Helper()
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		t.Fatalf("expected five segments, got %d", len(parts))
+	} else if parts[1] != "" {
+		t.Fatalf("expected an empty encrypted key for direct encryption, got %q", parts[1])
+	}
+
+	var segments [5][]byte
+	for i, part := range parts {
+		b, err := base64.RawURLEncoding.DecodeString(part)
+		if err != nil {
+			t.Fatalf("segment %d: %s", i, err)
+		}
+		segments[i] = b
+	}
+
+	var header map[string]string
+	if err := json.Unmarshal(segments[0], &header); err != nil {
+		t.Fatal(err)
+	}
+
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext, err := gcm.Open(nil, segments[2], append(segments[3], segments[4]...), []byte(parts[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal(plaintext, &claims); err != nil {
+		t.Fatal(err)
+	}
+
+	return header, claims
+}
+
+func TestCompactJWE(t *testing.T) {
+	s, _ := newStore(t)
+	s.CompactJWE = true
+
+	ss := cookiesession.NewSession().WithUID(uuid.UUID{1}).WithState([]byte("state"))
+	v := value(t, s, ss)
+
+	key, err := s.JWEKey()
+	if err != nil {
+		t.Fatal(err)
+	} else if key == s.Key {
+		t.Fatal("expected the jwe key to be derived from the store's key")
+	}
+
+	header, claims := openCompactJWE(t, v, key)
+	if header["alg"] != "dir" || header["enc"] != "A256GCM" {
+		t.Errorf("expected a dir/A256GCM header, got %v", header)
+	}
+	if claims["sub"] != ss.UID.String() || claims["sid"] != ss.SID.String() {
+		t.Errorf("expected the session's sub and sid, got %v", claims)
+	}
+	if claims["iat"] != float64(epoch.Unix()) || claims["exp"] != float64(epoch.Add(time.Hour).Unix()) {
+		t.Errorf("expected iat and exp from the session's time and TTL, got %v and %v", claims["iat"], claims["exp"])
+	}
+
+	got, err := s.Decode(v)
+	if err != nil {
+		t.Fatal(err)
+	} else if got.SID != ss.SID || got.UID != ss.UID || string(got.State) != "state" {
+		t.Errorf("expected the session to round-trip, got %+v", got)
+	}
+
+	native, _ := newStore(t)
+	if _, err := native.Decode(v); err == nil {
+		t.Error("expected a store using the native format not to read a jwe")
+	}
+	if _, err := s.Decode(value(t, native, cookiesession.NewSession().WithState([]byte("state")))); err == nil {
+		t.Error("expected a store using jwes not to read the native format")
+	}
+}
+
+func TestCompactJWEInvalid(t *testing.T) {
+	s, _ := newStore(t)
+	s.CompactJWE = true
+
+	v := value(t, s, cookiesession.NewSession().WithState([]byte("state")))
+	parts := strings.Split(v, ".")
+
+	for name, bad := range map[string]string{
+		"segments":   strings.Join(parts[:4], "."),
+		"key":        strings.Join([]string{parts[0], "a2V5", parts[2], parts[3], parts[4]}, "."),
+		"algorithm":  strings.Join(append([]string{base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"A256KW","enc":"A256GCM"}`))}, parts[1:]...), "."),
+		"encoding":   strings.Join([]string{parts[0], "", "not*base64", parts[3], parts[4]}, "."),
+		"ciphertext": strings.Join([]string{parts[0], "", parts[2], "AAAA" + parts[3], parts[4]}, "."),
+	} {
+		if _, err := s.Decode(bad); err == nil {
+			t.Errorf("%s: expected an error for an invalid jwe", name)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package cookiesession
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/scrypt"
+)
+
+var (
+	ErrInvalidKDFParams = errors.New("invalid key derivation parameters")
+)
+
+// KeyDerivation turns a secret into a key, for Store.KeyDerivation. Without
+// one, keys are the SHA-256 of the secret, which is fine for long random
+// secrets but weak for passphrases. To use a key directly without deriving
+// it at all, see NewWithKey.
+type KeyDerivation func(secret string) [32]byte
+
+// HKDF derives keys with HKDF-SHA256, for high-entropy secrets.
+func HKDF(salt, info []byte) KeyDerivation {
+	return func(secret string) [32]byte {
+		var key [32]byte
+		if _, err := io.ReadFull(hkdf.New(sha256.New, []byte(secret), salt, info), key[:]); err != nil {
+			panic(err)
+		}
+
+		return key
+	}
+}
+
+// Scrypt derives keys with scrypt, for passphrases. N must be a power of two
+// greater than one.
+func Scrypt(salt []byte, n, r, p int) (KeyDerivation, error) {
+	if n <= 1 || n&(n-1) != 0 || r <= 0 || p <= 0 || uint64(r)*uint64(p) >= 1<<30 {
+		return nil, ErrInvalidKDFParams
+	}
+
+	return func(secret string) [32]byte {
+		b, err := scrypt.Key([]byte(secret), salt, n, r, p, 32)
+		if err != nil {
+			panic(err)
+		}
+
+		var key [32]byte
+		copy(key[:], b)
+		wipe(b)
+
+		return key
+	}, nil
+}
+
+// Argon2id derives keys with Argon2id, for passphrases. memory is in KiB.
+func Argon2id(salt []byte, time, memory uint32, threads uint8) (KeyDerivation, error) {
+	if time == 0 || threads == 0 || memory < 8*uint32(threads) {
+		return nil, ErrInvalidKDFParams
+	}
+
+	return func(secret string) [32]byte {
+		b := argon2.IDKey([]byte(secret), salt, time, memory, threads, 32)
+
+		var key [32]byte
+		copy(key[:], b)
+		wipe(b)
+
+		return key
+	}, nil
+}
+
+// WithKeyDerivation makes New derive the store's key with kdf.
+func WithKeyDerivation(kdf KeyDerivation) Option {
+	return func(s *Store) { s.KeyDerivation = kdf }
+}
+
+// deriveKey derives a key from secret with the store's KeyDerivation.
+func (s *Store) deriveKey(secret string) [32]byte {
+	if s.KeyDerivation != nil {
+		return s.KeyDerivation(secret)
+	}
+
+	return deriveKey(secret)
+}
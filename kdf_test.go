@@ -0,0 +1,123 @@
+package cookiesession_test
+
+import (
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+// kdfs returns one of each key derivation, with cheap parameters, all salted
+// with salt.
+func kdfs(t *testing.T, salt string) map[string]cookiesession.KeyDerivation {
+	t.Helper()
+
+	scrypt, err := cookiesession.Scrypt([]byte(salt), 16, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	argon2id, err := cookiesession.Argon2id([]byte(salt), 1, 64, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string]cookiesession.KeyDerivation{
+		"hkdf":     cookiesession.HKDF([]byte(salt), []byte("cookiesession")),
+		"scrypt":   scrypt,
+		"argon2id": argon2id,
+	}
+}
+
+func TestKeyDerivation(t *testing.T) {
+	a, b := kdfs(t, "salt"), kdfs(t, "pepper")
+
+	for name, kdf := range a {
+		t.Run(name, func(t *testing.T) {
+			key := kdf("secret")
+
+			if key != kdf("secret") {
+				t.Fatal("expected the same secret to derive the same key")
+			}
+			if key == kdf("other secret") {
+				t.Fatal("expected different secrets to derive different keys")
+			}
+			if key == b[name]("secret") {
+				t.Fatal("expected different salts to derive different keys")
+			}
+			if key == sha256.Sum256([]byte("secret")) {
+				t.Fatal("expected the key not to be the plain SHA-256 of the secret")
+			}
+		})
+	}
+}
+
+func TestKeyDerivationParams(t *testing.T) {
+	scrypt := []struct{ n, r, p int }{
+		{0, 1, 1},
+		{1, 1, 1},
+		{15, 1, 1},
+		{16, 0, 1},
+		{16, 1, 0},
+		{16, 1 << 15, 1 << 15},
+	}
+
+	for _, c := range scrypt {
+		if _, err := cookiesession.Scrypt(nil, c.n, c.r, c.p); err != cookiesession.ErrInvalidKDFParams {
+			t.Errorf("expected Scrypt(%d, %d, %d) to be rejected, got %v", c.n, c.r, c.p, err)
+		}
+	}
+
+	argon2id := []struct {
+		time, memory uint32
+		threads      uint8
+	}{
+		{0, 64, 1},
+		{1, 64, 0},
+		{1, 7, 1},
+		{1, 15, 2},
+	}
+
+	for _, c := range argon2id {
+		if _, err := cookiesession.Argon2id(nil, c.time, c.memory, c.threads); err != cookiesession.ErrInvalidKDFParams {
+			t.Errorf("expected Argon2id(%d, %d, %d) to be rejected, got %v", c.time, c.memory, c.threads, err)
+		}
+	}
+}
+
+func TestWithKeyDerivation(t *testing.T) {
+	for name, kdf := range kdfs(t, "salt") {
+		t.Run(name, func(t *testing.T) {
+			s := cookiesession.New("session", "secret", time.Hour, cookiesession.WithKeyDerivation(kdf))
+			if s.Key != kdf("secret") {
+				t.Fatal("expected New to derive the key with the KeyDerivation")
+			}
+
+			v := value(t, s, cookiesession.NewSession().WithState([]byte("state")))
+
+			other := cookiesession.New("session", "secret", time.Hour, cookiesession.WithKeyDerivation(kdf))
+			if got, err := other.Decode(v); err != nil || string(got.State) != "state" {
+				t.Fatalf("expected a store with the same derivation to decode the value, got %v", err)
+			}
+
+			if _, err := cookiesession.New("session", "secret", time.Hour).Decode(v); err != cookiesession.ErrDecryptFailed {
+				t.Fatalf("expected a store without the derivation to reject the value, got %v", err)
+			}
+
+			s.Rotate("new secret")
+			if s.Key != kdf("new secret") || s.OldKeys[0] != kdf("secret") {
+				t.Fatal("expected Rotate to derive the new key with the KeyDerivation")
+			}
+			if got, err := s.Decode(v); err != nil || string(got.State) != "state" {
+				t.Fatalf("expected the value to decode under the old key after rotating, got %v", err)
+			}
+
+			other.SetKeys(kdf("new secret"), nil)
+			other.AddRotatedSecret("secret")
+			if got, err := other.Decode(v); err != nil || string(got.State) != "state" {
+				t.Fatalf("expected AddRotatedSecret to derive the key with the KeyDerivation, got %v", err)
+			}
+		})
+	}
+}
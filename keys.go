@@ -0,0 +1,204 @@
+package cookiesession
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMissingKey      = errors.New("no key material provided")
+	ErrInvalidKey      = errors.New("key must be 32 bytes, either raw or base64 encoded")
+	ErrInsecureKeyFile = errors.New("key file is accessible by other users")
+	ErrInvalidHexKey   = errors.New("key must be 64 hex characters")
+	ErrUnknownKeyID    = errors.New("key id isn't in the key ring")
+)
+
+// NewWithKey is like New, but uses key directly instead of deriving it from
+// a secret.
+func NewWithKey(name string, key [32]byte, ttl time.Duration) *Store {
+	return &Store{
+		Name: name,
+		TTL:  ttl,
+		Key:  key,
+	}
+}
+
+// DecodeWithKey decodes a cookie value sealed with key, checking its age
+// against ttl, without needing a configured Store. It's meant for one-off
+// migrations and forensics with a key that no Store is using any more. Values
+// saved with BindName set can't be decoded this way.
+func DecodeWithKey(value string, key [32]byte, ttl time.Duration) (Session, error) {
+	return NewWithKey("", key, ttl).Decode(value)
+}
+
+// NewFromEnv creates a Store using the key held in the environment variable
+// envVar, which must be 32 bytes either raw or base64 encoded.
+func NewFromEnv(name, envVar string, ttl time.Duration) (*Store, error) {
+	key, err := parseKey(os.Getenv(envVar))
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWithKey(name, key, ttl), nil
+}
+
+// NewFromFile creates a Store using the key held in the file at path, in the
+// same format as NewFromEnv. Surrounding whitespace is ignored. The file must
+// not be readable or writable by other users.
+func NewFromFile(name, path string, ttl time.Duration) (*Store, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.New("couldn't stat key file: " + err.Error())
+	}
+
+	if fi.Mode().Perm()&0007 != 0 {
+		return nil, ErrInsecureKeyFile
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.New("couldn't read key file: " + err.Error())
+	}
+
+	key, err := parseKey(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWithKey(name, key, ttl), nil
+}
+
+// NewFromHexKey creates a Store using a key given as 64 hex characters.
+func NewFromHexKey(name, hexKey string, ttl time.Duration) (*Store, error) {
+	var key [32]byte
+
+	if len(hexKey) != hex.EncodedLen(len(key)) {
+		return nil, ErrInvalidHexKey
+	}
+
+	if _, err := hex.Decode(key[:], []byte(hexKey)); err != nil {
+		return nil, ErrInvalidHexKey
+	}
+
+	return NewWithKey(name, key, ttl), nil
+}
+
+// Rekey decodes each of values with the store's keys and seals it again
+// under newKey, for migrating exported sessions offline. Sessions keep their
+// times, so expired values stay expired. Values that can't be decoded have
+// an error in the slice parallel to values.
+func (s *Store) Rekey(values []string, newKey [32]byte) ([]string, []error) {
+	n := s.Clone(s.Name)
+	n.Key = newKey
+	n.OldKeys = nil
+	n.KeyRing = nil
+
+	out := make([]string, len(values))
+	errs := make([]error, len(values))
+
+	for i, value := range values {
+		ss, err := s.DecodeValue(value)
+		if err == nil {
+			out[i], err = n.encode(&ss)
+		}
+
+		errs[i] = err
+	}
+
+	return out, errs
+}
+
+// activeKey returns the key to seal with, and the key id prefix to put in
+// front of the value when using a KeyRing.
+func (s *Store) activeKey() ([32]byte, []byte, error) {
+	mu := s.lock()
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if s.KeyRing == nil {
+		return s.Key, nil, nil
+	}
+
+	key, ok := s.KeyRing[s.ActiveKeyID]
+	if !ok {
+		return [32]byte{}, nil, ErrUnknownKeyID
+	}
+
+	return key, bindName(s.ActiveKeyID, nil), nil
+}
+
+// ringKey splits the key id prefix from a value sealed under a KeyRing, and
+// returns the key it names along with the rest of the value.
+func (s *Store) ringKey(raw []byte) ([32]byte, []byte, error) {
+	id, rest, err := keyID(raw)
+	if err != nil {
+		return [32]byte{}, nil, err
+	}
+
+	key, ok := s.ringKeyByID(id)
+	if !ok {
+		return [32]byte{}, nil, ErrUnknownKeyID
+	}
+
+	return key, rest, nil
+}
+
+// ringKeys returns a copy of every key in KeyRing.
+func (s *Store) ringKeys() [][32]byte {
+	mu := s.lock()
+	mu.RLock()
+	defer mu.RUnlock()
+
+	keys := make([][32]byte, 0, len(s.KeyRing))
+	for _, key := range s.KeyRing {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// ringKeyByID returns a copy of the key id names in KeyRing.
+func (s *Store) ringKeyByID(id string) ([32]byte, bool) {
+	mu := s.lock()
+	mu.RLock()
+	defer mu.RUnlock()
+
+	key, ok := s.KeyRing[id]
+
+	return key, ok
+}
+
+// keyID splits the key id prefix from a value sealed under a KeyRing.
+func keyID(raw []byte) (string, []byte, error) {
+	n, l := binary.Uvarint(raw)
+	if l <= 0 || n > uint64(len(raw)-l) {
+		return "", nil, ErrTooShort
+	}
+
+	return string(raw[l : l+int(n)]), raw[l+int(n):], nil
+}
+
+func parseKey(s string) ([32]byte, error) {
+	var key [32]byte
+
+	if s == "" {
+		return key, ErrMissingKey
+	}
+
+	if b, err := base64.StdEncoding.DecodeString(s); err == nil && len(b) == len(key) {
+		copy(key[:], b)
+		return key, nil
+	}
+
+	if len(s) == len(key) {
+		copy(key[:], s)
+		return key, nil
+	}
+
+	return key, ErrInvalidKey
+}
@@ -0,0 +1,278 @@
+package cookiesession_test
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+var testKey = [32]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32}
+
+func TestNewFromEnv(t *testing.T) {
+	for name, v := range map[string]string{
+		"base64": base64.StdEncoding.EncodeToString(testKey[:]),
+		"raw":    strings.Repeat("k", 32),
+	} {
+		t.Setenv("COOKIESESSION_TEST_KEY", v)
+
+		s, err := cookiesession.NewFromEnv("session", "COOKIESESSION_TEST_KEY", time.Hour)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		if name == "base64" && s.Key != testKey {
+			t.Errorf("expected the decoded key, got %x", s.Key)
+		} else if name == "raw" && string(s.Key[:]) != v {
+			t.Errorf("expected the raw key, got %x", s.Key)
+		}
+	}
+
+	t.Setenv("COOKIESESSION_TEST_KEY", "")
+	if _, err := cookiesession.NewFromEnv("session", "COOKIESESSION_TEST_KEY", time.Hour); err != cookiesession.ErrMissingKey {
+		t.Errorf("expected %v for an empty variable, got %v", cookiesession.ErrMissingKey, err)
+	}
+
+	if _, err := cookiesession.NewFromEnv("session", "COOKIESESSION_TEST_UNSET", time.Hour); err != cookiesession.ErrMissingKey {
+		t.Errorf("expected %v for a missing variable, got %v", cookiesession.ErrMissingKey, err)
+	}
+
+	t.Setenv("COOKIESESSION_TEST_KEY", "too short")
+	if _, err := cookiesession.NewFromEnv("session", "COOKIESESSION_TEST_KEY", time.Hour); err != cookiesession.ErrInvalidKey {
+		t.Errorf("expected %v for a short key, got %v", cookiesession.ErrInvalidKey, err)
+	}
+}
+
+func TestNewFromFile(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "key")
+	if err := os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(testKey[:])+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := cookiesession.NewFromFile("session", path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	} else if s.Key != testKey {
+		t.Fatalf("expected the key from the file, got %x", s.Key)
+	}
+
+	if err := os.Chmod(path, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cookiesession.NewFromFile("session", path, time.Hour); err != cookiesession.ErrInsecureKeyFile {
+		t.Errorf("expected %v for a world-readable file, got %v", cookiesession.ErrInsecureKeyFile, err)
+	}
+
+	empty := filepath.Join(dir, "empty")
+	if err := os.WriteFile(empty, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cookiesession.NewFromFile("session", empty, time.Hour); err != cookiesession.ErrMissingKey {
+		t.Errorf("expected %v for an empty file, got %v", cookiesession.ErrMissingKey, err)
+	}
+
+	if _, err := cookiesession.NewFromFile("session", filepath.Join(dir, "missing"), time.Hour); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestNewFromHexKey(t *testing.T) {
+	s, err := cookiesession.NewFromHexKey("session", hex.EncodeToString(testKey[:]), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	} else if s.Key != testKey {
+		t.Fatalf("expected the decoded key, got %x", s.Key)
+	}
+
+	if _, err := cookiesession.NewFromHexKey("session", strings.ToUpper(hex.EncodeToString(testKey[:])), time.Hour); err != nil {
+		t.Errorf("expected upper case hex to be accepted, got %v", err)
+	}
+
+	for name, v := range map[string]string{
+		"short":   hex.EncodeToString(testKey[:31]),
+		"long":    hex.EncodeToString(testKey[:]) + "00",
+		"non-hex": strings.Repeat("zz", 32),
+		"empty":   "",
+	} {
+		if _, err := cookiesession.NewFromHexKey("session", v, time.Hour); err != cookiesession.ErrInvalidHexKey {
+			t.Errorf("%s: expected %v, got %v", name, cookiesession.ErrInvalidHexKey, err)
+		}
+	}
+}
+
+func TestDecodeWithKey(t *testing.T) {
+	s := cookiesession.NewWithKey("session", testKey, time.Hour)
+
+	ss := cookiesession.NewSession().WithState([]byte("state"))
+	v, err := s.Token(ss)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := cookiesession.DecodeWithKey(v, testKey, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	} else if got.SID != ss.SID || string(got.Bytes()) != "state" {
+		t.Errorf("expected the session with the matching key, got %+v", got)
+	}
+
+	if _, err := cookiesession.DecodeWithKey(v, [32]byte{1}, time.Hour); err != cookiesession.ErrDecryptFailed {
+		t.Errorf("expected %v with a mismatching key, got %v", cookiesession.ErrDecryptFailed, err)
+	}
+}
+
+func TestKeyRing(t *testing.T) {
+	s, _ := newStore(t)
+	s.KeyRing = map[string][32]byte{"kms-a": {1}}
+	s.ActiveKeyID = "kms-a"
+
+	underA := cookiesession.NewSession().WithState([]byte("a"))
+	a := value(t, s, underA)
+
+	// Keys are added out of order and the new one made active.
+	s.KeyRing["kms-0"] = [32]byte{2}
+	s.ActiveKeyID = "kms-0"
+
+	underZero := cookiesession.NewSession().WithState([]byte("0"))
+	zero := value(t, s, underZero)
+
+	for v, want := range map[string]*cookiesession.Session{a: underA, zero: underZero} {
+		if got, err := s.Decode(v); err != nil {
+			t.Errorf("expected a session sealed under a key in the ring, got %v", err)
+		} else if got.SID != want.SID {
+			t.Errorf("expected session %s, got %s", want.SID, got.SID)
+		}
+	}
+
+	delete(s.KeyRing, "kms-a")
+
+	if _, err := s.Decode(a); err != cookiesession.ErrUnknownKeyID {
+		t.Errorf("expected %v once its key is removed, got %v", cookiesession.ErrUnknownKeyID, err)
+	}
+	if _, err := s.Decode(zero); err != nil {
+		t.Errorf("expected the active key's session to still decode, got %v", err)
+	}
+
+	s.ActiveKeyID = "kms-a"
+	if err := s.Validate(); err != cookiesession.ErrUnknownKeyID {
+		t.Errorf("expected %v from Validate with a missing active key, got %v", cookiesession.ErrUnknownKeyID, err)
+	}
+	if err := s.Save(httptest.NewRecorder(), cookiesession.NewSession().WithState([]byte("state"))); err != cookiesession.ErrUnknownKeyID {
+		t.Errorf("expected %v saving with a missing active key, got %v", cookiesession.ErrUnknownKeyID, err)
+	}
+}
+
+func TestEnvironment(t *testing.T) {
+	stores := map[string]*cookiesession.Store{}
+	for _, env := range []string{"", "staging", "production"} {
+		s := cookiesession.New("session", "shared secret", time.Hour)
+		s.Environment = env
+		stores[env] = s
+	}
+
+	for from, s := range stores {
+		ss := cookiesession.NewSession().WithState([]byte("state"))
+
+		v, err := s.Token(ss)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token, err := s.Seal([]byte("token"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for to, o := range stores {
+			_, err := o.Decode(v)
+			_, terr := o.Open(token)
+
+			if from == to {
+				if err != nil || terr != nil {
+					t.Errorf("%q: expected values to open in their own environment, got %v and %v", from, err, terr)
+				}
+			} else if err != cookiesession.ErrDecryptFailed || terr != cookiesession.ErrDecryptFailed {
+				t.Errorf("expected values from %q to fail to decrypt in %q, got %v and %v", from, to, err, terr)
+			}
+		}
+	}
+}
+
+func TestCanDecode(t *testing.T) {
+	a := cookiesession.New("session", "shared secret", time.Hour)
+	b := cookiesession.New("session", "shared secret", time.Hour)
+
+	if !a.CanDecode(b) || !b.CanDecode(a) {
+		t.Fatal("expected stores with the same secret to interoperate")
+	}
+
+	shared := func(configure func(o *cookiesession.Store)) *cookiesession.Store {
+		o := cookiesession.New("session", "shared secret", time.Hour)
+		configure(o)
+		return o
+	}
+
+	for name, o := range map[string]*cookiesession.Store{
+		"different secret":      cookiesession.New("session", "another secret", time.Hour),
+		"different environment": shared(func(o *cookiesession.Store) { o.Environment = "staging" }),
+		"signing key":           shared(func(o *cookiesession.Store) { o.SigningKey = []byte("sign") }),
+	} {
+		if a.CanDecode(o) {
+			t.Errorf("%s: expected the stores not to interoperate", name)
+		}
+	}
+
+	rotated := cookiesession.New("session", "new secret", time.Hour)
+	rotated.OldKeys = [][32]byte{a.Key}
+	if !rotated.CanDecode(a) {
+		t.Error("expected a store to read sessions sealed under one of its old keys")
+	}
+	if a.CanDecode(rotated) {
+		t.Error("expected a store not to read sessions sealed under a key it doesn't have")
+	}
+}
+
+func TestRekey(t *testing.T) {
+	s, _ := newStore(t)
+
+	a := cookiesession.NewSession().WithState([]byte("a"))
+	b := cookiesession.NewSession().WithState([]byte("b"))
+	values := []string{value(t, s, a), "garbage", value(t, s, b)}
+
+	newKey := [32]byte{9}
+
+	out, errs := s.Rekey(values, newKey)
+	if len(out) != 3 || len(errs) != 3 {
+		t.Fatalf("expected 3 results, got %d values and %d errors", len(out), len(errs))
+	}
+	if errs[1] == nil || out[1] != "" {
+		t.Errorf("expected an error for the garbage value, got %q", out[1])
+	}
+
+	n, _ := newStore(t)
+	n.Key = newKey
+
+	for i, want := range map[int]*cookiesession.Session{0: a, 2: b} {
+		if errs[i] != nil {
+			t.Fatalf("%d: %s", i, errs[i])
+		}
+
+		if got, err := n.Decode(out[i]); err != nil {
+			t.Errorf("%d: expected the value to decode under the new key, got %v", i, err)
+		} else if got.SID != want.SID || string(got.State) != string(want.State) || !got.Time.Equal(want.Time) {
+			t.Errorf("%d: expected the session unchanged, got %+v", i, got)
+		}
+
+		if _, err := s.Decode(out[i]); err == nil {
+			t.Errorf("%d: expected the old key not to decode the new value", i)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package cookiesession_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+func TestMaxSize(t *testing.T) {
+	s, _ := newStore(t)
+
+	rec := httptest.NewRecorder()
+	err := s.Save(rec, cookiesession.NewSession().WithState([]byte(strings.Repeat("x", cookiesession.MaxCookieSize))))
+	if err != cookiesession.ErrTooLarge {
+		t.Fatalf("expected %v over the default limit, got %v", cookiesession.ErrTooLarge, err)
+	}
+	if n := len(rec.Result().Header["Set-Cookie"]); n != 0 {
+		t.Errorf("expected no Set-Cookie for a refused save, got %d", n)
+	}
+
+	s.MaxSize = -1
+	if err := s.Save(httptest.NewRecorder(), cookiesession.NewSession().WithState([]byte(strings.Repeat("x", cookiesession.MaxCookieSize)))); err != nil {
+		t.Errorf("expected no limit with a negative MaxSize, got %v", err)
+	}
+}
+
+func TestMaxSizeRefusedSaveChangesNothing(t *testing.T) {
+	s, clock := newStore(t)
+	s.MaxSize = 512
+
+	backend := &countingBackend{}
+	s.Backend = backend
+
+	ss := cookiesession.NewSession().WithState([]byte("state"))
+	got := s.Get(save(t, s, ss))
+	before := got
+
+	clock.Advance(time.Minute)
+	got.WithState([]byte("new state"))
+	got.AddFlash("info", strings.Repeat("too long ", 100))
+
+	if err := s.Save(httptest.NewRecorder(), &got); err != cookiesession.ErrTooLarge {
+		t.Fatalf("expected %v, got %v", cookiesession.ErrTooLarge, err)
+	}
+
+	if got.Seq != before.Seq || !got.Time.Equal(before.Time) || !got.Dirty() {
+		t.Errorf("expected a refused save to leave the session as it was, got seq %d at %s (dirty %v)", got.Seq, got.Time, got.Dirty())
+	}
+	if backend.stores != 1 {
+		t.Errorf("expected a refused save not to store state, got %d stores", backend.stores)
+	}
+	if state, err := backend.Load(context.Background(), ss.SID); err != nil || string(state) != "state" {
+		t.Errorf("expected the backend to keep the saved state, got %q, %v", state, err)
+	}
+
+	fresh := cookiesession.NewSession()
+	fresh.AddFlash("info", strings.Repeat("too long ", 100))
+	if err := s.Save(httptest.NewRecorder(), fresh); err != cookiesession.ErrTooLarge {
+		t.Fatalf("expected %v, got %v", cookiesession.ErrTooLarge, err)
+	}
+	if fresh.Valid || fresh.Seq != 0 || !fresh.Time.IsZero() {
+		t.Errorf("expected a refused fresh session to stay unsaved, got %+v", fresh)
+	}
+}
+
+func TestMaxChunkedSizeRefusedSaveChangesNothing(t *testing.T) {
+	s, _ := newStore(t)
+	s.ChunkSize = 1000
+	s.MaxChunkedSize = 2000
+
+	ss := cookiesession.NewSession().WithState([]byte(strings.Repeat("x", 3000)))
+	if err := s.Save(httptest.NewRecorder(), ss); err != cookiesession.ErrChunkedTooLarge {
+		t.Fatalf("expected %v, got %v", cookiesession.ErrChunkedTooLarge, err)
+	}
+	if ss.Valid || ss.Seq != 0 || !ss.Dirty() {
+		t.Errorf("expected the session to stay unsaved, got %+v", ss)
+	}
+}
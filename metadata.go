@@ -0,0 +1,131 @@
+package cookiesession
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+var (
+	ErrBadMetadata = errors.New("session metadata is malformed or doesn't match the sealed value")
+)
+
+// Metadata is what PublicExpiry and PublicSID carry in plaintext in front of
+// each sealed value. Expires is zero for sessions that don't expire, or
+// without PublicExpiry, and SID is Nil without PublicSID.
+type Metadata struct {
+	Expires time.Time
+	SID     uuid.UUID
+}
+
+// ReadMetadata reads the plaintext metadata from the front of value, for
+// edge infrastructure that doesn't have the store's key. If key is set, the
+// HMAC added with the store's MetadataKey is checked with it first.
+func ReadMetadata(value string, key []byte) (Metadata, error) {
+	m, _, _, err := splitMetadata(value, key)
+
+	return m, err
+}
+
+func (s *Store) publicMetadata() bool {
+	return s.PublicExpiry || s.PublicSID
+}
+
+// metadata returns the plaintext metadata for ss, which is bound into the
+// sealed plaintext the same way as the name is with BindName.
+func (s *Store) metadata(ss *Session) string {
+	var exp, sid string
+
+	if s.PublicExpiry {
+		t := ss.ExpiresAt
+		if ttl := s.ttl(ss); t.IsZero() && ttl > 0 {
+			t = ss.Time.Add(ttl)
+		}
+
+		if d := s.timeoutDeadline(ss); !d.IsZero() && (t.IsZero() || d.Before(t)) {
+			t = d
+		}
+
+		if !t.IsZero() {
+			exp = strconv.FormatInt(t.Unix(), 10)
+		}
+	}
+
+	if s.PublicSID {
+		sid = ss.SID.String()
+	}
+
+	return exp + "." + sid
+}
+
+// addMetadata puts meta in front of value, with an HMAC over both if
+// MetadataKey is set.
+func (s *Store) addMetadata(meta, value string) string {
+	var sum string
+	if len(s.MetadataKey) != 0 {
+		sum = base64.RawURLEncoding.EncodeToString(metadataMAC(s.MetadataKey, meta, value))
+	}
+
+	return meta + "." + sum + "|" + value
+}
+
+// splitMetadata splits value into its metadata, in parsed and plaintext
+// form, and the sealed value behind it, checking the HMAC under key if it's
+// set.
+func splitMetadata(value string, key []byte) (Metadata, string, string, error) {
+	i := strings.IndexByte(value, '|')
+	if i < 0 {
+		return Metadata{}, "", "", ErrBadMetadata
+	}
+
+	parts := strings.Split(value[:i], ".")
+	if len(parts) != 3 {
+		return Metadata{}, "", "", ErrBadMetadata
+	}
+
+	meta, value := parts[0]+"."+parts[1], value[i+1:]
+
+	if len(key) != 0 {
+		sum, err := base64.RawURLEncoding.DecodeString(parts[2])
+		if err != nil || !hmac.Equal(sum, metadataMAC(key, meta, value)) {
+			return Metadata{}, "", "", ErrBadSignature
+		}
+	}
+
+	var m Metadata
+
+	if parts[0] != "" {
+		exp, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return Metadata{}, "", "", ErrBadMetadata
+		}
+
+		m.Expires = time.Unix(exp, 0)
+	}
+
+	if parts[1] != "" {
+		sid, err := uuid.FromString(parts[1])
+		if err != nil {
+			return Metadata{}, "", "", ErrBadMetadata
+		}
+
+		m.SID = sid
+	}
+
+	return m, meta, value, nil
+}
+
+func metadataMAC(key []byte, meta, value string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(meta))
+	mac.Write([]byte{'|'})
+	mac.Write([]byte(value))
+
+	return mac.Sum(nil)
+}
@@ -0,0 +1,152 @@
+package cookiesession_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/satori/go.uuid"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+// public returns a store that puts sessions' expiry and SID in front of
+// their values, and a session saved with it.
+func public(t *testing.T) (*cookiesession.Store, *cookiesession.Session, string) {
+	t.Helper()
+
+	s, _ := newStore(t)
+	s.PublicExpiry = true
+	s.PublicSID = true
+
+	ss := cookiesession.NewSession().WithState([]byte("secret state"))
+
+	return s, ss, value(t, s, ss)
+}
+
+// decodeCookie returns the error from loading v as s's cookie.
+func decodeCookie(s *cookiesession.Store, v string) error {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: s.Name, Value: v})
+
+	_, err := s.GetE(r)
+
+	return err
+}
+
+func TestReadMetadata(t *testing.T) {
+	s, ss, v := public(t)
+
+	m, err := cookiesession.ReadMetadata(v, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := epoch.Add(s.TTL); !m.Expires.Equal(want) {
+		t.Errorf("expected the expiry %s, got %s", want, m.Expires)
+	}
+	if m.SID != ss.SID {
+		t.Errorf("expected the SID %s, got %s", ss.SID, m.SID)
+	}
+
+	if strings.Contains(v, "secret state") {
+		t.Error("expected the state to stay sealed")
+	}
+
+	if err := decodeCookie(s, v); err != nil {
+		t.Fatalf("expected the value to load, got %v", err)
+	}
+}
+
+func TestReadMetadataFields(t *testing.T) {
+	s, _ := newStore(t)
+	s.PublicExpiry = true
+
+	if m, err := cookiesession.ReadMetadata(value(t, s, cookiesession.NewSession().WithState([]byte("state"))), nil); err != nil || m.SID != uuid.Nil || m.Expires.IsZero() {
+		t.Fatalf("expected only the expiry with PublicExpiry, got %+v, %v", m, err)
+	}
+
+	s.PublicExpiry = false
+	s.PublicSID = true
+
+	if m, err := cookiesession.ReadMetadata(value(t, s, cookiesession.NewSession().WithState([]byte("state"))), nil); err != nil || m.SID == uuid.Nil || !m.Expires.IsZero() {
+		t.Fatalf("expected only the SID with PublicSID, got %+v, %v", m, err)
+	}
+
+	s.PublicExpiry = true
+	s.SessionCookie = true
+	s.TTL = 0
+
+	if m, err := cookiesession.ReadMetadata(value(t, s, cookiesession.NewSession().WithState([]byte("state"))), nil); err != nil || !m.Expires.IsZero() {
+		t.Fatalf("expected no expiry for a session that doesn't expire, got %+v, %v", m, err)
+	}
+}
+
+func TestReadMetadataMalformed(t *testing.T) {
+	for _, v := range []string{"", "no metadata", "1.2|value", "a..|value", "1.not a uuid.|value"} {
+		if _, err := cookiesession.ReadMetadata(v, nil); err != cookiesession.ErrBadMetadata {
+			t.Errorf("expected %v for %q, got %v", cookiesession.ErrBadMetadata, v, err)
+		}
+	}
+}
+
+func TestMetadataTampered(t *testing.T) {
+	s, ss, v := public(t)
+
+	exp := strconv.FormatInt(epoch.Add(s.TTL).Unix(), 10)
+	later := strconv.FormatInt(epoch.Add(24*time.Hour).Unix(), 10)
+
+	extended := strings.Replace(v, exp, later, 1)
+	if m, err := cookiesession.ReadMetadata(extended, nil); err != nil || !m.Expires.Equal(epoch.Add(24*time.Hour)) {
+		t.Fatalf("expected the edge to read the changed expiry, got %+v, %v", m, err)
+	}
+	if err := decodeCookie(s, extended); err != cookiesession.ErrBadMetadata {
+		t.Errorf("expected %v for a changed expiry, got %v", cookiesession.ErrBadMetadata, err)
+	}
+
+	swapped := strings.Replace(v, ss.SID.String(), uuid.UUID{1}.String(), 1)
+	if err := decodeCookie(s, swapped); err != cookiesession.ErrBadMetadata {
+		t.Errorf("expected %v for a changed SID, got %v", cookiesession.ErrBadMetadata, err)
+	}
+
+	if err := decodeCookie(s, v[strings.IndexByte(v, '|')+1:]); err != cookiesession.ErrBadMetadata {
+		t.Errorf("expected %v for a value without its metadata, got %v", cookiesession.ErrBadMetadata, err)
+	}
+}
+
+func TestMetadataKey(t *testing.T) {
+	s, _ := newStore(t)
+	s.PublicExpiry = true
+	s.MetadataKey = []byte("edge key")
+
+	v := value(t, s, cookiesession.NewSession().WithState([]byte("state")))
+
+	if m, err := cookiesession.ReadMetadata(v, []byte("edge key")); err != nil || m.Expires.IsZero() {
+		t.Fatalf("expected the metadata to check out under the key, got %+v, %v", m, err)
+	}
+
+	if _, err := cookiesession.ReadMetadata(v, []byte("other key")); err != cookiesession.ErrBadSignature {
+		t.Fatalf("expected %v under the wrong key, got %v", cookiesession.ErrBadSignature, err)
+	}
+
+	if _, err := cookiesession.ReadMetadata(v, nil); err != nil {
+		t.Fatalf("expected the metadata to be readable without the key, got %v", err)
+	}
+
+	exp := strconv.FormatInt(epoch.Add(s.TTL).Unix(), 10)
+	extended := strings.Replace(v, exp, strconv.FormatInt(epoch.Add(24*time.Hour).Unix(), 10), 1)
+
+	if _, err := cookiesession.ReadMetadata(extended, []byte("edge key")); err != cookiesession.ErrBadSignature {
+		t.Fatalf("expected the edge to reject a changed expiry, got %v", err)
+	}
+	if err := decodeCookie(s, extended); err != cookiesession.ErrBadSignature {
+		t.Fatalf("expected the store to reject a changed expiry, got %v", err)
+	}
+
+	if err := decodeCookie(s, v); err != nil {
+		t.Fatalf("expected the value to load, got %v", err)
+	}
+}
@@ -0,0 +1,252 @@
+// Package metrics counts what a cookiesession.Store does, for production
+// visibility. A Collector serves its metrics in the Prometheus text format,
+// and Snapshot gives the same numbers to anything else, such as OpenTelemetry
+// observable instruments.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+var (
+	// SizeBuckets are the upper bounds of the save size histogram, in bytes.
+	SizeBuckets = []float64{256, 512, 1024, 2048, 3072, 4096, 8192, 16384}
+
+	// LatencyBuckets are the upper bounds of the seal and open latency
+	// histograms, in seconds.
+	LatencyBuckets = []float64{0.000005, 0.00001, 0.000025, 0.00005, 0.0001, 0.00025, 0.0005, 0.001, 0.005}
+)
+
+// Histogram is a snapshot of a histogram. Counts[i] is the number of
+// observations no greater than Buckets[i], and Count includes those greater
+// than every bucket.
+type Histogram struct {
+	Buckets []float64
+	Counts  []uint64
+	Count   uint64
+	Sum     float64
+}
+
+func newHistogram(buckets []float64) Histogram {
+	return Histogram{Buckets: buckets, Counts: make([]uint64, len(buckets))}
+}
+
+func (h *Histogram) observe(v float64) {
+	for i, b := range h.Buckets {
+		if v <= b {
+			h.Counts[i]++
+		}
+	}
+
+	h.Count++
+	h.Sum += v
+}
+
+func (h Histogram) clone() Histogram {
+	h.Counts = append([]uint64(nil), h.Counts...)
+
+	return h
+}
+
+// Snapshot is a copy of a Collector's metrics at one moment.
+type Snapshot struct {
+	Created        uint64
+	Saved          uint64
+	Expired        uint64
+	DecodeFailures map[string]uint64
+
+	SaveBytes   Histogram
+	SealSeconds Histogram
+	OpenSeconds Histogram
+}
+
+// Collector counts sessions created, saved and expired, decode failures by
+// the reasons given to OnError, the size of each saved cookie, and how long
+// sealing and opening values take.
+type Collector struct {
+	mu sync.Mutex
+	s  Snapshot
+}
+
+// New returns an empty Collector.
+func New() *Collector {
+	return &Collector{s: Snapshot{
+		DecodeFailures: make(map[string]uint64),
+		SaveBytes:      newHistogram(SizeBuckets),
+		SealSeconds:    newHistogram(LatencyBuckets),
+		OpenSeconds:    newHistogram(LatencyBuckets),
+	}}
+}
+
+// Instrument sets s's callbacks and Cipher so that c sees what s does. Any
+// callbacks already set are still called. It must be called before s is
+// used. Latencies are only measured for the native format, not CompactJWE.
+// Instrumenting several stores with one Collector adds their metrics
+// together.
+func (c *Collector) Instrument(s *cookiesession.Store) {
+	onCreate := s.OnCreate
+	s.OnCreate = func(r *http.Request, ss *cookiesession.Session) {
+		c.add(func(s *Snapshot) { s.Created++ })
+		if onCreate != nil {
+			onCreate(r, ss)
+		}
+	}
+
+	onError := s.OnError
+	s.OnError = func(r *http.Request, reason string, err error) {
+		c.add(func(s *Snapshot) { s.DecodeFailures[reason]++ })
+		if onError != nil {
+			onError(r, reason, err)
+		}
+	}
+
+	onExpire := s.OnExpire
+	s.OnExpire = func(r *http.Request, ss *cookiesession.Session) {
+		c.add(func(s *Snapshot) { s.Expired++ })
+		if onExpire != nil {
+			onExpire(r, ss)
+		}
+	}
+
+	beforeSave := s.BeforeSave
+	s.BeforeSave = func(r *http.Request, cookie *http.Cookie) {
+		if beforeSave != nil {
+			beforeSave(r, cookie)
+		}
+		c.add(func(s *Snapshot) {
+			s.Saved++
+			s.SaveBytes.observe(float64(len(cookie.Value)))
+		})
+	}
+
+	inner := s.Cipher
+	if inner == nil {
+		inner = cookiesession.Secretbox
+	}
+	s.Cipher = timedCipher{Cipher: inner, c: c}
+}
+
+func (c *Collector) add(fn func(s *Snapshot)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fn(&c.s)
+}
+
+// Snapshot returns a copy of c's metrics.
+func (c *Collector) Snapshot() Snapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.s
+	s.DecodeFailures = make(map[string]uint64, len(c.s.DecodeFailures))
+	for k, v := range c.s.DecodeFailures {
+		s.DecodeFailures[k] = v
+	}
+	s.SaveBytes = c.s.SaveBytes.clone()
+	s.SealSeconds = c.s.SealSeconds.clone()
+	s.OpenSeconds = c.s.OpenSeconds.clone()
+
+	return s
+}
+
+// ServeHTTP writes c's metrics in the Prometheus text format, so c can be
+// scraped directly.
+func (c *Collector) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	c.WriteTo(rw)
+}
+
+// WriteTo writes c's metrics to w in the Prometheus text format.
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	s := c.Snapshot()
+
+	cw := &countingWriter{w: w}
+
+	writeCounter(cw, "cookiesession_sessions_created_total", "Fresh sessions handed out.", s.Created)
+	writeCounter(cw, "cookiesession_sessions_saved_total", "Session cookies written.", s.Saved)
+	writeCounter(cw, "cookiesession_sessions_expired_total", "Expired session cookies rejected.", s.Expired)
+
+	fmt.Fprintf(cw, "# HELP cookiesession_decode_failures_total Session cookies rejected, by reason.\n")
+	fmt.Fprintf(cw, "# TYPE cookiesession_decode_failures_total counter\n")
+	reasons := make([]string, 0, len(s.DecodeFailures))
+	for reason := range s.DecodeFailures {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		fmt.Fprintf(cw, "cookiesession_decode_failures_total{reason=%q} %d\n", reason, s.DecodeFailures[reason])
+	}
+
+	writeHistogram(cw, "cookiesession_save_bytes", "Size of saved cookie values.", s.SaveBytes)
+	writeHistogram(cw, "cookiesession_seal_seconds", "Time taken to seal a value.", s.SealSeconds)
+	writeHistogram(cw, "cookiesession_open_seconds", "Time taken to open a value.", s.OpenSeconds)
+
+	return cw.n, cw.err
+}
+
+func writeCounter(w io.Writer, name, help string, v uint64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, v)
+}
+
+func writeHistogram(w io.Writer, name, help string, h Histogram) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for i, b := range h.Buckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%g\"} %d\n", name, b, h.Counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.Count)
+	fmt.Fprintf(w, "%s_sum %g\n%s_count %d\n", name, h.Sum, name, h.Count)
+}
+
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	n, err := w.w.Write(b)
+	w.n += int64(n)
+	w.err = err
+
+	return n, err
+}
+
+// timedCipher times each Seal and Open of the Cipher it wraps. It keeps the
+// wrapped cipher's ID, so values are unchanged.
+type timedCipher struct {
+	cookiesession.Cipher
+	c *Collector
+}
+
+func (t timedCipher) Seal(dst, plaintext []byte, nonce *[24]byte, key *[32]byte) []byte {
+	start := time.Now()
+	out := t.Cipher.Seal(dst, plaintext, nonce, key)
+	d := time.Since(start)
+
+	t.c.add(func(s *Snapshot) { s.SealSeconds.observe(d.Seconds()) })
+
+	return out
+}
+
+func (t timedCipher) Open(dst, sealed []byte, nonce *[24]byte, key *[32]byte) ([]byte, bool) {
+	start := time.Now()
+	out, ok := t.Cipher.Open(dst, sealed, nonce, key)
+	d := time.Since(start)
+
+	t.c.add(func(s *Snapshot) { s.OpenSeconds.observe(d.Seconds()) })
+
+	return out, ok
+}
@@ -0,0 +1,208 @@
+package metrics_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"fknsrs.biz/p/cookiesession"
+	"fknsrs.biz/p/cookiesession/cookiesessiontest"
+	"fknsrs.biz/p/cookiesession/metrics"
+)
+
+// with returns a request carrying value as s's cookie.
+func with(s *cookiesession.Store, value string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: s.Name, Value: value})
+
+	return r
+}
+
+// saveValue saves a session holding state with s and returns its cookie
+// value.
+func saveValue(t *testing.T, s *cookiesession.Store, state string) string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	if err := s.Save(rec, cookiesession.NewSession().WithState([]byte(state))); err != nil {
+		t.Fatal(err)
+	}
+
+	return rec.Result().Cookies()[0].Value
+}
+
+func TestInstrument(t *testing.T) {
+	clock := cookiesessiontest.NewClock(time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC))
+
+	s := cookiesessiontest.NewStore("session", t.Name())
+	s.Now = clock.Now
+
+	c := metrics.New()
+	c.Instrument(s)
+
+	s.Get(httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := c.Snapshot(); got.Created != 1 {
+		t.Fatalf("expected one session created, got %d", got.Created)
+	}
+
+	v := saveValue(t, s, "state")
+
+	got := c.Snapshot()
+	if got.Saved != 1 || got.SaveBytes.Count != 1 || got.SaveBytes.Sum != float64(len(v)) {
+		t.Fatalf("expected one save of %d bytes, got %d saves totalling %g", len(v), got.Saved, got.SaveBytes.Sum)
+	}
+	if got.SealSeconds.Count == 0 {
+		t.Fatal("expected sealing to be timed")
+	}
+
+	if ss := s.Get(with(s, v)); string(ss.State) != "state" {
+		t.Fatalf("expected the value to load, got %q", ss.State)
+	}
+	if got := c.Snapshot(); got.OpenSeconds.Count == 0 || got.Created != 1 {
+		t.Fatalf("expected opening to be timed and no session created, got %+v", got)
+	}
+
+	s.Get(with(s, "garbage"))
+	s.Get(with(s, "garbage"))
+
+	clock.Advance(s.TTL + cookiesession.DefaultClockSkew + time.Second)
+	s.Get(with(s, v))
+
+	got = c.Snapshot()
+	if got.Expired != 1 {
+		t.Errorf("expected one expiry, got %d", got.Expired)
+	}
+	if got.DecodeFailures["expired"] != 1 || got.DecodeFailures["malformed"] != 2 {
+		t.Errorf("expected failures counted by reason, got %v", got.DecodeFailures)
+	}
+	if got.Created != 4 {
+		t.Errorf("expected a session created in place of each rejected one, got %d", got.Created)
+	}
+}
+
+func TestInstrumentKeepsCallbacks(t *testing.T) {
+	s := cookiesessiontest.NewStore("session", t.Name())
+
+	var created, rejected, saved int
+	s.OnCreate = func(r *http.Request, ss *cookiesession.Session) { created++ }
+	s.OnError = func(r *http.Request, reason string, err error) { rejected++ }
+	s.BeforeSave = func(r *http.Request, c *http.Cookie) {
+		saved++
+		c.Value = strings.Repeat("x", 100)
+	}
+
+	c := metrics.New()
+	c.Instrument(s)
+
+	s.Get(with(s, "garbage"))
+	saveValue(t, s, "state")
+
+	if created != 1 || rejected != 1 || saved != 1 {
+		t.Fatalf("expected the existing callbacks to still be called, got %d, %d and %d", created, rejected, saved)
+	}
+
+	if got := c.Snapshot(); got.SaveBytes.Sum != 100 {
+		t.Fatalf("expected the size after BeforeSave to be counted, got %g", got.SaveBytes.Sum)
+	}
+}
+
+func TestInstrumentKeepsValues(t *testing.T) {
+	plain := cookiesessiontest.NewStore("session", t.Name())
+
+	s := cookiesessiontest.NewStore("session", t.Name())
+	metrics.New().Instrument(s)
+
+	if ss := plain.Get(with(plain, saveValue(t, s, "state"))); string(ss.State) != "state" {
+		t.Fatalf("expected an instrumented store's values to be unchanged, got %q", ss.State)
+	}
+
+	if ss := s.Get(with(s, saveValue(t, plain, "state"))); string(ss.State) != "state" {
+		t.Fatalf("expected an instrumented store to read existing values, got %q", ss.State)
+	}
+}
+
+func TestSeveralStores(t *testing.T) {
+	c := metrics.New()
+
+	for _, name := range []string{"a", "b"} {
+		s := cookiesessiontest.NewStore(name, t.Name())
+		c.Instrument(s)
+		saveValue(t, s, "state")
+	}
+
+	if got := c.Snapshot(); got.Saved != 2 {
+		t.Fatalf("expected the stores' metrics to be added together, got %d", got.Saved)
+	}
+}
+
+func TestSnapshotCopies(t *testing.T) {
+	s := cookiesessiontest.NewStore("session", t.Name())
+
+	c := metrics.New()
+	c.Instrument(s)
+
+	s.Get(with(s, "garbage"))
+	saveValue(t, s, "state")
+
+	got := c.Snapshot()
+	got.DecodeFailures["malformed"] = 100
+	got.SaveBytes.Counts[len(got.SaveBytes.Counts)-1] = 100
+
+	again := c.Snapshot()
+	if again.DecodeFailures["malformed"] != 1 || again.SaveBytes.Counts[len(again.SaveBytes.Counts)-1] != 1 {
+		t.Fatal("expected changes to a snapshot not to reach the collector")
+	}
+}
+
+func TestWriteTo(t *testing.T) {
+	s := cookiesessiontest.NewStore("session", t.Name())
+	s.BeforeSave = func(r *http.Request, c *http.Cookie) { c.Value = strings.Repeat("x", 300) }
+
+	c := metrics.New()
+	c.Instrument(s)
+
+	s.Get(with(s, "garbage"))
+	saveValue(t, s, "state")
+
+	var buf bytes.Buffer
+	n, err := c.WriteTo(&buf)
+	if err != nil || n != int64(buf.Len()) {
+		t.Fatalf("expected %d bytes written, got %d, %v", buf.Len(), n, err)
+	}
+
+	for _, line := range []string{
+		"# TYPE cookiesession_sessions_created_total counter",
+		"cookiesession_sessions_created_total 1",
+		"cookiesession_sessions_saved_total 1",
+		"cookiesession_sessions_expired_total 0",
+		`cookiesession_decode_failures_total{reason="malformed"} 1`,
+		"# TYPE cookiesession_save_bytes histogram",
+		`cookiesession_save_bytes_bucket{le="256"} 0`,
+		`cookiesession_save_bytes_bucket{le="512"} 1`,
+		`cookiesession_save_bytes_bucket{le="+Inf"} 1`,
+		"cookiesession_save_bytes_sum 300",
+		"cookiesession_save_bytes_count 1",
+		"cookiesession_seal_seconds_count 1",
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("expected the line %q, got:\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	c := metrics.New()
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("expected the Prometheus text format, got %q", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "cookiesession_sessions_created_total 0\n") {
+		t.Errorf("expected the metrics in the body, got:\n%s", rec.Body.String())
+	}
+}
@@ -0,0 +1,109 @@
+package cookiesession
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+type contextKey struct{}
+
+// FromContext returns the session that Middleware loaded for the request
+// whose context is ctx, or nil if there isn't one.
+func FromContext(ctx context.Context) *Session {
+	ss, _ := ctx.Value(contextKey{}).(*Session)
+
+	return ss
+}
+
+// Middleware loads each request's session into its context, where handlers
+// can get it with FromContext, and saves it just before the response headers
+// are sent if it's dirty or due to be renewed, as with SaveIfChanged.
+// Changing the session's fields directly doesn't make it dirty, so call
+// MarkDirty after doing that. Save errors can't be returned to anyone, so
+// they're logged. A handler that saves or clears the session itself is left
+// alone, so the response only gets its cookie. Handlers are given a
+// TrackingWriter, so SaveChecked works with it.
+//
+// The chisession, echosession and fibersession packages adapt it to those
+// frameworks.
+func (s *Store) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		ss, _ := s.GetContext(r.Context(), r)
+
+		r = r.WithContext(context.WithValue(r.Context(), contextKey{}, &ss))
+
+		w := &autoSaveWriter{ResponseWriter: rw, store: s, r: r, ss: &ss}
+		next.ServeHTTP(TrackWrites(w), r)
+		w.save()
+	})
+}
+
+// Wrap returns a ResponseWriter that saves ss, like Middleware does, just
+// before the response headers are first sent by WriteHeader, Write or Flush,
+// so that the cookie can't be dropped by saving too late. If the handler
+// might not write anything, call WriteHeader explicitly. There's no
+// request to save for, so options like AutoSecure that need one don't
+// apply.
+func (s *Store) Wrap(rw http.ResponseWriter, ss *Session) http.ResponseWriter {
+	return &autoSaveWriter{ResponseWriter: rw, store: s, ss: ss}
+}
+
+// autoSaveWriter saves a dirty session the first time the response headers
+// are about to be sent, unless they already set the session cookie.
+type autoSaveWriter struct {
+	http.ResponseWriter
+	store *Store
+	r     *http.Request
+	ss    *Session
+	done  bool
+}
+
+func (w *autoSaveWriter) save() {
+	if w.done {
+		return
+	}
+	w.done = true
+
+	if w.store.setsCookie(w.Header()) {
+		return
+	}
+
+	if _, err := w.store.SaveIfChangedFor(w.ResponseWriter, w.r, w.ss); err != nil {
+		w.store.logf("cookiesession: couldn't save session %q: %s", w.store.Name, err)
+	}
+}
+
+func (w *autoSaveWriter) WriteHeader(code int) {
+	w.save()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *autoSaveWriter) Write(b []byte) (int, error) {
+	w.save()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *autoSaveWriter) Flush() {
+	w.save()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *autoSaveWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// setsCookie reports whether h already has a Set-Cookie header for the
+// store's cookie.
+func (s *Store) setsCookie(h http.Header) bool {
+	prefix := s.Name + "="
+	for _, v := range h["Set-Cookie"] {
+		if strings.HasPrefix(v, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
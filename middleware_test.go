@@ -0,0 +1,103 @@
+package cookiesession_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/satori/go.uuid"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+// countingBackend counts how many times state is stored.
+type countingBackend struct {
+	cookiesession.MemoryBackend
+	stores int
+}
+
+func (b *countingBackend) Store(ctx context.Context, sid uuid.UUID, state []byte) error {
+	b.stores++
+	return b.MemoryBackend.Store(ctx, sid, state)
+}
+
+func TestMiddleware(t *testing.T) {
+	s, _ := newStore(t)
+
+	h := s.Middleware(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		ss := cookiesession.FromContext(r.Context())
+		ss.WithState(append(ss.State, 'x'))
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	got := s.Get(request(rec))
+	if string(got.State) != "x" {
+		t.Fatalf("expected the handler's change to be saved, got %q", got.State)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, request(httptest.NewRecorder()))
+	if string(s.Get(request(rec)).State) != "x" {
+		t.Error("expected a fresh session for a request without a cookie")
+	}
+
+	quiet := s.Middleware(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+
+	r := save(t, s, &got)
+	rec = httptest.NewRecorder()
+	quiet.ServeHTTP(rec, r)
+	if n := len(rec.Result().Header["Set-Cookie"]); n != 0 {
+		t.Errorf("expected no Set-Cookie for an unchanged session, got %d", n)
+	}
+}
+
+func TestMiddlewareExplicitSave(t *testing.T) {
+	s, _ := newStore(t)
+
+	backend := &countingBackend{}
+	s.Backend = backend
+
+	h := s.Middleware(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		ss := cookiesession.FromContext(r.Context())
+		ss.WithState([]byte("state"))
+
+		if err := s.SaveFor(rw, r, ss); err != nil {
+			t.Error(err)
+		}
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if n := len(rec.Result().Header["Set-Cookie"]); n != 1 {
+		t.Errorf("expected exactly one Set-Cookie header, got %d", n)
+	}
+	if backend.stores != 1 {
+		t.Errorf("expected the state to be stored once, got %d", backend.stores)
+	}
+	if got := s.Get(request(rec)); got.Seq != 1 {
+		t.Errorf("expected the sequence number to be bumped once, got %d", got.Seq)
+	}
+}
+
+func TestMiddlewareExplicitClear(t *testing.T) {
+	s, _ := newStore(t)
+
+	h := s.Middleware(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		cookiesession.FromContext(r.Context()).WithState([]byte("changed"))
+		s.Clear(rw)
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, save(t, s, cookiesession.NewSession().WithState([]byte("state"))))
+
+	if n := len(rec.Result().Header["Set-Cookie"]); n != 1 {
+		t.Fatalf("expected only the clearing Set-Cookie header, got %d", n)
+	}
+	if _, ok := s.TryGet(request(rec)); ok {
+		t.Error("expected the cleared session not to be saved again")
+	}
+}
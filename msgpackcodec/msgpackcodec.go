@@ -0,0 +1,25 @@
+// Package msgpackcodec encodes the values kept by Session.SetEncodedValue
+// with MessagePack, which is more compact than JSON and keeps integer and
+// binary types intact. It's a separate package so that stores which don't use
+// it don't depend on msgpack.
+package msgpackcodec
+
+import (
+	"github.com/vmihailenco/msgpack/v5"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+// Codec encodes values with MessagePack. Set Store.Codec to it. Values that
+// were encoded with another codec can't be read with it.
+var Codec cookiesession.Codec = codec{}
+
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	return msgpack.Unmarshal(data, v)
+}
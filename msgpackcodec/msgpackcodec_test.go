@@ -0,0 +1,79 @@
+package msgpackcodec_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"fknsrs.biz/p/cookiesession"
+	"fknsrs.biz/p/cookiesession/cookiesessiontest"
+	"fknsrs.biz/p/cookiesession/msgpackcodec"
+)
+
+type cart struct {
+	Items []string          `msgpack:"items"`
+	Total int64             `msgpack:"total"`
+	Meta  map[string]string `msgpack:"meta"`
+}
+
+func TestRoundTrip(t *testing.T) {
+	in := cart{Items: []string{"widget", "gadget"}, Total: 1 << 40, Meta: map[string]string{"coupon": "SPRING"}}
+
+	b, err := msgpackcodec.Codec.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	json, err := cookiesession.JSONCodec{}.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(b) >= len(json) {
+		t.Errorf("expected msgpack to be smaller than JSON, got %d bytes against %d", len(b), len(json))
+	}
+
+	var out cart
+	if err := msgpackcodec.Codec.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	} else if len(out.Items) != 2 || out.Total != in.Total || out.Meta["coupon"] != "SPRING" {
+		t.Fatalf("expected the original value back, got %+v", out)
+	}
+}
+
+func TestRejectsGarbage(t *testing.T) {
+	var out cart
+	if err := msgpackcodec.Codec.Unmarshal([]byte("not msgpack"), &out); err == nil {
+		t.Fatal("expected an error for bytes that aren't msgpack")
+	}
+}
+
+func TestStore(t *testing.T) {
+	s := cookiesessiontest.NewStore("session", t.Name())
+	s.Codec = msgpackcodec.Codec
+
+	ss := s.Get(httptest.NewRequest(http.MethodGet, "/", nil))
+	if err := ss.SetEncodedValue("cart", cart{Items: []string{"widget"}, Total: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	if err := s.Save(rec, &ss); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range rec.Result().Cookies() {
+		r.AddCookie(c)
+	}
+
+	got, err := s.GetE(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out cart
+	if ok, err := got.GetEncodedValue("cart", &out); err != nil || !ok {
+		t.Fatalf("expected the value back, got %v and %v", ok, err)
+	} else if len(out.Items) != 1 || out.Items[0] != "widget" || out.Total != 3 {
+		t.Fatalf("expected the original value back, got %+v", out)
+	}
+}
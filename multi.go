@@ -0,0 +1,256 @@
+package cookiesession
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/http"
+)
+
+var (
+	ErrTooLarge  = errors.New("cookie would be larger than MaxSize")
+	ErrNoAccount = errors.New("no account in that slot")
+	ErrNotMulti  = errors.New("value doesn't hold a multi-session")
+)
+
+// MaxCookieSize is the largest cookie, name and value together, that
+// browsers can be relied on to store, and the default for Store.MaxSize.
+const MaxCookieSize = 4096
+
+// formatMulti marks a plaintext holding a MultiSession rather than a single
+// session.
+const formatMulti = 2
+
+// fits reports whether a cookie with the given name and value is no larger
+// than MaxSize.
+func (s *Store) fits(name, value string) bool {
+	max := s.MaxSize
+	if max == 0 {
+		max = MaxCookieSize
+	}
+
+	return max < 0 || len(name)+1+len(value) <= max
+}
+
+// MultiSession is a set of sessions kept in one cookie, for letting a browser
+// stay logged in to several accounts and switch between them.
+type MultiSession struct {
+	Sessions []Session
+	Active   int
+}
+
+// ActiveSession returns the active session, or nil if there are none.
+func (m *MultiSession) ActiveSession() *Session {
+	if m.Active < 0 || m.Active >= len(m.Sessions) {
+		return nil
+	}
+
+	return &m.Sessions[m.Active]
+}
+
+// AddAccount adds ss and makes it active, returning its slot. A session for
+// a user who's already present replaces theirs.
+func (m *MultiSession) AddAccount(ss Session) int {
+	for i := range m.Sessions {
+		if m.Sessions[i].UID == ss.UID {
+			m.Sessions[i] = ss
+			m.Active = i
+			return i
+		}
+	}
+
+	m.Sessions = append(m.Sessions, ss)
+	m.Active = len(m.Sessions) - 1
+
+	return m.Active
+}
+
+// SwitchTo makes the session in slot i active.
+func (m *MultiSession) SwitchTo(i int) error {
+	if i < 0 || i >= len(m.Sessions) {
+		return ErrNoAccount
+	}
+
+	m.Active = i
+
+	return nil
+}
+
+// RemoveAccount removes the session in slot i. If it was active, the first
+// remaining session becomes active.
+func (m *MultiSession) RemoveAccount(i int) error {
+	if i < 0 || i >= len(m.Sessions) {
+		return ErrNoAccount
+	}
+
+	m.Sessions = append(m.Sessions[:i], m.Sessions[i+1:]...)
+
+	switch {
+	case m.Active == i:
+		m.Active = 0
+	case m.Active > i:
+		m.Active--
+	}
+
+	return nil
+}
+
+// GetMulti returns the set of sessions in the request's cookie, which may be
+// split into chunks. Each session is checked as Get would check it, and those
+// that have expired or are otherwise unacceptable are dropped. A request with
+// no usable cookie gives an empty set.
+func (s *Store) GetMulti(r *http.Request) MultiSession {
+	if s.isClosed() {
+		return MultiSession{}
+	}
+
+	for _, c := range r.Cookies() {
+		if c.Name != s.Name {
+			continue
+		}
+
+		value, err := s.unchunk(r, c.Value)
+		if err == nil {
+			var m MultiSession
+			if m, err = s.decodeMulti(r, value); err == nil {
+				return m
+			}
+		}
+
+		s.rejected(r, nil, err)
+	}
+
+	return MultiSession{}
+}
+
+func (s *Store) decodeMulti(r *http.Request, value string) (MultiSession, error) {
+	if s.RequireSecure {
+		if err := s.checkTransport(r); err != nil {
+			return MultiSession{}, err
+		}
+	}
+
+	buf, _, err := s.openPayload(nil, value)
+	if err != nil {
+		return MultiSession{}, err
+	}
+
+	if buf, err = s.unbind(buf); err != nil {
+		return MultiSession{}, err
+	}
+
+	if len(buf) == 0 || buf[0] != formatMulti {
+		return MultiSession{}, ErrNotMulti
+	}
+	buf = buf[1:]
+
+	active, l := binary.Uvarint(buf)
+	if l <= 0 {
+		return MultiSession{}, ErrMalformed
+	}
+	buf = buf[l:]
+
+	var m MultiSession
+	for i := 0; len(buf) > 0; i++ {
+		n, l := binary.Uvarint(buf)
+		if l <= 0 || n > uint64(len(buf)-l) {
+			return MultiSession{}, ErrMalformed
+		}
+
+		var ss Session
+		if err := ss.UnmarshalBinary(buf[l : l+int(n)]); err != nil {
+			return MultiSession{}, err
+		}
+		buf = buf[l+int(n):]
+
+		if err := s.decodeState(&ss); err != nil {
+			return MultiSession{}, err
+		}
+
+		if err := s.check(r.Context(), &ss); err != nil {
+			s.rejected(r, &ss, err)
+			continue
+		}
+
+		if err := s.accept(r, &ss); err != nil {
+			s.rejected(r, &ss, err)
+			continue
+		}
+
+		if uint64(i) == active {
+			m.Active = len(m.Sessions)
+		}
+		m.Sessions = append(m.Sessions, ss)
+	}
+
+	return m, nil
+}
+
+// SaveMulti writes the set of sessions to rw as one cookie, which is split
+// into chunks with ChunkSize, returning ErrTooLarge if it wouldn't fit in
+// MaxSize. Each session is checked, stamped and committed as Save would, so
+// its State goes to the Backend and OnSave is called for it, and nothing is
+// changed if the cookie can't be written. The cookie's lifetime and any
+// public metadata come from the active session.
+func (s *Store) SaveMulti(rw http.ResponseWriter, m *MultiSession) error {
+	return s.SaveMultiFor(rw, nil, m)
+}
+
+// SaveMultiFor is like SaveMulti, but makes the request available to the
+// bindings and BeforeSave as SaveFor does.
+func (s *Store) SaveMultiFor(rw http.ResponseWriter, r *http.Request, m *MultiSession) error {
+	nexts := make([]*Session, len(m.Sessions))
+	for i := range m.Sessions {
+		next, err := s.stamp(r, &m.Sessions[i])
+		if err != nil {
+			return err
+		}
+		nexts[i] = next
+	}
+
+	var l [binary.MaxVarintLen64]byte
+
+	buf := []byte{formatMulti}
+	buf = append(buf, l[:binary.PutUvarint(l[:], uint64(m.Active))]...)
+	for _, next := range nexts {
+		b, err := s.marshal(next, 0)
+		if err != nil {
+			wipe(buf)
+			return err
+		}
+
+		buf = append(buf, l[:binary.PutUvarint(l[:], uint64(len(b)))]...)
+		buf = append(buf, b...)
+		wipe(b)
+	}
+
+	lead := &Session{Time: s.now().Truncate(s.timeGranularity())}
+	if m.Active >= 0 && m.Active < len(nexts) {
+		lead = nexts[m.Active]
+	}
+
+	value, err := s.sealPayload(lead, buf)
+	if err != nil {
+		return err
+	}
+
+	cookies, err := s.fitted(s.finishCookie(r, lead, value))
+	if err != nil {
+		return err
+	}
+
+	for i, next := range nexts {
+		if err := s.commit(contextOf(r), &m.Sessions[i], next); err != nil {
+			return err
+		}
+	}
+
+	s.addCookies(rw.Header(), r, cookies)
+
+	if s.OnSave != nil {
+		for i := range m.Sessions {
+			s.OnSave(r, &m.Sessions[i])
+		}
+	}
+
+	return nil
+}
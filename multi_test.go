@@ -0,0 +1,281 @@
+package cookiesession_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/satori/go.uuid"
+
+	"fknsrs.biz/p/cookiesession"
+	"fknsrs.biz/p/cookiesession/cookiesessiontest"
+)
+
+func account(uid byte) cookiesession.Session {
+	ss := cookiesession.NewSession().WithUID(uuid.UUID{uid})
+	return *ss
+}
+
+func TestMultiSession(t *testing.T) {
+	s, _ := newStore(t)
+
+	var m cookiesession.MultiSession
+	if m.ActiveSession() != nil {
+		t.Fatal("expected no active session in an empty set")
+	}
+
+	for _, uid := range []byte{1, 2, 3} {
+		if i := m.AddAccount(account(uid)); i != int(uid)-1 {
+			t.Fatalf("expected account %d in slot %d, got %d", uid, uid-1, i)
+		}
+	}
+	if i := m.AddAccount(account(2)); i != 1 || len(m.Sessions) != 3 {
+		t.Fatalf("expected a returning account to replace its slot, got slot %d of %d", i, len(m.Sessions))
+	}
+
+	if err := m.SwitchTo(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SwitchTo(3); err != cookiesession.ErrNoAccount {
+		t.Errorf("expected %v switching to a missing slot, got %v", cookiesession.ErrNoAccount, err)
+	}
+
+	rec := httptest.NewRecorder()
+	if err := s.SaveMulti(rec, &m); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(rec.Result().Cookies()); n != 1 {
+		t.Fatalf("expected one cookie, got %d", n)
+	}
+
+	got := s.GetMulti(request(rec))
+	if len(got.Sessions) != 3 || got.ActiveSession().UID != (uuid.UUID{3}) {
+		t.Fatalf("expected three accounts with the third active, got %+v", got)
+	}
+
+	if err := got.RemoveAccount(0); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Sessions) != 2 || got.ActiveSession().UID != (uuid.UUID{3}) {
+		t.Errorf("expected the active account to stay active, got %+v", got)
+	}
+
+	if err := got.RemoveAccount(1); err != nil {
+		t.Fatal(err)
+	}
+	if got.ActiveSession().UID != (uuid.UUID{2}) {
+		t.Errorf("expected the first remaining account to become active, got %s", got.ActiveSession().UID)
+	}
+
+	if err := got.RemoveAccount(5); err != cookiesession.ErrNoAccount {
+		t.Errorf("expected %v removing a missing slot, got %v", cookiesession.ErrNoAccount, err)
+	}
+}
+
+func TestMultiSessionSeparateFromSessions(t *testing.T) {
+	s, _ := newStore(t)
+
+	m := cookiesession.MultiSession{}
+	m.AddAccount(account(1))
+
+	rec := httptest.NewRecorder()
+	if err := s.SaveMulti(rec, &m); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := s.GetE(request(rec)); err == nil {
+		t.Errorf("expected a multi-session not to open as a session, got %+v", got)
+	}
+
+	if got := s.GetMulti(save(t, s, cookiesession.NewSession().WithState([]byte("state")))); len(got.Sessions) != 0 {
+		t.Errorf("expected a session not to open as a multi-session, got %+v", got)
+	}
+}
+
+func TestMultiSessionTooLarge(t *testing.T) {
+	s, _ := newStore(t)
+
+	var m cookiesession.MultiSession
+	for _, uid := range []byte{1, 2, 3} {
+		ss := account(uid)
+		ss.WithState(bytes.Repeat([]byte{uid}, 1200))
+		m.AddAccount(ss)
+	}
+
+	if err := s.SaveMulti(httptest.NewRecorder(), &m); err != cookiesession.ErrTooLarge {
+		t.Errorf("expected %v for a set over the size limit, got %v", cookiesession.ErrTooLarge, err)
+	}
+
+	m.RemoveAccount(0)
+
+	if err := s.SaveMulti(httptest.NewRecorder(), &m); err != nil {
+		t.Errorf("expected the set to fit with an account removed, got %v", err)
+	}
+}
+
+// accounts returns a set of sessions for the given users, each with n bytes
+// of state that doesn't compress, and the last one active.
+func accounts(t *testing.T, n int, uids ...byte) cookiesession.MultiSession {
+	t.Helper()
+
+	var m cookiesession.MultiSession
+	for _, uid := range uids {
+		state := make([]byte, n)
+		if _, err := io.ReadFull(cookiesessiontest.NewReader(string(uid)), state); err != nil {
+			t.Fatal(err)
+		}
+
+		ss := account(uid)
+		ss.WithState(state)
+		m.AddAccount(ss)
+	}
+
+	return m
+}
+
+func TestMultiSessionChunked(t *testing.T) {
+	s, _ := newStore(t)
+	s.ChunkSize = 1000
+
+	m := accounts(t, 1500, 1, 2)
+
+	rec := httptest.NewRecorder()
+	if err := s.SaveMulti(rec, &m); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(rec.Result().Cookies()); n < 3 {
+		t.Fatalf("expected the set to be split into chunks, got %d cookies", n)
+	}
+
+	got := s.GetMulti(request(rec))
+	if len(got.Sessions) != 2 || !bytes.Equal(got.Sessions[1].State, m.Sessions[1].State) {
+		t.Fatalf("expected both accounts back from the chunks, got %d", len(got.Sessions))
+	}
+}
+
+func TestMultiSessionSavesLikeSave(t *testing.T) {
+	s, _ := newStore(t)
+	s.ExtraAttributes = []string{"Priority=High"}
+
+	var before, saved int
+	s.BeforeSave = func(r *http.Request, c *http.Cookie) { before++ }
+	s.OnSave = func(r *http.Request, ss *cookiesession.Session) { saved++ }
+
+	m := accounts(t, 10, 1, 2)
+
+	rec := httptest.NewRecorder()
+	if err := s.SaveMulti(rec, &m); err != nil {
+		t.Fatal(err)
+	}
+
+	if h := rec.Header().Get("Set-Cookie"); !strings.HasSuffix(h, "; Priority=High") {
+		t.Errorf("expected ExtraAttributes on the cookie, got %q", h)
+	}
+	if before != 1 || saved != 2 {
+		t.Errorf("expected BeforeSave once and OnSave for each session, got %d and %d", before, saved)
+	}
+
+	for i, ss := range m.Sessions {
+		if !ss.Valid || ss.Dirty() || ss.Seq != 1 || !ss.Time.Equal(epoch) {
+			t.Errorf("%d: expected the session to be stamped as saved, got %+v", i, ss)
+		}
+	}
+
+	got := s.GetMulti(request(rec))
+	if len(got.Sessions) != 2 {
+		t.Fatalf("expected both accounts back, got %d", len(got.Sessions))
+	}
+	if got.ActiveSession().CSRFToken() == "" {
+		t.Error("expected loaded sessions to know their store")
+	}
+}
+
+func TestMultiSessionCompressedWithMetadata(t *testing.T) {
+	s, _ := newStore(t)
+	s.Compression = cookiesession.GzipCompression
+	s.PublicSID = true
+
+	var m cookiesession.MultiSession
+	for _, uid := range []byte{1, 2} {
+		ss := account(uid)
+		ss.WithState(bytes.Repeat([]byte("compressible "), 200))
+		m.AddAccount(ss)
+	}
+
+	rec := httptest.NewRecorder()
+	if err := s.SaveMulti(rec, &m); err != nil {
+		t.Fatal(err)
+	}
+
+	c := rec.Result().Cookies()[0]
+	if len(c.Value) > 1000 {
+		t.Errorf("expected the set to be compressed, got %d bytes", len(c.Value))
+	}
+
+	if md, err := cookiesession.ReadMetadata(c.Value, nil); err != nil || md.SID != m.ActiveSession().SID {
+		t.Errorf("expected the active session's SID in the metadata, got %+v and %v", md, err)
+	}
+
+	if got := s.GetMulti(request(rec)); len(got.Sessions) != 2 || string(got.Sessions[0].State) != string(m.Sessions[0].State) {
+		t.Fatalf("expected both accounts back, got %d", len(got.Sessions))
+	}
+}
+
+func TestMultiSessionRefusedSaveChangesNothing(t *testing.T) {
+	s, _ := newStore(t)
+
+	m := accounts(t, 10, 1, 2)
+	m.Sessions[1].Freeze()
+
+	rec := httptest.NewRecorder()
+	if err := s.SaveMulti(rec, &m); err != cookiesession.ErrReadOnly {
+		t.Fatalf("expected %v with a frozen session in the set, got %v", cookiesession.ErrReadOnly, err)
+	}
+	if len(rec.Result().Cookies()) != 0 || m.Sessions[0].Valid || m.Sessions[0].Seq != 0 {
+		t.Fatalf("expected a refused save to change nothing, got %+v", m.Sessions[0])
+	}
+
+	m = cookiesession.MultiSession{Sessions: []cookiesession.Session{{}}}
+	if err := s.SaveMulti(httptest.NewRecorder(), &m); err != cookiesession.ErrSessionNotValid {
+		t.Errorf("expected %v for a session nothing was done to, got %v", cookiesession.ErrSessionNotValid, err)
+	}
+
+	m = accounts(t, 1500, 1, 2, 3)
+	if err := s.SaveMulti(httptest.NewRecorder(), &m); err != cookiesession.ErrTooLarge {
+		t.Fatalf("expected %v, got %v", cookiesession.ErrTooLarge, err)
+	}
+	for i, ss := range m.Sessions {
+		if ss.Valid || ss.Seq != 0 || !ss.Dirty() {
+			t.Errorf("%d: expected a set that doesn't fit to stay unsaved, got %+v", i, ss)
+		}
+	}
+}
+
+func TestMultiSessionBinding(t *testing.T) {
+	s, _ := newStore(t)
+	s.Binding = &cookiesession.Binding{UserAgent: true}
+
+	m := accounts(t, 10, 1, 2)
+
+	if err := s.SaveMulti(httptest.NewRecorder(), &m); err != cookiesession.ErrNoBindingRequest {
+		t.Fatalf("expected %v without a request, got %v", cookiesession.ErrNoBindingRequest, err)
+	}
+
+	rec := httptest.NewRecorder()
+	if err := s.SaveMultiFor(rec, from("192.0.2.1:1234", "browser"), &m); err != nil {
+		t.Fatal(err)
+	}
+
+	c := rec.Result().Cookies()[0]
+	for ua, want := range map[string]int{"browser": 2, "curl": 0} {
+		r := from("192.0.2.1:1234", ua)
+		r.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+
+		if got := s.GetMulti(r); len(got.Sessions) != want {
+			t.Errorf("%s: expected %d sessions, got %d", ua, want, len(got.Sessions))
+		}
+	}
+}
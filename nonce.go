@@ -0,0 +1,127 @@
+package cookiesession
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	ErrNonceReuse = errors.New("nonce was reused; the random source is broken")
+)
+
+// NonceReuseWindow is how many recent nonces a Store remembers when
+// DetectNonceReuse is set.
+const NonceReuseWindow = 1024
+
+// nonceSet remembers a bounded number of recently used nonces.
+type nonceSet struct {
+	mu   sync.Mutex
+	seen map[[24]byte]struct{}
+	ring [][24]byte
+	next int
+}
+
+func newNonceSet(size int) *nonceSet {
+	return &nonceSet{
+		seen: make(map[[24]byte]struct{}, size),
+		ring: make([][24]byte, 0, size),
+	}
+}
+
+// add records nonce, and reports false if it was already in the set.
+func (n *nonceSet) add(nonce [24]byte) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if _, ok := n.seen[nonce]; ok {
+		return false
+	}
+
+	if len(n.ring) < cap(n.ring) {
+		n.ring = append(n.ring, nonce)
+	} else {
+		delete(n.seen, n.ring[n.next])
+		n.ring[n.next] = nonce
+		n.next = (n.next + 1) % len(n.ring)
+	}
+
+	n.seen[nonce] = struct{}{}
+
+	return true
+}
+
+// noncesMu guards the lazy creation of each Store's nonceSet.
+var noncesMu sync.Mutex
+
+func (s *Store) nonceSet() *nonceSet {
+	noncesMu.Lock()
+	defer noncesMu.Unlock()
+
+	if s.nonces == nil {
+		s.nonces = newNonceSet(NonceReuseWindow)
+	}
+
+	return s.nonces
+}
+
+// nonceCounter generates nonces from a fixed random prefix and a counter.
+type nonceCounter struct {
+	n      uint64
+	prefix [12]byte
+}
+
+func (c *nonceCounter) next() [24]byte {
+	var nonce [24]byte
+	copy(nonce[:12], c.prefix[:])
+	binary.BigEndian.PutUint64(nonce[16:], atomic.AddUint64(&c.n, 1))
+
+	return nonce
+}
+
+func (s *Store) nonceCounter() (*nonceCounter, error) {
+	noncesMu.Lock()
+	c := s.counter
+	noncesMu.Unlock()
+
+	if c != nil {
+		return c, nil
+	}
+
+	// Rand may be anything, so it's read without holding noncesMu, and
+	// whichever prefix is stored first wins.
+	c = &nonceCounter{}
+	if _, err := io.ReadFull(s.rand(), c.prefix[:]); err != nil {
+		return nil, err
+	}
+
+	noncesMu.Lock()
+	defer noncesMu.Unlock()
+
+	if s.counter == nil {
+		s.counter = c
+	}
+
+	return s.counter, nil
+}
+
+// nonce returns a fresh nonce for sealing a value.
+func (s *Store) nonce() ([24]byte, error) {
+	if s.CounterNonces {
+		c, err := s.nonceCounter()
+		if err != nil {
+			return [24]byte{}, err
+		}
+
+		return c.next(), nil
+	}
+
+	var nonce [24]byte
+	if _, err := io.ReadFull(s.rand(), nonce[:]); err != nil {
+		return [24]byte{}, err
+	}
+
+	return nonce, nil
+}
@@ -0,0 +1,131 @@
+package cookiesession_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+// constantReader is a broken random source that always reads the same byte.
+type constantReader byte
+
+func (r constantReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(r)
+	}
+
+	return len(p), nil
+}
+
+func TestDetectNonceReuse(t *testing.T) {
+	s, _ := newStore(t)
+	s.Rand = constantReader(7)
+	s.DetectNonceReuse = true
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("state"))
+
+	if err := s.Save(httptest.NewRecorder(), ss); err != nil {
+		t.Fatalf("expected the first seal to succeed, got %v", err)
+	}
+
+	ss.MarkDirty()
+
+	rec := httptest.NewRecorder()
+	if err := s.Save(rec, ss); err != cookiesession.ErrNonceReuse {
+		t.Fatalf("expected %v for the repeated nonce, got %v", cookiesession.ErrNonceReuse, err)
+	} else if len(rec.Header()) != 0 {
+		t.Fatal("expected nothing to be written")
+	}
+}
+
+func TestNonceReuseUndetected(t *testing.T) {
+	s, _ := newStore(t)
+	s.Rand = constantReader(7)
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("state"))
+
+	for i := 0; i < 2; i++ {
+		if err := s.Save(httptest.NewRecorder(), ss); err != nil {
+			t.Fatalf("expected reuse to go unnoticed with DetectNonceReuse off, got %v", err)
+		}
+	}
+}
+
+func TestNonceReuseRandomSource(t *testing.T) {
+	s, _ := newStore(t)
+	s.DetectNonceReuse = true
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("state"))
+
+	for i := 0; i < cookiesession.NonceReuseWindow+10; i++ {
+		if err := s.Save(httptest.NewRecorder(), ss); err != nil {
+			t.Fatalf("expected a working source never to trip the check, got %v", err)
+		}
+	}
+}
+
+func TestCounterNonces(t *testing.T) {
+	s, _ := newStore(t)
+	s.Rand = constantReader(7)
+	s.CounterNonces = true
+
+	seen := make(map[[24]byte]bool)
+
+	for i := 0; i < 10000; i++ {
+		v, err := s.Seal([]byte("token"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var nonce [24]byte
+		copy(nonce[:], b)
+
+		if seen[nonce] {
+			t.Fatalf("nonce %x was used twice after %d seals", nonce, i)
+		}
+		seen[nonce] = true
+
+		if !bytes.Equal(nonce[:12], bytes.Repeat([]byte{7}, 12)) {
+			t.Fatalf("expected the prefix to be read once from Rand, got %x", nonce[:12])
+		}
+	}
+
+	v, err := s.Seal([]byte("token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err := s.Open(v); err != nil || string(b) != "token" {
+		t.Fatalf("expected a counter nonce token to open, got %q, %v", b, err)
+	}
+}
+
+func BenchmarkSaveCounterNonces(b *testing.B) {
+	s := cookiesession.New("session", "secret", time.Hour)
+	s.CounterNonces = true
+	ss := benchSession()
+	h := http.Header{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := s.SaveToHeader(h, ss); err != nil {
+			b.Fatal(err)
+		}
+		delete(h, "Set-Cookie")
+	}
+}
@@ -0,0 +1,51 @@
+package cookiesession
+
+import (
+	"errors"
+)
+
+// errorReasons maps the errors a cookie can be rejected with to the short
+// reasons given to OnError.
+var errorReasons = []struct {
+	err    error
+	reason string
+}{
+	{ErrNameMismatch, "name_mismatch"},
+	{ErrBadEncoding, "bad_encoding"},
+	{ErrDecryptFailed, "decrypt_failed"},
+	{ErrBadSignature, "bad_signature"},
+	{ErrUnknownKeyID, "unknown_key_id"},
+	{ErrTooShort, "malformed"},
+	{ErrMalformed, "malformed"},
+	{ErrInvalidJWE, "malformed"},
+	{ErrBadMetadata, "malformed"},
+	{ErrUnknownCompression, "unknown_version"},
+	{ErrUnknownCipher, "unknown_version"},
+	{ErrMissingChunk, "malformed"},
+	{ErrChunkedTooLarge, "malformed"},
+	{ErrUnknownVersion, "unknown_version"},
+	{ErrExpired, "expired"},
+	{ErrFutureSession, "future_session"},
+	{ErrEpochMismatch, "epoch_mismatch"},
+	{ErrReplayed, "replayed"},
+	{ErrRevoked, "revoked"},
+	{ErrMissingCSRFToken, "csrf"},
+	{ErrBadCSRFToken, "csrf"},
+	{ErrAudienceMismatch, "audience_mismatch"},
+	{ErrNoClientCert, "cert_mismatch"},
+	{ErrCertMismatch, "cert_mismatch"},
+	{ErrNoClientAddr, "binding_mismatch"},
+	{ErrBindingMismatch, "binding_mismatch"},
+}
+
+// errorReason returns the OnError reason for err, or "invalid" for anything
+// that isn't one of the package's errors.
+func errorReason(err error) string {
+	for _, e := range errorReasons {
+		if errors.Is(err, e.err) {
+			return e.reason
+		}
+	}
+
+	return "invalid"
+}
@@ -0,0 +1,56 @@
+package cookiesession
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Option configures a Store as it's made by New. Each one just sets the
+// Store field of the same name, so they can be mixed freely with setting
+// fields directly.
+type Option func(s *Store)
+
+func WithPath(path string) Option {
+	return func(s *Store) { s.Path = path }
+}
+
+func WithDomain(domain string) Option {
+	return func(s *Store) { s.Domain = domain }
+}
+
+func WithSameSite(mode http.SameSite) Option {
+	return func(s *Store) { s.SameSite = mode }
+}
+
+func WithHttpOnly(httpOnly bool) Option {
+	return func(s *Store) { s.HttpOnly = httpOnly }
+}
+
+func WithSecure(secure bool) Option {
+	return func(s *Store) { s.Secure = secure }
+}
+
+// WithSessionCookie makes cookies last only as long as the browser session,
+// leaving off Max-Age and Expires.
+func WithSessionCookie() Option {
+	return func(s *Store) { s.SessionCookie = true }
+}
+
+// HostPrefix, if enabled, gives the cookie the __Host- name prefix and the
+// attributes it needs: Secure, Path "/" and no Domain. Browsers then only
+// accept the cookie from the exact host, over HTTPS.
+func HostPrefix(enabled bool) Option {
+	return func(s *Store) {
+		if !enabled {
+			return
+		}
+
+		if !strings.HasPrefix(s.Name, "__Host-") {
+			s.Name = "__Host-" + s.Name
+		}
+		s.Secure = true
+		s.OmitPath = false
+		s.Path = "/"
+		s.Domain = ""
+	}
+}
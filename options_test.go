@@ -0,0 +1,74 @@
+package cookiesession_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+// saved saves a session with s and returns the cookie it set.
+func saved(t *testing.T, s *cookiesession.Store) *http.Cookie {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	if err := s.Save(rec, cookiesession.NewSession().WithState([]byte("state"))); err != nil {
+		t.Fatal(err)
+	}
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected one cookie, got %d", len(cookies))
+	}
+
+	return cookies[0]
+}
+
+func TestOptions(t *testing.T) {
+	s := cookiesession.New("session", "secret", time.Hour,
+		cookiesession.WithPath("/app"),
+		cookiesession.WithDomain("example.com"),
+		cookiesession.WithSameSite(http.SameSiteStrictMode),
+		cookiesession.WithHttpOnly(false),
+		cookiesession.WithSecure(true),
+	)
+
+	if s.Path != "/app" || s.Domain != "example.com" || s.SameSite != http.SameSiteStrictMode || s.HttpOnly || !s.Secure {
+		t.Fatalf("expected each option to set its field, got %+v", s)
+	}
+
+	c := saved(t, s)
+	if c.Path != "/app" || c.Domain != "example.com" || c.SameSite != http.SameSiteStrictMode || c.HttpOnly || !c.Secure {
+		t.Fatalf("expected the cookie to carry the options, got %+v", c)
+	}
+}
+
+func TestOptionsDefaults(t *testing.T) {
+	s := cookiesession.New("session", "secret", time.Hour)
+
+	c := saved(t, s)
+	if c.Path != "/" || c.Domain != "" || c.SameSite != 0 || c.Secure || c.MaxAge != 3600 {
+		t.Fatalf("expected the default attributes, got %+v", c)
+	}
+}
+
+func TestWithSessionCookie(t *testing.T) {
+	s := cookiesession.New("session", "secret", time.Hour, cookiesession.WithSessionCookie())
+
+	if c := saved(t, s); c.MaxAge != 0 || !c.Expires.IsZero() {
+		t.Fatalf("expected a cookie without Max-Age or Expires, got %+v", c)
+	}
+}
+
+func TestOptionsApplyInOrder(t *testing.T) {
+	s := cookiesession.New("session", "secret", time.Hour,
+		cookiesession.WithSameSite(http.SameSiteLaxMode),
+		cookiesession.WithSameSite(http.SameSiteNoneMode),
+	)
+
+	if s.SameSite != http.SameSiteNoneMode {
+		t.Fatalf("expected the last option to win, got %v", s.SameSite)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build go1.23
+
+package cookiesession
+
+import (
+	"net/http"
+)
+
+func setPartitioned(c *http.Cookie, partitioned bool) {
+	c.Partitioned = partitioned
+}
+
+func isPartitioned(c *http.Cookie) bool {
+	return c.Partitioned
+}
+
+// cookieString serialises c for a Set-Cookie header.
+func cookieString(c *http.Cookie) string {
+	return c.String()
+}
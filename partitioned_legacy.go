@@ -0,0 +1,37 @@
+//go:build !go1.23
+
+package cookiesession
+
+import (
+	"net/http"
+)
+
+// Before Go 1.23, http.Cookie has no Partitioned field, so the attribute is
+// kept with the cookie's unparsed attributes and written by hand.
+const partitionedAttr = "Partitioned"
+
+func setPartitioned(c *http.Cookie, partitioned bool) {
+	if partitioned && !isPartitioned(c) {
+		c.Unparsed = append(c.Unparsed, partitionedAttr)
+	}
+}
+
+func isPartitioned(c *http.Cookie) bool {
+	for _, attr := range c.Unparsed {
+		if attr == partitionedAttr {
+			return true
+		}
+	}
+
+	return false
+}
+
+// cookieString serialises c for a Set-Cookie header.
+func cookieString(c *http.Cookie) string {
+	v := c.String()
+	if v != "" && isPartitioned(c) {
+		v += "; " + partitionedAttr
+	}
+
+	return v
+}
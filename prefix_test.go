@@ -0,0 +1,84 @@
+package cookiesession_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+func TestHostPrefix(t *testing.T) {
+	s := cookiesession.New("session", "secret", time.Hour,
+		cookiesession.WithPath("/app"),
+		cookiesession.WithDomain("example.com"),
+		cookiesession.HostPrefix(true),
+	)
+
+	if s.Name != "__Host-session" {
+		t.Fatalf("expected the name to get the __Host- prefix, got %q", s.Name)
+	}
+	if err := s.Validate(); err != nil {
+		t.Fatalf("expected the store to follow the prefix rules, got %v", err)
+	}
+
+	c := saved(t, s)
+	if c.Name != "__Host-session" || !c.Secure || c.Path != "/" || c.Domain != "" {
+		t.Fatalf("expected a Secure cookie at Path=/ with no Domain, got %+v", c)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+	r.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+	if got := s.Get(r); string(got.State) != "state" {
+		t.Fatalf("expected the prefixed cookie to load, got %q", got.State)
+	}
+}
+
+func TestHostPrefixKeepsName(t *testing.T) {
+	s := cookiesession.New("__Host-session", "secret", time.Hour, cookiesession.HostPrefix(true))
+	if s.Name != "__Host-session" {
+		t.Fatalf("expected an already prefixed name to be kept, got %q", s.Name)
+	}
+
+	s = cookiesession.New("session", "secret", time.Hour, func(s *cookiesession.Store) { s.OmitPath = true }, cookiesession.HostPrefix(true))
+	if c := saved(t, s); c.Path != "/" {
+		t.Fatalf("expected HostPrefix to put the path back, got %q", c.Path)
+	}
+}
+
+func TestHostPrefixDisabled(t *testing.T) {
+	s := cookiesession.New("session", "secret", time.Hour, cookiesession.WithDomain("example.com"), cookiesession.HostPrefix(false))
+
+	if c := saved(t, s); c.Name != "session" || c.Secure || c.Domain != "example.com" {
+		t.Fatalf("expected HostPrefix(false) to change nothing, got %+v", c)
+	}
+}
+
+func TestPrefixRules(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		secure bool
+		path   string
+		domain string
+		err    error
+	}{
+		{name: "session", path: "/app", domain: "example.com"},
+		{name: "__Host-session", secure: true, path: "/"},
+		{name: "__Host-session", path: "/", err: cookiesession.ErrPrefixRules},
+		{name: "__Host-session", secure: true, path: "/app", err: cookiesession.ErrPrefixRules},
+		{name: "__Host-session", secure: true, path: "/", domain: "example.com", err: cookiesession.ErrPrefixRules},
+		{name: "__Secure-session", secure: true, path: "/app", domain: "example.com"},
+		{name: "__Secure-session", path: "/", err: cookiesession.ErrPrefixRules},
+	} {
+		s := cookiesession.New(tc.name, "secret", time.Hour,
+			cookiesession.WithSecure(tc.secure),
+			cookiesession.WithPath(tc.path),
+			cookiesession.WithDomain(tc.domain),
+		)
+
+		if err := s.Validate(); err != tc.err {
+			t.Errorf("%s secure=%v path=%q domain=%q: expected %v, got %v", tc.name, tc.secure, tc.path, tc.domain, tc.err, err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Package redisbackend keeps cookiesession session state in Redis, for
+// servers that run as several processes. It's a separate package so that
+// stores which don't use it don't depend on a Redis client.
+package redisbackend
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/satori/go.uuid"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+// DefaultPrefix is what keys start with when Backend.Prefix is empty.
+const DefaultPrefix = "cookiesession:"
+
+// Backend is a cookiesession.Backend that keeps each session's state under
+// its own key. Set Store.Backend to one made with New.
+type Backend struct {
+	Client redis.UniversalClient
+
+	// Prefix is prepended to each SID to make its key, so that several
+	// stores can share a database. It defaults to DefaultPrefix.
+	Prefix string
+
+	// TTL, if positive, is how long Redis keeps state after it's last
+	// saved, so that abandoned sessions are evicted. It should be at least
+	// as long as the store's TTL, or sessions will lose their state before
+	// their cookies expire.
+	TTL time.Duration
+}
+
+// New returns a Backend that keeps state in client for ttl.
+func New(client redis.UniversalClient, ttl time.Duration) *Backend {
+	return &Backend{Client: client, TTL: ttl}
+}
+
+func (b *Backend) key(sid uuid.UUID) string {
+	prefix := b.Prefix
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+
+	return prefix + sid.String()
+}
+
+// Load returns cookiesession.ErrNotInBackend for sessions that have no state,
+// whether it was deleted or evicted.
+func (b *Backend) Load(ctx context.Context, sid uuid.UUID) ([]byte, error) {
+	state, err := b.Client.Get(ctx, b.key(sid)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, cookiesession.ErrNotInBackend
+	} else if err != nil {
+		return nil, errors.New("couldn't load state from redis: " + err.Error())
+	}
+
+	return state, nil
+}
+
+func (b *Backend) Store(ctx context.Context, sid uuid.UUID, state []byte) error {
+	ttl := b.TTL
+	if ttl < 0 {
+		ttl = 0
+	}
+
+	if err := b.Client.Set(ctx, b.key(sid), state, ttl).Err(); err != nil {
+		return errors.New("couldn't store state in redis: " + err.Error())
+	}
+
+	return nil
+}
+
+func (b *Backend) Delete(ctx context.Context, sid uuid.UUID) error {
+	if err := b.Client.Del(ctx, b.key(sid)).Err(); err != nil {
+		return errors.New("couldn't delete state from redis: " + err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package redisbackend_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/satori/go.uuid"
+
+	"fknsrs.biz/p/cookiesession"
+	"fknsrs.biz/p/cookiesession/cookiesessiontest"
+	"fknsrs.biz/p/cookiesession/redisbackend"
+)
+
+func newBackend(t *testing.T, ttl time.Duration) (*redisbackend.Backend, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return redisbackend.New(client, ttl), mr
+}
+
+func TestBackend(t *testing.T) {
+	b, mr := newBackend(t, time.Hour)
+	ctx := context.Background()
+	sid := uuid.UUID{1}
+
+	if _, err := b.Load(ctx, sid); err != cookiesession.ErrNotInBackend {
+		t.Fatalf("expected %v for a missing session, got %v", cookiesession.ErrNotInBackend, err)
+	}
+
+	if err := b.Store(ctx, sid, []byte("state")); err != nil {
+		t.Fatal(err)
+	}
+	if state, err := b.Load(ctx, sid); err != nil || string(state) != "state" {
+		t.Fatalf("expected the stored state, got %q and %v", state, err)
+	}
+
+	key := redisbackend.DefaultPrefix + sid.String()
+	if ttl := mr.TTL(key); ttl != time.Hour {
+		t.Errorf("expected %s to expire in an hour, got %s", key, ttl)
+	}
+
+	if err := b.Delete(ctx, sid); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Load(ctx, sid); err != cookiesession.ErrNotInBackend {
+		t.Fatalf("expected %v once deleted, got %v", cookiesession.ErrNotInBackend, err)
+	}
+}
+
+func TestBackendExpires(t *testing.T) {
+	b, mr := newBackend(t, time.Minute)
+	ctx := context.Background()
+
+	if err := b.Store(ctx, uuid.UUID{1}, []byte("state")); err != nil {
+		t.Fatal(err)
+	}
+
+	mr.FastForward(2 * time.Minute)
+
+	if _, err := b.Load(ctx, uuid.UUID{1}); err != cookiesession.ErrNotInBackend {
+		t.Fatalf("expected %v once evicted, got %v", cookiesession.ErrNotInBackend, err)
+	}
+}
+
+func TestBackendPrefix(t *testing.T) {
+	b, mr := newBackend(t, 0)
+	b.Prefix = "app:"
+
+	if err := b.Store(context.Background(), uuid.UUID{1}, []byte("state")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := mr.Get("app:" + uuid.UUID{1}.String()); err != nil || got != "state" {
+		t.Fatalf("expected the state under the prefix, got %q and %v", got, err)
+	}
+	if ttl := mr.TTL("app:" + uuid.UUID{1}.String()); ttl != 0 {
+		t.Errorf("expected no expiry without a TTL, got %s", ttl)
+	}
+}
+
+func TestBackendErrors(t *testing.T) {
+	b, mr := newBackend(t, time.Hour)
+	mr.Close()
+
+	if _, err := b.Load(context.Background(), uuid.UUID{1}); err == nil || errors.Is(err, cookiesession.ErrNotInBackend) {
+		t.Fatalf("expected a connection error, got %v", err)
+	}
+	if err := b.Store(context.Background(), uuid.UUID{1}, nil); err == nil {
+		t.Fatal("expected a connection error")
+	}
+}
+
+func TestStore(t *testing.T) {
+	b, _ := newBackend(t, time.Hour)
+
+	s := cookiesessiontest.NewStore("session", t.Name())
+	s.Backend = b
+
+	ss := cookiesession.NewSession().WithState([]byte("a large cart"))
+
+	rec := httptest.NewRecorder()
+	if err := s.Save(rec, ss); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range rec.Result().Cookies() {
+		r.AddCookie(c)
+	}
+
+	got, err := s.GetE(r)
+	if err != nil {
+		t.Fatal(err)
+	} else if string(got.State) != "a large cart" {
+		t.Fatalf("expected the state back from redis, got %q", got.State)
+	}
+
+	if err := b.Delete(context.Background(), ss.SID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetE(r); !errors.Is(err, cookiesession.ErrNotInBackend) {
+		t.Fatalf("expected %v once the state is deleted, got %v", cookiesession.ErrNotInBackend, err)
+	}
+}
@@ -0,0 +1,73 @@
+package cookiesession
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// RegenerateID gives the session a new SID, keeping everything else, and
+// marks it dirty. Call it on login and other privilege changes, so that a SID
+// planted before then is of no use afterwards. Sessions from a Store get
+// their new SID from its IDGenerator.
+func (s *Session) RegenerateID() {
+	s.mustBeWritable()
+
+	s.SID = s.store.newID()
+	s.Seq = 0
+	s.dirty = true
+}
+
+// RegenerateFlags adjusts what Regenerate carries over to the new SID.
+type RegenerateFlags uint
+
+const (
+	// KeepAuthSections keeps the sections named by Store.AuthSections.
+	KeepAuthSections RegenerateFlags = 1 << iota
+
+	// ClearFlashes drops pending flashes. They're kept by default, so that
+	// a message added at login survives the redirect that follows it.
+	ClearFlashes
+)
+
+// Regenerate gives ss a new SID with RegenerateID and saves it. The CSRF
+// token is derived from the SID, so it changes too, and a token handed out
+// before then is rejected afterwards. The sections named by AuthSections are
+// removed and flashes are kept, unless RegenerateFlags says otherwise. The
+// old SID's state is deleted from the Backend, if there is one, and the old
+// SID is revoked if the Revoker supports it, since its cookie would otherwise
+// still be accepted until it expires.
+func (s *Store) Regenerate(rw http.ResponseWriter, ss *Session) error {
+	old := ss.SID
+
+	if ss.store == nil {
+		ss.store = s
+	}
+	ss.RegenerateID()
+
+	if s.RegenerateFlags&KeepAuthSections == 0 {
+		for _, name := range s.AuthSections {
+			delete(ss.sections, name)
+		}
+	}
+
+	if s.RegenerateFlags&ClearFlashes != 0 {
+		ss.flashes = nil
+	}
+
+	if err := s.Save(rw, ss); err != nil {
+		return err
+	}
+
+	if s.Backend != nil {
+		if err := s.Backend.Delete(context.Background(), old); err != nil {
+			return errors.New("couldn't delete old session state: " + err.Error())
+		}
+	}
+
+	if err := s.Revoke(old); err != nil && err != ErrCantRevoke {
+		return err
+	}
+
+	return nil
+}
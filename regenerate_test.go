@@ -0,0 +1,107 @@
+package cookiesession_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+// regenerated saves a session carrying a flash, an auth section and a plain
+// one, regenerates it with flags, and returns it as saved before and after
+// along with its CSRF token from before.
+func regenerated(t *testing.T, flags cookiesession.RegenerateFlags) (before, after cookiesession.Session, beforeToken string) {
+	t.Helper()
+
+	s, _ := newStore(t)
+	s.AuthSections = []string{"step-up"}
+	s.RegenerateFlags = flags
+
+	ss := s.Get(httptest.NewRequest(http.MethodGet, "/", nil))
+	ss.AddFlash("info", "welcome back")
+	if err := ss.SetSection("step-up", []byte("proof"), testKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := ss.SetSection("prefs", []byte("dark"), testKey); err != nil {
+		t.Fatal(err)
+	}
+
+	before = s.Get(save(t, s, &ss))
+	beforeToken = before.CSRFToken()
+
+	ss = before
+	rec := httptest.NewRecorder()
+	if err := s.Regenerate(rec, &ss); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := s.GetE(request(rec))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return before, after, beforeToken
+}
+
+func TestRegenerate(t *testing.T) {
+	before, after, token := regenerated(t, 0)
+
+	if after.SID == before.SID {
+		t.Fatal("expected a new SID")
+	}
+	if after.CSRFToken() == token {
+		t.Error("expected the CSRF token to change with the SID")
+	}
+
+	if flashes := after.Flashes(); len(flashes) != 1 || flashes[0].Message != "welcome back" {
+		t.Errorf("expected the flash to survive, got %+v", flashes)
+	}
+
+	if _, err := after.GetSection("step-up", testKey); err != cookiesession.ErrNoSection {
+		t.Errorf("expected the auth section to be removed, got %v", err)
+	}
+	if data, err := after.GetSection("prefs", testKey); err != nil || string(data) != "dark" {
+		t.Errorf("expected other sections to be kept, got %q and %v", data, err)
+	}
+}
+
+func TestRegenerateFlags(t *testing.T) {
+	_, after, token := regenerated(t, cookiesession.KeepAuthSections|cookiesession.ClearFlashes)
+
+	if after.CSRFToken() == token {
+		t.Error("expected the CSRF token to change whatever the flags")
+	}
+	if flashes := after.Flashes(); len(flashes) != 0 {
+		t.Errorf("expected ClearFlashes to drop the flash, got %+v", flashes)
+	}
+	if data, err := after.GetSection("step-up", testKey); err != nil || string(data) != "proof" {
+		t.Errorf("expected KeepAuthSections to keep the auth section, got %q and %v", data, err)
+	}
+}
+
+func TestRegenerateRejectsOldCSRFToken(t *testing.T) {
+	s, _ := newStore(t)
+
+	ss := s.Get(httptest.NewRequest(http.MethodGet, "/", nil))
+	ss.SetBytes([]byte("state"))
+	ss = s.Get(save(t, s, &ss))
+	token := ss.CSRFToken()
+
+	rec := httptest.NewRecorder()
+	if err := s.Regenerate(rec, &ss); err != nil {
+		t.Fatal(err)
+	}
+
+	r := request(rec)
+	r.Method = http.MethodPost
+	r.Header.Set(cookiesession.DefaultCSRFHeader, token)
+	if err := s.VerifyCSRF(r); err != cookiesession.ErrBadCSRFToken {
+		t.Fatalf("expected %v for a token from before Regenerate, got %v", cookiesession.ErrBadCSRFToken, err)
+	}
+
+	r.Header.Set(cookiesession.DefaultCSRFHeader, ss.CSRFToken())
+	if err := s.VerifyCSRF(r); err != nil {
+		t.Fatalf("expected the new token to pass, got %v", err)
+	}
+}
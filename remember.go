@@ -0,0 +1,123 @@
+package cookiesession
+
+import (
+	"context"
+	"encoding/binary"
+	"net/http"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+// RememberMethod is the method recorded with RecordAuth in sessions that Get
+// restores from a remember-me cookie.
+const RememberMethod = "remember"
+
+// SaveRemember writes a remember-me cookie for ss's UID, lasting d. When a
+// later request has no session cookie, Get uses it to start a fresh session
+// for the same UID, with RememberMethod recorded as how it authenticated.
+// The cookie carries a counter that goes up each time it's saved, and that's
+// kept in ss so that saving ss keeps it across requests, so CheckRemember can
+// reject cookies that have been superseded. ss is marked dirty.
+func (s *Store) SaveRemember(rw http.ResponseWriter, ss *Session, d time.Duration) error {
+	if ss.UID == uuid.Nil {
+		return ErrSessionNotValid
+	}
+
+	counter := ss.rememberSeq + 1
+	expires := s.now().Add(d)
+
+	buf := make([]byte, 8+16+4)
+	binary.BigEndian.PutUint64(buf, uint64(expires.Unix()))
+	copy(buf[8:], ss.UID.Bytes())
+	binary.BigEndian.PutUint32(buf[24:], counter)
+
+	value, err := s.sealValue(purposeRemember, bindName(RememberMethod+":"+s.Name, buf))
+	if err != nil {
+		return err
+	}
+
+	c := s.deletion(s.path())
+	c.Name = s.rememberName()
+	c.Value = value
+	c.Expires = expires
+	c.MaxAge = maxAge(d)
+
+	setCookie(rw, c)
+
+	ss.rememberSeq = counter
+	ss.dirty = true
+
+	return nil
+}
+
+// ClearRemember deletes the remember-me cookie. Logging out should call it
+// as well as Clear.
+func (s *Store) ClearRemember(rw http.ResponseWriter) {
+	c := s.deletion(s.path())
+	c.Name = s.rememberName()
+
+	setCookie(rw, c)
+}
+
+func (s *Store) rememberName() string {
+	if s.RememberName != "" {
+		return s.RememberName
+	}
+
+	return s.Name + "_remember"
+}
+
+// remembered returns a fresh session restored from r's remember-me cookie,
+// if it has a usable one.
+func (s *Store) remembered(ctx context.Context, r *http.Request) (Session, bool) {
+	c, err := r.Cookie(s.rememberName())
+	if err != nil || c.Value == "" {
+		return Session{}, false
+	}
+
+	uid, counter, err := s.openRemember(ctx, c.Value)
+	if err != nil {
+		s.rejected(r, nil, err)
+		return Session{}, false
+	}
+
+	ss := s.created(r)
+	ss.SetUID(uid)
+	ss.RecordAuth(RememberMethod, s.now())
+	ss.rememberSeq = counter
+
+	return ss, true
+}
+
+func (s *Store) openRemember(ctx context.Context, value string) (uuid.UUID, uint32, error) {
+	buf, _, err := s.openValue(purposeRemember, nil, value)
+	if err != nil {
+		return uuid.Nil, 0, err
+	}
+
+	if buf, err = unbindName(RememberMethod+":"+s.Name, buf); err != nil {
+		return uuid.Nil, 0, err
+	} else if len(buf) < 8+16+4 {
+		return uuid.Nil, 0, ErrTooShort
+	}
+
+	if s.now().Unix() > int64(binary.BigEndian.Uint64(buf)) {
+		return uuid.Nil, 0, ErrExpired
+	}
+
+	uid, err := uuid.FromBytes(buf[8:24])
+	if err != nil {
+		return uuid.Nil, 0, ErrMalformed
+	}
+
+	counter := binary.BigEndian.Uint32(buf[24:])
+
+	if s.CheckRemember != nil {
+		if err := s.CheckRemember(ctx, uid, counter); err != nil {
+			return uuid.Nil, 0, err
+		}
+	}
+
+	return uid, counter, nil
+}
@@ -0,0 +1,140 @@
+package cookiesession_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/satori/go.uuid"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+// rememberCookie returns the remember-me cookie that rec was given.
+func rememberCookie(t *testing.T, s *cookiesession.Store, rec *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == s.Name+"_remember" {
+			return c
+		}
+	}
+
+	t.Fatal("expected a remember-me cookie")
+
+	return nil
+}
+
+// withRemember returns a request carrying only the remember-me cookie c.
+func withRemember(c *http.Cookie) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+
+	return r
+}
+
+func TestSaveRemember(t *testing.T) {
+	s, clock := newStore(t)
+
+	uid := uuid.UUID{1}
+	ss := cookiesession.NewSession().WithUID(uid)
+
+	rec := httptest.NewRecorder()
+	if err := s.SaveRemember(rec, ss, 30*24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	remember := rememberCookie(t, s, rec)
+
+	clock.Advance(7 * 24 * time.Hour)
+
+	r := withRemember(remember)
+
+	got, created := s.GetOrCreate(r)
+	if !created {
+		t.Error("expected a session restored from a remember-me cookie to be reported as created")
+	}
+	if got.UID != uid || got.SID == ss.SID || got.Valid {
+		t.Errorf("expected a fresh session for the remembered user, got %+v", got)
+	}
+	if !got.HasRecentAuth(cookiesession.RememberMethod, time.Minute, clock.Now()) {
+		t.Error("expected the restored session to record how it was authenticated")
+	}
+
+	if got, ok := s.TryGet(r); ok {
+		t.Error("expected TryGet to report a restored session as new")
+	} else if got.UID != uid {
+		t.Errorf("expected TryGet to still return the restored session, got %+v", got)
+	}
+
+	if err := s.SaveRemember(httptest.NewRecorder(), cookiesession.NewSession(), time.Hour); err != cookiesession.ErrSessionNotValid {
+		t.Errorf("expected %v for a session without a user, got %v", cookiesession.ErrSessionNotValid, err)
+	}
+
+	clock.Advance(30 * 24 * time.Hour)
+	if got := s.Get(withRemember(remember)); got.UID != uuid.Nil {
+		t.Errorf("expected an expired remember-me cookie to be ignored, got %s", got.UID)
+	}
+}
+
+func TestRememberCounter(t *testing.T) {
+	s, _ := newStore(t)
+
+	errSuperseded := errors.New("remember-me cookie was superseded")
+
+	// latest is the counter of the newest remember-me cookie, as a server
+	// would track it.
+	var latest, seen uint32
+	s.CheckRemember = func(ctx context.Context, uid uuid.UUID, counter uint32) error {
+		seen = counter
+		if counter < latest {
+			return errSuperseded
+		}
+		return nil
+	}
+
+	issue := func(ss *cookiesession.Session) *http.Cookie {
+		rec := httptest.NewRecorder()
+		if err := s.SaveRemember(rec, ss, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		latest++
+
+		return rememberCookie(t, s, rec)
+	}
+
+	ss := cookiesession.NewSession().WithUID(uuid.UUID{1})
+	first := issue(ss)
+
+	// The counter travels with the session cookie, so rotating the
+	// remember-me cookie on a later request moves it on.
+	got := s.Get(save(t, s, ss))
+	second := issue(&got)
+
+	if got := s.Get(withRemember(second)); got.UID != ss.UID || seen != 2 {
+		t.Errorf("expected the rotated cookie to restore the session with counter 2, got %s with %d", got.UID, seen)
+	}
+
+	var rejected error
+	s.OnDecodeError = func(r *http.Request, err error) { rejected = err }
+
+	if got := s.Get(withRemember(first)); got.UID != uuid.Nil || seen != 1 {
+		t.Errorf("expected the superseded cookie to be rejected, got %s with counter %d", got.UID, seen)
+	}
+	if rejected != errSuperseded {
+		t.Errorf("expected the rejection to be reported, got %v", rejected)
+	}
+
+	restored := s.Get(withRemember(second))
+	third := issue(&restored)
+	if !restored.Dirty() {
+		t.Error("expected SaveRemember to mark the session dirty so its counter is kept")
+	}
+
+	s.Get(withRemember(third))
+	if seen != 3 {
+		t.Errorf("expected a cookie rotated from a restored session to carry counter 3, got %d", seen)
+	}
+}
@@ -0,0 +1,82 @@
+package cookiesession
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+var (
+	ErrRevoked    = errors.New("session has been revoked")
+	ErrCantRevoke = errors.New("store's revoker doesn't support revoking sessions")
+)
+
+// Revoker reports whether sessions have been revoked, for Store.Revoker.
+type Revoker interface {
+	IsRevoked(sid uuid.UUID) bool
+}
+
+// Revoke revokes the session with the given SID, if the store's Revoker has
+// a Revoke method like Denylist's, so that it's rejected from then on even
+// though its cookie hasn't expired.
+func (s *Store) Revoke(sid uuid.UUID) error {
+	r, ok := s.Revoker.(interface{ Revoke(sid uuid.UUID) })
+	if !ok {
+		return ErrCantRevoke
+	}
+
+	r.Revoke(sid)
+
+	return nil
+}
+
+// Denylist is an in-memory Revoker that remembers each revoked SID for ttl,
+// which should be at least as long as sessions can last, after which the
+// session has expired anyway.
+type Denylist struct {
+	// Now, if set, replaces time.Now for expiring revocations, and should
+	// match the Now of the stores using the denylist.
+	Now func() time.Time
+
+	ttl time.Duration
+
+	mu      sync.RWMutex
+	revoked map[uuid.UUID]time.Time
+}
+
+func NewDenylist(ttl time.Duration) *Denylist {
+	return &Denylist{ttl: ttl, revoked: make(map[uuid.UUID]time.Time)}
+}
+
+func (d *Denylist) Revoke(sid uuid.UUID) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	for id, until := range d.revoked {
+		if now.After(until) {
+			delete(d.revoked, id)
+		}
+	}
+
+	d.revoked[sid] = now.Add(d.ttl)
+}
+
+func (d *Denylist) IsRevoked(sid uuid.UUID) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	until, ok := d.revoked[sid]
+
+	return ok && d.now().Before(until)
+}
+
+func (d *Denylist) now() time.Time {
+	if d.Now != nil {
+		return d.Now()
+	}
+
+	return time.Now()
+}
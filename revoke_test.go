@@ -0,0 +1,133 @@
+package cookiesession_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/satori/go.uuid"
+
+	"fknsrs.biz/p/cookiesession"
+	"fknsrs.biz/p/cookiesession/cookiesessiontest"
+)
+
+func TestDenylistNow(t *testing.T) {
+	clock := cookiesessiontest.NewClock(epoch)
+
+	d := cookiesession.NewDenylist(time.Hour)
+	d.Now = clock.Now
+
+	sid := uuid.UUID{1}
+	d.Revoke(sid)
+
+	clock.Advance(59 * time.Minute)
+	if !d.IsRevoked(sid) {
+		t.Fatal("expected the SID to stay revoked until the denylist's clock passes its ttl")
+	}
+
+	clock.Advance(2 * time.Minute)
+	if d.IsRevoked(sid) {
+		t.Fatal("expected the revocation to lapse by the denylist's clock")
+	}
+}
+
+// revokerFunc is a Revoker that can't revoke anything itself.
+type revokerFunc func(sid uuid.UUID) bool
+
+func (f revokerFunc) IsRevoked(sid uuid.UUID) bool { return f(sid) }
+
+func TestRevoke(t *testing.T) {
+	s, _ := newStore(t)
+	s.Revoker = cookiesession.NewDenylist(time.Hour)
+
+	a, b := cookiesession.NewSession(), cookiesession.NewSession()
+	a.SetBytes([]byte("a"))
+	b.SetBytes([]byte("b"))
+
+	ra, rb := save(t, s, a), save(t, s, b)
+
+	if _, err := s.GetE(ra); err != nil {
+		t.Fatalf("expected the session to load before it's revoked, got %v", err)
+	}
+
+	if err := s.Revoke(a.SID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.GetE(ra); err != cookiesession.ErrRevoked {
+		t.Fatalf("expected a revoked session to be rejected, got %v", err)
+	}
+	if got := s.Get(ra); got.SID == a.SID || got.State != nil {
+		t.Fatal("expected Get to hand out a new session in place of a revoked one")
+	}
+
+	if got, err := s.GetE(rb); err != nil || string(got.State) != "b" {
+		t.Fatalf("expected other sessions to be unaffected, got %v", err)
+	}
+}
+
+func TestRevokeUnsupported(t *testing.T) {
+	s, _ := newStore(t)
+
+	if err := s.Revoke(uuid.UUID{1}); err != cookiesession.ErrCantRevoke {
+		t.Fatalf("expected ErrCantRevoke without a Revoker, got %v", err)
+	}
+
+	s.Revoker = revokerFunc(func(uuid.UUID) bool { return false })
+	if err := s.Revoke(uuid.UUID{1}); err != cookiesession.ErrCantRevoke {
+		t.Fatalf("expected ErrCantRevoke from a Revoker without Revoke, got %v", err)
+	}
+}
+
+func TestRevokerConsulted(t *testing.T) {
+	s, _ := newStore(t)
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("state"))
+	r := save(t, s, ss)
+
+	var asked uuid.UUID
+	s.Revoker = revokerFunc(func(sid uuid.UUID) bool {
+		asked = sid
+		return true
+	})
+
+	if _, err := s.GetE(r); err != cookiesession.ErrRevoked {
+		t.Fatalf("expected the Revoker's answer to be honoured, got %v", err)
+	}
+	if asked != ss.SID {
+		t.Fatalf("expected the Revoker to be asked about %s, got %s", ss.SID, asked)
+	}
+
+	if _, err := s.GetE(httptest.NewRequest(http.MethodGet, "/", nil)); err != nil {
+		t.Fatalf("expected a request without a cookie not to be rejected, got %v", err)
+	}
+}
+
+func TestDenylistSweeps(t *testing.T) {
+	clock := cookiesessiontest.NewClock(epoch)
+
+	d := cookiesession.NewDenylist(time.Hour)
+	d.Now = clock.Now
+
+	d.Revoke(uuid.UUID{1})
+	d.Revoke(uuid.UUID{2})
+
+	clock.Advance(30 * time.Minute)
+	d.Revoke(uuid.UUID{3})
+
+	if d.Len() != 3 {
+		t.Fatalf("expected live revocations to be kept, got %d", d.Len())
+	}
+
+	clock.Advance(31 * time.Minute)
+	d.Revoke(uuid.UUID{4})
+
+	if d.Len() != 2 {
+		t.Fatalf("expected Revoke to sweep lapsed revocations, got %d", d.Len())
+	}
+	if !d.IsRevoked(uuid.UUID{3}) || !d.IsRevoked(uuid.UUID{4}) || d.IsRevoked(uuid.UUID{1}) {
+		t.Fatal("expected only the lapsed revocations to be swept")
+	}
+}
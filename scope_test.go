@@ -0,0 +1,99 @@
+package cookiesession_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+func TestScope(t *testing.T) {
+	s, clock := newStore(t)
+	s.Domain = "example.com"
+	s.RememberName = "remember"
+
+	prefs := s.Scope("prefs", 24*time.Hour)
+
+	if prefs.Name != "prefs" || prefs.TTL != 24*time.Hour || prefs.Key != s.Key || prefs.Domain != "example.com" {
+		t.Fatalf("expected the scope to share the key and settings under its own name and TTL, got %+v", prefs)
+	}
+	if prefs.RememberName != "" {
+		t.Fatalf("expected the scope not to share the remember-me cookie, got %q", prefs.RememberName)
+	}
+	if s.Name != "session" || s.TTL != time.Hour {
+		t.Fatal("expected the original store to be unchanged")
+	}
+
+	ss := cookiesession.NewSession().WithState([]byte("dark mode"))
+
+	rec := httptest.NewRecorder()
+	if err := prefs.Save(rec, ss); err != nil {
+		t.Fatal(err)
+	}
+
+	c := rec.Result().Cookies()[0]
+	if c.Name != "prefs" || c.MaxAge != 86400 || c.Domain != "example.com" {
+		t.Fatalf("expected a cookie under the scope's name and TTL, got %+v", c)
+	}
+
+	clock.Advance(2 * time.Hour)
+	if got := prefs.Get(request(rec)); string(got.State) != "dark mode" {
+		t.Fatalf("expected the scope's own TTL to apply, got %q", got.State)
+	}
+}
+
+func TestScopeSeparate(t *testing.T) {
+	s, _ := newStore(t)
+
+	prefs := s.Scope("prefs", time.Hour)
+	bucket := s.Scope("bucket", time.Hour)
+
+	original := value(t, s, cookiesession.NewSession().WithState([]byte("login")))
+	scoped := value(t, prefs, cookiesession.NewSession().WithState([]byte("prefs")))
+
+	for _, tc := range []struct {
+		name  string
+		store *cookiesession.Store
+		value string
+	}{
+		{"scope reading the original", prefs, original},
+		{"original reading the scope", s, scoped},
+		{"other scope reading the scope", bucket, scoped},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.AddCookie(&http.Cookie{Name: tc.store.Name, Value: tc.value})
+
+		if _, err := tc.store.GetE(r); err == nil {
+			t.Errorf("%s: expected the value to be rejected", tc.name)
+		}
+	}
+
+	if got, err := prefs.Decode(scoped); err != nil || string(got.State) != "prefs" {
+		t.Fatalf("expected the scope to read its own value, got %v", err)
+	}
+	if got, err := s.Scope("prefs", 2*time.Hour).Decode(scoped); err != nil || string(got.State) != "prefs" {
+		t.Fatalf("expected a scope of the same name to read the value, got %v", err)
+	}
+}
+
+func TestScopeOwnsConfig(t *testing.T) {
+	s, _ := newStore(t)
+
+	prefs := s.Scope("prefs", time.Hour)
+	v := value(t, prefs, cookiesession.NewSession().WithState([]byte("prefs")))
+
+	s.Rotate("new secret")
+	if _, err := prefs.Decode(v); err != nil {
+		t.Fatalf("expected rotating the original not to change the scope, got %v", err)
+	}
+
+	prefs.Rotate("new secret")
+	if _, err := prefs.Decode(v); err != nil {
+		t.Fatalf("expected the scope to keep its old key after rotating, got %v", err)
+	}
+	if prefs.Key != s.Key {
+		t.Fatal("expected the same secret to give the same key")
+	}
+}
@@ -0,0 +1,79 @@
+package cookiesession
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"sort"
+
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+var (
+	ErrNoSection = errors.New("session has no section with that name")
+)
+
+// SetSection stores data as a named section of the session, sealed under key
+// rather than the Store's key. Sections are carried alongside State inside
+// the session cookie, so the Store's key still protects the whole value, but
+// reading a section also requires its own key. This lets different trust
+// domains share a session without being able to read each other's data.
+func (s *Session) SetSection(name string, data []byte, key [32]byte) error {
+	if s.readOnly {
+		return ErrReadOnly
+	}
+
+	var nonce [24]byte
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return errors.New("couldn't get random nonce: " + err.Error())
+	}
+
+	if s.sections == nil {
+		s.sections = make(map[string][]byte)
+	}
+
+	s.sections[name] = secretbox.Seal(nonce[:], bindName(name, data), &nonce, &key)
+	s.dirty = true
+
+	return nil
+}
+
+// GetSection opens the named section with key.
+func (s *Session) GetSection(name string, key [32]byte) ([]byte, error) {
+	sealed, ok := s.sections[name]
+	if !ok {
+		return nil, ErrNoSection
+	}
+
+	if len(sealed) < 24+secretbox.Overhead {
+		return nil, ErrTooShort
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], sealed[:24])
+
+	buf, ok := secretbox.Open(nil, sealed[24:], &nonce, &key)
+	if !ok {
+		return nil, ErrDecryptFailed
+	}
+
+	return unbindName(name, buf)
+}
+
+func (s *Session) RemoveSection(name string) {
+	s.mustBeWritable()
+
+	delete(s.sections, name)
+	s.dirty = true
+}
+
+func (s *Session) sectionNames() []string {
+	names := make([]string, 0, len(s.sections))
+	for name := range s.sections {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,45 @@
+package cookiesession_test
+
+import (
+	"testing"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+func TestSections(t *testing.T) {
+	s, _ := newStore(t)
+
+	alpha, beta := [32]byte{1}, [32]byte{2}
+
+	ss := cookiesession.NewSession()
+	if err := ss.SetSection("alpha", []byte("alpha data"), alpha); err != nil {
+		t.Fatal(err)
+	}
+	if err := ss.SetSection("beta", []byte("beta data"), beta); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.GetE(save(t, s, ss))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err := got.GetSection("alpha", alpha); err != nil || string(b) != "alpha data" {
+		t.Errorf("expected alpha's data with its key, got %q, %v", b, err)
+	}
+	if b, err := got.GetSection("beta", beta); err != nil || string(b) != "beta data" {
+		t.Errorf("expected beta's data with its key, got %q, %v", b, err)
+	}
+
+	if _, err := got.GetSection("alpha", beta); err != cookiesession.ErrDecryptFailed {
+		t.Errorf("expected %v opening alpha with beta's key, got %v", cookiesession.ErrDecryptFailed, err)
+	}
+	if _, err := got.GetSection("gamma", alpha); err != cookiesession.ErrNoSection {
+		t.Errorf("expected %v for a missing section, got %v", cookiesession.ErrNoSection, err)
+	}
+
+	got.RemoveSection("alpha")
+	if _, err := got.GetSection("alpha", alpha); err != cookiesession.ErrNoSection {
+		t.Errorf("expected %v for a removed section, got %v", cookiesession.ErrNoSection, err)
+	}
+}
@@ -0,0 +1,70 @@
+package cookiesession
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+var (
+	ErrStatePayload = errors.New("session state couldn't be decoded")
+)
+
+// StatePayloadError is returned when a session decrypts successfully but its
+// State can't be decoded into the requested type, which usually means the
+// state was written in a different format. It matches ErrStatePayload.
+type StatePayloadError struct {
+	Len int
+	Err error
+}
+
+func (e *StatePayloadError) Error() string {
+	return "session state (" + strconv.Itoa(e.Len) + " bytes) couldn't be decoded: " + e.Err.Error()
+}
+
+func (e *StatePayloadError) Unwrap() error {
+	return e.Err
+}
+
+func (e *StatePayloadError) Is(target error) bool {
+	return target == ErrStatePayload
+}
+
+// StateCodec transforms State on its way into and out of the cookie, so that
+// it can be encrypted or serialized by the application's own scheme while
+// the rest of the session is handled as usual.
+type StateCodec interface {
+	Encode(state []byte) ([]byte, error)
+	Decode(state []byte) ([]byte, error)
+}
+
+// EncodeState stores v in State as JSON and marks the session dirty.
+func (s *Session) EncodeState(v interface{}) error {
+	if s.readOnly {
+		return ErrReadOnly
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return errors.New("couldn't encode state: " + err.Error())
+	}
+
+	s.State = b
+	s.dirty = true
+
+	return nil
+}
+
+// DecodeState decodes State as JSON into v. Empty State leaves v untouched.
+// Malformed State gives a *StatePayloadError.
+func (s *Session) DecodeState(v interface{}) error {
+	if len(s.State) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(s.State, v); err != nil {
+		return &StatePayloadError{Len: len(s.State), Err: err}
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package cookiesession_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+type identityCodec struct{}
+
+func (identityCodec) Encode(state []byte) ([]byte, error) { return state, nil }
+func (identityCodec) Decode(state []byte) ([]byte, error) { return state, nil }
+
+// xorCodec is a stand-in for a real field-level encryption scheme.
+type xorCodec byte
+
+func (c xorCodec) Encode(state []byte) ([]byte, error) { return c.xor(state), nil }
+func (c xorCodec) Decode(state []byte) ([]byte, error) { return c.xor(state), nil }
+
+func (c xorCodec) xor(state []byte) []byte {
+	out := make([]byte, len(state))
+	for i, b := range state {
+		out[i] = b ^ byte(c)
+	}
+
+	return out
+}
+
+type failingCodec struct{ identityCodec }
+
+func (failingCodec) Decode(state []byte) ([]byte, error) { return nil, errors.New("no") }
+
+func TestStateCodec(t *testing.T) {
+	for name, codec := range map[string]cookiesession.StateCodec{
+		"identity": identityCodec{},
+		"xor":      xorCodec(0x5a),
+	} {
+		s, _ := newStore(t)
+		s.StateCodec = codec
+
+		ss := cookiesession.NewSession().WithState([]byte("state"))
+
+		got, err := s.GetE(save(t, s, ss))
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+		} else if got.SID != ss.SID || string(got.Bytes()) != "state" {
+			t.Errorf("%s: expected the state to round-trip, got %q", name, got.Bytes())
+		}
+	}
+}
+
+func TestStateCodecApplied(t *testing.T) {
+	s, _ := newStore(t)
+	s.StateCodec = xorCodec(0x5a)
+
+	v := value(t, s, cookiesession.NewSession().WithState([]byte("state")))
+
+	plain, _ := newStore(t)
+
+	got, err := plain.Decode(v)
+	if err != nil {
+		t.Fatal(err)
+	} else if want := xorCodec(0x5a).xor([]byte("state")); !bytes.Equal(got.State, want) {
+		t.Errorf("expected the sealed state to have been encoded, got %q", got.State)
+	}
+
+	s.StateCodec = failingCodec{}
+	if _, err := s.Decode(v); err == nil {
+		t.Error("expected an error from the codec to be returned")
+	}
+}
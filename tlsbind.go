@@ -0,0 +1,68 @@
+package cookiesession
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+)
+
+var (
+	ErrNoClientCert = errors.New("request has no tls client certificate")
+	ErrCertMismatch = errors.New("session is bound to a different tls client certificate")
+
+	ErrInsecureTransport = errors.New("session cookie was presented over an insecure connection")
+)
+
+// checkTransport rejects requests that didn't come over TLS, as decided by
+// IsSecure if it's set.
+func (s *Store) checkTransport(r *http.Request) error {
+	secure := r.TLS != nil
+	if s.IsSecure != nil {
+		secure = s.IsSecure(r)
+	}
+
+	if !secure {
+		return ErrInsecureTransport
+	}
+
+	return nil
+}
+
+func clientCertHash(r *http.Request) ([]byte, bool) {
+	if r == nil || r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil, false
+	}
+
+	h := sha256.Sum256(r.TLS.PeerCertificates[0].Raw)
+
+	return h[:], true
+}
+
+// bindTLS records the fingerprint of the request's client certificate in ss.
+// Without a request, a session that's already bound keeps its binding.
+func (s *Store) bindTLS(r *http.Request, ss *Session) error {
+	if h, ok := clientCertHash(r); ok {
+		ss.certHash = h
+		return nil
+	}
+
+	if r == nil && len(ss.certHash) != 0 {
+		return nil
+	}
+
+	return ErrNoClientCert
+}
+
+func (s *Store) checkTLS(r *http.Request, ss *Session) error {
+	h, ok := clientCertHash(r)
+	if !ok {
+		return ErrNoClientCert
+	}
+
+	if subtle.ConstantTimeCompare(h, ss.certHash) != 1 {
+		return ErrCertMismatch
+	}
+
+	return nil
+}
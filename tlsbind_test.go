@@ -0,0 +1,96 @@
+package cookiesession_test
+
+import (
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+// withCert returns a TLS request presenting a client certificate made of raw.
+func withCert(raw string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+	if raw != "" {
+		r.TLS.PeerCertificates = []*x509.Certificate{{Raw: []byte(raw)}}
+	}
+
+	return r
+}
+
+func TestBindTLS(t *testing.T) {
+	s, _ := newStore(t)
+	s.BindTLS = true
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("state"))
+
+	rec := httptest.NewRecorder()
+	if err := s.SaveFor(rec, withCert("alice"), ss); err != nil {
+		t.Fatal(err)
+	}
+
+	c := rec.Result().Cookies()[0]
+
+	for name, tc := range map[string]struct {
+		r   *http.Request
+		err error
+	}{
+		"matching":  {r: withCert("alice"), err: nil},
+		"different": {r: withCert("mallory"), err: cookiesession.ErrCertMismatch},
+		"no cert":   {r: withCert(""), err: cookiesession.ErrNoClientCert},
+		"no tls":    {r: httptest.NewRequest(http.MethodGet, "/", nil), err: cookiesession.ErrNoClientCert},
+	} {
+		tc.r.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+
+		if _, err := s.GetE(tc.r); err != tc.err {
+			t.Errorf("%s: expected %v, got %v", name, tc.err, err)
+		}
+	}
+}
+
+func TestBindTLSRequiresCert(t *testing.T) {
+	s, _ := newStore(t)
+	s.BindTLS = true
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("state"))
+
+	if err := s.SaveFor(httptest.NewRecorder(), withCert(""), ss); err != cookiesession.ErrNoClientCert {
+		t.Fatalf("expected %v saving without a client certificate, got %v", cookiesession.ErrNoClientCert, err)
+	}
+}
+
+func TestRequireSecure(t *testing.T) {
+	s, _ := newStore(t)
+	s.RequireSecure = true
+
+	v := value(t, s, cookiesession.NewSession().WithState([]byte("state")))
+
+	get := func(r *http.Request) error {
+		r.AddCookie(&http.Cookie{Name: s.Name, Value: v})
+		_, err := s.GetE(r)
+		return err
+	}
+
+	if err := get(httptest.NewRequest(http.MethodGet, "https://example.com/", nil)); err != nil {
+		t.Errorf("expected a session over TLS to be accepted, got %v", err)
+	}
+	if err := get(httptest.NewRequest(http.MethodGet, "http://example.com/", nil)); err != cookiesession.ErrInsecureTransport {
+		t.Errorf("expected %v without TLS, got %v", cookiesession.ErrInsecureTransport, err)
+	}
+
+	s.IsSecure = func(r *http.Request) bool {
+		return r.Header.Get("X-Forwarded-Proto") == "https"
+	}
+
+	proxied := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	proxied.Header.Set("X-Forwarded-Proto", "https")
+	if err := get(proxied); err != nil {
+		t.Errorf("expected IsSecure to accept a request forwarded from https, got %v", err)
+	}
+	if err := get(httptest.NewRequest(http.MethodGet, "http://example.com/", nil)); err != cookiesession.ErrInsecureTransport {
+		t.Errorf("expected %v when IsSecure says no, got %v", cookiesession.ErrInsecureTransport, err)
+	}
+}
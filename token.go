@@ -0,0 +1,81 @@
+package cookiesession
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+var (
+	ErrContextMismatch = errors.New("token was sealed for a different context")
+)
+
+// Seal encrypts plaintext with a key derived from the Store's key and encodes
+// it the same way as a cookie value, for general purpose tokens like password
+// reset links. The key is only used for tokens, so a token is never accepted
+// as a session cookie, nor a cookie as a token. The token never expires on
+// its own; checking its age is up to the caller.
+func (s *Store) Seal(plaintext []byte) (string, error) {
+	return s.sealValue(purposeToken, plaintext)
+}
+
+// Open decrypts a token produced by Seal, trying OldKeys as well as Key.
+func (s *Store) Open(token string) ([]byte, error) {
+	buf, _, err := s.openValue(purposeToken, nil, token)
+
+	return buf, err
+}
+
+// SealWithExpiry is like Seal, but the token is only valid for d, which
+// OpenWithExpiry enforces.
+func (s *Store) SealWithExpiry(plaintext []byte, d time.Duration) (string, error) {
+	buf := make([]byte, 8, 8+len(plaintext))
+	binary.BigEndian.PutUint64(buf, uint64(s.now().Add(d).Unix()))
+	buf = append(buf, plaintext...)
+
+	return s.sealValue(purposeToken, buf)
+}
+
+// OpenWithExpiry opens a token produced by SealWithExpiry, returning
+// ErrExpired if it's no longer valid.
+func (s *Store) OpenWithExpiry(token string) ([]byte, error) {
+	buf, err := s.Open(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(buf) < 8 {
+		return nil, ErrTooShort
+	}
+
+	if s.now().Unix() > int64(binary.BigEndian.Uint64(buf)) {
+		return nil, ErrExpired
+	}
+
+	return buf[8:], nil
+}
+
+// SealWithContext is like Seal, but binds the token to aad, such as the path
+// it's meant to be used on. The aad isn't stored in the token; OpenWithContext
+// must be given the same aad or it rejects the token.
+func (s *Store) SealWithContext(plaintext, aad []byte) (string, error) {
+	return s.sealValue(purposeToken, bindName(string(aad), plaintext))
+}
+
+// OpenWithContext opens a token produced by SealWithContext, returning
+// ErrContextMismatch if it was sealed with different aad.
+func (s *Store) OpenWithContext(token string, aad []byte) ([]byte, error) {
+	buf, err := s.Open(token)
+	if err != nil {
+		return nil, err
+	}
+
+	buf, err = unbindName(string(aad), buf)
+	if err == ErrNameMismatch {
+		return nil, ErrContextMismatch
+	} else if err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
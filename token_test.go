@@ -0,0 +1,122 @@
+package cookiesession_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/satori/go.uuid"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+func TestSealOpen(t *testing.T) {
+	s, _ := newStore(t)
+
+	token, err := s.Seal([]byte("reset:alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err := s.Open(token); err != nil || string(b) != "reset:alice" {
+		t.Fatalf("expected the plaintext back, got %q, %v", b, err)
+	}
+
+	if _, err := s.Open(tamper(t, token)); err == nil {
+		t.Error("expected a tampered token to be rejected")
+	}
+
+	o, _ := newStore(t)
+	o.Key = [32]byte{1}
+	if _, err := o.Open(token); err == nil {
+		t.Error("expected a token to be rejected under a different key")
+	}
+
+	o.OldKeys = [][32]byte{s.Key}
+	if b, err := o.Open(token); err != nil || string(b) != "reset:alice" {
+		t.Errorf("expected a token sealed under an old key to open, got %q, %v", b, err)
+	}
+}
+
+func TestSealOpenSeparateFromCookies(t *testing.T) {
+	s, _ := newStore(t)
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("state"))
+
+	if _, err := s.Open(value(t, s, ss)); err == nil {
+		t.Error("expected Open to reject a session cookie")
+	}
+
+	// A token holding a well formed session encoding still isn't a cookie.
+	token, err := s.Seal(legacy(epoch, ss.SID, uuid.Nil, "state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: s.Name, Value: token})
+
+	if _, err := s.GetE(r); err == nil {
+		t.Error("expected Get to reject a sealed token")
+	}
+}
+
+func TestSealWithExpiry(t *testing.T) {
+	s, clock := newStore(t)
+
+	token, err := s.SealWithExpiry([]byte("magic:alice"), 15*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(14 * time.Minute)
+	if b, err := s.OpenWithExpiry(token); err != nil || string(b) != "magic:alice" {
+		t.Fatalf("expected a fresh token to open, got %q, %v", b, err)
+	}
+
+	if _, err := s.OpenWithExpiry(tamper(t, token)); err == nil {
+		t.Error("expected a tampered token to be rejected")
+	}
+
+	clock.Advance(2 * time.Minute)
+	if _, err := s.OpenWithExpiry(token); err != cookiesession.ErrExpired {
+		t.Fatalf("expected %v for an expired token, got %v", cookiesession.ErrExpired, err)
+	}
+
+	short, err := s.Seal([]byte("abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.OpenWithExpiry(short); err != cookiesession.ErrTooShort {
+		t.Errorf("expected %v for a token without an expiry, got %v", cookiesession.ErrTooShort, err)
+	}
+}
+
+func TestSealWithContext(t *testing.T) {
+	s, _ := newStore(t)
+
+	token, err := s.SealWithContext([]byte("download"), []byte("/files/report.pdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b, err := s.OpenWithContext(token, []byte("/files/report.pdf")); err != nil || string(b) != "download" {
+		t.Fatalf("expected the token to open with matching context, got %q, %v", b, err)
+	}
+
+	for name, aad := range map[string]string{
+		"other path": "/files/secrets.pdf",
+		"prefix":     "/files/report",
+		"empty":      "",
+	} {
+		if _, err := s.OpenWithContext(token, []byte(aad)); err != cookiesession.ErrContextMismatch {
+			t.Errorf("%s: expected %v, got %v", name, cookiesession.ErrContextMismatch, err)
+		}
+	}
+
+	if _, err := s.OpenWithContext(tamper(t, token), []byte("/files/report.pdf")); err == nil {
+		t.Error("expected a tampered token to be rejected")
+	}
+}
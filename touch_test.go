@@ -0,0 +1,81 @@
+package cookiesession_test
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+func TestTouch(t *testing.T) {
+	s, clock := newStore(t)
+
+	ss := s.Get(save(t, s, cookiesession.NewSession().WithState([]byte("state"))))
+
+	clock.Advance(29 * time.Minute)
+	if touched, err := s.Touch(httptest.NewRecorder(), &ss); err != nil || touched {
+		t.Fatalf("expected a session under half its lifetime to be left alone, got %v, %v", touched, err)
+	}
+
+	clock.Advance(2 * time.Minute)
+	rec := httptest.NewRecorder()
+	if touched, err := s.Touch(rec, &ss); err != nil || !touched {
+		t.Fatalf("expected a session past half its lifetime to be reissued, got %v, %v", touched, err)
+	}
+	if !ss.Time.Equal(epoch.Add(31 * time.Minute)) {
+		t.Errorf("expected the reissued session to be restamped, got %s", ss.Time)
+	}
+
+	// Reissuing extends the session past its original expiry.
+	clock.Advance(45 * time.Minute)
+	if _, err := s.GetE(request(rec)); err != nil {
+		t.Fatalf("expected the reissued cookie to outlast the original, got %v", err)
+	}
+}
+
+func TestTouchIgnoresDirty(t *testing.T) {
+	s, _ := newStore(t)
+
+	ss := s.Get(save(t, s, cookiesession.NewSession().WithState([]byte("state"))))
+	ss.WithState([]byte("changed"))
+
+	if touched, err := s.Touch(httptest.NewRecorder(), &ss); err != nil || touched {
+		t.Fatalf("expected Touch not to save a dirty session that isn't due, got %v, %v", touched, err)
+	}
+}
+
+func TestTouchRenewEvery(t *testing.T) {
+	s, clock := newStore(t)
+	s.RenewEvery = 5 * time.Minute
+
+	ss := s.Get(save(t, s, cookiesession.NewSession().WithState([]byte("state"))))
+
+	clock.Advance(4 * time.Minute)
+	if touched, _ := s.Touch(httptest.NewRecorder(), &ss); touched {
+		t.Fatal("expected a session younger than RenewEvery to be left alone")
+	}
+
+	clock.Advance(time.Minute)
+	if touched, err := s.Touch(httptest.NewRecorder(), &ss); err != nil || !touched {
+		t.Fatalf("expected a session as old as RenewEvery to be reissued, got %v, %v", touched, err)
+	}
+}
+
+func TestTouchFixedExpiry(t *testing.T) {
+	s, clock := newStore(t)
+
+	fresh := cookiesession.NewSession().WithState([]byte("state"))
+	fresh.ExpiresAt = epoch.Add(time.Hour)
+	ss := s.Get(save(t, s, fresh))
+
+	clock.Advance(50 * time.Minute)
+	if touched, _ := s.Touch(httptest.NewRecorder(), &ss); touched {
+		t.Fatal("expected a session with a fixed expiry never to be reissued")
+	}
+
+	unsaved := cookiesession.NewSession().WithState([]byte("state"))
+	if touched, _ := s.Touch(httptest.NewRecorder(), unsaved); touched {
+		t.Fatal("expected a session that was never saved not to be reissued")
+	}
+}
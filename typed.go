@@ -0,0 +1,73 @@
+package cookiesession
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// TypedStore wraps a Store so that each session's State holds a T, encoded
+// with the store's Codec, instead of raw bytes.
+type TypedStore[T any] struct {
+	*Store
+}
+
+// TypedSession is a session whose State has been decoded into Data.
+type TypedSession[T any] struct {
+	Session
+	Data T
+}
+
+// NewTyped is like New, but returns a TypedStore for sessions holding a T.
+func NewTyped[T any](name, secret string, ttl time.Duration, opts ...Option) *TypedStore[T] {
+	return &TypedStore[T]{Store: New(name, secret, ttl, opts...)}
+}
+
+// Get is like Store.Get, decoding the session's State into Data. A session
+// whose State can't be decoded as a T is treated like any other unusable
+// session, and a fresh one is returned in its place; use GetE to tell that
+// apart from there being no session.
+func (s *TypedStore[T]) Get(r *http.Request) TypedSession[T] {
+	ts, _ := s.GetE(r)
+
+	return ts
+}
+
+// GetE is like Get, but also reports why an existing session couldn't be
+// used, as Store.GetE does. A session whose State can't be decoded as a T
+// gives a *StatePayloadError, along with a fresh session and a zero Data.
+func (s *TypedStore[T]) GetE(r *http.Request) (TypedSession[T], error) {
+	ss, err := s.Store.GetE(r)
+	if err != nil {
+		return TypedSession[T]{Session: ss}, err
+	}
+
+	var ts TypedSession[T]
+	if len(ss.State) > 0 {
+		if err := s.codec().Unmarshal(ss.State, &ts.Data); err != nil {
+			n := len(ss.State)
+			wipe(ss.State)
+			return TypedSession[T]{Session: s.created(r)}, &StatePayloadError{Len: n, Err: err}
+		}
+	}
+	ts.Session = ss
+
+	return ts, nil
+}
+
+// Save encodes Data into the session's State and saves it like Store.Save.
+func (s *TypedStore[T]) Save(rw http.ResponseWriter, ts *TypedSession[T]) error {
+	if ts.readOnly {
+		return ErrReadOnly
+	}
+
+	state, err := s.codec().Marshal(ts.Data)
+	if err != nil {
+		return errors.New("couldn't encode state: " + err.Error())
+	}
+
+	ts.State = state
+	ts.dirty = true
+
+	return s.Store.Save(rw, &ts.Session)
+}
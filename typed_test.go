@@ -0,0 +1,112 @@
+package cookiesession_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+type cart struct {
+	Items []string `json:"items"`
+}
+
+func TestTypedStateGarbage(t *testing.T) {
+	s, _ := newStore(t)
+	ts := &cookiesession.TypedStore[cart]{Store: s}
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("definitely not json"))
+
+	got, err := ts.GetE(save(t, s, ss))
+
+	var perr *cookiesession.StatePayloadError
+	if !errors.Is(err, cookiesession.ErrStatePayload) || !errors.As(err, &perr) {
+		t.Fatalf("expected %v, got %v", cookiesession.ErrStatePayload, err)
+	} else if perr.Len != len("definitely not json") {
+		t.Errorf("expected the error to carry the state length, got %d", perr.Len)
+	}
+
+	if got.Valid || got.SID == ss.SID || got.Data.Items != nil {
+		t.Errorf("expected a fresh session with zero data, got %+v", got)
+	}
+}
+
+func TestTypedState(t *testing.T) {
+	s, _ := newStore(t)
+	ts := &cookiesession.TypedStore[cart]{Store: s}
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte(`{"items":["apple"]}`))
+
+	got, err := ts.GetE(save(t, s, ss))
+	if err != nil {
+		t.Fatal(err)
+	} else if !got.Valid || len(got.Data.Items) != 1 || got.Data.Items[0] != "apple" {
+		t.Fatalf("expected the decoded cart, got %+v", got)
+	}
+}
+
+func TestNewTyped(t *testing.T) {
+	ts := cookiesession.NewTyped[cart]("session", "secret", time.Hour, cookiesession.WithPath("/shop"))
+	if ts.Name != "session" || ts.Path != "/shop" || ts.TTL != time.Hour {
+		t.Fatalf("expected NewTyped to configure the store like New, got %+v", ts.Store)
+	}
+
+	got := ts.Get(httptest.NewRequest(http.MethodGet, "/", nil))
+	if got.Valid || got.Data.Items != nil {
+		t.Fatalf("expected a fresh session without a cookie, got %+v", got)
+	}
+
+	got.Data.Items = []string{"apple", "pear"}
+
+	rec := httptest.NewRecorder()
+	if err := ts.Save(rec, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Valid || string(got.State) != `{"items":["apple","pear"]}` {
+		t.Fatalf("expected Save to encode Data into State, got %q", got.State)
+	}
+
+	again := ts.Get(request(rec))
+	if !again.Valid || again.SID != got.SID || len(again.Data.Items) != 2 || again.Data.Items[1] != "pear" {
+		t.Fatalf("expected the saved cart back, got %+v", again)
+	}
+}
+
+func TestTypedCodec(t *testing.T) {
+	s, _ := newStore(t)
+	s.Codec = cookiesession.GobCodec{}
+	ts := &cookiesession.TypedStore[cart]{Store: s}
+
+	got := ts.Get(httptest.NewRequest(http.MethodGet, "/", nil))
+	got.Data.Items = []string{"apple"}
+
+	rec := httptest.NewRecorder()
+	if err := ts.Save(rec, &got); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.HasPrefix(got.State, []byte("{")) {
+		t.Fatalf("expected State encoded with the store's Codec, got %q", got.State)
+	}
+
+	if again := ts.Get(request(rec)); len(again.Data.Items) != 1 || again.Data.Items[0] != "apple" {
+		t.Fatalf("expected the saved cart back, got %+v", again)
+	}
+}
+
+func TestTypedSaveFrozen(t *testing.T) {
+	s, _ := newStore(t)
+	ts := &cookiesession.TypedStore[cart]{Store: s}
+
+	got := ts.Get(httptest.NewRequest(http.MethodGet, "/", nil))
+	got.Freeze()
+
+	if err := ts.Save(httptest.NewRecorder(), &got); err != cookiesession.ErrReadOnly {
+		t.Fatalf("expected %v, got %v", cookiesession.ErrReadOnly, err)
+	}
+}
@@ -0,0 +1,63 @@
+package cookiesession
+
+import (
+	"errors"
+)
+
+var (
+	ErrDisallowedKey = errors.New("value key isn't in the store's allowed keys")
+)
+
+// Values decodes State as a JSON object of strings, as written by SetValues.
+// Empty State gives an empty map.
+func (s *Session) Values() (map[string]string, error) {
+	values := make(map[string]string)
+	if err := s.DecodeState(&values); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// SetValues replaces the session's State with values, encoded as JSON. If
+// AllowedValueKeys is set, any other key is rejected with ErrDisallowedKey
+// and the session is left untouched.
+func (s *Store) SetValues(ss *Session, values map[string]string) error {
+	for k := range values {
+		if !s.allowedValueKey(k) {
+			return ErrDisallowedKey
+		}
+	}
+
+	return ss.EncodeState(values)
+}
+
+// SetValue sets a single key in the session's values, keeping the rest.
+func (s *Store) SetValue(ss *Session, key, value string) error {
+	if !s.allowedValueKey(key) {
+		return ErrDisallowedKey
+	}
+
+	values, err := ss.Values()
+	if err != nil {
+		return err
+	}
+
+	values[key] = value
+
+	return ss.EncodeState(values)
+}
+
+func (s *Store) allowedValueKey(key string) bool {
+	if s.AllowedValueKeys == nil {
+		return true
+	}
+
+	for _, k := range s.AllowedValueKeys {
+		if k == key {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,49 @@
+package cookiesession_test
+
+import (
+	"testing"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+func TestAllowedValueKeys(t *testing.T) {
+	s, _ := newStore(t)
+	s.AllowedValueKeys = []string{"theme", "lang"}
+
+	ss := cookiesession.NewSession()
+
+	if err := s.SetValues(ss, map[string]string{"theme": "dark", "lang": "en"}); err != nil {
+		t.Fatalf("expected allowed keys to be set, got %v", err)
+	}
+	if err := s.SetValue(ss, "lang", "fr"); err != nil {
+		t.Fatalf("expected an allowed key to be set, got %v", err)
+	}
+
+	if err := s.SetValue(ss, "password", "hunter2"); err != cookiesession.ErrDisallowedKey {
+		t.Errorf("expected %v from SetValue, got %v", cookiesession.ErrDisallowedKey, err)
+	}
+	if err := s.SetValues(ss, map[string]string{"theme": "light", "password": "hunter2"}); err != cookiesession.ErrDisallowedKey {
+		t.Errorf("expected %v from SetValues, got %v", cookiesession.ErrDisallowedKey, err)
+	}
+
+	values, err := ss.Values()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(values) != 2 || values["theme"] != "dark" || values["lang"] != "fr" {
+		t.Errorf("expected rejected writes to leave the values alone, got %v", values)
+	}
+}
+
+func TestAllowedValueKeysUnset(t *testing.T) {
+	s, _ := newStore(t)
+
+	ss := cookiesession.NewSession()
+
+	if err := s.SetValue(ss, "anything", "goes"); err != nil {
+		t.Fatalf("expected any key without AllowedValueKeys, got %v", err)
+	}
+
+	if values, err := ss.Values(); err != nil || values["anything"] != "goes" {
+		t.Errorf("expected the value to be set, got %v, %v", values, err)
+	}
+}
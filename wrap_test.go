@@ -0,0 +1,119 @@
+package cookiesession_test
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+func TestWrap(t *testing.T) {
+	for name, send := range map[string]func(rw http.ResponseWriter){
+		"Write":       func(rw http.ResponseWriter) { rw.Write([]byte("body")) },
+		"WriteHeader": func(rw http.ResponseWriter) { rw.WriteHeader(http.StatusNoContent) },
+		"Flush":       func(rw http.ResponseWriter) { rw.(http.Flusher).Flush() },
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, _ := newStore(t)
+
+			ss := cookiesession.NewSession().WithState([]byte("state"))
+
+			rec := httptest.NewRecorder()
+			rw := s.Wrap(rec, ss)
+
+			send(rw)
+
+			// Changes after the headers are sent can't reach the cookie.
+			ss.SetBytes([]byte("too late"))
+			rw.Write([]byte("more"))
+
+			if n := len(rec.Result().Header["Set-Cookie"]); n != 1 {
+				t.Fatalf("expected the cookie to be set once, got %d", n)
+			}
+			if got := s.Get(request(rec)); string(got.State) != "state" {
+				t.Fatalf("expected the session as it was when the headers were sent, got %q", got.State)
+			}
+		})
+	}
+}
+
+func TestWrapFlushes(t *testing.T) {
+	s, _ := newStore(t)
+
+	rec := httptest.NewRecorder()
+	s.Wrap(rec, cookiesession.NewSession().WithState([]byte("state"))).(http.Flusher).Flush()
+
+	if !rec.Flushed {
+		t.Fatal("expected Flush to reach the underlying writer")
+	}
+}
+
+func TestWrapUnchanged(t *testing.T) {
+	s, _ := newStore(t)
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("state"))
+	loaded := s.Get(save(t, s, ss))
+
+	rec := httptest.NewRecorder()
+	s.Wrap(rec, &loaded).Write([]byte("body"))
+
+	if n := len(rec.Result().Header["Set-Cookie"]); n != 0 {
+		t.Fatalf("expected no cookie for an unchanged session, got %d", n)
+	}
+}
+
+func TestWrapSavedByHandler(t *testing.T) {
+	s, _ := newStore(t)
+
+	ss := cookiesession.NewSession().WithState([]byte("state"))
+
+	rec := httptest.NewRecorder()
+	rw := s.Wrap(rec, ss)
+
+	if err := s.Save(rw, cookiesession.NewSession().WithState([]byte("handler"))); err != nil {
+		t.Fatal(err)
+	}
+	rw.Write([]byte("body"))
+
+	if n := len(rec.Result().Header["Set-Cookie"]); n != 1 {
+		t.Fatalf("expected only the handler's cookie, got %d", n)
+	}
+	if got := s.Get(request(rec)); string(got.State) != "handler" {
+		t.Fatalf("expected the handler's session, got %q", got.State)
+	}
+}
+
+func TestWrapLogsErrors(t *testing.T) {
+	s, _ := newStore(t)
+
+	var buf bytes.Buffer
+	s.Logger = log.New(&buf, "", 0)
+
+	rec := httptest.NewRecorder()
+	rw := s.Wrap(rec, cookiesession.NewSession().WithState([]byte(strings.Repeat("x", cookiesession.MaxCookieSize))))
+	rw.WriteHeader(http.StatusOK)
+
+	if rec.Code != http.StatusOK || len(rec.Result().Header["Set-Cookie"]) != 0 {
+		t.Fatalf("expected the response to go out without a cookie, got %d", rec.Code)
+	}
+	if !strings.Contains(buf.String(), cookiesession.ErrTooLarge.Error()) {
+		t.Fatalf("expected the save error to be logged, got %q", buf.String())
+	}
+}
+
+func TestWrapUnwrap(t *testing.T) {
+	s, _ := newStore(t)
+
+	rec := httptest.NewRecorder()
+	rw := s.Wrap(rec, cookiesession.NewSession())
+
+	u, ok := rw.(interface{ Unwrap() http.ResponseWriter })
+	if !ok || u.Unwrap() != rec {
+		t.Fatal("expected Unwrap to return the wrapped writer")
+	}
+}
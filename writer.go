@@ -0,0 +1,66 @@
+package cookiesession
+
+import (
+	"errors"
+	"net/http"
+)
+
+var (
+	ErrHeadersSent = errors.New("response headers have already been sent")
+)
+
+// TrackingWriter wraps a ResponseWriter and records whether the response
+// headers have been sent, so that SaveChecked can tell when it's too late to
+// set a cookie.
+type TrackingWriter struct {
+	http.ResponseWriter
+	headersSent bool
+}
+
+// TrackWrites wraps rw in a TrackingWriter. It should be installed before
+// the handler has a chance to write anything.
+func TrackWrites(rw http.ResponseWriter) *TrackingWriter {
+	if tw, ok := rw.(*TrackingWriter); ok {
+		return tw
+	}
+
+	return &TrackingWriter{ResponseWriter: rw}
+}
+
+func (w *TrackingWriter) WriteHeader(code int) {
+	w.headersSent = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *TrackingWriter) Write(b []byte) (int, error) {
+	w.headersSent = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *TrackingWriter) Flush() {
+	w.headersSent = true
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *TrackingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// HeadersSent reports whether WriteHeader, Write or Flush has been called.
+func (w *TrackingWriter) HeadersSent() bool {
+	return w.headersSent
+}
+
+// SaveChecked is like Save, but returns ErrHeadersSent instead of silently
+// losing the cookie when rw is a TrackingWriter that's already sent the
+// response headers. Other writers can't be checked, and are saved to as
+// normal.
+func (s *Store) SaveChecked(rw http.ResponseWriter, ss *Session) error {
+	if tw, ok := rw.(*TrackingWriter); ok && tw.headersSent {
+		return ErrHeadersSent
+	}
+
+	return s.Save(rw, ss)
+}
@@ -0,0 +1,62 @@
+package cookiesession_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+func TestSaveChecked(t *testing.T) {
+	s, _ := newStore(t)
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("state"))
+
+	rec := httptest.NewRecorder()
+	tw := cookiesession.TrackWrites(rec)
+
+	if err := s.SaveChecked(tw, ss); err != nil {
+		t.Fatalf("expected saving before the body to work, got %v", err)
+	}
+
+	tw.Write([]byte("hello"))
+
+	if !tw.HeadersSent() {
+		t.Fatal("expected the headers to be sent after writing the body")
+	}
+	if err := s.SaveChecked(tw, ss); err != cookiesession.ErrHeadersSent {
+		t.Fatalf("expected %v saving after the body, got %v", cookiesession.ErrHeadersSent, err)
+	}
+}
+
+func TestSaveCheckedMiddleware(t *testing.T) {
+	s, _ := newStore(t)
+
+	var err error
+	h := s.Middleware(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("hello"))
+
+		ss := cookiesession.NewSession()
+		ss.SetBytes([]byte("state"))
+		err = s.SaveChecked(rw, ss)
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if err != cookiesession.ErrHeadersSent {
+		t.Fatalf("expected %v from a handler that wrote first, got %v", cookiesession.ErrHeadersSent, err)
+	}
+}
+
+func TestSaveCheckedUntracked(t *testing.T) {
+	s, _ := newStore(t)
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes([]byte("state"))
+
+	if err := s.SaveChecked(httptest.NewRecorder(), ss); err != nil {
+		t.Fatalf("expected an untracked writer to be saved to, got %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+// Package zstdcompress compresses cookiesession sessions with zstd, which
+// does better than gzip on sessions carrying a few kilobytes of JSON. It's a
+// separate package so that stores which don't use it don't depend on zstd.
+package zstdcompress
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+
+	"fknsrs.biz/p/cookiesession"
+)
+
+var (
+	ErrTooLarge = errors.New("zstd frame is too large")
+)
+
+// ID is the compressor ID that marks values compressed with zstd.
+const ID = 2
+
+// maxValueSize caps how much compressed input NewReader reads, and
+// maxDecodedSize how far it decompresses, so that a small value can't be
+// made to decompress into something enormous. cookiesession caps the output
+// at the same size.
+const (
+	maxValueSize   = 1 << 20
+	maxDecodedSize = 1 << 20
+)
+
+// Compression compresses sessions with zstd. Set Store.Compression to it;
+// values compressed with gzip can still be read.
+var Compression cookiesession.Compressor = compressor{}
+
+type compressor struct{}
+
+var (
+	once    sync.Once
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+	initErr error
+)
+
+// codecs returns the encoder and decoder shared by every store. Both are
+// safe for concurrent use through EncodeAll and DecodeAll.
+func codecs() (*zstd.Encoder, *zstd.Decoder, error) {
+	once.Do(func() {
+		encoder, initErr = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		if initErr != nil {
+			initErr = errors.New("couldn't create zstd encoder: " + initErr.Error())
+			return
+		}
+
+		decoder, initErr = zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(maxDecodedSize))
+		if initErr != nil {
+			initErr = errors.New("couldn't create zstd decoder: " + initErr.Error())
+		}
+	})
+
+	return encoder, decoder, initErr
+}
+
+func (compressor) ID() byte { return ID }
+
+func (compressor) Compress(b []byte) ([]byte, error) {
+	enc, _, err := codecs()
+	if err != nil {
+		return nil, err
+	}
+
+	return enc.EncodeAll(b, nil), nil
+}
+
+func (compressor) NewReader(r io.Reader) (io.Reader, error) {
+	_, dec, err := codecs()
+	if err != nil {
+		return nil, err
+	}
+
+	in, err := io.ReadAll(io.LimitReader(r, maxValueSize+1))
+	if err != nil {
+		return nil, err
+	} else if len(in) > maxValueSize {
+		return nil, ErrTooLarge
+	}
+
+	b, err := dec.DecodeAll(in, nil)
+	if err != nil {
+		return nil, errors.New("couldn't decompress zstd frame: " + err.Error())
+	}
+
+	return bytes.NewReader(b), nil
+}
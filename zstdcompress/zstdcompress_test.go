@@ -0,0 +1,94 @@
+package zstdcompress_test
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"fknsrs.biz/p/cookiesession"
+	"fknsrs.biz/p/cookiesession/cookiesessiontest"
+	"fknsrs.biz/p/cookiesession/zstdcompress"
+)
+
+// state is a few kilobytes of repetitive JSON, the kind of State that's worth
+// compressing.
+var state = []byte("[" + strings.Repeat(`{"item":"widget","qty":1,"note":"some text"},`, 60) + "{}]")
+
+func TestRoundTrip(t *testing.T) {
+	b, err := zstdcompress.Compression.Compress(state)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(b) >= len(state) {
+		t.Fatalf("expected compression to help, got %d bytes from %d", len(b), len(state))
+	}
+
+	r, err := zstdcompress.Compression.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if _, err := out.ReadFrom(r); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(out.Bytes(), state) {
+		t.Fatal("expected the original bytes back")
+	}
+}
+
+func TestRejectsGarbage(t *testing.T) {
+	if _, err := zstdcompress.Compression.NewReader(strings.NewReader("not zstd")); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+// save saves ss with s and returns the cookie's value.
+func save(t *testing.T, s *cookiesession.Store, ss *cookiesession.Session) string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	if err := s.Save(rec, ss); err != nil {
+		t.Fatal(err)
+	}
+
+	ss2 := cookiesessiontest.ExtractSession(t, s, rec)
+	if !bytes.Equal(ss2.State, state) {
+		t.Fatal("expected the session to round-trip")
+	}
+
+	return rec.Result().Cookies()[0].Value
+}
+
+func TestStore(t *testing.T) {
+	gz := cookiesessiontest.NewStore("sess", "zstd")
+	gz.Compression = cookiesession.GzipCompression
+
+	zs := cookiesessiontest.NewStore("sess", "zstd")
+	zs.Compression = zstdcompress.Compression
+
+	plain := cookiesessiontest.NewStore("sess", "zstd")
+
+	ss := cookiesession.NewSession()
+	ss.SetBytes(state)
+
+	gzValue := save(t, gz, ss)
+	zsValue := save(t, zs, ss)
+	plainValue := save(t, plain, ss)
+
+	if len(zsValue) >= len(plainValue) {
+		t.Errorf("expected zstd to shrink the cookie, got %d bytes against %d", len(zsValue), len(plainValue))
+	}
+
+	for _, value := range []string{gzValue, zsValue, plainValue} {
+		got, err := zs.Decode(value)
+		if err != nil {
+			t.Fatalf("expected a zstd store to read every value, got %s", err)
+		} else if !bytes.Equal(got.State, state) {
+			t.Fatal("expected the original state")
+		}
+	}
+
+	if _, err := gz.Decode(zsValue); err != cookiesession.ErrUnknownCompression {
+		t.Fatalf("expected %v from a gzip store, got %v", cookiesession.ErrUnknownCompression, err)
+	}
+}